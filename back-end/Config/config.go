@@ -2,6 +2,7 @@ package config
 
 import (
 	"errors"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -18,10 +19,51 @@ type Config struct {
 	DBName     string
 
 	// Authentication and security
-	JWTSecret      string
-	JWTExpiryHours int
-	CookieDomain   string
-	CookieSecure   bool
+	JWTSecret               string
+	JWTSigningAlg           string   // "HS256", "RS256" or "EdDSA"
+	JWTSigningKeyFile       string   // PEM private key for RS256 or EdDSA
+	JWTVerificationKeyFiles []string // PEM keys still accepted for verification, e.g. after a rotation
+	JWTIssuer               string
+	JWTAudience             string
+	JWTLeeway               time.Duration // Allowed clock skew when validating token times
+	AccessTokenTTL          time.Duration
+	RefreshTokenTTL         time.Duration
+	SessionSecret           string // Signs the session cookie; kept apart from the JWT secret
+	CookieDomain            string
+	CookieSecure            bool
+	PasswordResetTTL        time.Duration
+	EmailVerificationTTL    time.Duration
+	RequireVerifiedEmail    []string      // Features blocked until the email is verified
+	TwoFactorRequiredRoles  []string      // Roles that must sign in with two-factor authentication
+	TwoFactorEnforceAfter   time.Time     // Until then required roles are only asked to enroll; zero enforces at once
+	TOTPIssuer              string        // App name shown in authenticator apps
+	LoginBackoffAfter       int           // Failed logins before each attempt must wait longer
+	LoginLockoutAfter       int           // Failed logins before the account is locked
+	LoginLockoutDuration    time.Duration // How long a locked account stays locked
+	LoginNotifyAfter        int           // Failed logins before the user is emailed
+	PasswordMinLength       int
+	PasswordBannedFile      string        // Extra banned passwords, one per line
+	PasswordBreachedFile    string        // SHA-1 hashes of breached passwords, one per line
+	AccountDeletionGrace    time.Duration // How long a deletion request can be cancelled before the data is purged
+	CSRFExemptPaths         []string      // Request paths not checked for a CSRF token; a trailing * matches a prefix
+	CSRFDisabled            bool          // Skips CSRF checks; only allowed when APP_ENV=development is set
+	RolePermissionsFile     string        // JSON mapping of roles to permissions; built-in defaults when empty
+
+	// Email
+	MailDriver   string // "smtp", "file" or "memory"
+	MailFrom     string
+	MailFileDir  string // Where the file driver writes messages
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+
+	// AppBaseURL is the front-end URL used in links sent by email
+	AppBaseURL string
+
+	// OpenID Connect sign-in
+	OIDCProviders       []OIDCProvider
+	OIDCRedirectBaseURL string // Public API URL the providers redirect back to
 
 	// Server
 	ServerPort         string
@@ -31,6 +73,16 @@ type Config struct {
 	Environment string // "development", "testing", or "production"
 }
 
+// OIDCProvider configures one OpenID Connect identity provider
+type OIDCProvider struct {
+	Name         string // Used in URLs, e.g. /api/auth/oidc/google/login
+	DisplayName  string
+	Issuer       string
+	ClientID     string
+	ClientSecret string // Empty for public clients, which rely on PKCE alone
+	Scopes       []string
+}
+
 // LoadConfig loads configuration from environment variables
 func LoadConfig() (*Config, error) {
 	// Default configuration for local development
@@ -43,10 +95,35 @@ func LoadConfig() (*Config, error) {
 		DBName:     "habitbite",
 
 		// Authentication and security
-		JWTSecret:      "your_development_secret_key", // Change this in production
-		JWTExpiryHours: 24,
-		CookieDomain:   "localhost",
-		CookieSecure:   false, // Set to false for development, true for production
+		JWTSecret:            "your_development_secret_key", // Change this in production
+		JWTSigningAlg:        "HS256",
+		JWTIssuer:            "habitbite",
+		JWTAudience:          "habitbite-api",
+		JWTLeeway:            30 * time.Second,
+		AccessTokenTTL:       24 * time.Hour,
+		RefreshTokenTTL:      7 * 24 * time.Hour,
+		SessionSecret:        "your_development_session_key", // Change this in production
+		CookieDomain:         "localhost",
+		CookieSecure:         false, // Set to false for development, true for production
+		PasswordResetTTL:     30 * time.Minute,
+		EmailVerificationTTL: 48 * time.Hour,
+		TOTPIssuer:           "HabitBite",
+		LoginBackoffAfter:    3,
+		LoginLockoutAfter:    10,
+		LoginLockoutDuration: 15 * time.Minute,
+		LoginNotifyAfter:     5,
+		PasswordMinLength:    8,
+		AccountDeletionGrace: 14 * 24 * time.Hour,
+		CSRFExemptPaths:      []string{"/api/auth/login", "/api/auth/register"},
+
+		// Email (written to files during development)
+		MailDriver:  "file",
+		MailFrom:    "HabitBite <no-reply@habitbite.local>",
+		MailFileDir: "mail",
+		SMTPPort:    587,
+
+		AppBaseURL:          "http://localhost:5173",
+		OIDCRedirectBaseURL: "http://localhost:8080",
 
 		// Server
 		ServerPort:         "8080",
@@ -77,12 +154,177 @@ func LoadConfig() (*Config, error) {
 	if secret := os.Getenv("JWT_SECRET"); secret != "" {
 		config.JWTSecret = secret
 	}
+	if alg := os.Getenv("JWT_SIGNING_ALG"); alg != "" {
+		config.JWTSigningAlg = alg
+	}
+	if keyFile := os.Getenv("JWT_SIGNING_KEY_FILE"); keyFile != "" {
+		config.JWTSigningKeyFile = keyFile
+	}
+	if keyFiles := os.Getenv("JWT_VERIFICATION_KEY_FILES"); keyFiles != "" {
+		for _, path := range strings.Split(keyFiles, ",") {
+			if path = strings.TrimSpace(path); path != "" {
+				config.JWTVerificationKeyFiles = append(config.JWTVerificationKeyFiles, path)
+			}
+		}
+	}
+	if issuer := os.Getenv("JWT_ISSUER"); issuer != "" {
+		config.JWTIssuer = issuer
+	}
+	if audience := os.Getenv("JWT_AUDIENCE"); audience != "" {
+		config.JWTAudience = audience
+	}
+	if leeway := os.Getenv("JWT_LEEWAY"); leeway != "" {
+		if d, err := time.ParseDuration(leeway); err == nil {
+			config.JWTLeeway = d
+		}
+	}
+	if ttl := os.Getenv("ACCESS_TOKEN_TTL"); ttl != "" {
+		if d, err := time.ParseDuration(ttl); err == nil {
+			config.AccessTokenTTL = d
+		}
+	}
+	if ttl := os.Getenv("REFRESH_TOKEN_TTL"); ttl != "" {
+		if d, err := time.ParseDuration(ttl); err == nil {
+			config.RefreshTokenTTL = d
+		}
+	}
+	if secret := os.Getenv("SESSION_SECRET"); secret != "" {
+		config.SessionSecret = secret
+	}
+	if ttl := os.Getenv("PASSWORD_RESET_TTL"); ttl != "" {
+		if d, err := time.ParseDuration(ttl); err == nil {
+			config.PasswordResetTTL = d
+		}
+	}
+	if ttl := os.Getenv("EMAIL_VERIFICATION_TTL"); ttl != "" {
+		if d, err := time.ParseDuration(ttl); err == nil {
+			config.EmailVerificationTTL = d
+		}
+	}
+	if features := os.Getenv("REQUIRE_VERIFIED_EMAIL"); features != "" {
+		for _, feature := range strings.Split(features, ",") {
+			if feature = strings.TrimSpace(feature); feature != "" {
+				config.RequireVerifiedEmail = append(config.RequireVerifiedEmail, feature)
+			}
+		}
+	}
+	if roles := os.Getenv("TWO_FACTOR_REQUIRED_ROLES"); roles != "" {
+		for _, role := range strings.Split(roles, ",") {
+			if role = strings.TrimSpace(role); role != "" {
+				config.TwoFactorRequiredRoles = append(config.TwoFactorRequiredRoles, role)
+			}
+		}
+	}
+	// Requiring 2FA for a role locks out its members until they enroll, so
+	// a deployment turning it on should set TWO_FACTOR_ENFORCE_AFTER to give
+	// them time: until then they can still sign in and are prompted to enroll.
+	if deadline := os.Getenv("TWO_FACTOR_ENFORCE_AFTER"); deadline != "" {
+		t, err := time.Parse(time.RFC3339, deadline)
+		if err != nil {
+			return nil, errors.New("TWO_FACTOR_ENFORCE_AFTER must be an RFC 3339 time, e.g. 2026-12-01T00:00:00Z")
+		}
+		config.TwoFactorEnforceAfter = t
+	}
+	if issuer := os.Getenv("TOTP_ISSUER"); issuer != "" {
+		config.TOTPIssuer = issuer
+	}
+	if n := os.Getenv("LOGIN_BACKOFF_AFTER"); n != "" {
+		if v, err := strconv.Atoi(n); err == nil {
+			config.LoginBackoffAfter = v
+		}
+	}
+	if n := os.Getenv("LOGIN_LOCKOUT_AFTER"); n != "" {
+		if v, err := strconv.Atoi(n); err == nil {
+			config.LoginLockoutAfter = v
+		}
+	}
+	if d := os.Getenv("LOGIN_LOCKOUT_DURATION"); d != "" {
+		if v, err := time.ParseDuration(d); err == nil {
+			config.LoginLockoutDuration = v
+		}
+	}
+	if n := os.Getenv("LOGIN_NOTIFY_AFTER"); n != "" {
+		if v, err := strconv.Atoi(n); err == nil {
+			config.LoginNotifyAfter = v
+		}
+	}
+	if n := os.Getenv("PASSWORD_MIN_LENGTH"); n != "" {
+		if v, err := strconv.Atoi(n); err == nil {
+			config.PasswordMinLength = v
+		}
+	}
+	if path := os.Getenv("PASSWORD_BANNED_FILE"); path != "" {
+		config.PasswordBannedFile = path
+	}
+	if path := os.Getenv("PASSWORD_BREACHED_FILE"); path != "" {
+		config.PasswordBreachedFile = path
+	}
+	if d := os.Getenv("ACCOUNT_DELETION_GRACE"); d != "" {
+		if v, err := time.ParseDuration(d); err == nil {
+			config.AccountDeletionGrace = v
+		}
+	}
+	if paths, ok := os.LookupEnv("CSRF_EXEMPT_PATHS"); ok {
+		config.CSRFExemptPaths = nil
+		for _, path := range strings.Split(paths, ",") {
+			if path = strings.TrimSpace(path); path != "" {
+				config.CSRFExemptPaths = append(config.CSRFExemptPaths, path)
+			}
+		}
+	}
+	if disabled := os.Getenv("CSRF_DISABLED"); disabled != "" {
+		config.CSRFDisabled = disabled == "true"
+	}
+	if path := os.Getenv("ROLE_PERMISSIONS_FILE"); path != "" {
+		config.RolePermissionsFile = path
+	}
+	if driver := os.Getenv("MAIL_DRIVER"); driver != "" {
+		config.MailDriver = driver
+	}
+	if from := os.Getenv("MAIL_FROM"); from != "" {
+		config.MailFrom = from
+	}
+	if dir := os.Getenv("MAIL_FILE_DIR"); dir != "" {
+		config.MailFileDir = dir
+	}
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		config.SMTPHost = host
+	}
+	if port := os.Getenv("SMTP_PORT"); port != "" {
+		if p, err := strconv.Atoi(port); err == nil {
+			config.SMTPPort = p
+		}
+	}
+	if user := os.Getenv("SMTP_USERNAME"); user != "" {
+		config.SMTPUsername = user
+	}
+	if pass := os.Getenv("SMTP_PASSWORD"); pass != "" {
+		config.SMTPPassword = pass
+	}
+	if baseURL := os.Getenv("APP_BASE_URL"); baseURL != "" {
+		config.AppBaseURL = strings.TrimRight(baseURL, "/")
+	}
+	if providers := os.Getenv("OIDC_PROVIDERS"); providers != "" {
+		for _, name := range strings.Split(providers, ",") {
+			if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+				config.OIDCProviders = append(config.OIDCProviders, loadOIDCProvider(name))
+			}
+		}
+	}
+	if baseURL := os.Getenv("OIDC_REDIRECT_BASE_URL"); baseURL != "" {
+		config.OIDCRedirectBaseURL = strings.TrimRight(baseURL, "/")
+	}
 	if port := os.Getenv("APP_PORT"); port != "" {
 		config.ServerPort = port
 	}
 	if env := os.Getenv("APP_ENV"); env != "" {
 		config.Environment = env
 	}
+	// Environment falls back to development, so a missing APP_ENV must not
+	// be enough to switch CSRF checks off
+	if config.CSRFDisabled && os.Getenv("APP_ENV") != "development" {
+		return nil, errors.New("CSRF_DISABLED requires APP_ENV=development to be set explicitly")
+	}
 	if secure := os.Getenv("COOKIE_SECURE"); secure != "" {
 		config.CookieSecure = secure == "true"
 	}
@@ -96,9 +338,37 @@ func LoadConfig() (*Config, error) {
 	return config, nil
 }
 
-// JWTExpiryDuration returns the JWT expiry duration
-func (c *Config) JWTExpiryDuration() time.Duration {
-	return time.Duration(c.JWTExpiryHours) * time.Hour
+// loadOIDCProvider reads the OIDC_<NAME>_* variables for a provider
+func loadOIDCProvider(name string) OIDCProvider {
+	prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+
+	provider := OIDCProvider{
+		Name:         name,
+		DisplayName:  os.Getenv(prefix + "DISPLAY_NAME"),
+		Issuer:       strings.TrimRight(os.Getenv(prefix+"ISSUER"), "/"),
+		ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+		ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+	}
+	if scopes := os.Getenv(prefix + "SCOPES"); scopes != "" {
+		provider.Scopes = strings.Fields(strings.ReplaceAll(scopes, ",", " "))
+	}
+	return provider
+}
+
+// Features that can require a verified email (REQUIRE_VERIFIED_EMAIL)
+const (
+	FeatureFoodLogging      = "food_logging"
+	FeatureDietitianLinking = "dietitian_linking"
+)
+
+// RequiresVerifiedEmail reports whether a feature is blocked until the user's email is verified
+func (c *Config) RequiresVerifiedEmail(feature string) bool {
+	for _, f := range c.RequireVerifiedEmail {
+		if f == feature {
+			return true
+		}
+	}
+	return false
 }
 
 // IsDevelopment returns true if the application is running in development mode
@@ -113,12 +383,130 @@ func (c *Config) IsProduction() bool {
 
 // Validate checks if the configuration is valid
 func (c *Config) Validate() error {
-	if c.JWTSecret == "" {
-		return errors.New("JWT_SECRET is required")
+	// The shared secret only signs tokens under HS256
+	switch c.JWTSigningAlg {
+	case "HS256":
+		if c.JWTSecret == "" {
+			return errors.New("JWT_SECRET is required for HS256")
+		}
+	case "RS256", "EdDSA":
+		if c.JWTSigningKeyFile == "" && !c.IsDevelopment() {
+			return errors.New("JWT_SIGNING_KEY_FILE is required for " + c.JWTSigningAlg)
+		}
+	default:
+		return errors.New("JWT_SIGNING_ALG must be HS256, RS256 or EdDSA")
+	}
+
+	if c.SessionSecret == "" {
+		return errors.New("SESSION_SECRET is required")
 	}
 
-	if c.JWTExpiryHours <= 0 {
-		return errors.New("JWT_EXPIRY_HOURS must be positive")
+	if c.JWTSecret != "" && c.SessionSecret == c.JWTSecret {
+		return errors.New("SESSION_SECRET must differ from JWT_SECRET")
+	}
+
+	if c.AccessTokenTTL <= 0 {
+		return errors.New("ACCESS_TOKEN_TTL must be positive")
+	}
+
+	if c.RefreshTokenTTL <= c.AccessTokenTTL {
+		return errors.New("REFRESH_TOKEN_TTL must be longer than ACCESS_TOKEN_TTL")
+	}
+
+	if c.JWTLeeway < 0 {
+		return errors.New("JWT_LEEWAY must not be negative")
+	}
+
+	if c.PasswordResetTTL <= 0 || c.PasswordResetTTL > 24*time.Hour {
+		return errors.New("PASSWORD_RESET_TTL must be between 0 and 24h")
+	}
+
+	if c.EmailVerificationTTL <= 0 {
+		return errors.New("EMAIL_VERIFICATION_TTL must be positive")
+	}
+
+	for _, feature := range c.RequireVerifiedEmail {
+		if feature != FeatureFoodLogging && feature != FeatureDietitianLinking {
+			return errors.New("REQUIRE_VERIFIED_EMAIL accepts food_logging and dietitian_linking")
+		}
+	}
+
+	for _, role := range c.TwoFactorRequiredRoles {
+		if role != "user" && role != "dietitian" && role != "admin" {
+			return errors.New("TWO_FACTOR_REQUIRED_ROLES accepts user, dietitian and admin")
+		}
+	}
+
+	if c.LoginBackoffAfter <= 0 || c.LoginLockoutAfter < c.LoginBackoffAfter {
+		return errors.New("LOGIN_BACKOFF_AFTER must be positive and no greater than LOGIN_LOCKOUT_AFTER")
+	}
+
+	if c.LoginLockoutDuration <= 0 {
+		return errors.New("LOGIN_LOCKOUT_DURATION must be positive")
+	}
+
+	if c.LoginNotifyAfter <= 0 {
+		return errors.New("LOGIN_NOTIFY_AFTER must be positive")
+	}
+
+	if c.PasswordMinLength < 8 || c.PasswordMinLength > 64 {
+		return errors.New("PASSWORD_MIN_LENGTH must be between 8 and 64")
+	}
+
+	if c.AccountDeletionGrace < 0 {
+		return errors.New("ACCOUNT_DELETION_GRACE must not be negative")
+	}
+
+	if c.CSRFDisabled && !c.IsDevelopment() {
+		return errors.New("CSRF_DISABLED is only allowed in development")
+	}
+
+	for _, path := range c.CSRFExemptPaths {
+		if !strings.HasPrefix(path, "/") {
+			return errors.New("CSRF_EXEMPT_PATHS entries must start with /")
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, p := range c.OIDCProviders {
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(p.Name, "-", "_")) + "_"
+		if seen[p.Name] {
+			return errors.New("OIDC_PROVIDERS lists " + p.Name + " twice")
+		}
+		seen[p.Name] = true
+
+		if strings.Trim(p.Name, "abcdefghijklmnopqrstuvwxyz0123456789-") != "" {
+			return errors.New("OIDC provider names may only contain letters, digits and dashes")
+		}
+		if p.ClientID == "" {
+			return errors.New(prefix + "CLIENT_ID is required")
+		}
+		issuer, err := url.Parse(p.Issuer)
+		if err != nil || issuer.Host == "" || (issuer.Scheme != "https" && issuer.Scheme != "http") {
+			return errors.New(prefix + "ISSUER must be an absolute URL")
+		}
+		if issuer.Scheme != "https" && c.IsProduction() {
+			return errors.New(prefix + "ISSUER must use https in production")
+		}
+	}
+
+	if len(c.OIDCProviders) > 0 {
+		if redirect, err := url.Parse(c.OIDCRedirectBaseURL); err != nil || redirect.Host == "" {
+			return errors.New("OIDC_REDIRECT_BASE_URL must be an absolute URL")
+		}
+	}
+
+	switch c.MailDriver {
+	case "smtp":
+		if c.SMTPHost == "" {
+			return errors.New("SMTP_HOST is required for the smtp mail driver")
+		}
+	case "file", "memory":
+		if c.IsProduction() {
+			return errors.New("MAIL_DRIVER must be smtp in production")
+		}
+	default:
+		return errors.New("MAIL_DRIVER must be smtp, file or memory")
 	}
 
 	return nil
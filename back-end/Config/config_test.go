@@ -0,0 +1,79 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoadConfigCSRFDisabled(t *testing.T) {
+	tests := []struct {
+		name         string
+		env          map[string]string
+		wantErr      bool
+		wantDisabled bool
+	}{
+		{"enabled by default", map[string]string{}, false, false},
+		{"disabled without APP_ENV", map[string]string{"CSRF_DISABLED": "true"}, true, false},
+		{"disabled in production", map[string]string{"CSRF_DISABLED": "true", "APP_ENV": "production"}, true, false},
+		{"disabled in testing", map[string]string{"CSRF_DISABLED": "true", "APP_ENV": "testing"}, true, false},
+		{"disabled in development", map[string]string{"CSRF_DISABLED": "true", "APP_ENV": "development"}, false, true},
+		{"explicitly enabled", map[string]string{"CSRF_DISABLED": "false"}, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CSRF_DISABLED", "")
+			t.Setenv("APP_ENV", "")
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			cfg, err := LoadConfig()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg.CSRFDisabled != tt.wantDisabled {
+				t.Errorf("CSRFDisabled = %v, want %v", cfg.CSRFDisabled, tt.wantDisabled)
+			}
+		})
+	}
+}
+
+func TestLoadConfigTwoFactorEnforceAfter(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{"", time.Time{}, false},
+		{"2026-12-01T00:00:00Z", time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC), false},
+		{"2026-12-01", time.Time{}, true},
+		{"next week", time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("TWO_FACTOR_ENFORCE_AFTER", tt.value)
+
+			cfg, err := LoadConfig()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !cfg.TwoFactorEnforceAfter.Equal(tt.want) {
+				t.Errorf("TwoFactorEnforceAfter = %v, want %v", cfg.TwoFactorEnforceAfter, tt.want)
+			}
+		})
+	}
+}
@@ -60,11 +60,388 @@ func CreateSchema(db *sqlx.DB) error {
 		return fmt.Errorf("error creating users table: %v", err)
 	}
 
-	// Add more tables here as needed
+	// Create the remaining base tables from habitbite.sql; the migrations
+	// below alter them, so a fresh database needs them first
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS user_goals (
+		user_id INT NOT NULL PRIMARY KEY,
+		target_calories INT NOT NULL,
+		target_protein DECIMAL(5,2) DEFAULT NULL,
+		target_carbs DECIMAL(5,2) DEFAULT NULL,
+		target_fats DECIMAL(5,2) DEFAULT NULL,
+		target_weight DECIMAL(5,2) DEFAULT NULL,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+	`)
+
+	if err != nil {
+		return fmt.Errorf("error creating user_goals table: %v", err)
+	}
+
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS consumed_foods (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		user_id INT NOT NULL,
+		food_id VARCHAR(50) NOT NULL,
+		food_name VARCHAR(255) NOT NULL,
+		quantity DECIMAL(10,2) NOT NULL,
+		calories DECIMAL(10,2) NOT NULL,
+		protein DECIMAL(10,2) NOT NULL,
+		carbs DECIMAL(10,2) NOT NULL,
+		fats DECIMAL(10,2) NOT NULL,
+		entry_date DATETIME NOT NULL,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL,
+		INDEX idx_user_date (user_id, entry_date),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+	`)
+
+	if err != nil {
+		return fmt.Errorf("error creating consumed_foods table: %v", err)
+	}
+
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS daily_entries (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		user_id INT NOT NULL,
+		entry_date DATE NOT NULL,
+		total_calories INT NOT NULL,
+		total_protein DECIMAL(5,2) DEFAULT NULL,
+		total_carbs DECIMAL(5,2) DEFAULT NULL,
+		total_fats DECIMAL(5,2) DEFAULT NULL,
+		notes TEXT DEFAULT NULL,
+		UNIQUE KEY user_id (user_id, entry_date),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+	`)
+
+	if err != nil {
+		return fmt.Errorf("error creating daily_entries table: %v", err)
+	}
+
+	// Apply incremental schema changes in order
+	for i, statement := range schemaMigrations {
+		if _, err := db.Exec(statement); err != nil {
+			return fmt.Errorf("error applying schema migration %d: %v", i+1, err)
+		}
+	}
 
 	return nil
 }
 
+// schemaMigrations holds idempotent schema changes applied after the base tables.
+// Append new statements to the end; never edit or reorder existing ones.
+var schemaMigrations = []string{
+	// Per-user macro split preference
+	`ALTER TABLE user_goals
+		ADD COLUMN IF NOT EXISTS macro_preset VARCHAR(20) NOT NULL DEFAULT '',
+		ADD COLUMN IF NOT EXISTS protein_pct DECIMAL(5,2) NOT NULL DEFAULT 0,
+		ADD COLUMN IF NOT EXISTS carbs_pct DECIMAL(5,2) NOT NULL DEFAULT 0,
+		ADD COLUMN IF NOT EXISTS fat_pct DECIMAL(5,2) NOT NULL DEFAULT 0,
+		ADD COLUMN IF NOT EXISTS protein_per_kg DECIMAL(4,2) NOT NULL DEFAULT 0`,
+
+	// Optional body-fat input and choice of energy formula
+	`ALTER TABLE users
+		ADD COLUMN IF NOT EXISTS body_fat_pct DECIMAL(4,1) NULL,
+		ADD COLUMN IF NOT EXISTS energy_formula VARCHAR(30) NOT NULL DEFAULT 'mifflin_st_jeor'`,
+
+	// Weigh-ins and target-weight plans
+	`CREATE TABLE IF NOT EXISTS weight_entries (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		user_id INT NOT NULL,
+		weight DECIMAL(5,2) NOT NULL,
+		entry_date DATE NOT NULL,
+		created_at DATETIME NOT NULL,
+		UNIQUE KEY uq_weight_user_date (user_id, entry_date),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+	`CREATE TABLE IF NOT EXISTS weight_plans (
+		user_id INT PRIMARY KEY,
+		start_weight DECIMAL(5,2) NOT NULL,
+		target_weight DECIMAL(5,2) NOT NULL,
+		start_date DATE NOT NULL,
+		target_date DATE NOT NULL,
+		auto_apply BOOLEAN NOT NULL DEFAULT FALSE,
+		estimated_tdee INT NULL,
+		last_evaluated_at DATETIME NULL,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+	// Weekday and day-tag goal overrides
+	`CREATE TABLE IF NOT EXISTS user_goal_overrides (
+		user_id INT NOT NULL,
+		schedule_type VARCHAR(10) NOT NULL,
+		schedule_key VARCHAR(30) NOT NULL,
+		target_calories INT NOT NULL,
+		target_protein DECIMAL(6,2) NOT NULL DEFAULT 0,
+		target_carbs DECIMAL(6,2) NOT NULL DEFAULT 0,
+		target_fats DECIMAL(6,2) NOT NULL DEFAULT 0,
+		PRIMARY KEY (user_id, schedule_type, schedule_key),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+	`CREATE TABLE IF NOT EXISTS user_day_tags (
+		user_id INT NOT NULL,
+		tag_date DATE NOT NULL,
+		tag VARCHAR(30) NOT NULL,
+		PRIMARY KEY (user_id, tag_date),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+	// Diet profile and the food catalog with diet and allergen flags
+	`ALTER TABLE users
+		ADD COLUMN IF NOT EXISTS diet VARCHAR(20) NOT NULL DEFAULT '',
+		ADD COLUMN IF NOT EXISTS allergens VARCHAR(255) NOT NULL DEFAULT ''`,
+	`CREATE TABLE IF NOT EXISTS foods (
+		food_id VARCHAR(50) PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		calories DECIMAL(6,2) NOT NULL DEFAULT 0,
+		protein DECIMAL(6,2) NOT NULL DEFAULT 0,
+		carbs DECIMAL(6,2) NOT NULL DEFAULT 0,
+		fats DECIMAL(6,2) NOT NULL DEFAULT 0,
+		is_vegetarian BOOLEAN NOT NULL DEFAULT FALSE,
+		is_vegan BOOLEAN NOT NULL DEFAULT FALSE,
+		is_keto BOOLEAN NOT NULL DEFAULT FALSE,
+		allergens VARCHAR(255) NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL,
+		INDEX idx_foods_name (name)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+	// Rotating, single-use refresh tokens grouped into families per login
+	`CREATE TABLE IF NOT EXISTS refresh_tokens (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		user_id INT NOT NULL,
+		family_id VARCHAR(64) NOT NULL,
+		token_hash CHAR(64) NOT NULL,
+		expires_at DATETIME NOT NULL,
+		created_at DATETIME NOT NULL,
+		used_at DATETIME NULL,
+		revoked_at DATETIME NULL,
+		UNIQUE KEY uq_refresh_token_hash (token_hash),
+		INDEX idx_refresh_family (family_id),
+		INDEX idx_refresh_user (user_id),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+	// Revoked access tokens and per-user "log out everywhere" cutoffs
+	`CREATE TABLE IF NOT EXISTS revoked_tokens (
+		jti VARCHAR(64) PRIMARY KEY,
+		user_id INT NOT NULL,
+		expires_at DATETIME NOT NULL,
+		revoked_at DATETIME NOT NULL,
+		INDEX idx_revoked_expires (expires_at)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+	`CREATE TABLE IF NOT EXISTS user_token_revocations (
+		user_id INT PRIMARY KEY,
+		revoked_before DATETIME NOT NULL,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+	// Single-use password reset tokens, stored hashed
+	`CREATE TABLE IF NOT EXISTS password_resets (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		user_id INT NOT NULL,
+		token_hash CHAR(64) NOT NULL,
+		expires_at DATETIME NOT NULL,
+		created_at DATETIME NOT NULL,
+		UNIQUE KEY uq_password_reset_hash (token_hash),
+		INDEX idx_password_reset_user (user_id),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+	// Email verification. Accounts that existed before verification was
+	// introduced are treated as verified; new accounts start unverified.
+	`ALTER TABLE users
+		ADD COLUMN IF NOT EXISTS email_verified BOOLEAN NOT NULL DEFAULT TRUE,
+		ADD COLUMN IF NOT EXISTS email_verified_at DATETIME NULL`,
+	`ALTER TABLE users ALTER COLUMN email_verified SET DEFAULT FALSE`,
+
+	// Links between users and their dietitians
+	`CREATE TABLE IF NOT EXISTS user_dietitian (
+		user_id INT NOT NULL,
+		dietitian_id INT NOT NULL,
+		assigned_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (user_id, dietitian_id),
+		INDEX idx_user_dietitian_dietitian (dietitian_id),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY (dietitian_id) REFERENCES users(id) ON DELETE CASCADE
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+	// TOTP two-factor authentication and hashed recovery codes
+	`CREATE TABLE IF NOT EXISTS user_two_factor (
+		user_id INT PRIMARY KEY,
+		secret VARCHAR(64) NOT NULL,
+		enabled_at DATETIME NULL,
+		last_used_step BIGINT NOT NULL DEFAULT 0,
+		failed_attempts INT NOT NULL DEFAULT 0,
+		locked_until DATETIME NULL,
+		created_at DATETIME NOT NULL,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+	`CREATE TABLE IF NOT EXISTS user_recovery_codes (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		user_id INT NOT NULL,
+		code_hash CHAR(64) NOT NULL,
+		created_at DATETIME NOT NULL,
+		used_at DATETIME NULL,
+		UNIQUE KEY uq_recovery_code (user_id, code_hash),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+	// Whether a refresh token family was started with a second factor
+	`ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS mfa BOOLEAN NOT NULL DEFAULT FALSE`,
+
+	// OpenID Connect sign-in. Accounts created through a provider start with
+	// placeholder body measurements and no password.
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS profile_complete BOOLEAN NOT NULL DEFAULT TRUE`,
+	`CREATE TABLE IF NOT EXISTS user_identities (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		user_id INT NOT NULL,
+		provider VARCHAR(50) NOT NULL,
+		subject VARCHAR(255) NOT NULL,
+		email VARCHAR(255) NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL,
+		last_login_at DATETIME NULL,
+		UNIQUE KEY uq_identity_subject (provider, subject),
+		UNIQUE KEY uq_identity_user_provider (user_id, provider),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+	`CREATE TABLE IF NOT EXISTS oidc_flows (
+		state_hash CHAR(64) PRIMARY KEY,
+		provider VARCHAR(50) NOT NULL,
+		nonce VARCHAR(64) NOT NULL,
+		code_verifier VARCHAR(128) NOT NULL,
+		user_id INT NULL,
+		expires_at DATETIME NOT NULL,
+		created_at DATETIME NOT NULL,
+		INDEX idx_oidc_flow_expires (expires_at),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+	// Failed-login streaks for per-account backoff and lockout
+	`CREATE TABLE IF NOT EXISTS user_login_failures (
+		user_id INT PRIMARY KEY,
+		failed_count INT NOT NULL DEFAULT 0,
+		last_failed_at DATETIME NOT NULL,
+		locked_until DATETIME NULL,
+		notified_at DATETIME NULL,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+	// Self-service account deletion; the account is purged once the time passes
+	`ALTER TABLE users
+		ADD COLUMN IF NOT EXISTS deletion_scheduled_at DATETIME NULL,
+		ADD INDEX IF NOT EXISTS idx_users_deletion_scheduled (deletion_scheduled_at)`,
+
+	// Logins per device; the ID is the refresh token family ID
+	`CREATE TABLE IF NOT EXISTS user_sessions (
+		id VARCHAR(64) PRIMARY KEY,
+		user_id INT NOT NULL,
+		device VARCHAR(100) NOT NULL DEFAULT '',
+		user_agent VARCHAR(512) NOT NULL DEFAULT '',
+		ip_address VARCHAR(45) NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL,
+		last_used_at DATETIME NOT NULL,
+		revoked_at DATETIME NULL,
+		INDEX idx_sessions_user (user_id),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+	// Personal access tokens for scripts; only the SHA-256 hash is stored
+	`CREATE TABLE IF NOT EXISTS personal_access_tokens (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		user_id INT NOT NULL,
+		name VARCHAR(100) NOT NULL,
+		token_hash CHAR(64) NOT NULL,
+		scopes VARCHAR(255) NOT NULL DEFAULT '',
+		mfa BOOLEAN NOT NULL DEFAULT FALSE,
+		expires_at DATETIME NOT NULL,
+		last_used_at DATETIME NULL,
+		created_at DATETIME NOT NULL,
+		UNIQUE KEY uq_personal_token_hash (token_hash),
+		INDEX idx_personal_token_user (user_id),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+	// Accounts disabled by an admin cannot sign in until re-enabled
+	`ALTER TABLE users
+		ADD COLUMN IF NOT EXISTS disabled_at DATETIME NULL,
+		ADD INDEX IF NOT EXISTS idx_users_role (role),
+		ADD INDEX IF NOT EXISTS idx_users_created (created_at)`,
+
+	// Batch goal recalculations run in the background. cursor_user_id is the
+	// last user processed, so an interrupted job resumes after it.
+	`CREATE TABLE IF NOT EXISTS goal_recalculation_jobs (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		status VARCHAR(20) NOT NULL,
+		dry_run BOOLEAN NOT NULL DEFAULT FALSE,
+		goal_type VARCHAR(20) NOT NULL DEFAULT '',
+		requested_by INT NULL,
+		total_users INT NOT NULL DEFAULT 0,
+		cursor_user_id INT NOT NULL DEFAULT 0,
+		processed INT NOT NULL DEFAULT 0,
+		changed INT NOT NULL DEFAULT 0,
+		failed INT NOT NULL DEFAULT 0,
+		error TEXT NULL,
+		created_at DATETIME NOT NULL,
+		started_at DATETIME NULL,
+		heartbeat_at DATETIME NULL,
+		finished_at DATETIME NULL,
+		INDEX idx_goal_job_status (status),
+		FOREIGN KEY (requested_by) REFERENCES users(id) ON DELETE SET NULL
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+	// Goals a recalculation changed, or would change in a dry run
+	`CREATE TABLE IF NOT EXISTS goal_recalculation_changes (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		job_id INT NOT NULL,
+		user_id INT NOT NULL,
+		before_calories INT NOT NULL,
+		before_protein DECIMAL(6,2) NOT NULL,
+		before_carbs DECIMAL(6,2) NOT NULL,
+		before_fats DECIMAL(6,2) NOT NULL,
+		after_calories INT NOT NULL,
+		after_protein DECIMAL(6,2) NOT NULL,
+		after_carbs DECIMAL(6,2) NOT NULL,
+		after_fats DECIMAL(6,2) NOT NULL,
+		UNIQUE KEY uq_goal_change_job_user (job_id, user_id),
+		INDEX idx_goal_change_user (user_id),
+		FOREIGN KEY (job_id) REFERENCES goal_recalculation_jobs(id) ON DELETE CASCADE,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+	// Append-only record of security and data-changing events. It has no
+	// foreign keys, so entries outlive the accounts they mention.
+	`CREATE TABLE IF NOT EXISTS audit_log (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		actor_id INT NULL,
+		subject_id INT NULL,
+		action VARCHAR(50) NOT NULL,
+		ip_address VARCHAR(45) NOT NULL DEFAULT '',
+		user_agent VARCHAR(512) NOT NULL DEFAULT '',
+		before_data JSON NULL,
+		after_data JSON NULL,
+		created_at DATETIME NOT NULL,
+		INDEX idx_audit_actor (actor_id, created_at),
+		INDEX idx_audit_subject (subject_id, created_at),
+		INDEX idx_audit_action (action, created_at),
+		INDEX idx_audit_created (created_at)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+
+	// Failed logins for email addresses without an account, keyed by a hash
+	// of the address, so they are throttled just like real accounts
+	`CREATE TABLE IF NOT EXISTS login_email_failures (
+		email_hash CHAR(64) PRIMARY KEY,
+		failed_count INT NOT NULL DEFAULT 0,
+		last_failed_at DATETIME NOT NULL,
+		locked_until DATETIME NULL,
+		INDEX idx_login_email_failures_last (last_failed_at)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+}
+
 // MigrateDB runs database migrations
 func MigrateDB(db *sqlx.DB) error {
 	// For a full-featured migration solution, consider:
@@ -0,0 +1,393 @@
+package Controllers
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	models "HabitBite/backend/Models"
+	nutrition "HabitBite/backend/Nutrition"
+	repositories "HabitBite/backend/Repositories"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccountController lets users edit their own profile, password and email,
+// export their data and delete their account
+type AccountController struct {
+	userService   *models.UserService
+	accounts      *models.AccountService
+	verifications *models.EmailVerificationService
+	loginThrottle *models.LoginThrottleService
+	auth          *AuthController
+}
+
+// NewAccountController creates a new AccountController. Signing out after a
+// password change goes through the AuthController's token stores and cookies.
+func NewAccountController(userService *models.UserService, accounts *models.AccountService,
+	verifications *models.EmailVerificationService, loginThrottle *models.LoginThrottleService,
+	authController *AuthController) *AccountController {
+	return &AccountController{
+		userService:   userService,
+		accounts:      accounts,
+		verifications: verifications,
+		loginThrottle: loginThrottle,
+		auth:          authController,
+	}
+}
+
+// UpdateProfileRequest represents the request body for editing the profile.
+// Fields left out are not changed.
+type UpdateProfileRequest struct {
+	FullName      *string  `json:"fullName" binding:"omitempty,min=1,max=100"`
+	Birthdate     *string  `json:"birthdate"`
+	Gender        *string  `json:"gender" binding:"omitempty,oneof=male female other"`
+	Height        *float64 `json:"height" binding:"omitempty,gt=0"`
+	Weight        *float64 `json:"weight" binding:"omitempty,gt=0"`
+	GoalType      *string  `json:"goalType" binding:"omitempty,oneof=lose gain maintain"`
+	ActivityLevel *string  `json:"activityLevel" binding:"omitempty,oneof=sedentary light moderate active very_active"`
+
+	// Optional energy-estimate inputs; clearBodyFat removes a stored percentage
+	BodyFatPercent *float64 `json:"bodyFatPercent" binding:"omitempty,gte=2,lte=70"`
+	ClearBodyFat   bool     `json:"clearBodyFat"`
+	EnergyFormula  *string  `json:"energyFormula" binding:"omitempty,oneof=mifflin_st_jeor harris_benedict katch_mcardle cunningham"`
+}
+
+// ChangePasswordRequest represents the request body for changing the password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword" binding:"required"`
+	NewPassword     string `json:"newPassword" binding:"required"`
+}
+
+// ChangeEmailRequest represents the request body for starting an email change.
+// The password is required for accounts that have one.
+type ChangeEmailRequest struct {
+	NewEmail string `json:"newEmail" binding:"required,email,max=255"`
+	Password string `json:"password"`
+}
+
+// DeleteAccountRequest represents the request body for deleting the account.
+// The password is required for accounts that have one.
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+// UpdateProfile edits the current user's profile, recalculating the calorie
+// goal when the body stats, goal type, activity level or formula change
+func (acc *AccountController) UpdateProfile(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": validationErrors(err),
+		})
+		return
+	}
+
+	update := models.ProfileUpdate{
+		FullName:      req.FullName,
+		Gender:        req.Gender,
+		Height:        req.Height,
+		Weight:        req.Weight,
+		GoalType:      req.GoalType,
+		ActivityLevel: req.ActivityLevel,
+		BodyFatPct:    req.BodyFatPercent,
+		EnergyFormula: req.EnergyFormula,
+		ClearBodyFat:  req.ClearBodyFat,
+	}
+	if req.Birthdate != nil {
+		birthdate, err := time.Parse("2006-01-02", *req.Birthdate)
+		if err != nil || !birthdate.Before(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid birthdate. Use YYYY-MM-DD"})
+			return
+		}
+		update.Birthdate = &birthdate
+	}
+
+	result, err := acc.userService.UpdateProfile(c.Request.Context(), userID, update)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositories.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		case errors.Is(err, nutrition.ErrBodyFatRequired):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bodyFatPercent is required for the selected energy formula"})
+		case errors.Is(err, nutrition.ErrUnknownFormula),
+			errors.Is(err, nutrition.ErrInvalidBodyFat),
+			errors.Is(err, nutrition.ErrInvalidBodyMetrics):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			log.Printf("Error updating profile for user %d: %v", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		}
+		return
+	}
+
+	response := gin.H{
+		"message":          "Profile updated successfully",
+		"user":             result.User.ToAuthUser(),
+		"goalRecalculated": result.GoalRecalculated(),
+	}
+	if result.GoalRecalculated() {
+		response["previousCalorieGoal"] = result.PreviousCalorieGoal
+		response["energy"] = result.Energy
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ChangePassword sets a new password after checking the current one, then
+// signs the user out of every session, this one included
+func (acc *AccountController) ChangePassword(c *gin.Context) {
+	user, ok := acc.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": validationErrors(err),
+		})
+		return
+	}
+
+	if !user.HasPassword() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This account has no password yet; use forgot password to set one"})
+		return
+	}
+	if !acc.checkPassword(c, user, req.CurrentPassword) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := acc.userService.ChangePassword(ctx, user.ID, req.NewPassword); err != nil {
+		if writePasswordPolicyError(c, err) {
+			return
+		}
+		log.Printf("Error changing password for user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+
+	// Whoever knew the old password must not keep a session
+	if acc.auth.revocations != nil {
+		if err := acc.auth.revocations.RevokeAllForUser(ctx, user.ID); err != nil {
+			log.Printf("Error revoking access tokens for user %d: %v", user.ID, err)
+		}
+	}
+	if acc.auth.refreshTokens != nil {
+		if err := acc.auth.revokeAllSessions(ctx, user.ID); err != nil {
+			log.Printf("Error revoking sessions for user %d: %v", user.ID, err)
+		}
+	}
+	acc.auth.clearAuthCookie(c)
+	acc.auth.clearRefreshTokenCookie(c)
+
+	log.Printf("User %d changed their password", user.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed. Please log in again with your new password."})
+}
+
+// RequestEmailChange sends a confirmation link to a new email address. The
+// account's email only changes once the link is used.
+func (acc *AccountController) RequestEmailChange(c *gin.Context) {
+	user, ok := acc.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req ChangeEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": validationErrors(err),
+		})
+		return
+	}
+
+	// Accounts that sign in only through a provider have no password to ask for
+	if user.HasPassword() && !acc.checkPassword(c, user, req.Password) {
+		return
+	}
+
+	if err := acc.verifications.RequestEmailChange(c.Request.Context(), user, req.NewEmail); err != nil {
+		switch {
+		case errors.Is(err, models.ErrEmailUnchanged):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The new email is the same as the current one"})
+		case errors.Is(err, models.ErrEmailInUse):
+			c.JSON(http.StatusConflict, gin.H{"error": "Email address is already in use"})
+		default:
+			log.Printf("Error requesting email change for user %d: %v", user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send confirmation email"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "A confirmation link has been sent to the new address"})
+}
+
+// RequestDeletion schedules the current user's account for deletion. The
+// account keeps working until the grace period ends, so it can be cancelled.
+func (acc *AccountController) RequestDeletion(c *gin.Context) {
+	user, ok := acc.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": validationErrors(err),
+		})
+		return
+	}
+
+	if user.HasPassword() && !acc.checkPassword(c, user, req.Password) {
+		return
+	}
+
+	at, err := acc.accounts.ScheduleDeletion(c.Request.Context(), user)
+	if err != nil {
+		if errors.Is(err, models.ErrDeletionAlreadyScheduled) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Account deletion is already scheduled"})
+			return
+		}
+		log.Printf("Error scheduling deletion for user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to schedule account deletion"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":             "Your account will be deleted at the scheduled time unless you cancel",
+		"deletionScheduledAt": at,
+	})
+}
+
+// CancelDeletion keeps the current user's account after a deletion request
+func (acc *AccountController) CancelDeletion(c *gin.Context) {
+	user, ok := acc.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if err := acc.accounts.CancelDeletion(c.Request.Context(), user); err != nil {
+		if errors.Is(err, models.ErrDeletionNotScheduled) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Account deletion is not scheduled"})
+			return
+		}
+		log.Printf("Error cancelling deletion for user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel account deletion"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account deletion cancelled"})
+}
+
+// ExportData downloads everything stored about the current user, as a zip
+// archive of data.json and one CSV file per table, or as JSON alone with
+// ?format=json
+func (acc *AccountController) ExportData(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	format := c.DefaultQuery("format", "zip")
+	if format != "zip" && format != "json" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be zip or json"})
+		return
+	}
+
+	export, err := acc.accounts.Export(c.Request.Context(), userID)
+	if err != nil {
+		log.Printf("Error exporting data for user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export data"})
+		return
+	}
+
+	filename := "habitbite-export-" + export.ExportedAt.Format("2006-01-02")
+	c.Header("Cache-Control", "no-store")
+
+	if format == "json" {
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`.json"`)
+		c.JSON(http.StatusOK, export)
+		return
+	}
+
+	var archive bytes.Buffer
+	if err := export.WriteArchive(&archive); err != nil {
+		log.Printf("Error writing export archive for user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export data"})
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`.zip"`)
+	c.Data(http.StatusOK, "application/zip", archive.Bytes())
+}
+
+// currentUser loads the authenticated user, writing an error response on failure
+func (acc *AccountController) currentUser(c *gin.Context) (*models.User, bool) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return nil, false
+	}
+
+	user, err := acc.userService.FindByID(c.Request.Context(), userID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrUserNotFound) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+			return nil, false
+		}
+		log.Printf("Error finding user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return nil, false
+	}
+
+	return user, true
+}
+
+// checkPassword confirms the user's current password. Wrong guesses count
+// towards the same backoff and lockout as failed logins, so a stolen session
+// cannot be used to guess the password faster.
+func (acc *AccountController) checkPassword(c *gin.Context, user *models.User, password string) bool {
+	ctx := c.Request.Context()
+
+	if acc.loginThrottle != nil {
+		wait, err := acc.loginThrottle.ReserveAttempt(ctx, user.ID)
+		if err != nil {
+			log.Printf("Error checking login throttle: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check password"})
+			return false
+		}
+		if wait > 0 {
+			writeThrottled(c, wait, "Too many failed password attempts. Please try again later.")
+			return false
+		}
+	}
+
+	if !user.CheckPassword(password) {
+		if acc.loginThrottle != nil {
+			if err := acc.loginThrottle.RecordFailure(ctx, user); err != nil {
+				log.Printf("Error recording failed password check: %v", err)
+			}
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+		return false
+	}
+
+	if acc.loginThrottle != nil {
+		if err := acc.loginThrottle.RecordSuccess(ctx, user.ID); err != nil {
+			log.Printf("Error clearing failed logins: %v", err)
+		}
+	}
+
+	return true
+}
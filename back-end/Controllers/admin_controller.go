@@ -0,0 +1,326 @@
+package Controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	models "HabitBite/backend/Models"
+	repositories "HabitBite/backend/Repositories"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminController handles account administration
+type AdminController struct {
+	userService   *models.UserService
+	loginThrottle *models.LoginThrottleService
+	userAdmin     *models.UserAdminService
+	audit         *models.AuditService
+}
+
+// NewAdminController creates a new AdminController. Every look at or change
+// to another user's account is recorded in the audit log.
+func NewAdminController(userService *models.UserService, loginThrottle *models.LoginThrottleService,
+	userAdmin *models.UserAdminService, audit *models.AuditService) *AdminController {
+	return &AdminController{
+		userService:   userService,
+		loginThrottle: loginThrottle,
+		userAdmin:     userAdmin,
+		audit:         audit,
+	}
+}
+
+// ChangeRoleRequest represents the request body for changing a user's role
+type ChangeRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=user dietitian admin"`
+}
+
+// ListUsers returns one page of users, newest first. It accepts the query
+// parameters q (email, username or name), role, status (active or
+// disabled), createdFrom and createdTo (YYYY-MM-DD, inclusive), page and limit.
+func (ac *AdminController) ListUsers(c *gin.Context) {
+	adminID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	search := models.UserSearch{
+		Query:  strings.TrimSpace(c.Query("q")),
+		Role:   c.Query("role"),
+		Status: c.Query("status"),
+	}
+
+	switch search.Role {
+	case "", models.RoleUser, models.RoleDietitian, models.RoleAdmin:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": models.ErrInvalidRole.Error()})
+		return
+	}
+	switch search.Status {
+	case "", models.UserStatusActive, models.UserStatusDisabled:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Status must be active or disabled"})
+		return
+	}
+
+	if s := c.Query("createdFrom"); s != "" {
+		parsed, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid createdFrom date format. Use YYYY-MM-DD"})
+			return
+		}
+		search.CreatedFrom = &parsed
+	}
+	if s := c.Query("createdTo"); s != "" {
+		parsed, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid createdTo date format. Use YYYY-MM-DD"})
+			return
+		}
+		before := parsed.AddDate(0, 0, 1)
+		search.CreatedBefore = &before
+	}
+
+	page := 1
+	if s := c.Query("page"); s != "" {
+		parsed, err := strconv.Atoi(s)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Page must be a positive number"})
+			return
+		}
+		page = parsed
+	}
+	search.Limit = models.DefaultUserListLimit
+	if s := c.Query("limit"); s != "" {
+		parsed, err := strconv.Atoi(s)
+		if err != nil || parsed <= 0 || parsed > models.MaxUserListLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Limit must be between 1 and 100"})
+			return
+		}
+		search.Limit = parsed
+	}
+	search.Offset = (page - 1) * search.Limit
+
+	users, total, err := ac.userAdmin.List(c.Request.Context(), search)
+	if err != nil {
+		log.Printf("Error listing users: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list users"})
+		return
+	}
+
+	ac.recordAudit(c, adminID, 0, models.AuditUsersListed, nil,
+		gin.H{"query": c.Request.URL.RawQuery, "results": len(users)})
+
+	c.JSON(http.StatusOK, gin.H{
+		"users": users,
+		"total": total,
+		"page":  page,
+		"limit": search.Limit,
+	})
+}
+
+// GetUser returns a user's profile and goals
+func (ac *AdminController) GetUser(c *gin.Context) {
+	adminID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	userID, ok := ac.targetUserID(c)
+	if !ok {
+		return
+	}
+
+	user, goals, err := ac.userAdmin.Get(c.Request.Context(), userID)
+	if err != nil {
+		ac.writeError(c, err, "Failed to load user")
+		return
+	}
+
+	ac.recordAudit(c, adminID, userID, models.AuditUserViewed, nil, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"user":  user,
+		"goals": goals,
+	})
+}
+
+// ChangeRole gives a user a new role; it applies from their next request
+func (ac *AdminController) ChangeRole(c *gin.Context) {
+	adminID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	userID, ok := ac.targetUserID(c)
+	if !ok {
+		return
+	}
+
+	var req ChangeRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": validationErrors(err),
+		})
+		return
+	}
+
+	user, previous, err := ac.userAdmin.ChangeRole(c.Request.Context(), adminID, userID, req.Role)
+	if err != nil {
+		ac.writeError(c, err, "Failed to change role")
+		return
+	}
+
+	if previous != req.Role {
+		ac.recordAudit(c, adminID, userID, models.AuditRoleChanged, gin.H{"role": previous}, gin.H{"role": req.Role})
+	}
+
+	log.Printf("Admin %d changed the role of user %d to %s", adminID, userID, req.Role)
+	c.JSON(http.StatusOK, gin.H{"message": "Role changed", "user": user})
+}
+
+// DisableUser stops a user from signing in and signs them out everywhere
+func (ac *AdminController) DisableUser(c *gin.Context) {
+	adminID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	userID, ok := ac.targetUserID(c)
+	if !ok {
+		return
+	}
+
+	user, err := ac.userAdmin.Disable(c.Request.Context(), adminID, userID)
+	if err != nil {
+		ac.writeError(c, err, "Failed to disable user")
+		return
+	}
+
+	ac.recordAudit(c, adminID, userID, models.AuditUserDisabled, gin.H{"disabledAt": nil}, gin.H{"disabledAt": user.DisabledAt})
+
+	log.Printf("Admin %d disabled user %d", adminID, userID)
+	c.JSON(http.StatusOK, gin.H{"message": "User disabled", "user": user})
+}
+
+// EnableUser lets a disabled user sign in again
+func (ac *AdminController) EnableUser(c *gin.Context) {
+	adminID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	userID, ok := ac.targetUserID(c)
+	if !ok {
+		return
+	}
+
+	user, err := ac.userAdmin.Enable(c.Request.Context(), adminID, userID)
+	if err != nil {
+		ac.writeError(c, err, "Failed to enable user")
+		return
+	}
+
+	ac.recordAudit(c, adminID, userID, models.AuditUserEnabled, nil, gin.H{"disabledAt": nil})
+
+	log.Printf("Admin %d re-enabled user %d", adminID, userID)
+	c.JSON(http.StatusOK, gin.H{"message": "User enabled", "user": user})
+}
+
+// ForcePasswordReset clears a user's password, signs them out and emails
+// them a link to choose a new one
+func (ac *AdminController) ForcePasswordReset(c *gin.Context) {
+	adminID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	userID, ok := ac.targetUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := ac.userAdmin.ForcePasswordReset(c.Request.Context(), userID); err != nil {
+		ac.writeError(c, err, "Failed to reset password")
+		return
+	}
+
+	ac.recordAudit(c, adminID, userID, models.AuditPasswordReset, nil, nil)
+
+	log.Printf("Admin %d forced a password reset for user %d", adminID, userID)
+	c.JSON(http.StatusOK, gin.H{"message": "Password cleared; the user has been emailed a reset link"})
+}
+
+// UnlockUser clears a user's failed-login streak and lockout
+func (ac *AdminController) UnlockUser(c *gin.Context) {
+	adminID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	userID, ok := ac.targetUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := ac.loginThrottle.Unlock(c.Request.Context(), userID); err != nil {
+		log.Printf("Error unlocking user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock user"})
+		return
+	}
+
+	ac.recordAudit(c, adminID, userID, models.AuditUserUnlocked, nil, nil)
+
+	log.Printf("Admin unlocked logins for user %d", userID)
+	c.JSON(http.StatusOK, gin.H{"message": "User unlocked"})
+}
+
+// recordAudit records an admin action on another user's account, or on
+// many accounts when userID is 0
+func (ac *AdminController) recordAudit(c *gin.Context, adminID, userID int, action string, before, after interface{}) {
+	recordAudit(c, ac.audit, models.AuditEvent{
+		ActorID:   adminID,
+		SubjectID: userID,
+		Action:    action,
+		Before:    before,
+		After:     after,
+	})
+}
+
+// writeError maps user administration errors to responses
+func (ac *AdminController) writeError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, models.ErrInvalidRole):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrOwnAccount):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrUserAlreadyDisabled), errors.Is(err, models.ErrUserNotDisabled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, repositories.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	default:
+		log.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
+
+// targetUserID parses the :id parameter and checks that the user exists,
+// writing an error response on failure
+func (ac *AdminController) targetUserID(c *gin.Context) (int, bool) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return 0, false
+	}
+
+	if _, err := ac.userService.FindByID(c.Request.Context(), userID); err != nil {
+		if errors.Is(err, repositories.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return 0, false
+		}
+		log.Printf("Error finding user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load user"})
+		return 0, false
+	}
+
+	return userID, true
+}
@@ -0,0 +1,96 @@
+package Controllers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	models "HabitBite/backend/Models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuditController lets admins read the audit log
+type AuditController struct {
+	audit *models.AuditService
+}
+
+// NewAuditController creates a new AuditController
+func NewAuditController(audit *models.AuditService) *AuditController {
+	return &AuditController{audit: audit}
+}
+
+// SearchAuditLog returns one page of audit entries, newest first. It
+// accepts the query parameters actorId, subjectId, userId (actor or
+// subject), action, from and to (YYYY-MM-DD, inclusive), page and limit.
+func (auc *AuditController) SearchAuditLog(c *gin.Context) {
+	query := models.AuditQuery{Action: c.Query("action")}
+
+	for param, target := range map[string]*int{
+		"actorId":   &query.ActorID,
+		"subjectId": &query.SubjectID,
+		"userId":    &query.UserID,
+	} {
+		if s := c.Query(param); s != "" {
+			id, err := strconv.Atoi(s)
+			if err != nil || id <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param})
+				return
+			}
+			*target = id
+		}
+	}
+
+	if s := c.Query("from"); s != "" {
+		parsed, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date format. Use YYYY-MM-DD"})
+			return
+		}
+		query.From = &parsed
+	}
+	if s := c.Query("to"); s != "" {
+		parsed, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date format. Use YYYY-MM-DD"})
+			return
+		}
+		before := parsed.AddDate(0, 0, 1)
+		query.Before = &before
+	}
+
+	page := 1
+	if s := c.Query("page"); s != "" {
+		parsed, err := strconv.Atoi(s)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Page must be a positive number"})
+			return
+		}
+		page = parsed
+	}
+	query.Limit = models.DefaultAuditLimit
+	if s := c.Query("limit"); s != "" {
+		parsed, err := strconv.Atoi(s)
+		if err != nil || parsed <= 0 || parsed > models.MaxAuditLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Limit must be between 1 and 500"})
+			return
+		}
+		query.Limit = parsed
+	}
+	query.Offset = (page - 1) * query.Limit
+
+	entries, total, err := auc.audit.Search(c.Request.Context(), query)
+	if err != nil {
+		log.Printf("Error searching audit log: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search audit log"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"entries": entries,
+		"total":   total,
+		"page":    page,
+		"limit":   query.Limit,
+	})
+}
@@ -1,8 +1,8 @@
 package Controllers
 
 import (
+	"context"
 	"errors"
-	"fmt"
 	"log"
 	"net/http"
 	"strings"
@@ -11,32 +11,59 @@ import (
 	config "HabitBite/backend/Config"
 	middleware "HabitBite/backend/Middleware"
 	models "HabitBite/backend/Models"
+	nutrition "HabitBite/backend/Nutrition"
 	repositories "HabitBite/backend/Repositories"
+	tokens "HabitBite/backend/Tokens"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 )
 
 // AuthController handles authentication-related operations
 type AuthController struct {
-	userRepo    repositories.UserRepository
-	userService *models.UserService
-	config      *config.Config
+	userRepo      repositories.UserRepository
+	userService   *models.UserService
+	tokens        *tokens.Service
+	refreshTokens *models.RefreshTokenService
+	sessions      *models.SessionService
+	revocations   *models.TokenRevocationService
+	verifications *models.EmailVerificationService
+	twoFactor     *models.TwoFactorService
+	loginThrottle *models.LoginThrottleService
+	audit         *models.AuditService
+	config        *config.Config
 }
 
+// refreshTokenCookie is the cookie holding the opaque refresh token
+const refreshTokenCookie = "refresh_token"
+
 // NewAuthController creates a new AuthController
-func NewAuthController(repo repositories.UserRepository, cfg *config.Config) *AuthController {
+func NewAuthController(repo repositories.UserRepository, tokenService *tokens.Service, cfg *config.Config) *AuthController {
 	return &AuthController{
 		userRepo: repo,
+		tokens:   tokenService,
 		config:   cfg,
 	}
 }
 
-// NewAuthControllerWithService creates a new AuthController using the UserService
-func NewAuthControllerWithService(service *models.UserService, cfg *config.Config) *AuthController {
+// NewAuthControllerWithService creates a new AuthController using the UserService,
+// rotating refresh tokens, per-device sessions, access token revocation,
+// email verification, two-factor login, per-account login throttling and an
+// audit log of logins and goal changes
+func NewAuthControllerWithService(service *models.UserService, tokenService *tokens.Service,
+	refreshTokens *models.RefreshTokenService, sessions *models.SessionService, revocations *models.TokenRevocationService,
+	verifications *models.EmailVerificationService, twoFactor *models.TwoFactorService,
+	loginThrottle *models.LoginThrottleService, audit *models.AuditService, cfg *config.Config) *AuthController {
 	return &AuthController{
-		userService: service,
-		config:      cfg,
+		userService:   service,
+		tokens:        tokenService,
+		refreshTokens: refreshTokens,
+		sessions:      sessions,
+		revocations:   revocations,
+		verifications: verifications,
+		twoFactor:     twoFactor,
+		loginThrottle: loginThrottle,
+		audit:         audit,
+		config:        cfg,
 	}
 }
 
@@ -44,7 +71,7 @@ func NewAuthControllerWithService(service *models.UserService, cfg *config.Confi
 type RegisterRequest struct {
 	Email         string  `json:"email" binding:"required,email"`
 	Username      string  `json:"username" binding:"required,alphanum,min=3,max=50"`
-	Password      string  `json:"password" binding:"required,min=8"`
+	Password      string  `json:"password" binding:"required"`
 	FullName      string  `json:"fullName" binding:"required"`
 	Birthdate     string  `json:"birthdate" binding:"required"`
 	Gender        string  `json:"gender" binding:"required,oneof=male female other"`
@@ -52,6 +79,10 @@ type RegisterRequest struct {
 	Weight        float64 `json:"weight" binding:"required,gt=0"`
 	GoalType      string  `json:"goalType" binding:"required,oneof=lose gain maintain"`
 	ActivityLevel string  `json:"activityLevel" binding:"required,oneof=sedentary light moderate active very_active"`
+
+	// Optional energy-estimate inputs
+	BodyFatPercent *float64 `json:"bodyFatPercent" binding:"omitempty,gte=2,lte=70"`
+	EnergyFormula  string   `json:"energyFormula" binding:"omitempty,oneof=mifflin_st_jeor harris_benedict katch_mcardle cunningham"`
 }
 
 // LoginRequest represents the request body for user login
@@ -82,7 +113,6 @@ func (ac *AuthController) Register(c *gin.Context) {
 	}
 
 	log.Printf("Registration request received for email: %s", req.Email)
-	log.Printf("Request data: %+v", req)
 
 	// Parse birthdate
 	birthdate, err := time.Parse("2006-01-02", req.Birthdate)
@@ -113,35 +143,58 @@ func (ac *AuthController) Register(c *gin.Context) {
 		return
 	}
 
-	// Calculate daily calorie goal
-	dailyCalorieGoal := calculateDailyCalorieGoal(
-		req.Weight,
-		req.Height,
-		req.Gender,
-		time.Now().Year()-birthdate.Year(),
-		req.ActivityLevel,
-		req.GoalType,
-	)
-
-	log.Printf("Calculated daily calorie goal: %d", dailyCalorieGoal)
+	energyFormula := req.EnergyFormula
+	if energyFormula == "" {
+		energyFormula = nutrition.DefaultFormula
+	}
 
 	// Create user
 	user := &models.User{
-		Email:            req.Email,
-		Username:         req.Username,
-		FullName:         req.FullName,
-		Birthdate:        birthdate,
-		Gender:           req.Gender,
-		Height:           req.Height,
-		Weight:           req.Weight,
-		GoalType:         req.GoalType,
-		ActivityLevel:    req.ActivityLevel,
-		Role:             models.RoleUser,
-		CreatedAt:        time.Now(),
-		UpdatedAt:        time.Now(),
-		DailyCalorieGoal: dailyCalorieGoal,
+		Email:           req.Email,
+		Username:        req.Username,
+		FullName:        req.FullName,
+		Birthdate:       birthdate,
+		Gender:          req.Gender,
+		Height:          req.Height,
+		Weight:          req.Weight,
+		GoalType:        req.GoalType,
+		ActivityLevel:   req.ActivityLevel,
+		BodyFatPct:      req.BodyFatPercent,
+		EnergyFormula:   energyFormula,
+		Role:            models.RoleUser,
+		ProfileComplete: true,
+		CreatedAt:       time.Now(),
+		UpdatedAt:       time.Now(),
+	}
+
+	if ac.userService != nil {
+		if err := ac.userService.ValidatePassword(c.Request.Context(), user, req.Password); err != nil {
+			if writePasswordPolicyError(c, err) {
+				return
+			}
+			log.Printf("Error checking password policy: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process password"})
+			return
+		}
 	}
 
+	// Formulas based on lean mass cannot work without a body-fat percentage
+	if estimator, err := nutrition.Estimator(energyFormula); err == nil && estimator.RequiresBodyFat() && req.BodyFatPercent == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bodyFatPercent is required for the selected energy formula"})
+		return
+	}
+
+	// Calculate daily calorie goal
+	energy, err := user.EstimateEnergy(time.Now())
+	if err != nil {
+		log.Printf("Error estimating energy expenditure: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user.DailyCalorieGoal = energy.TargetCalories
+
+	log.Printf("Calculated daily calorie goal: %d (%s)", user.DailyCalorieGoal, energy.Formula)
+
 	// Set password
 	if err := user.SetPassword(req.Password); err != nil {
 		log.Printf("Error hashing password: %v", err)
@@ -149,7 +202,7 @@ func (ac *AuthController) Register(c *gin.Context) {
 		return
 	}
 
-	log.Printf("Attempting to create user in database with data: %+v", user)
+	log.Printf("Attempting to create user in database with email: %s", user.Email)
 
 	if ac.userService != nil {
 		err = ac.userService.CreateUser(c.Request.Context(), user)
@@ -169,8 +222,15 @@ func (ac *AuthController) Register(c *gin.Context) {
 
 	log.Printf("User created successfully with ID: %d", user.ID)
 
+	// A failed email does not fail registration; the user can ask for a new link
+	if ac.verifications != nil {
+		if err := ac.verifications.SendVerification(c.Request.Context(), user); err != nil {
+			log.Printf("Error sending verification email to user %d: %v", user.ID, err)
+		}
+	}
+
 	// Generate tokens
-	accessToken, refreshToken, err := ac.generateAuthTokens(user)
+	accessToken, refreshToken, err := ac.generateAuthTokens(c, user, false)
 	if err != nil {
 		log.Printf("Error generating tokens: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate tokens"})
@@ -223,21 +283,159 @@ func (ac *AuthController) Login(c *gin.Context) {
 		user, err = ac.userRepo.FindByEmail(c.Request.Context(), email)
 	}
 
+	// Unknown addresses are throttled like accounts, so the responses look
+	// the same whether or not the address is registered
 	if err != nil {
 		log.Printf("User not found: %v", err)
+		if ac.loginThrottle != nil {
+			wait, err := ac.loginThrottle.ReserveUnknownAttempt(c.Request.Context(), email)
+			if err != nil {
+				log.Printf("Error checking login throttle: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+				return
+			}
+			if wait > 0 {
+				ac.auditLoginFailure(c, 0, email, "throttled")
+				writeThrottled(c, wait, "Too many failed login attempts. Please try again later.")
+				return
+			}
+		}
+		ac.auditLoginFailure(c, 0, email, "unknown_email")
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 		return
 	}
 
+	// Accounts with repeated failures must wait before the password is even
+	// checked; otherwise the attempt is counted as failed until it succeeds
+	if ac.loginThrottle != nil {
+		wait, err := ac.loginThrottle.ReserveAttempt(c.Request.Context(), user.ID)
+		if err != nil {
+			log.Printf("Error checking login throttle: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+			return
+		}
+		if wait > 0 {
+			ac.auditLoginFailure(c, user.ID, email, "throttled")
+			writeThrottled(c, wait, "Too many failed login attempts. Please try again later.")
+			return
+		}
+	}
+
 	// Verify password
 	if !user.CheckPassword(req.Password) {
 		log.Printf("Invalid password for user: %s", email)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		ac.auditLoginFailure(c, user.ID, email, "invalid_password")
+		if ac.loginThrottle != nil {
+			if err := ac.loginThrottle.RecordFailure(c.Request.Context(), user); err != nil {
+				log.Printf("Error recording failed login: %v", err)
+			}
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		return
+	}
+
+	if ac.loginThrottle != nil {
+		if err := ac.loginThrottle.RecordSuccess(c.Request.Context(), user.ID); err != nil {
+			log.Printf("Error clearing failed logins: %v", err)
+		}
+	}
+
+	if ac.rejectDisabled(c, user) {
+		ac.auditLoginFailure(c, user.ID, email, "account_disabled")
+		return
+	}
+
+	// With 2FA enabled the password only earns a challenge for the second step
+	if ac.twoFactor != nil {
+		enabled, err := ac.twoFactor.IsEnabled(c.Request.Context(), user.ID)
+		if err != nil {
+			log.Printf("Error checking two-factor status: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+			return
+		}
+		if enabled {
+			challenge, err := ac.tokens.IssueTwoFactorChallenge(user.ID)
+			if err != nil {
+				log.Printf("Error issuing two-factor challenge: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{
+				"twoFactorRequired": true,
+				"challengeToken":    challenge,
+				"expiresIn":         int(tokens.TwoFactorChallengeTTL.Seconds()),
+			})
+			return
+		}
+	}
+
+	ac.completeLogin(c, user, false)
+}
+
+// LoginTwoFactorRequest represents the request body for the second login step
+type LoginTwoFactorRequest struct {
+	ChallengeToken string `json:"challengeToken" binding:"required"`
+	Code           string `json:"code" binding:"required,max=32"`
+}
+
+// LoginTwoFactor completes a login with a TOTP or recovery code and the
+// challenge token returned by Login
+func (ac *AuthController) LoginTwoFactor(c *gin.Context) {
+	if ac.twoFactor == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Two-factor authentication is not available"})
+		return
+	}
+
+	var req LoginTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": validationErrors(err),
+		})
+		return
+	}
+
+	userID, err := ac.tokens.ParseTwoFactorChallenge(req.ChallengeToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired login challenge; please log in again"})
+		return
+	}
+
+	if err := ac.twoFactor.Verify(c.Request.Context(), userID, req.Code); err != nil {
+		switch {
+		case errors.Is(err, models.ErrTwoFactorInvalidCode):
+			ac.auditLoginFailure(c, userID, "", "invalid_two_factor_code")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code"})
+		case errors.Is(err, models.ErrTwoFactorLocked):
+			ac.auditLoginFailure(c, userID, "", "two_factor_locked")
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		case errors.Is(err, models.ErrTwoFactorNotEnrolled):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired login challenge; please log in again"})
+		default:
+			log.Printf("Error verifying two-factor code: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		}
+		return
+	}
+
+	user, err := ac.userService.FindByID(c.Request.Context(), userID)
+	if err != nil {
+		log.Printf("Error finding user after two-factor login: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired login challenge; please log in again"})
+		return
+	}
+
+	ac.completeLogin(c, user, true)
+}
+
+// completeLogin issues tokens for an authenticated user and writes the login response
+func (ac *AuthController) completeLogin(c *gin.Context, user *models.User, mfa bool) {
+	if ac.rejectDisabled(c, user) {
 		return
 	}
 
 	// Generate tokens
-	accessToken, refreshToken, err := ac.generateAuthTokens(user)
+	accessToken, refreshToken, err := ac.generateAuthTokens(c, user, mfa)
 	if err != nil {
 		log.Printf("Error generating tokens: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate tokens"})
@@ -255,42 +453,211 @@ func (ac *AuthController) Login(c *gin.Context) {
 	}
 
 	// Return user data and access token
-	authUser := user.ToAuthUser()
-	c.JSON(http.StatusOK, gin.H{
-		"user":  authUser,
+	response := gin.H{
+		"user":  user.ToAuthUser(),
 		"token": accessToken,
+	}
+
+	// Roles that must use 2FA only reach the enrollment endpoints until they
+	// do, or until the enrollment deadline passes
+	if !mfa && ac.twoFactor != nil && ac.twoFactor.IsRequiredForRole(user.Role) {
+		response["twoFactorSetupRequired"] = true
+		if deadline := ac.twoFactor.EnrollmentDeadline(); deadline != nil {
+			response["twoFactorSetupDeadline"] = deadline
+		}
+	}
+
+	recordAudit(c, ac.audit, models.AuditEvent{
+		ActorID:   user.ID,
+		SubjectID: user.ID,
+		Action:    models.AuditLogin,
+		After:     gin.H{"mfa": mfa},
+	})
+
+	c.JSON(http.StatusOK, response)
+}
+
+// auditLoginFailure records a failed login. userID is 0 when the email
+// belongs to no account.
+func (ac *AuthController) auditLoginFailure(c *gin.Context, userID int, email, reason string) {
+	after := gin.H{"reason": reason}
+	if email != "" {
+		after["email"] = email
+	}
+
+	recordAudit(c, ac.audit, models.AuditEvent{
+		SubjectID: userID,
+		Action:    models.AuditLoginFailed,
+		After:     after,
+	})
+}
+
+// rejectDisabled writes a 403 response and returns true if an admin has
+// disabled the user's account
+func (ac *AuthController) rejectDisabled(c *gin.Context, user *models.User) bool {
+	if !user.IsDisabled() {
+		return false
+	}
+
+	c.JSON(http.StatusForbidden, gin.H{
+		"error": "This account has been disabled",
+		"code":  "account_disabled",
 	})
+	return true
 }
 
-// Logout handles user logout
+// Logout revokes the presented access token and the refresh token family of
+// this login, then clears both cookies. It needs no valid access token, so
+// that a client can always log out.
 func (ac *AuthController) Logout(c *gin.Context) {
-	// Clear auth cookie
-	c.SetCookie(
-		"auth_token",
-		"",
-		-1, // Expire immediately
-		"/",
-		ac.config.CookieDomain,
-		true, // Secure
-		true, // HttpOnly
-	)
+	ctx := c.Request.Context()
+
+	if ac.revocations != nil {
+		if claims, ok := middleware.RequestAccessToken(c, ac.tokens); ok {
+			userID, _ := claims.UserID()
+			if err := ac.revocations.RevokeToken(ctx, claims.ID, userID, claims.ExpiresAt.Time); err != nil {
+				log.Printf("Error revoking access token: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+				return
+			}
+
+			// Ending the session also revokes its refresh tokens
+			if ac.sessions != nil && claims.SessionID != "" {
+				if err := ac.sessions.Revoke(ctx, userID, claims.SessionID); err != nil && !errors.Is(err, models.ErrSessionNotFound) {
+					log.Printf("Error ending session: %v", err)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+					return
+				}
+			}
+		}
+	}
+
+	if ac.refreshTokens != nil {
+		if raw, err := c.Cookie(refreshTokenCookie); err == nil && raw != "" {
+			if err := ac.refreshTokens.Revoke(ctx, raw); err != nil {
+				log.Printf("Error revoking refresh token: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+				return
+			}
+		}
+	}
+
+	ac.clearAuthCookie(c)
+	ac.clearRefreshTokenCookie(c)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
 }
 
-// GetCurrentUser returns the current authenticated user
-func (ac *AuthController) GetCurrentUser(c *gin.Context) {
-	// Get user ID from context (set by AuthMiddleware)
-	userID, exists := c.Get("userID")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+// LogoutAll revokes every access and refresh token of the current user,
+// logging them out on all devices
+func (ac *AuthController) LogoutAll(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	if ac.revocations == nil || ac.refreshTokens == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Session revocation is not available"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := ac.revocations.RevokeAllForUser(ctx, userID); err != nil {
+		log.Printf("Error revoking access tokens for user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out everywhere"})
+		return
+	}
+	if err := ac.revokeAllSessions(ctx, userID); err != nil {
+		log.Printf("Error revoking sessions for user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out everywhere"})
+		return
+	}
+
+	ac.clearAuthCookie(c)
+	ac.clearRefreshTokenCookie(c)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out on all devices"})
+}
+
+// ListSessions returns the devices the current user is signed in on, marking
+// the one making the request
+func (ac *AuthController) ListSessions(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
 		return
 	}
 
-	// Convert interface{} to int
-	id, ok := userID.(float64)
+	if ac.sessions == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Sessions are not available"})
+		return
+	}
+
+	sessions, err := ac.sessions.List(c.Request.Context(), userID)
+	if err != nil {
+		log.Printf("Error listing sessions for user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve sessions"})
+		return
+	}
+
+	var currentID string
+	if claims, ok := middleware.TokenClaims(c); ok {
+		currentID = claims.SessionID
+	}
+
+	response := make([]gin.H, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, gin.H{
+			"id":         session.ID,
+			"device":     session.Device,
+			"userAgent":  session.UserAgent,
+			"ipAddress":  session.IPAddress,
+			"createdAt":  session.CreatedAt,
+			"lastUsedAt": session.LastUsedAt,
+			"current":    session.ID == currentID,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": response})
+}
+
+// RevokeSession signs the current user out on one device
+func (ac *AuthController) RevokeSession(c *gin.Context) {
+	userID, ok := currentUserID(c)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if ac.sessions == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Sessions are not available"})
+		return
+	}
+
+	sessionID := c.Param("id")
+	if err := ac.sessions.Revoke(c.Request.Context(), userID, sessionID); err != nil {
+		if errors.Is(err, models.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+			return
+		}
+		log.Printf("Error revoking session for user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+
+	// Revoking the session in use also signs this browser out
+	if claims, ok := middleware.TokenClaims(c); ok && claims.SessionID == sessionID {
+		ac.clearAuthCookie(c)
+		ac.clearRefreshTokenCookie(c)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// GetCurrentUser returns the current authenticated user
+func (ac *AuthController) GetCurrentUser(c *gin.Context) {
+	// Get user ID from context (set by AuthMiddleware)
+	id, ok := middleware.UserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
 		return
 	}
 
@@ -299,9 +666,9 @@ func (ac *AuthController) GetCurrentUser(c *gin.Context) {
 	var err error
 
 	if ac.userService != nil {
-		user, err = ac.userService.FindByID(c.Request.Context(), int(id))
+		user, err = ac.userService.FindByID(c.Request.Context(), id)
 	} else {
-		user, err = ac.userRepo.FindByID(c.Request.Context(), int(id))
+		user, err = ac.userRepo.FindByID(c.Request.Context(), id)
 	}
 
 	if err != nil {
@@ -315,40 +682,49 @@ func (ac *AuthController) GetCurrentUser(c *gin.Context) {
 		return
 	}
 
-	// Return user data
-	c.JSON(http.StatusOK, gin.H{
-		"user": user.ToAuthUser(),
-	})
+	// Return user data, flagged when an admin is viewing it
+	response := gin.H{"user": user.ToAuthUser()}
+	if impersonation := impersonationInfo(c); impersonation != nil {
+		response["impersonation"] = impersonation
+	}
+	c.JSON(http.StatusOK, response)
 }
 
-// RefreshToken refreshes the JWT token
+// RefreshToken exchanges the refresh token cookie for a new access token and
+// a rotated refresh token. It needs no access token, so it keeps working
+// after the access token has expired.
 func (ac *AuthController) RefreshToken(c *gin.Context) {
-	// Get user ID from context (set by AuthMiddleware)
-	userID, exists := c.Get("userID")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+	if ac.refreshTokens == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Token refresh is not available"})
 		return
 	}
 
-	// Convert interface{} to int
-	id, ok := userID.(float64)
-	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+	raw, err := c.Cookie(refreshTokenCookie)
+	if err != nil || raw == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token required"})
 		return
 	}
 
-	// Get user from database
-	var user *models.User
-	var err error
-
-	if ac.userService != nil {
-		user, err = ac.userService.FindByID(c.Request.Context(), int(id))
-	} else {
-		user, err = ac.userRepo.FindByID(c.Request.Context(), int(id))
+	newRaw, token, err := ac.refreshTokens.Rotate(c.Request.Context(), raw)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRefreshTokenReused):
+			ac.clearRefreshTokenCookie(c)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has already been used; please log in again"})
+		case errors.Is(err, models.ErrRefreshTokenInvalid), errors.Is(err, models.ErrRefreshTokenExpired):
+			ac.clearRefreshTokenCookie(c)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+		default:
+			log.Printf("Error rotating refresh token: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		}
+		return
 	}
 
+	user, err := ac.userService.FindByID(c.Request.Context(), token.UserID)
 	if err != nil {
 		if errors.Is(err, repositories.ErrUserNotFound) {
+			ac.clearRefreshTokenCookie(c)
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 			return
 		}
@@ -357,20 +733,40 @@ func (ac *AuthController) RefreshToken(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
 		return
 	}
+	if user.IsDisabled() {
+		ac.clearRefreshTokenCookie(c)
+		ac.rejectDisabled(c, user)
+		return
+	}
 
-	// Generate new JWT token
-	token, err := ac.generateJWT(user)
+	// Access tokens from this refresh belong to the same session
+	var sessionID string
+	if ac.sessions != nil {
+		sessionID, err = ac.sessions.Refreshed(c.Request.Context(), token, c.Request.UserAgent(), c.ClientIP())
+		if err != nil {
+			if errors.Is(err, models.ErrSessionNotFound) {
+				ac.clearRefreshTokenCookie(c)
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has ended; please log in again"})
+				return
+			}
+			log.Printf("Error recording session refresh: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+			return
+		}
+	}
+
+	accessToken, err := ac.generateAccessToken(user, token.MFA, sessionID)
 	if err != nil {
-		log.Printf("Error generating JWT: %v", err)
+		log.Printf("Error generating access token: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
 		return
 	}
 
-	// Set cookie
-	ac.setAuthCookie(c, token)
+	ac.setRefreshTokenCookie(c, newRaw)
+	ac.setAuthCookie(c, accessToken)
 
 	c.JSON(http.StatusOK, gin.H{
-		"token": token,
+		"token": accessToken,
 		"user":  user.ToAuthUser(),
 	})
 }
@@ -389,28 +785,11 @@ func (ac *AuthController) GetCSRFToken(c *gin.Context) {
 	})
 }
 
-// generateJWT generates a JWT token for the given user
-func (ac *AuthController) generateJWT(user *models.User) (string, error) {
-	// Create claims
-	expirationTime := time.Now().Add(ac.config.JWTExpiryDuration())
-	claims := jwt.MapClaims{
-		"sub":  user.ID,
-		"name": user.Username,
-		"role": user.Role,
-		"iat":  time.Now().Unix(),
-		"exp":  expirationTime.Unix(),
-	}
-
-	// Create token with claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	// Sign token with secret key
-	tokenString, err := token.SignedString([]byte(ac.config.JWTSecret))
-	if err != nil {
-		return "", fmt.Errorf("failed to sign token: %v", err)
-	}
-
-	return tokenString, nil
+// GetJWKS publishes the public keys that verify access tokens, so other
+// services can validate them without sharing a secret
+func (ac *AuthController) GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.JSON(http.StatusOK, ac.tokens.JWKS())
 }
 
 // setAuthCookie sets the authentication cookie
@@ -419,14 +798,20 @@ func (ac *AuthController) setAuthCookie(c *gin.Context, token string) {
 	c.SetCookie(
 		"auth_token",
 		token,
-		3600*ac.config.JWTExpiryHours, // Cookie expiry time in seconds
-		"/",                           // Path
-		ac.config.CookieDomain,        // Domain
-		true,                          // Secure flag (HTTPS only)
-		true,                          // HttpOnly (not accessible via JavaScript)
+		int(ac.tokens.AccessTokenTTL().Seconds()), // Cookie expiry time in seconds
+		"/",                    // Path
+		ac.config.CookieDomain, // Domain
+		true,                   // Secure flag (HTTPS only)
+		true,                   // HttpOnly (not accessible via JavaScript)
 	)
 }
 
+// clearAuthCookie removes the access token cookie
+func (ac *AuthController) clearAuthCookie(c *gin.Context) {
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie("auth_token", "", -1, "/", ac.config.CookieDomain, true, true)
+}
+
 // validationErrors formats validation errors for better readability
 func validationErrors(err error) interface{} {
 	if err == nil {
@@ -439,56 +824,16 @@ func validationErrors(err error) interface{} {
 	return err.Error()
 }
 
-// calculateDailyCalorieGoal calculates the user's daily calorie goal
-func calculateDailyCalorieGoal(weight, height float64, gender string, age int, activityLevel, goalType string) int {
-	// Height is already in centimeters, no need to convert
-	heightInCm := height
-
-	// Basic BMR calculation (Mifflin-St Jeor Equation)
-	var bmr float64
-	if gender == "male" {
-		bmr = 10*weight + 6.25*heightInCm - 5*float64(age) + 5
-	} else {
-		bmr = 10*weight + 6.25*heightInCm - 5*float64(age) - 161
-	}
-
-	// Activity multiplier
-	activityMultiplier := 1.2 // sedentary
-	switch activityLevel {
-	case "light":
-		activityMultiplier = 1.375
-	case "moderate":
-		activityMultiplier = 1.55
-	case "active":
-		activityMultiplier = 1.725
-	case "very_active":
-		activityMultiplier = 1.9
-	}
-
-	// Calculate TDEE (Total Daily Energy Expenditure)
-	tdee := bmr * activityMultiplier
-
-	// Adjust based on goal
-	switch goalType {
-	case "lose":
-		tdee -= 500 // 500 calorie deficit
-	case "gain":
-		tdee += 500 // 500 calorie surplus
-	}
-
-	return int(tdee)
-}
-
-// generateAuthTokens generates access and refresh tokens for a user
-func (ac *AuthController) generateAuthTokens(user *models.User) (string, string, error) {
-	// Generate access token
-	accessToken, err := ac.generateAccessToken(user)
+// generateAuthTokens starts a new session for a user and returns an access
+// token for it with the session's first refresh token. The refresh token is
+// empty when rotation is not configured.
+func (ac *AuthController) generateAuthTokens(c *gin.Context, user *models.User, mfa bool) (string, string, error) {
+	refreshToken, sessionID, err := ac.startSession(c, user.ID, mfa)
 	if err != nil {
 		return "", "", err
 	}
 
-	// Generate refresh token
-	refreshToken, err := ac.generateRefreshToken(user)
+	accessToken, err := ac.generateAccessToken(user, mfa, sessionID)
 	if err != nil {
 		return "", "", err
 	}
@@ -496,37 +841,55 @@ func (ac *AuthController) generateAuthTokens(user *models.User) (string, string,
 	return accessToken, refreshToken, nil
 }
 
-// generateAccessToken generates a JWT access token for a user
-func (ac *AuthController) generateAccessToken(user *models.User) (string, error) {
-	claims := jwt.MapClaims{
-		"sub":   user.ID,
-		"email": user.Email,
-		"role":  user.Role,
-		"exp":   time.Now().Add(time.Hour * 24).Unix(), // 24 hours
+// startSession starts a refresh token family for a login and records it as a
+// session with the client's device and address. It returns the first
+// refresh token and the session ID, both empty when rotation is not
+// configured; the session ID is also empty when sessions are not recorded.
+func (ac *AuthController) startSession(c *gin.Context, userID int, mfa bool) (string, string, error) {
+	ctx := c.Request.Context()
+
+	if ac.sessions != nil {
+		refreshToken, session, err := ac.sessions.Start(ctx, userID, mfa, c.Request.UserAgent(), c.ClientIP())
+		if err != nil {
+			return "", "", err
+		}
+		return refreshToken, session.ID, nil
+	}
+
+	if ac.refreshTokens == nil {
+		return "", "", nil
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(ac.config.JWTSecret))
+	refreshToken, _, err := ac.refreshTokens.Issue(ctx, userID, mfa)
+	return refreshToken, "", err
 }
 
-// generateRefreshToken generates a JWT refresh token for a user
-func (ac *AuthController) generateRefreshToken(user *models.User) (string, error) {
-	claims := jwt.MapClaims{
-		"sub":  user.ID,
-		"type": "refresh",
-		"exp":  time.Now().Add(time.Hour * 24 * 7).Unix(), // 7 days
+// revokeAllSessions ends every session of a user, or revokes their refresh
+// tokens when sessions are not recorded
+func (ac *AuthController) revokeAllSessions(ctx context.Context, userID int) error {
+	if ac.sessions != nil {
+		return ac.sessions.RevokeAll(ctx, userID)
 	}
+	return ac.refreshTokens.RevokeAll(ctx, userID)
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(ac.config.JWTSecret))
+// generateAccessToken generates a JWT access token for a user in a session
+func (ac *AuthController) generateAccessToken(user *models.User, mfa bool, sessionID string) (string, error) {
+	token, _, err := ac.tokens.IssueAccessToken(user.ID, user.Email, user.Role, mfa, sessionID)
+	return token, err
 }
 
 // setRefreshTokenCookie sets the refresh token in an HTTP-only cookie
 func (ac *AuthController) setRefreshTokenCookie(c *gin.Context, token string) {
+	if token == "" {
+		return
+	}
+
+	c.SetSameSite(http.SameSiteStrictMode)
 	c.SetCookie(
-		"refresh_token",
+		refreshTokenCookie,
 		token,
-		7*24*60*60, // 7 days
+		int(ac.refreshTokens.TTL().Seconds()),
 		"/",
 		"",
 		true, // secure
@@ -534,37 +897,43 @@ func (ac *AuthController) setRefreshTokenCookie(c *gin.Context, token string) {
 	)
 }
 
+// clearRefreshTokenCookie removes the refresh token cookie
+func (ac *AuthController) clearRefreshTokenCookie(c *gin.Context) {
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(refreshTokenCookie, "", -1, "/", "", true, true)
+}
+
 // GetUserGoals handles retrieving user goals
 func (ac *AuthController) GetUserGoals(c *gin.Context) {
 	// Get user ID from context (set by AuthMiddleware)
-	userIDValue, exists := c.Get("userID")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		return
-	}
-
-	// Convert to float64 then int as JWT claims are stored as float64
-	userIDFloat, ok := userIDValue.(float64)
+	userID, ok := currentUserID(c)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
 		return
 	}
 
-	userID := int(userIDFloat)
-	if userID == 0 {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		return
+	// Targets can vary by weekday and day tag, so goals are resolved for a date
+	date := time.Now()
+	if dateStr := c.Query("date"); dateStr != "" {
+		parsed, err := time.Parse("2006-01-02", dateStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format. Use YYYY-MM-DD"})
+			return
+		}
+		date = parsed
 	}
 
-	var goals *models.UserGoals
-	var err error
-
 	if ac.userService != nil {
-		goals, err = ac.userService.GetUserGoals(c.Request.Context(), userID)
-	} else {
-		goals, err = ac.userRepo.GetUserGoals(c.Request.Context(), userID)
+		goals, err := ac.userService.GetEffectiveGoals(c.Request.Context(), userID, date)
+		if err != nil {
+			log.Printf("Error getting user goals: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user goals"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"goals": goals})
+		return
 	}
 
+	goals, err := ac.userRepo.GetUserGoals(c.Request.Context(), userID)
 	if err != nil {
 		log.Printf("Error getting user goals: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user goals"})
@@ -577,22 +946,8 @@ func (ac *AuthController) GetUserGoals(c *gin.Context) {
 // UpdateUserGoals handles updating user goals
 func (ac *AuthController) UpdateUserGoals(c *gin.Context) {
 	// Get user ID from context (set by AuthMiddleware)
-	userIDValue, exists := c.Get("userID")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		return
-	}
-
-	// Convert to float64 then int as JWT claims are stored as float64
-	userIDFloat, ok := userIDValue.(float64)
+	userID, ok := currentUserID(c)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
-		return
-	}
-
-	userID := int(userIDFloat)
-	if userID == 0 {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
 
@@ -605,8 +960,12 @@ func (ac *AuthController) UpdateUserGoals(c *gin.Context) {
 	// Ensure the user ID matches
 	goals.UserID = userID
 
+	var before *models.UserGoals
 	var err error
 	if ac.userService != nil {
+		if before, err = ac.userService.GetUserGoals(c.Request.Context(), userID); err != nil {
+			log.Printf("Error loading user goals: %v", err)
+		}
 		err = ac.userService.UpdateUserGoals(c.Request.Context(), &goals)
 	} else {
 		err = ac.userRepo.UpdateUserGoals(c.Request.Context(), &goals)
@@ -618,92 +977,13 @@ func (ac *AuthController) UpdateUserGoals(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Goals updated successfully", "goals": goals})
-}
-
-// RecalculateAllUserGoals updates the macronutrient targets for all users
-func (ac *AuthController) RecalculateAllUserGoals(c *gin.Context) {
-	// Only allow admin users to access this endpoint
-	userRole, exists := c.Get("userRole")
-	if !exists || userRole != models.RoleAdmin {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
-		return
-	}
-
-	// Get users one by one using the repository methods
-	// This is a bit slower but avoids direct DB access
-	// Get user IDs first (assuming we have at least one user with ID 1)
-	maxUserID := 100 // Reasonable upper limit for user IDs
-	updatedCount := 0
-	failedCount := 0
-
-	// Process each potential user ID
-	for userID := 1; userID <= maxUserID; userID++ {
-		// Try to find the user
-		user, err := ac.userRepo.FindByID(c.Request.Context(), userID)
-		if err != nil {
-			// Skip if user not found
-			if errors.Is(err, repositories.ErrUserNotFound) {
-				continue
-			}
-			// Log other errors
-			log.Printf("Error finding user %d: %v", userID, err)
-			failedCount++
-			continue
-		}
-
-		// Calculate macronutrient targets based on goal type
-		var targetProtein, targetCarbs, targetFats float64
-		caloriesFromProtein := 4.0 // 4 calories per gram of protein
-		caloriesFromCarbs := 4.0   // 4 calories per gram of carbs
-		caloriesFromFats := 9.0    // 9 calories per gram of fat
-
-		switch user.GoalType {
-		case "lose":
-			// For weight loss: protein 35%, fats 35%, carbs 30%
-			targetProtein = float64(user.DailyCalorieGoal) * 0.35 / caloriesFromProtein
-			targetFats = float64(user.DailyCalorieGoal) * 0.35 / caloriesFromFats
-			targetCarbs = float64(user.DailyCalorieGoal) * 0.30 / caloriesFromCarbs
-		case "maintain":
-			// For weight maintenance: protein 25%, fats 25%, carbs 50%
-			targetProtein = float64(user.DailyCalorieGoal) * 0.25 / caloriesFromProtein
-			targetFats = float64(user.DailyCalorieGoal) * 0.25 / caloriesFromFats
-			targetCarbs = float64(user.DailyCalorieGoal) * 0.50 / caloriesFromCarbs
-		case "gain":
-			// For weight gain: protein 30%, fats 25%, carbs 45%
-			targetProtein = float64(user.DailyCalorieGoal) * 0.30 / caloriesFromProtein
-			targetFats = float64(user.DailyCalorieGoal) * 0.25 / caloriesFromFats
-			targetCarbs = float64(user.DailyCalorieGoal) * 0.45 / caloriesFromCarbs
-		default:
-			// Default to maintenance if goal type is invalid
-			targetProtein = float64(user.DailyCalorieGoal) * 0.25 / caloriesFromProtein
-			targetFats = float64(user.DailyCalorieGoal) * 0.25 / caloriesFromFats
-			targetCarbs = float64(user.DailyCalorieGoal) * 0.50 / caloriesFromCarbs
-		}
-
-		// Create or update user goals
-		goals := &models.UserGoals{
-			UserID:         user.ID,
-			TargetCalories: user.DailyCalorieGoal,
-			TargetProtein:  targetProtein,
-			TargetCarbs:    targetCarbs,
-			TargetFats:     targetFats,
-			TargetWeight:   user.Weight,
-		}
-
-		// Use the repository's UpdateUserGoals method
-		err = ac.userRepo.UpdateUserGoals(c.Request.Context(), goals)
-		if err != nil {
-			log.Printf("Error updating goals for user %d: %v", user.ID, err)
-			failedCount++
-		} else {
-			updatedCount++
-		}
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"message": "User goals recalculated",
-		"updated": updatedCount,
-		"failed":  failedCount,
+	recordAudit(c, ac.audit, models.AuditEvent{
+		ActorID:   userID,
+		SubjectID: userID,
+		Action:    models.AuditGoalsUpdated,
+		Before:    before,
+		After:     goals,
 	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Goals updated successfully", "goals": goals})
 }
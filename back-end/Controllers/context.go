@@ -0,0 +1,40 @@
+package Controllers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	middleware "HabitBite/backend/Middleware"
+	models "HabitBite/backend/Models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// currentUserID returns the authenticated user's ID, writing a 401 response if it is missing
+func currentUserID(c *gin.Context) (int, bool) {
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return 0, false
+	}
+	return userID, true
+}
+
+// recordAudit stores an audit event with the client's IP address and user agent
+func recordAudit(c *gin.Context, audit *models.AuditService, event models.AuditEvent) {
+	event.IPAddress = c.ClientIP()
+	event.UserAgent = c.Request.UserAgent()
+	audit.Record(c.Request.Context(), event)
+}
+
+// writeThrottled writes a 429 response telling the client how long to wait
+func writeThrottled(c *gin.Context, wait time.Duration, message string) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":      message,
+		"retryAfter": seconds,
+	})
+}
@@ -0,0 +1,62 @@
+package Controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	models "HabitBite/backend/Models"
+	repositories "HabitBite/backend/Repositories"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LinkDietitian links the current user to a dietitian, giving the dietitian
+// access to the user's nutrition settings
+func (nc *NutritionController) LinkDietitian(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	dietitianID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dietitian ID"})
+		return
+	}
+
+	if err := nc.userService.AssignDietitian(c.Request.Context(), userID, dietitianID); err != nil {
+		if errors.Is(err, repositories.ErrUserNotFound) || errors.Is(err, models.ErrNotADietitian) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Dietitian not found"})
+			return
+		}
+		log.Printf("Error linking dietitian: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link dietitian"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Dietitian linked"})
+}
+
+// UnlinkDietitian removes the current user's link to a dietitian
+func (nc *NutritionController) UnlinkDietitian(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	dietitianID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dietitian ID"})
+		return
+	}
+
+	if err := nc.userService.UnassignDietitian(c.Request.Context(), userID, dietitianID); err != nil {
+		log.Printf("Error unlinking dietitian: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlink dietitian"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
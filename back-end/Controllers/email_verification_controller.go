@@ -0,0 +1,113 @@
+package Controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	models "HabitBite/backend/Models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EmailVerificationController handles email address verification
+type EmailVerificationController struct {
+	verifications *models.EmailVerificationService
+}
+
+// NewEmailVerificationController creates a new EmailVerificationController
+func NewEmailVerificationController(verifications *models.EmailVerificationService) *EmailVerificationController {
+	return &EmailVerificationController{
+		verifications: verifications,
+	}
+}
+
+// VerifyEmailRequest represents the request body for verifying an email address
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required,max=2048"`
+}
+
+// VerifyEmail marks an email address as verified using the token from a verification link
+func (vc *EmailVerificationController) VerifyEmail(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": validationErrors(err),
+		})
+		return
+	}
+
+	user, err := vc.verifications.Verify(c.Request.Context(), req.Token)
+	if err != nil {
+		if errors.Is(err, models.ErrEmailVerificationInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification link"})
+			return
+		}
+		log.Printf("Error verifying email: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Email verified",
+		"user":    user.ToAuthUser(),
+	})
+}
+
+// ResendVerification sends a new verification link to the current user
+func (vc *EmailVerificationController) ResendVerification(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := vc.verifications.ResendVerification(c.Request.Context(), userID); err != nil {
+		if errors.Is(err, models.ErrEmailAlreadyVerified) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email is already verified"})
+			return
+		}
+		log.Printf("Error resending verification email: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Verification email sent"})
+}
+
+// ConfirmEmailChangeRequest represents the request body for confirming a new email address
+type ConfirmEmailChangeRequest struct {
+	Token string `json:"token" binding:"required,max=2048"`
+}
+
+// ConfirmEmailChange moves the account to the new address using the token
+// from an email change link
+func (vc *EmailVerificationController) ConfirmEmailChange(c *gin.Context) {
+	var req ConfirmEmailChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": validationErrors(err),
+		})
+		return
+	}
+
+	user, err := vc.verifications.ConfirmEmailChange(c.Request.Context(), req.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEmailChangeInvalid):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired email change link"})
+		case errors.Is(err, models.ErrEmailInUse):
+			c.JSON(http.StatusConflict, gin.H{"error": "Email address is already in use"})
+		default:
+			log.Printf("Error confirming email change: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change email"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Email changed",
+		"user":    user.ToAuthUser(),
+	})
+}
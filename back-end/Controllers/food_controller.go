@@ -0,0 +1,127 @@
+package Controllers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	models "HabitBite/backend/Models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxFoodSearchLimit caps the number of foods returned by one search
+const maxFoodSearchLimit = 100
+
+// FoodController handles the food catalog
+type FoodController struct {
+	catalog *models.FoodCatalogService
+}
+
+// NewFoodController creates a new FoodController
+func NewFoodController(catalog *models.FoodCatalogService) *FoodController {
+	return &FoodController{
+		catalog: catalog,
+	}
+}
+
+// SearchFoods searches the catalog by name. Pass excludeConflicts=true to
+// leave out foods that conflict with the current user's diet profile.
+func (fc *FoodController) SearchFoods(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Search query is required"})
+		return
+	}
+
+	limit := 0
+	if s := c.Query("limit"); s != "" {
+		parsed, err := strconv.Atoi(s)
+		if err != nil || parsed <= 0 || parsed > maxFoodSearchLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Limit must be between 1 and 100"})
+			return
+		}
+		limit = parsed
+	}
+
+	excludeConflicts := c.Query("excludeConflicts") == "true"
+
+	foods, err := fc.catalog.SearchFoods(c.Request.Context(), userID, query, limit, excludeConflicts)
+	if err != nil {
+		log.Printf("Error searching foods: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search foods"})
+		return
+	}
+
+	if foods == nil {
+		foods = []*models.Food{}
+	}
+
+	c.JSON(http.StatusOK, foods)
+}
+
+// GetFood returns a catalog food with any conflicts for the current user
+func (fc *FoodController) GetFood(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	food, warnings, err := fc.catalog.GetFood(c.Request.Context(), userID, c.Param("id"))
+	if err != nil {
+		log.Printf("Error getting food: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get food"})
+		return
+	}
+	if food == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Food not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"food": food, "warnings": warnings})
+}
+
+// SaveFood adds or updates a catalog food and its diet and allergen flags
+func (fc *FoodController) SaveFood(c *gin.Context) {
+	foodID := strings.TrimSpace(c.Param("id"))
+	if foodID == "" || len(foodID) > 50 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid food ID"})
+		return
+	}
+
+	var req models.FoodRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": validationErrors(err),
+		})
+		return
+	}
+
+	food := &models.Food{
+		FoodID:       foodID,
+		Name:         req.Name,
+		Calories:     req.Calories,
+		Protein:      req.Protein,
+		Carbs:        req.Carbs,
+		Fat:          req.Fat,
+		Vegetarian:   req.Vegetarian,
+		Vegan:        req.Vegan,
+		KetoFriendly: req.KetoFriendly,
+		Allergens:    req.Allergens,
+	}
+
+	if err := fc.catalog.SaveFood(c.Request.Context(), food); err != nil {
+		log.Printf("Error saving food: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save food"})
+		return
+	}
+
+	c.JSON(http.StatusOK, food)
+}
@@ -2,10 +2,12 @@ package Controllers
 
 import (
 	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 	"time"
 
+	middleware "HabitBite/backend/Middleware"
 	models "HabitBite/backend/Models"
 	repositories "HabitBite/backend/Repositories"
 
@@ -15,6 +17,9 @@ import (
 // FoodEntryController handles food entry-related operations
 type FoodEntryController struct {
 	foodEntryRepo repositories.FoodEntryRepository
+	userService   *models.UserService
+	catalog       *models.FoodCatalogService
+	audit         *models.AuditService
 }
 
 // NewFoodEntryController creates a new FoodEntryController
@@ -24,11 +29,30 @@ func NewFoodEntryController(repo repositories.FoodEntryRepository) *FoodEntryCon
 	}
 }
 
+// NewFoodEntryControllerWithService creates a new FoodEntryController that
+// also reports the goals in effect on each day, warns about foods that
+// conflict with the user's diet profile and audits deleted entries
+func NewFoodEntryControllerWithService(repo repositories.FoodEntryRepository, service *models.UserService,
+	catalog *models.FoodCatalogService, audit *models.AuditService) *FoodEntryController {
+	return &FoodEntryController{
+		foodEntryRepo: repo,
+		userService:   service,
+		catalog:       catalog,
+		audit:         audit,
+	}
+}
+
+// FoodEntryResponse is a logged food entry with any diet or allergen warnings
+type FoodEntryResponse struct {
+	*models.FoodEntry
+	Warnings []models.DietWarning `json:"warnings,omitempty"`
+}
+
 // AddFoodEntry adds a new food entry for the current user
 func (c *FoodEntryController) AddFoodEntry(ctx *gin.Context) {
 	// Get user ID from context (set by AuthMiddleware)
-	userID, exists := ctx.Get("userID")
-	if !exists {
+	userID, ok := middleware.UserID(ctx)
+	if !ok {
 		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
 		return
 	}
@@ -41,7 +65,7 @@ func (c *FoodEntryController) AddFoodEntry(ctx *gin.Context) {
 
 	// Create food entry with provided nutrition values
 	entry := &models.FoodEntry{
-		UserID:   int(userID.(float64)),
+		UserID:   userID,
 		FoodID:   req.FoodID,
 		Name:     req.Name,
 		Amount:   req.Amount,
@@ -57,13 +81,24 @@ func (c *FoodEntryController) AddFoodEntry(ctx *gin.Context) {
 		return
 	}
 
-	ctx.JSON(http.StatusCreated, entry)
+	response := FoodEntryResponse{FoodEntry: entry}
+
+	// Conflicts are reported, not enforced; the entry is already logged
+	if c.catalog != nil {
+		warnings, err := c.catalog.CheckFood(ctx.Request.Context(), entry.UserID, entry.FoodID)
+		if err != nil {
+			log.Printf("Error checking food %s against diet profile: %v", entry.FoodID, err)
+		}
+		response.Warnings = warnings
+	}
+
+	ctx.JSON(http.StatusCreated, response)
 }
 
 // GetDailyEntries retrieves all food entries for a user on a specific date
 func (c *FoodEntryController) GetDailyEntries(ctx *gin.Context) {
-	userID, exists := ctx.Get("userID")
-	if !exists {
+	userID, ok := middleware.UserID(ctx)
+	if !ok {
 		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
 		return
 	}
@@ -86,7 +121,7 @@ func (c *FoodEntryController) GetDailyEntries(ctx *gin.Context) {
 	// Show date in UTC to avoid timezone issues
 	fmt.Printf("[DEBUG GetDailyEntries] Parsed date in UTC: %s\n", date.UTC().Format("2006-01-02"))
 
-	entries, err := c.foodEntryRepo.GetDailyEntries(ctx.Request.Context(), int(userID.(float64)), date)
+	entries, err := c.foodEntryRepo.GetDailyEntries(ctx.Request.Context(), userID, date)
 	if err != nil {
 		fmt.Printf("[ERROR GetDailyEntries] Error fetching entries: %v\n", err)
 		ctx.JSON(http.StatusOK, []interface{}{})
@@ -131,8 +166,8 @@ func (c *FoodEntryController) GetDailyEntries(ctx *gin.Context) {
 
 // GetDailyNutrition retrieves the total nutrition for a user on a specific date
 func (c *FoodEntryController) GetDailyNutrition(ctx *gin.Context) {
-	userID, exists := ctx.Get("userID")
-	if !exists {
+	userID, ok := middleware.UserID(ctx)
+	if !ok {
 		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
 		return
 	}
@@ -148,19 +183,25 @@ func (c *FoodEntryController) GetDailyNutrition(ctx *gin.Context) {
 		return
 	}
 
-	nutrition, err := c.foodEntryRepo.GetDailyNutrition(ctx.Request.Context(), int(userID.(float64)), date)
+	nutrition, err := c.foodEntryRepo.GetDailyNutrition(ctx.Request.Context(), userID, date)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get nutrition data"})
 		return
 	}
 
+	if err := c.attachTargets(ctx, userID, []*models.DailyNutrition{nutrition}, date, date); err != nil {
+		log.Printf("Error resolving goals for %s: %v", dateStr, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get nutrition data"})
+		return
+	}
+
 	ctx.JSON(http.StatusOK, nutrition)
 }
 
-// DeleteFoodEntry deletes a food entry
+// DeleteFoodEntry deletes one of the current user's food entries
 func (c *FoodEntryController) DeleteFoodEntry(ctx *gin.Context) {
-	// Verify user is authenticated
-	if _, exists := ctx.Get("userID"); !exists {
+	userID, ok := middleware.UserID(ctx)
+	if !ok {
 		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
 		return
 	}
@@ -171,18 +212,32 @@ func (c *FoodEntryController) DeleteFoodEntry(ctx *gin.Context) {
 		return
 	}
 
-	if err := c.foodEntryRepo.DeleteFoodEntry(ctx.Request.Context(), entryID); err != nil {
+	entry, err := c.foodEntryRepo.DeleteFoodEntry(ctx.Request.Context(), userID, entryID)
+	if err != nil {
+		log.Printf("Error deleting food entry %d: %v", entryID, err)
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete food entry"})
 		return
 	}
+	// Entries of other users are reported as missing rather than forbidden
+	if entry == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Food entry not found"})
+		return
+	}
+
+	recordAudit(ctx, c.audit, models.AuditEvent{
+		ActorID:   userID,
+		SubjectID: userID,
+		Action:    models.AuditEntryDeleted,
+		Before:    entry,
+	})
 
 	ctx.Status(http.StatusNoContent)
 }
 
 // GetNutritionHistory retrieves nutrition data for a date range
 func (c *FoodEntryController) GetNutritionHistory(ctx *gin.Context) {
-	userID, exists := ctx.Get("userID")
-	if !exists {
+	userID, ok := middleware.UserID(ctx)
+	if !ok {
 		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
 		return
 	}
@@ -240,7 +295,7 @@ func (c *FoodEntryController) GetNutritionHistory(ctx *gin.Context) {
 	fmt.Printf("[DEBUG GetNutritionHistory] Fetching history for user_id=%v from %s to %s\n",
 		userID, startDate.Format("2006-01-02 15:04:05"), endDate.Format("2006-01-02 15:04:05"))
 
-	history, err := c.foodEntryRepo.GetNutritionHistory(ctx.Request.Context(), int(userID.(float64)), startDate, endDate)
+	history, err := c.foodEntryRepo.GetNutritionHistory(ctx.Request.Context(), userID, startDate, endDate)
 	if err != nil {
 		// Add detailed logging for debugging
 		fmt.Printf("[ERROR GetNutritionHistory] Error: %v\n", err)
@@ -248,6 +303,12 @@ func (c *FoodEntryController) GetNutritionHistory(ctx *gin.Context) {
 		return
 	}
 
+	if err := c.attachTargets(ctx, userID, history, startDate, endDate); err != nil {
+		log.Printf("Error resolving goals for nutrition history: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get nutrition history"})
+		return
+	}
+
 	// Log the results before sending
 	fmt.Printf("[DEBUG GetNutritionHistory] Returning %d days of nutrition data\n", len(history))
 	for i, day := range history {
@@ -258,3 +319,22 @@ func (c *FoodEntryController) GetNutritionHistory(ctx *gin.Context) {
 
 	ctx.JSON(http.StatusOK, history)
 }
+
+// attachTargets sets the goals in effect on each reported day, so reports
+// compare intake against that day's targets rather than a flat goal
+func (c *FoodEntryController) attachTargets(ctx *gin.Context, userID int, days []*models.DailyNutrition, startDate, endDate time.Time) error {
+	if c.userService == nil || len(days) == 0 {
+		return nil
+	}
+
+	targets, err := c.userService.GetEffectiveGoalsRange(ctx.Request.Context(), userID, startDate, endDate)
+	if err != nil {
+		return err
+	}
+
+	for _, day := range days {
+		day.Targets = targets[day.Date.Format("2006-01-02")]
+	}
+
+	return nil
+}
@@ -0,0 +1,209 @@
+package Controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	models "HabitBite/backend/Models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recentGoalJobs is how many jobs ListJobs returns
+const recentGoalJobs = 20
+
+// GoalJobController handles batch goal recalculation jobs
+type GoalJobController struct {
+	goalJobs *models.GoalRecalculationService
+	audit    *models.AuditService
+}
+
+// NewGoalJobController creates a new GoalJobController
+func NewGoalJobController(goalJobs *models.GoalRecalculationService, audit *models.AuditService) *GoalJobController {
+	return &GoalJobController{goalJobs: goalJobs, audit: audit}
+}
+
+// StartGoalJobRequest represents the request body for starting a recalculation.
+// GoalType limits the job to users with that goal; DryRun only records the
+// changes the job would make.
+type StartGoalJobRequest struct {
+	GoalType string `json:"goalType" binding:"omitempty,oneof=lose maintain gain"`
+	DryRun   bool   `json:"dryRun"`
+}
+
+// goalJobView is a job as returned by the API, with its progress in percent
+type goalJobView struct {
+	*models.GoalRecalculationJob
+	Progress float64 `json:"progress"`
+}
+
+// newGoalJobView wraps a job for a response
+func newGoalJobView(job *models.GoalRecalculationJob) goalJobView {
+	return goalJobView{GoalRecalculationJob: job, Progress: job.Progress()}
+}
+
+// StartJob queues a goal recalculation and returns it straight away; poll
+// GetJob for its progress
+func (gc *GoalJobController) StartJob(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req StartGoalJobRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": validationErrors(err),
+		})
+		return
+	}
+
+	job, err := gc.goalJobs.Start(c.Request.Context(), userID, req.GoalType, req.DryRun)
+	if err != nil {
+		gc.writeError(c, err, "Failed to start goal recalculation")
+		return
+	}
+
+	recordAudit(c, gc.audit, models.AuditEvent{
+		ActorID: userID,
+		Action:  models.AuditGoalsRecalculate,
+		After:   gin.H{"jobId": job.ID, "goalType": job.GoalType, "dryRun": job.DryRun},
+	})
+
+	c.JSON(http.StatusAccepted, gin.H{"job": newGoalJobView(job)})
+}
+
+// ListJobs returns the most recent goal recalculation jobs
+func (gc *GoalJobController) ListJobs(c *gin.Context) {
+	jobs, err := gc.goalJobs.List(c.Request.Context(), recentGoalJobs)
+	if err != nil {
+		log.Printf("Error listing goal recalculation jobs: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list jobs"})
+		return
+	}
+
+	views := make([]goalJobView, len(jobs))
+	for i, job := range jobs {
+		views[i] = newGoalJobView(job)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"jobs": views})
+}
+
+// GetJob returns a job's status and progress
+func (gc *GoalJobController) GetJob(c *gin.Context) {
+	jobID, ok := gc.jobID(c)
+	if !ok {
+		return
+	}
+
+	job, err := gc.goalJobs.Get(c.Request.Context(), jobID)
+	if err != nil {
+		gc.writeError(c, err, "Failed to load job")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"job": newGoalJobView(job)})
+}
+
+// ListChanges returns the goals a job changed, or would change in a dry
+// run, as before and after values. It accepts page and limit.
+func (gc *GoalJobController) ListChanges(c *gin.Context) {
+	jobID, ok := gc.jobID(c)
+	if !ok {
+		return
+	}
+
+	page := 1
+	if s := c.Query("page"); s != "" {
+		parsed, err := strconv.Atoi(s)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Page must be a positive number"})
+			return
+		}
+		page = parsed
+	}
+	limit := models.DefaultGoalChangeLimit
+	if s := c.Query("limit"); s != "" {
+		parsed, err := strconv.Atoi(s)
+		if err != nil || parsed <= 0 || parsed > models.MaxGoalChangeLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Limit must be between 1 and 500"})
+			return
+		}
+		limit = parsed
+	}
+
+	changes, total, err := gc.goalJobs.Changes(c.Request.Context(), jobID, limit, (page-1)*limit)
+	if err != nil {
+		gc.writeError(c, err, "Failed to load changes")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"changes": changes,
+		"total":   total,
+		"page":    page,
+		"limit":   limit,
+	})
+}
+
+// CancelJob stops a pending or running job
+func (gc *GoalJobController) CancelJob(c *gin.Context) {
+	jobID, ok := gc.jobID(c)
+	if !ok {
+		return
+	}
+
+	job, err := gc.goalJobs.Cancel(c.Request.Context(), jobID)
+	if err != nil {
+		gc.writeError(c, err, "Failed to cancel job")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"job": newGoalJobView(job)})
+}
+
+// ResumeJob queues a failed or cancelled job again; it continues after the
+// last user it finished
+func (gc *GoalJobController) ResumeJob(c *gin.Context) {
+	jobID, ok := gc.jobID(c)
+	if !ok {
+		return
+	}
+
+	job, err := gc.goalJobs.Resume(c.Request.Context(), jobID)
+	if err != nil {
+		gc.writeError(c, err, "Failed to resume job")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"job": newGoalJobView(job)})
+}
+
+// writeError maps goal recalculation errors to responses
+func (gc *GoalJobController) writeError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, models.ErrInvalidGoalType):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrGoalJobNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+	case errors.Is(err, models.ErrGoalJobNotActive), errors.Is(err, models.ErrGoalJobNotStopped):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		log.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
+
+// jobID parses the :id parameter
+func (gc *GoalJobController) jobID(c *gin.Context) (int, bool) {
+	jobID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return 0, false
+	}
+	return jobID, true
+}
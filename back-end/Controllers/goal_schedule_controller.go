@@ -0,0 +1,186 @@
+package Controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	models "HabitBite/backend/Models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetGoalSchedule returns the current user's weekday and day-tag overrides
+func (nc *NutritionController) GetGoalSchedule(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	overrides, err := nc.userService.GetGoalSchedule(c.Request.Context(), userID)
+	if err != nil {
+		log.Printf("Error getting goal schedule: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get goal schedule"})
+		return
+	}
+
+	if overrides == nil {
+		overrides = []*models.GoalOverride{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"overrides": overrides})
+}
+
+// UpdateGoalSchedule replaces the current user's weekday and day-tag overrides.
+// An empty list returns the user to flat daily targets.
+func (nc *NutritionController) UpdateGoalSchedule(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req models.GoalScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": validationErrors(err),
+		})
+		return
+	}
+
+	before, err := nc.userService.GetGoalSchedule(c.Request.Context(), userID)
+	if err != nil {
+		log.Printf("Error getting goal schedule: %v", err)
+	}
+
+	if err := nc.userService.UpdateGoalSchedule(c.Request.Context(), userID, req.Overrides); err != nil {
+		if errors.Is(err, models.ErrInvalidGoalSchedule) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Error updating goal schedule: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update goal schedule"})
+		return
+	}
+
+	recordAudit(c, nc.audit, models.AuditEvent{
+		ActorID:   userID,
+		SubjectID: userID,
+		Action:    models.AuditGoalsUpdated,
+		Before:    gin.H{"overrides": before},
+		After:     gin.H{"overrides": req.Overrides},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Goal schedule updated", "overrides": req.Overrides})
+}
+
+// GetDayTags lists the current user's day tags for a date range (default: the next 7 days)
+func (nc *NutritionController) GetDayTags(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	startDate := time.Now()
+	endDate := startDate.AddDate(0, 0, 6)
+
+	if s := c.Query("startDate"); s != "" {
+		parsed, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start date format. Use YYYY-MM-DD"})
+			return
+		}
+		startDate = parsed
+	}
+	if s := c.Query("endDate"); s != "" {
+		parsed, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end date format. Use YYYY-MM-DD"})
+			return
+		}
+		endDate = parsed
+	}
+
+	if endDate.Before(startDate) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "End date must be after start date"})
+		return
+	}
+
+	tags, err := nc.userService.GetDayTags(c.Request.Context(), userID, startDate, endDate)
+	if err != nil {
+		log.Printf("Error getting day tags: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get day tags"})
+		return
+	}
+
+	if tags == nil {
+		tags = []*models.DayTag{}
+	}
+
+	c.JSON(http.StatusOK, tags)
+}
+
+// SetDayTag tags a day (e.g. "training") for the current user
+func (nc *NutritionController) SetDayTag(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	date, err := time.Parse("2006-01-02", c.Param("date"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format. Use YYYY-MM-DD"})
+		return
+	}
+
+	var req models.DayTagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": validationErrors(err),
+		})
+		return
+	}
+
+	if err := nc.userService.SetDayTag(c.Request.Context(), userID, date, req.Tag); err != nil {
+		if errors.Is(err, models.ErrInvalidGoalSchedule) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Error setting day tag: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set day tag"})
+		return
+	}
+
+	goals, err := nc.userService.GetEffectiveGoals(c.Request.Context(), userID, date)
+	if err != nil {
+		log.Printf("Error resolving goals after tagging day: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve goals"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Day tagged", "goals": goals})
+}
+
+// DeleteDayTag removes the tag from a day for the current user
+func (nc *NutritionController) DeleteDayTag(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	date, err := time.Parse("2006-01-02", c.Param("date"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format. Use YYYY-MM-DD"})
+		return
+	}
+
+	if err := nc.userService.DeleteDayTag(c.Request.Context(), userID, date); err != nil {
+		log.Printf("Error deleting day tag: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete day tag"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,114 @@
+package Controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	middleware "HabitBite/backend/Middleware"
+	models "HabitBite/backend/Models"
+	repositories "HabitBite/backend/Repositories"
+	tokens "HabitBite/backend/Tokens"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ImpersonationController lets admins view the app as another user
+type ImpersonationController struct {
+	userAdmin *models.UserAdminService
+	tokens    *tokens.Service
+	audit     *models.AuditService
+}
+
+// NewImpersonationController creates a new ImpersonationController
+func NewImpersonationController(userAdmin *models.UserAdminService, tokenService *tokens.Service,
+	audit *models.AuditService) *ImpersonationController {
+	return &ImpersonationController{userAdmin: userAdmin, tokens: tokenService, audit: audit}
+}
+
+// StartImpersonationRequest represents the request body for impersonating a
+// user. Writable allows the token to change the user's data as well.
+type StartImpersonationRequest struct {
+	Reason   string `json:"reason" binding:"required,max=500"`
+	Writable bool   `json:"writable"`
+}
+
+// StartImpersonation issues a short-lived token that acts as the user while
+// naming the admin behind it. The admin sends it as a bearer token; every
+// request made with it is recorded in the audit log.
+func (ic *ImpersonationController) StartImpersonation(c *gin.Context) {
+	adminID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req StartImpersonationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": validationErrors(err),
+		})
+		return
+	}
+
+	user, err := ic.userAdmin.CheckImpersonation(c.Request.Context(), adminID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrImpersonateSelf), errors.Is(err, models.ErrImpersonateAdmin),
+			errors.Is(err, models.ErrImpersonateDisabled):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, repositories.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		default:
+			log.Printf("Error checking impersonation of user %d: %v", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start impersonation"})
+		}
+		return
+	}
+
+	// The token is as strongly authenticated as the admin's own session
+	claims, _ := middleware.TokenClaims(c)
+	mfa := claims != nil && claims.MFA
+
+	token, issued, err := ic.tokens.IssueImpersonationToken(adminID, user.ID, user.Role, mfa, req.Writable)
+	if err != nil {
+		log.Printf("Error issuing impersonation token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start impersonation"})
+		return
+	}
+
+	recordAudit(c, ic.audit, models.AuditEvent{
+		ActorID:   adminID,
+		SubjectID: user.ID,
+		Action:    models.AuditImpersonationStarted,
+		After:     gin.H{"reason": req.Reason, "writable": req.Writable, "tokenId": issued.ID},
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"token":     token,
+		"expiresIn": int(tokens.ImpersonationTTL.Seconds()),
+		"readOnly":  !req.Writable,
+		"user":      user.ToAuthUser(),
+	})
+}
+
+// impersonationInfo describes the impersonation behind the request, or is
+// nil when there is none
+func impersonationInfo(c *gin.Context) gin.H {
+	claims, ok := middleware.TokenClaims(c)
+	if !ok || claims.ImpersonatorID() == 0 {
+		return nil
+	}
+	return gin.H{
+		"adminId":   claims.ImpersonatorID(),
+		"readOnly":  !claims.Writable,
+		"expiresAt": claims.ExpiresAt.Time,
+	}
+}
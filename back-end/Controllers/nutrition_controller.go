@@ -0,0 +1,322 @@
+package Controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	middleware "HabitBite/backend/Middleware"
+	models "HabitBite/backend/Models"
+	nutrition "HabitBite/backend/Nutrition"
+	repositories "HabitBite/backend/Repositories"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NutritionController handles nutrition-planning operations such as macro splits
+type NutritionController struct {
+	userService *models.UserService
+	audit       *models.AuditService
+}
+
+// NewNutritionController creates a new NutritionController. Goal changes
+// are recorded in the audit log.
+func NewNutritionController(service *models.UserService, audit *models.AuditService) *NutritionController {
+	return &NutritionController{
+		userService: service,
+		audit:       audit,
+	}
+}
+
+// MacroPreferenceRequest represents the request body for choosing a macro split.
+// Leave everything empty to return to the default split for the user's goal type.
+type MacroPreferenceRequest struct {
+	Preset       string  `json:"preset" binding:"omitempty,oneof=balanced high_protein keto low_fat custom"`
+	ProteinPct   float64 `json:"proteinPct" binding:"gte=0,lte=100"`
+	CarbsPct     float64 `json:"carbsPct" binding:"gte=0,lte=100"`
+	FatPct       float64 `json:"fatPct" binding:"gte=0,lte=100"`
+	ProteinPerKg float64 `json:"proteinPerKg" binding:"gte=0"`
+}
+
+// toPreference converts the request into a nutrition.MacroPreference
+func (r *MacroPreferenceRequest) toPreference() nutrition.MacroPreference {
+	return nutrition.MacroPreference{
+		Preset: r.Preset,
+		Split: nutrition.MacroSplit{
+			ProteinPct: r.ProteinPct,
+			CarbsPct:   r.CarbsPct,
+			FatPct:     r.FatPct,
+		},
+		ProteinPerKg: r.ProteinPerKg,
+	}
+}
+
+// GetMacroPresets lists the named macro split presets
+func (nc *NutritionController) GetMacroPresets(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"presets": nutrition.Presets(),
+		"goalDefaults": gin.H{
+			models.GoalLose:     nutrition.DefaultSplitForGoal(models.GoalLose),
+			models.GoalMaintain: nutrition.DefaultSplitForGoal(models.GoalMaintain),
+			models.GoalGain:     nutrition.DefaultSplitForGoal(models.GoalGain),
+		},
+	})
+}
+
+// UpdateMacroPreference sets the macro split for the current user
+func (nc *NutritionController) UpdateMacroPreference(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	nc.applyMacroPreference(c, userID, userID)
+}
+
+// UpdateClientMacroPreference lets a dietitian set the macro split for an assigned client
+func (nc *NutritionController) UpdateClientMacroPreference(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	clientID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client ID"})
+		return
+	}
+
+	// Some roles may edit anyone; others only their assigned clients
+	if !middleware.HasPermission(c, models.PermClientsManageAny) {
+		assigned, err := nc.userService.IsAssignedDietitian(c.Request.Context(), userID, clientID)
+		if err != nil {
+			log.Printf("Error checking dietitian assignment: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check client assignment"})
+			return
+		}
+		if !assigned {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Client is not assigned to you"})
+			return
+		}
+	}
+
+	nc.applyMacroPreference(c, userID, clientID)
+}
+
+// applyMacroPreference binds, validates and stores a macro preference that
+// actorID sets for userID
+func (nc *NutritionController) applyMacroPreference(c *gin.Context, actorID, userID int) {
+	var req MacroPreferenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": validationErrors(err),
+		})
+		return
+	}
+
+	before, err := nc.userService.GetUserGoals(c.Request.Context(), userID)
+	if err != nil && !errors.Is(err, repositories.ErrUserNotFound) {
+		log.Printf("Error loading user goals: %v", err)
+	}
+
+	goals, err := nc.userService.UpdateMacroPreference(c.Request.Context(), userID, req.toPreference())
+	if err != nil {
+		if errors.Is(err, repositories.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if isMacroValidationError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		log.Printf("Error updating macro preference: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update macro preference"})
+		return
+	}
+
+	recordAudit(c, nc.audit, models.AuditEvent{
+		ActorID:   actorID,
+		SubjectID: userID,
+		Action:    models.AuditGoalsUpdated,
+		Before:    before,
+		After:     goals,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Macro preference updated successfully", "goals": goals})
+}
+
+// EnergyPreviewQuery holds optional overrides for the energy preview.
+// Anything left out is taken from the user's stored profile.
+type EnergyPreviewQuery struct {
+	Formula       string   `form:"formula" binding:"omitempty,oneof=mifflin_st_jeor harris_benedict katch_mcardle cunningham"`
+	Weight        *float64 `form:"weight" binding:"omitempty,gt=0"`
+	Height        *float64 `form:"height" binding:"omitempty,gt=0"`
+	BodyFat       *float64 `form:"bodyFat" binding:"omitempty,gte=2,lte=70"`
+	ActivityLevel string   `form:"activityLevel" binding:"omitempty,oneof=sedentary light moderate active very_active"`
+	GoalType      string   `form:"goalType" binding:"omitempty,oneof=lose gain maintain"`
+}
+
+// GetEnergyPreview shows the BMR/TDEE breakdown behind the user's calorie goal,
+// along with what every other formula would give for the same profile
+func (nc *NutritionController) GetEnergyPreview(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var query EnergyPreviewQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid query parameters",
+			"details": validationErrors(err),
+		})
+		return
+	}
+
+	user, err := nc.userService.FindByID(c.Request.Context(), userID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrUserNotFound) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+			return
+		}
+		log.Printf("Error finding user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+
+	// Apply overrides to a copy of the stored profile
+	formula := user.EnergyFormula
+	if query.Formula != "" {
+		formula = query.Formula
+	}
+	activityLevel := user.ActivityLevel
+	if query.ActivityLevel != "" {
+		activityLevel = query.ActivityLevel
+	}
+	goalType := user.GoalType
+	if query.GoalType != "" {
+		goalType = query.GoalType
+	}
+	profile := user.BodyProfile(time.Now())
+	if query.Weight != nil {
+		profile.WeightKg = *query.Weight
+	}
+	if query.Height != nil {
+		profile.HeightCm = *query.Height
+	}
+	if query.BodyFat != nil {
+		profile.BodyFatPct = query.BodyFat
+	}
+
+	estimator, err := nutrition.Estimator(formula)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	breakdown, err := nutrition.EstimateEnergy(estimator, profile, activityLevel, goalType)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Compare with every other formula; lean-mass formulas are skipped without body fat
+	alternatives := make([]gin.H, 0)
+	for _, name := range nutrition.FormulaNames() {
+		if name == breakdown.Formula {
+			continue
+		}
+		other, _ := nutrition.Estimator(name)
+		result, err := nutrition.EstimateEnergy(other, profile, activityLevel, goalType)
+		if err != nil {
+			alternatives = append(alternatives, gin.H{"formula": name, "error": err.Error()})
+			continue
+		}
+		alternatives = append(alternatives, gin.H{
+			"formula":        name,
+			"bmr":            result.BMR,
+			"tdee":           result.TDEE,
+			"targetCalories": result.TargetCalories,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"breakdown":          breakdown,
+		"currentCalorieGoal": user.DailyCalorieGoal,
+		"alternatives":       alternatives,
+	})
+}
+
+// isMacroValidationError reports whether err is a user-facing macro validation error
+func isMacroValidationError(err error) bool {
+	for _, target := range []error{
+		nutrition.ErrUnknownPreset,
+		nutrition.ErrInvalidSplit,
+		nutrition.ErrNegativeSplit,
+		nutrition.ErrInvalidProteinKg,
+		nutrition.ErrProteinTooHigh,
+		nutrition.ErrWeightRequired,
+		nutrition.ErrAmbiguousCustom,
+		nutrition.ErrPresetWithPercent,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetDietProfile returns the current user's diet and allergens
+func (nc *NutritionController) GetDietProfile(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	user, err := nc.userService.FindByID(c.Request.Context(), userID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		log.Printf("Error getting diet profile: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get diet profile"})
+		return
+	}
+
+	c.JSON(http.StatusOK, user.DietProfile())
+}
+
+// UpdateDietProfile sets the current user's diet and allergens
+func (nc *NutritionController) UpdateDietProfile(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req models.DietProfile
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": validationErrors(err),
+		})
+		return
+	}
+
+	user, err := nc.userService.UpdateDietProfile(c.Request.Context(), userID, req)
+	if err != nil {
+		if errors.Is(err, repositories.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		log.Printf("Error updating diet profile: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update diet profile"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Diet profile updated", "profile": user.DietProfile()})
+}
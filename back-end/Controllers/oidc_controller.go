@@ -0,0 +1,283 @@
+package Controllers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	config "HabitBite/backend/Config"
+	middleware "HabitBite/backend/Middleware"
+	models "HabitBite/backend/Models"
+	tokens "HabitBite/backend/Tokens"
+
+	"github.com/gin-gonic/gin"
+)
+
+// oidcStateCookie binds a provider sign-in to the browser that started it
+const oidcStateCookie = "oidc_state"
+
+// oidcCookiePath limits the state cookie to the OIDC endpoints
+const oidcCookiePath = "/api/auth/oidc"
+
+// OIDCController handles sign-in and account linking with OpenID Connect providers
+type OIDCController struct {
+	oidc        *models.OIDCService
+	auth        *AuthController
+	userService *models.UserService
+	config      *config.Config
+}
+
+// NewOIDCController creates a new OIDCController. Logins are completed
+// through the AuthController so they get the same tokens and 2FA checks.
+func NewOIDCController(service *models.OIDCService, auth *AuthController, userService *models.UserService, cfg *config.Config) *OIDCController {
+	return &OIDCController{
+		oidc:        service,
+		auth:        auth,
+		userService: userService,
+		config:      cfg,
+	}
+}
+
+// GetProviders lists the providers users can sign in with
+func (oc *OIDCController) GetProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"providers": oc.oidc.Providers()})
+}
+
+// Login redirects the browser to the provider to sign in
+func (oc *OIDCController) Login(c *gin.Context) {
+	authURL, state, err := oc.oidc.Start(c.Request.Context(), c.Param("provider"), 0)
+	if err != nil {
+		oc.writeStartError(c, err)
+		return
+	}
+
+	oc.setStateCookie(c, state)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Link starts linking a provider to the signed-in user and returns the
+// provider URL for the browser to open
+func (oc *OIDCController) Link(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	authURL, state, err := oc.oidc.Start(c.Request.Context(), c.Param("provider"), userID)
+	if err != nil {
+		oc.writeStartError(c, err)
+		return
+	}
+
+	oc.setStateCookie(c, state)
+	c.JSON(http.StatusOK, gin.H{"url": authURL})
+}
+
+// Callback completes a sign-in or link when the provider redirects back.
+// The browser is sent on to the front end: after a sign-in it holds a
+// refresh token cookie and exchanges it for an access token, or, with 2FA
+// enabled, receives a challenge token in the URL fragment.
+func (oc *OIDCController) Callback(c *gin.Context) {
+	provider := c.Param("provider")
+
+	cookieState, _ := c.Cookie(oidcStateCookie)
+	oc.clearStateCookie(c)
+
+	if providerErr := c.Query("error"); providerErr != "" {
+		log.Printf("OIDC provider %s returned error: %s", provider, providerErr)
+		oc.redirectError(c, "access_denied")
+		return
+	}
+
+	state := c.Query("state")
+	code := c.Query("code")
+	if state == "" || code == "" || subtle.ConstantTimeCompare([]byte(state), []byte(cookieState)) != 1 {
+		oc.redirectError(c, "invalid_state")
+		return
+	}
+
+	ctx := c.Request.Context()
+	result, err := oc.oidc.Complete(ctx, provider, state, code)
+	if err != nil {
+		oc.redirectError(c, oidcErrorCode(err))
+		return
+	}
+
+	if result.Linking {
+		c.Redirect(http.StatusFound, oc.config.AppBaseURL+"/settings/account?linked="+url.QueryEscape(provider))
+		return
+	}
+
+	user := result.User
+	callbackURL := oc.config.AppBaseURL + "/auth/callback"
+
+	if user.IsDisabled() {
+		oc.auth.auditLoginFailure(c, user.ID, "", "account_disabled")
+		oc.redirectError(c, "account_disabled")
+		return
+	}
+
+	// With 2FA enabled the provider sign-in only earns a challenge, as a password does
+	if oc.auth.twoFactor != nil {
+		enabled, err := oc.auth.twoFactor.IsEnabled(ctx, user.ID)
+		if err != nil {
+			log.Printf("Error checking two-factor status: %v", err)
+			oc.redirectError(c, "server_error")
+			return
+		}
+		if enabled {
+			challenge, err := oc.auth.tokens.IssueTwoFactorChallenge(user.ID)
+			if err != nil {
+				log.Printf("Error issuing two-factor challenge: %v", err)
+				oc.redirectError(c, "server_error")
+				return
+			}
+			fragment := url.Values{}
+			fragment.Set("twoFactorChallenge", challenge)
+			fragment.Set("expiresIn", strconv.Itoa(int(tokens.TwoFactorChallengeTTL.Seconds())))
+			c.Redirect(http.StatusFound, callbackURL+"#"+fragment.Encode())
+			return
+		}
+	}
+
+	if oc.auth.refreshTokens == nil {
+		log.Printf("OIDC sign-in needs refresh tokens to be configured")
+		oc.redirectError(c, "server_error")
+		return
+	}
+
+	refreshToken, _, err := oc.auth.startSession(c, user.ID, false)
+	if err != nil {
+		log.Printf("Error issuing refresh token: %v", err)
+		oc.redirectError(c, "server_error")
+		return
+	}
+	oc.auth.setRefreshTokenCookie(c, refreshToken)
+
+	if err := middleware.SetCSRFToken(c); err != nil {
+		log.Printf("Error setting CSRF token: %v", err)
+		oc.redirectError(c, "server_error")
+		return
+	}
+
+	recordAudit(c, oc.auth.audit, models.AuditEvent{
+		ActorID:   user.ID,
+		SubjectID: user.ID,
+		Action:    models.AuditLogin,
+		After:     gin.H{"provider": provider, "mfa": false},
+	})
+
+	query := url.Values{}
+	if result.Created {
+		query.Set("created", "true")
+	}
+	if !user.ProfileComplete {
+		query.Set("profileIncomplete", "true")
+	}
+	if len(query) > 0 {
+		callbackURL += "?" + query.Encode()
+	}
+	c.Redirect(http.StatusFound, callbackURL)
+}
+
+// GetIdentities lists the providers linked to the current user
+func (oc *OIDCController) GetIdentities(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	identities, err := oc.oidc.Identities(c.Request.Context(), userID)
+	if err != nil {
+		log.Printf("Error listing linked identities: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list linked accounts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"identities": identities})
+}
+
+// Unlink removes a provider from the current user
+func (oc *OIDCController) Unlink(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	user, err := oc.userService.FindByID(c.Request.Context(), userID)
+	if err != nil {
+		log.Printf("Error finding user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load user"})
+		return
+	}
+
+	if err := oc.oidc.Unlink(c.Request.Context(), user, c.Param("provider")); err != nil {
+		switch {
+		case errors.Is(err, models.ErrOIDCIdentityNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, models.ErrOIDCLastSignInMethod):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			log.Printf("Error unlinking identity: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlink account"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account unlinked"})
+}
+
+// writeStartError maps errors from starting a sign-in to responses
+func (oc *OIDCController) writeStartError(c *gin.Context, err error) {
+	if errors.Is(err, models.ErrOIDCUnknownProvider) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("Error starting OIDC sign-in: %v", err)
+	c.JSON(http.StatusBadGateway, gin.H{"error": "The sign-in provider is unavailable"})
+}
+
+// redirectError sends the browser to the front-end login page with an error code
+func (oc *OIDCController) redirectError(c *gin.Context, code string) {
+	c.Redirect(http.StatusFound, oc.config.AppBaseURL+"/login?error="+url.QueryEscape(code))
+}
+
+// setStateCookie stores the state of a started sign-in. SameSite=Lax lets
+// the cookie travel on the provider's redirect back to the callback.
+func (oc *OIDCController) setStateCookie(c *gin.Context, state string) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, int(models.OIDCFlowTTL.Seconds()), oidcCookiePath, "", true, true)
+}
+
+// clearStateCookie removes the state cookie
+func (oc *OIDCController) clearStateCookie(c *gin.Context) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, "", -1, oidcCookiePath, "", true, true)
+}
+
+// oidcErrorCode maps sign-in errors to the codes the front end understands
+func oidcErrorCode(err error) string {
+	switch {
+	case errors.Is(err, models.ErrOIDCUnknownProvider):
+		return "unknown_provider"
+	case errors.Is(err, models.ErrOIDCInvalidState):
+		return "invalid_state"
+	case errors.Is(err, models.ErrOIDCEmailNotVerified):
+		return "email_not_verified"
+	case errors.Is(err, models.ErrOIDCAccountNotLinked):
+		return "account_not_linked"
+	case errors.Is(err, models.ErrOIDCIdentityInUse):
+		return "identity_in_use"
+	case errors.Is(err, models.ErrOIDCAlreadyLinked):
+		return "already_linked"
+	case errors.Is(err, models.ErrOIDCLoginFailed):
+		log.Printf("OIDC sign-in failed: %v", err)
+		return "login_failed"
+	default:
+		log.Printf("Error completing OIDC sign-in: %v", err)
+		return "server_error"
+	}
+}
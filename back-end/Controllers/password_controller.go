@@ -0,0 +1,115 @@
+package Controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	models "HabitBite/backend/Models"
+	passwords "HabitBite/backend/Passwords"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PasswordController handles forgotten-password recovery and describes the password policy
+type PasswordController struct {
+	resets *models.PasswordResetService
+	policy *passwords.Policy
+}
+
+// NewPasswordController creates a new PasswordController
+func NewPasswordController(resets *models.PasswordResetService, policy *passwords.Policy) *PasswordController {
+	return &PasswordController{
+		resets: resets,
+		policy: policy,
+	}
+}
+
+// ForgotPasswordRequest represents the request body for requesting a reset link
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordRequest represents the request body for setting a new password
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required,max=128"`
+	Password string `json:"password" binding:"required"`
+}
+
+// ForgotPassword emails a password reset link. The response is the same
+// whether or not the address has an account.
+func (pc *PasswordController) ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": validationErrors(err),
+		})
+		return
+	}
+
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if err := pc.resets.RequestReset(c.Request.Context(), email); err != nil {
+		log.Printf("Error requesting password reset: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to request password reset"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "If an account exists for this email, a password reset link has been sent",
+	})
+}
+
+// ResetPassword sets a new password using the token from a reset link and
+// signs the user out of every session
+func (pc *PasswordController) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": validationErrors(err),
+		})
+		return
+	}
+
+	if err := pc.resets.ResetPassword(c.Request.Context(), req.Token, req.Password); err != nil {
+		if writePasswordPolicyError(c, err) {
+			return
+		}
+		if errors.Is(err, models.ErrPasswordResetInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+			return
+		}
+		log.Printf("Error resetting password: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset. Please log in again."})
+}
+
+// GetPolicy describes the password rules so the UI can show them up front
+func (pc *PasswordController) GetPolicy(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"minLength":     pc.policy.MinLength(),
+		"maxBytes":      passwords.MaxBytes,
+		"breachedCheck": pc.policy.ChecksBreaches(),
+	})
+}
+
+// writePasswordPolicyError writes a 400 listing the reasons when err is a
+// password rejected by the policy, and reports whether it did
+func writePasswordPolicyError(c *gin.Context, err error) bool {
+	var policyErr *passwords.PolicyError
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":   "Password does not meet the requirements",
+		"code":    "weak_password",
+		"reasons": policyErr.Reasons,
+	})
+	return true
+}
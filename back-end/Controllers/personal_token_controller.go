@@ -0,0 +1,125 @@
+package Controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	middleware "HabitBite/backend/Middleware"
+	models "HabitBite/backend/Models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PersonalTokenController handles personal access tokens for scripts and integrations
+type PersonalTokenController struct {
+	personalTokens *models.PersonalTokenService
+}
+
+// NewPersonalTokenController creates a new PersonalTokenController
+func NewPersonalTokenController(personalTokens *models.PersonalTokenService) *PersonalTokenController {
+	return &PersonalTokenController{personalTokens: personalTokens}
+}
+
+// CreatePersonalTokenRequest represents the request body for creating a token.
+// ExpiresInDays defaults to 90 when omitted.
+type CreatePersonalTokenRequest struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expiresInDays" binding:"omitempty,min=1,max=365"`
+}
+
+// ListTokens returns the current user's personal access tokens
+func (pc *PersonalTokenController) ListTokens(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	list, err := pc.personalTokens.List(c.Request.Context(), userID)
+	if err != nil {
+		log.Printf("Error listing personal access tokens for user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tokens":          list,
+		"availableScopes": models.PersonalTokenScopes,
+	})
+}
+
+// CreateToken creates a personal access token and returns it once
+func (pc *PersonalTokenController) CreateToken(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req CreatePersonalTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": validationErrors(err),
+		})
+		return
+	}
+
+	// Tokens keep the second-factor status of the login that creates them,
+	// so roles that require 2FA can still use them
+	var mfa bool
+	if claims, ok := middleware.TokenClaims(c); ok {
+		mfa = claims.MFA
+	}
+
+	ttl := time.Duration(req.ExpiresInDays) * 24 * time.Hour
+	raw, token, err := pc.personalTokens.Create(c.Request.Context(), userID, req.Name, req.Scopes, ttl, mfa)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrPersonalTokenName),
+			errors.Is(err, models.ErrPersonalTokenScopes),
+			errors.Is(err, models.ErrPersonalTokenTTL):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, models.ErrPersonalTokenLimit):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			log.Printf("Error creating personal access token for user %d: %v", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Token created. Copy it now; it is shown only once.",
+		"token":   raw,
+		"details": token,
+	})
+}
+
+// RevokeToken deletes one of the current user's personal access tokens
+func (pc *PersonalTokenController) RevokeToken(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	tokenID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token ID"})
+		return
+	}
+
+	if err := pc.personalTokens.Revoke(c.Request.Context(), userID, tokenID); err != nil {
+		if errors.Is(err, models.ErrPersonalTokenNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+			return
+		}
+		log.Printf("Error revoking personal access token %d: %v", tokenID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Token revoked"})
+}
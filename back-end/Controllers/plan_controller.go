@@ -0,0 +1,221 @@
+package Controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	models "HabitBite/backend/Models"
+	nutrition "HabitBite/backend/Nutrition"
+	repositories "HabitBite/backend/Repositories"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PlanController handles weigh-ins and target-weight plans
+type PlanController struct {
+	planService *models.PlanService
+}
+
+// NewPlanController creates a new PlanController
+func NewPlanController(service *models.PlanService) *PlanController {
+	return &PlanController{
+		planService: service,
+	}
+}
+
+// LogWeight records a weigh-in for the current user
+func (pc *PlanController) LogWeight(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req models.WeightEntryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": validationErrors(err),
+		})
+		return
+	}
+
+	date := time.Now()
+	if req.Date != "" {
+		parsed, err := time.Parse("2006-01-02", req.Date)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format. Use YYYY-MM-DD"})
+			return
+		}
+		if parsed.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Date cannot be in the future"})
+			return
+		}
+		date = parsed
+	}
+
+	entry, err := pc.planService.LogWeight(c.Request.Context(), userID, req.Weight, date)
+	if err != nil {
+		log.Printf("Error logging weight: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log weight"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, entry)
+}
+
+// GetWeightHistory retrieves weigh-ins for a date range (default: last 30 days)
+func (pc *PlanController) GetWeightHistory(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	endDate := time.Now()
+	startDate := endDate.AddDate(0, 0, -30)
+
+	if s := c.Query("startDate"); s != "" {
+		parsed, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start date format. Use YYYY-MM-DD"})
+			return
+		}
+		startDate = parsed
+	}
+	if s := c.Query("endDate"); s != "" {
+		parsed, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end date format. Use YYYY-MM-DD"})
+			return
+		}
+		endDate = parsed
+	}
+
+	if endDate.Before(startDate) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "End date must be after start date"})
+		return
+	}
+
+	entries, err := pc.planService.GetWeightEntries(c.Request.Context(), userID, startDate, endDate)
+	if err != nil {
+		log.Printf("Error getting weight history: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get weight history"})
+		return
+	}
+
+	if entries == nil {
+		entries = []*models.WeightEntry{}
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+// GetPlan returns the user's target-weight plan evaluated against the latest data
+func (pc *PlanController) GetPlan(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	evaluation, err := pc.planService.GetPlan(c.Request.Context(), userID)
+	if err != nil {
+		pc.handlePlanError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, evaluation)
+}
+
+// SetPlan creates or replaces the user's target-weight plan
+func (pc *PlanController) SetPlan(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req models.WeightPlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": validationErrors(err),
+		})
+		return
+	}
+
+	targetDate, err := time.Parse("2006-01-02", req.TargetDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid target date format. Use YYYY-MM-DD"})
+		return
+	}
+
+	evaluation, err := pc.planService.SetPlan(c.Request.Context(), userID, req.TargetWeight, targetDate, req.AutoApply)
+	if err != nil {
+		pc.handlePlanError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Weight plan saved", "evaluation": evaluation})
+}
+
+// DeletePlan removes the user's target-weight plan
+func (pc *PlanController) DeletePlan(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := pc.planService.DeletePlan(c.Request.Context(), userID); err != nil {
+		pc.handlePlanError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RecalculatePlanRequest represents the request body for re-estimating a plan
+type RecalculatePlanRequest struct {
+	Apply bool `json:"apply"`
+}
+
+// RecalculatePlan re-estimates TDEE and optionally applies the suggested calorie target
+func (pc *PlanController) RecalculatePlan(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req RecalculatePlanRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+			return
+		}
+	}
+
+	evaluation, err := pc.planService.Evaluate(c.Request.Context(), userID, req.Apply)
+	if err != nil {
+		pc.handlePlanError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, evaluation)
+}
+
+// handlePlanError maps plan service errors to HTTP responses
+func (pc *PlanController) handlePlanError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repositories.ErrWeightPlanNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "No weight plan set"})
+	case errors.Is(err, repositories.ErrUserNotFound):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+	case errors.Is(err, nutrition.ErrTargetDateInPast),
+		errors.Is(err, nutrition.ErrInvalidTargetWeight),
+		errors.Is(err, nutrition.ErrUnsupportedPlanWindow),
+		errors.Is(err, nutrition.ErrInvalidTDEE):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Error processing weight plan: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process weight plan"})
+	}
+}
@@ -0,0 +1,192 @@
+package Controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	models "HabitBite/backend/Models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TwoFactorController handles TOTP enrollment and recovery codes
+type TwoFactorController struct {
+	twoFactor   *models.TwoFactorService
+	userService *models.UserService
+}
+
+// NewTwoFactorController creates a new TwoFactorController
+func NewTwoFactorController(twoFactor *models.TwoFactorService, userService *models.UserService) *TwoFactorController {
+	return &TwoFactorController{
+		twoFactor:   twoFactor,
+		userService: userService,
+	}
+}
+
+// TwoFactorCodeRequest represents a request carrying a TOTP or recovery code
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required,max=32"`
+}
+
+// DisableTwoFactorRequest represents the request body for turning 2FA off
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required,max=32"`
+}
+
+// GetStatus returns the current user's two-factor setup
+func (tc *TwoFactorController) GetStatus(c *gin.Context) {
+	user, ok := tc.currentUser(c)
+	if !ok {
+		return
+	}
+
+	status, err := tc.twoFactor.Status(c.Request.Context(), user)
+	if err != nil {
+		log.Printf("Error getting two-factor status: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get two-factor status"})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// Enroll starts enrollment and returns the secret and otpauth URI for the authenticator app
+func (tc *TwoFactorController) Enroll(c *gin.Context) {
+	user, ok := tc.currentUser(c)
+	if !ok {
+		return
+	}
+
+	enrollment, err := tc.twoFactor.Enroll(c.Request.Context(), user)
+	if err != nil {
+		if errors.Is(err, models.ErrTwoFactorAlreadyEnabled) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Error starting two-factor enrollment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start two-factor enrollment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// Confirm enables 2FA with a first code and returns the recovery codes
+func (tc *TwoFactorController) Confirm(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": validationErrors(err),
+		})
+		return
+	}
+
+	codes, err := tc.twoFactor.Confirm(c.Request.Context(), userID, req.Code)
+	if err != nil {
+		tc.writeError(c, err, "Failed to enable two-factor authentication")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Two-factor authentication enabled. Store these recovery codes somewhere safe; they are shown only once.",
+		"recoveryCodes": codes,
+	})
+}
+
+// Disable turns 2FA off after checking the password and a current code
+func (tc *TwoFactorController) Disable(c *gin.Context) {
+	user, ok := tc.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": validationErrors(err),
+		})
+		return
+	}
+
+	if !user.CheckPassword(req.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+
+	if err := tc.twoFactor.Disable(c.Request.Context(), user, req.Code); err != nil {
+		tc.writeError(c, err, "Failed to disable two-factor authentication")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes after checking a current code
+func (tc *TwoFactorController) RegenerateRecoveryCodes(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": validationErrors(err),
+		})
+		return
+	}
+
+	codes, err := tc.twoFactor.RegenerateRecoveryCodes(c.Request.Context(), userID, req.Code)
+	if err != nil {
+		tc.writeError(c, err, "Failed to regenerate recovery codes")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recoveryCodes": codes})
+}
+
+// currentUser loads the authenticated user, writing an error response on failure
+func (tc *TwoFactorController) currentUser(c *gin.Context) (*models.User, bool) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return nil, false
+	}
+
+	user, err := tc.userService.FindByID(c.Request.Context(), userID)
+	if err != nil {
+		log.Printf("Error finding user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load user"})
+		return nil, false
+	}
+
+	return user, true
+}
+
+// writeError maps two-factor errors to responses
+func (tc *TwoFactorController) writeError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, models.ErrTwoFactorInvalidCode):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrTwoFactorLocked):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrTwoFactorNotEnrolled):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrTwoFactorAlreadyEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrTwoFactorRequiredForRole):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		log.Printf("%s: %v", fallback, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
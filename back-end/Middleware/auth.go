@@ -1,20 +1,117 @@
 package middleware
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/base64"
-	"fmt"
+	"log"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
-	config "HabitBite/backend/Config"
+	tokens "HabitBite/backend/Tokens"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 )
 
-// AuthMiddleware validates JWT tokens in requests
-func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
+// CSRF token cookie and header names
+const (
+	CSRFCookieName = "csrf_token"
+	CSRFHeaderName = "X-CSRF-Token"
+)
+
+// Context keys set by AuthMiddleware
+const (
+	ContextUserID   = "userID"
+	ContextUserRole = "userRole"
+	ContextClaims   = "tokenClaims"
+
+	contextPermissions = "permissions"
+)
+
+// ImpersonationHeader is set on every response to an impersonation token,
+// so clients can show that an admin is viewing the account
+const ImpersonationHeader = "X-Impersonation"
+
+// RevocationChecker reports whether an access token has been revoked
+type RevocationChecker interface {
+	IsRevoked(ctx context.Context, jti string, userID int, issuedAt time.Time) (bool, error)
+}
+
+// SessionChecker reports whether a login session is still active
+type SessionChecker interface {
+	Check(ctx context.Context, sessionID string, userID int, ipAddress string) (bool, error)
+}
+
+// PersonalTokenAuthenticator resolves personal access tokens. It returns nil
+// claims for unknown or expired tokens.
+type PersonalTokenAuthenticator interface {
+	AuthenticatePersonalToken(ctx context.Context, raw string) (*tokens.Claims, error)
+}
+
+// PersonalTokens lets AuthMiddleware accept personal access tokens as bearer
+// tokens. Scopes maps each route a token may use, as "METHOD /full/path",
+// to the scope it needs there; tokens are refused on every other route.
+type PersonalTokens struct {
+	Authenticator PersonalTokenAuthenticator
+	Scopes        map[string]string
+}
+
+// RoleResolver returns a user's current role, reporting false if the user
+// no longer exists
+type RoleResolver interface {
+	CurrentRole(ctx context.Context, userID int) (string, bool, error)
+}
+
+// AccountChecker reports whether a user's account has been disabled
+type AccountChecker interface {
+	IsDisabled(ctx context.Context, userID int) (bool, error)
+}
+
+// PermissionChecker reports whether a role grants a permission
+type PermissionChecker interface {
+	HasPermission(role, permission string) bool
+}
+
+// ImpersonationAuditor records a request made with an impersonation token
+// once it has been handled
+type ImpersonationAuditor interface {
+	RecordImpersonatedRequest(ctx context.Context, adminID, userID int, method, path, ipAddress, userAgent string, status int)
+}
+
+// Impersonation lets AuthMiddleware accept impersonation tokens. The admin
+// behind a token must still have an enabled account whose role grants
+// Permission; Auditor records every request made with one. Read-only
+// tokens are refused for anything but GET, HEAD and OPTIONS.
+type Impersonation struct {
+	Permission string
+	Auditor    ImpersonationAuditor
+}
+
+// AuthOptions are the checks AuthMiddleware runs besides validating the
+// token; each one is skipped when left nil.
+type AuthOptions struct {
+	// Revocations rejects revoked access tokens
+	Revocations RevocationChecker
+	// Sessions rejects access tokens whose login session has ended
+	Sessions SessionChecker
+	// PersonalTokens accepts personal access tokens on the routes it lists
+	PersonalTokens *PersonalTokens
+	// Accounts rejects every token of a disabled account
+	Accounts AccountChecker
+	// Roles replaces the role in the token with the user's current one, so
+	// role changes apply without logging in again
+	Roles RoleResolver
+	// Permissions backs RequirePermission and HasPermission
+	Permissions PermissionChecker
+	// Impersonation accepts impersonation tokens; they are refused when nil
+	Impersonation *Impersonation
+}
+
+// AuthMiddleware validates access tokens in requests and stores the user ID
+// (as an int), role and claims in the context
+func AuthMiddleware(tokenService *tokens.Service, opts AuthOptions) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenString := extractToken(c)
 		if tokenString == "" {
@@ -22,36 +119,394 @@ func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 			return
 		}
 
-		token, err := validateToken(tokenString, cfg.JWTSecret)
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		// An admin's browser still sends their own auth cookie, so an
+		// impersonation token in the Authorization header takes its place
+		if opts.Impersonation != nil {
+			if bearer := bearerToken(c); bearer != "" && bearer != tokenString {
+				if bearerClaims, err := tokenService.ParseRequestToken(bearer); err == nil && bearerClaims.Type == tokens.TypeImpersonation {
+					tokenString = bearer
+				}
+			}
+		}
+
+		var claims *tokens.Claims
+		if opts.PersonalTokens != nil && strings.HasPrefix(tokenString, tokens.PersonalAccessTokenPrefix) {
+			var ok bool
+			if claims, ok = opts.PersonalTokens.authenticate(c, tokenString); !ok {
+				return
+			}
+		} else {
+			var ok bool
+			if claims, ok = checkAccessToken(c, tokenService, tokenString, opts); !ok {
+				return
+			}
+		}
+
+		// Both token kinds carry a numeric subject
+		userID, _ := claims.UserID()
+
+		// Impersonated requests are audited once answered, refused ones included
+		adminID := claims.ImpersonatorID()
+		if adminID != 0 && opts.Impersonation.Auditor != nil {
+			auditor := opts.Impersonation.Auditor
+			defer func() {
+				auditor.RecordImpersonatedRequest(c.Request.Context(), adminID, userID,
+					c.Request.Method, c.Request.URL.Path, c.ClientIP(), c.Request.UserAgent(), c.Writer.Status())
+			}()
+		}
+
+		if opts.Accounts != nil {
+			disabled, err := opts.Accounts.IsDisabled(c.Request.Context(), userID)
+			if err != nil {
+				log.Printf("Error checking account status of user %d: %v", userID, err)
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate token"})
+				return
+			}
+			if disabled {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+					"error": "This account has been disabled",
+					"code":  "account_disabled",
+				})
+				return
+			}
+		}
+
+		// Personal access tokens are resolved with the user's current role already
+		role := claims.Role
+		if opts.Roles != nil && claims.Type != tokens.TypePersonalAccess {
+			current, found, err := opts.Roles.CurrentRole(c.Request.Context(), userID)
+			if err != nil {
+				log.Printf("Error looking up role of user %d: %v", userID, err)
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate token"})
+				return
+			}
+			if !found {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Account no longer exists"})
+				return
+			}
+			role = current
+		}
+
+		if adminID != 0 && !checkImpersonator(c, claims, adminID, opts) {
 			return
 		}
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			// Add claims to context
-			c.Set("userID", claims["sub"])
-			c.Set("userRole", claims["role"])
+		// Add claims to context
+		c.Set(ContextUserID, userID)
+		c.Set(ContextUserRole, role)
+		c.Set(ContextClaims, claims)
+		if opts.Permissions != nil {
+			c.Set(contextPermissions, opts.Permissions)
+		}
 
-			// Set CSRF token if not already set
-			if _, err := c.Cookie("csrf_token"); err != nil {
+		// Set CSRF token if not already set; scripts using personal access
+		// tokens have no use for one
+		if claims.Type != tokens.TypePersonalAccess {
+			if _, err := c.Cookie(CSRFCookieName); err != nil {
 				if err := SetCSRFToken(c); err != nil {
 					c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to set CSRF token"})
 					return
 				}
 			}
+		}
+
+		c.Next()
+	}
+}
+
+// checkImpersonator checks that the admin behind an impersonation token may
+// still impersonate and that a read-only token is only reading, writing an
+// error response on failure. It flags the response as impersonated.
+func checkImpersonator(c *gin.Context, claims *tokens.Claims, adminID int, opts AuthOptions) bool {
+	mode := "read-only"
+	if claims.Writable {
+		mode = "read-write"
+	}
+	c.Header(ImpersonationHeader, "admin="+strconv.Itoa(adminID)+"; mode="+mode)
+
+	if opts.Accounts != nil {
+		disabled, err := opts.Accounts.IsDisabled(c.Request.Context(), adminID)
+		if err != nil {
+			log.Printf("Error checking account status of user %d: %v", adminID, err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate token"})
+			return false
+		}
+		if disabled {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Impersonation has ended"})
+			return false
+		}
+	}
+
+	if opts.Roles != nil && opts.Permissions != nil {
+		role, found, err := opts.Roles.CurrentRole(c.Request.Context(), adminID)
+		if err != nil {
+			log.Printf("Error looking up role of user %d: %v", adminID, err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate token"})
+			return false
+		}
+		if !found || !opts.Permissions.HasPermission(role, opts.Impersonation.Permission) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Impersonation has ended"})
+			return false
+		}
+	}
+
+	if claims.Writable {
+		return true
+	}
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+		"error": "This impersonation session is read-only",
+		"code":  "impersonation_read_only",
+	})
+	return false
+}
+
+// ForbidImpersonation refuses impersonation tokens, for routes such as
+// password changes that only the account owner may use. It must run after
+// AuthMiddleware.
+func ForbidImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if claims, ok := TokenClaims(c); ok && claims.ImpersonatorID() != 0 {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "Not available while impersonating a user",
+				"code":  "impersonation_not_allowed",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// ImpersonatorID returns the ID of the admin impersonating the authenticated
+// user, or 0 when nobody is
+func ImpersonatorID(c *gin.Context) int {
+	if claims, ok := TokenClaims(c); ok {
+		return claims.ImpersonatorID()
+	}
+	return 0
+}
+
+// checkAccessToken validates a JWT access token and checks it has not been
+// revoked, writing an error response on failure
+func checkAccessToken(c *gin.Context, tokenService *tokens.Service, tokenString string, opts AuthOptions) (*tokens.Claims, bool) {
+	claims, err := tokenService.ParseRequestToken(tokenString)
+	if err != nil || (claims.Type == tokens.TypeImpersonation && opts.Impersonation == nil) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return nil, false
+	}
+
+	// ParseRequestToken guarantees a numeric subject
+	userID, _ := claims.UserID()
+
+	// Signing out everywhere ends impersonations by the admin as well as
+	// those of the user
+	if opts.Revocations != nil {
+		for _, id := range []int{userID, claims.ImpersonatorID()} {
+			if id == 0 {
+				continue
+			}
+			revoked, err := opts.Revocations.IsRevoked(c.Request.Context(), claims.ID, id, claims.IssuedAt.Time)
+			if err != nil {
+				log.Printf("Error checking token revocation: %v", err)
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate token"})
+				return nil, false
+			}
+			if revoked {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+				return nil, false
+			}
+		}
+	}
+
+	if opts.Sessions != nil && claims.SessionID != "" {
+		active, err := opts.Sessions.Check(c.Request.Context(), claims.SessionID, userID, c.ClientIP())
+		if err != nil {
+			log.Printf("Error checking session: %v", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate token"})
+			return nil, false
+		}
+		if !active {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Session has ended"})
+			return nil, false
+		}
+	}
+
+	return claims, true
+}
+
+// authenticate checks a personal access token and the scope the route
+// needs, writing an error response on failure
+func (p *PersonalTokens) authenticate(c *gin.Context, tokenString string) (*tokens.Claims, bool) {
+	claims, err := p.Authenticator.AuthenticatePersonalToken(c.Request.Context(), tokenString)
+	if err != nil {
+		log.Printf("Error checking personal access token: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate token"})
+		return nil, false
+	}
+	if claims == nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return nil, false
+	}
+
+	scope, allowed := p.Scopes[c.Request.Method+" "+c.FullPath()]
+	if !allowed {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "Personal access tokens cannot be used for this request",
+			"code":  "personal_token_not_allowed",
+		})
+		return nil, false
+	}
+	if !claims.HasScope(scope) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "Token is missing the " + scope + " scope",
+			"code":  "insufficient_scope",
+			"scope": scope,
+		})
+		return nil, false
+	}
+
+	return claims, true
+}
+
+// HasPermission reports whether the authenticated user's current role
+// grants a permission. It is false when AuthMiddleware has no Permissions.
+func HasPermission(c *gin.Context, permission string) bool {
+	value, _ := c.Get(contextPermissions)
+	checker, ok := value.(PermissionChecker)
+	return ok && checker.HasPermission(UserRole(c), permission)
+}
+
+// RequirePermission rejects requests from users whose role does not grant
+// the permission. It must run after AuthMiddleware.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !HasPermission(c, permission) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":      "Insufficient permissions for this resource",
+				"permission": permission,
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// UserID returns the authenticated user's ID set by AuthMiddleware
+func UserID(c *gin.Context) (int, bool) {
+	value, exists := c.Get(ContextUserID)
+	if !exists {
+		return 0, false
+	}
+	id, ok := value.(int)
+	return id, ok && id > 0
+}
+
+// UserRole returns the authenticated user's role set by AuthMiddleware
+func UserRole(c *gin.Context) string {
+	role, _ := c.Get(ContextUserRole)
+	roleStr, _ := role.(string)
+	return roleStr
+}
+
+// TokenClaims returns the access token claims set by AuthMiddleware
+func TokenClaims(c *gin.Context) (*tokens.Claims, bool) {
+	value, exists := c.Get(ContextClaims)
+	if !exists {
+		return nil, false
+	}
+	claims, ok := value.(*tokens.Claims)
+	return claims, ok
+}
+
+// RequestAccessToken returns the claims of a valid access token in the request
+// without checking revocation. It is meant for endpoints such as logout that
+// must work without AuthMiddleware.
+func RequestAccessToken(c *gin.Context, tokenService *tokens.Service) (*tokens.Claims, bool) {
+	tokenString := extractToken(c)
+	if tokenString == "" {
+		return nil, false
+	}
 
+	claims, err := tokenService.ParseAccessToken(tokenString)
+	if err != nil {
+		return nil, false
+	}
+
+	return claims, true
+}
+
+// EmailVerificationChecker reports whether a user's email address is verified
+type EmailVerificationChecker interface {
+	IsEmailVerified(ctx context.Context, userID int) (bool, error)
+}
+
+// RequireVerifiedEmail rejects requests from users whose email address is not
+// verified yet. It must run after AuthMiddleware.
+func RequireVerifiedEmail(checker EmailVerificationChecker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := UserID(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+
+		verified, err := checker.IsEmailVerified(c.Request.Context(), userID)
+		if err != nil {
+			log.Printf("Error checking email verification: %v", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check email verification"})
+			return
+		}
+		if !verified {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "Please verify your email address first",
+				"code":  "email_not_verified",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireTwoFactorForRoles rejects requests from users with one of the roles
+// unless their access token comes from a login that used a second factor.
+// Nothing is rejected before enforceAfter, which gives users time to enroll.
+// It must run after AuthMiddleware.
+func RequireTwoFactorForRoles(enforceAfter time.Time, roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if time.Now().Before(enforceAfter) {
 			c.Next()
-		} else {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+			return
 		}
+
+		role := UserRole(c)
+		for _, required := range roles {
+			if role != required {
+				continue
+			}
+			if claims, ok := TokenClaims(c); !ok || !claims.MFA {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+					"error": "Two-factor authentication is required for this account",
+					"code":  "two_factor_required",
+				})
+				return
+			}
+			break
+		}
+
+		c.Next()
 	}
 }
 
 // RoleMiddleware checks if user has required role
 func RoleMiddleware(allowedRoles ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userRole, exists := c.Get("userRole")
+		userRole, exists := c.Get(ContextUserRole)
 		if !exists {
 			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Role not found"})
 			return
@@ -85,6 +540,11 @@ func extractToken(c *gin.Context) string {
 	}
 
 	// Then check Authorization header
+	return bearerToken(c)
+}
+
+// bearerToken returns the token in the Authorization header, if any
+func bearerToken(c *gin.Context) string {
 	authHeader := c.GetHeader("Authorization")
 	if authHeader != "" {
 		// The header format should be "Bearer {token}"
@@ -97,32 +557,16 @@ func extractToken(c *gin.Context) string {
 	return ""
 }
 
-// validateToken validates the JWT token
-func validateToken(tokenString, secret string) (*jwt.Token, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// Validate signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-
-		return []byte(secret), nil
-	})
-
+// SetCSRFToken sets a new CSRF token in the response cookie and header
+func SetCSRFToken(c *gin.Context) error {
+	token, err := GenerateCSRFToken()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return token, nil
-}
-
-// SetCSRFToken sets a new CSRF token in the response cookie
-func SetCSRFToken(c *gin.Context) error {
-	// Generate a new token
-	token := GenerateCSRFToken()
-
 	// Set token in cookie
 	c.SetCookie(
-		"csrf_token",
+		CSRFCookieName,
 		token,
 		3600, // 1 hour
 		"/",
@@ -132,15 +576,16 @@ func SetCSRFToken(c *gin.Context) error {
 	)
 
 	// Set token in header for frontend to store
-	c.Header("X-CSRF-Token", token)
+	c.Header(CSRFHeaderName, token)
 	return nil
 }
 
-// GenerateCSRFToken generates a new CSRF token
-func GenerateCSRFToken() string {
-	// Generate 32 random bytes
+// GenerateCSRFToken generates a new CSRF token. It is URL-safe, so the cookie
+// holds it unescaped and the front end can copy it into the header as is.
+func GenerateCSRFToken() (string, error) {
 	b := make([]byte, 32)
-	rand.Read(b)
-	// Encode to base64
-	return base64.StdEncoding.EncodeToString(b)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
 }
@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	config "HabitBite/backend/Config"
+	tokens "HabitBite/backend/Tokens"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakePersonalTokens resolves personal access tokens from a map
+type fakePersonalTokens map[string]*tokens.Claims
+
+func (f fakePersonalTokens) AuthenticatePersonalToken(ctx context.Context, raw string) (*tokens.Claims, error) {
+	return f[raw], nil
+}
+
+func testTokenService(t *testing.T) *tokens.Service {
+	t.Helper()
+	s, err := tokens.NewService(&config.Config{
+		JWTSecret:            "test-secret-0123456789abcdef0123",
+		JWTSigningAlg:        tokens.AlgHS256,
+		JWTIssuer:            "habitbite",
+		JWTAudience:          "habitbite-api",
+		AccessTokenTTL:       time.Hour,
+		EmailVerificationTTL: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestAuthMiddlewarePersonalTokenScopes(t *testing.T) {
+	tokenService := testTokenService(t)
+	personal := &PersonalTokens{
+		Authenticator: fakePersonalTokens{
+			"hbp_reader": tokens.PersonalAccessClaims(1, 42, "user", []string{"read:entries"}, false),
+			"hbp_writer": tokens.PersonalAccessClaims(2, 42, "user", []string{"read:entries", "write:entries"}, false),
+		},
+		Scopes: map[string]string{
+			"GET /api/consumed-foods/daily": "read:entries",
+			"POST /api/consumed-foods":      "write:entries",
+		},
+	}
+
+	router := gin.New()
+	router.Use(AuthMiddleware(tokenService, AuthOptions{PersonalTokens: personal}))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.GET("/api/consumed-foods/daily", ok)
+	router.POST("/api/consumed-foods", ok)
+	router.DELETE("/api/consumed-foods/:id", ok)
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		token    string
+		want     int
+		wantCode string
+	}{
+		{"scope granted", http.MethodGet, "/api/consumed-foods/daily", "hbp_reader", http.StatusOK, ""},
+		{"write scope granted", http.MethodPost, "/api/consumed-foods", "hbp_writer", http.StatusOK, ""},
+		{"scope missing", http.MethodPost, "/api/consumed-foods", "hbp_reader", http.StatusForbidden, "insufficient_scope"},
+		{"route not listed", http.MethodDelete, "/api/consumed-foods/7", "hbp_writer", http.StatusForbidden, "personal_token_not_allowed"},
+		{"unknown token", http.MethodGet, "/api/consumed-foods/daily", "hbp_unknown", http.StatusUnauthorized, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("got status %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+			if tt.wantCode != "" {
+				var body struct {
+					Code string `json:"code"`
+				}
+				if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Code != tt.wantCode {
+					t.Errorf("got body %s, want code %q", w.Body.String(), tt.wantCode)
+				}
+			}
+			if w.Code == http.StatusOK && w.Header().Get("Set-Cookie") != "" {
+				t.Error("personal access tokens must not be given a CSRF cookie")
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewareImpersonation(t *testing.T) {
+	tokenService := testTokenService(t)
+	readOnly, _, err := tokenService.IssueImpersonationToken(7, 42, "user", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writable, _, err := tokenService.IssueImpersonationToken(7, 42, "user", false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newRouter := func(impersonation *Impersonation) *gin.Engine {
+		router := gin.New()
+		router.Use(AuthMiddleware(tokenService, AuthOptions{Impersonation: impersonation}))
+		ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+		router.GET("/api/user", ok)
+		router.POST("/api/consumed-foods", ok)
+		router.PUT("/api/user/password", ForbidImpersonation(), ok)
+		return router
+	}
+
+	tests := []struct {
+		name          string
+		impersonation *Impersonation
+		method        string
+		path          string
+		token         string
+		want          int
+	}{
+		{"read-only token reads", &Impersonation{}, http.MethodGet, "/api/user", readOnly, http.StatusOK},
+		{"read-only token writes", &Impersonation{}, http.MethodPost, "/api/consumed-foods", readOnly, http.StatusForbidden},
+		{"writable token writes", &Impersonation{}, http.MethodPost, "/api/consumed-foods", writable, http.StatusOK},
+		{"owner-only route", &Impersonation{}, http.MethodPut, "/api/user/password", writable, http.StatusForbidden},
+		{"impersonation not accepted", nil, http.MethodGet, "/api/user", readOnly, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+			newRouter(tt.impersonation).ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("got status %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+			if tt.impersonation != nil && w.Header().Get(ImpersonationHeader) == "" {
+				t.Errorf("response is missing the %s header", ImpersonationHeader)
+			}
+		})
+	}
+}
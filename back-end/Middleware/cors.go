@@ -26,7 +26,7 @@ func CORSMiddleware(allowedOrigins []string) gin.HandlerFunc {
 			c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 			c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
 			c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
-			c.Writer.Header().Set("Access-Control-Expose-Headers", "Set-Cookie")
+			c.Writer.Header().Set("Access-Control-Expose-Headers", "Set-Cookie, X-Impersonation")
 
 			if c.Request.Method == "OPTIONS" {
 				c.AbortWithStatus(204)
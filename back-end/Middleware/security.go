@@ -1,8 +1,12 @@
 package middleware
 
 import (
+	"crypto/subtle"
 	"log"
 	"net/http"
+	"strings"
+
+	config "HabitBite/backend/Config"
 
 	"github.com/gin-gonic/gin"
 )
@@ -101,44 +105,66 @@ func join(strings []string, separator string) string {
 	return result
 }
 
-// CSRFMiddleware handles CSRF token validation
-func CSRFMiddleware() gin.HandlerFunc {
+// CSRFMiddleware checks unsafe requests with the double-submit pattern: the
+// X-CSRF-Token header must match the csrf_token cookie, which other sites can
+// neither read nor set. Requests whose credentials come from the
+// Authorization header rather than a cookie cannot be forged this way and
+// are not checked, nor are the paths in cfg.CSRFExemptPaths. cfg.CSRFDisabled
+// turns the check off in development only.
+func CSRFMiddleware(cfg *config.Config) gin.HandlerFunc {
+	disabled := cfg.CSRFDisabled && cfg.IsDevelopment()
+	if disabled {
+		log.Println("Development mode: CSRF protection is disabled")
+	}
+
 	return func(c *gin.Context) {
-		// Handle CORS preflight requests
-		if c.Request.Method == "OPTIONS" {
-			c.Header("Access-Control-Allow-Origin", "http://localhost:3000")
-			c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
-			c.Header("Access-Control-Allow-Credentials", "true")
-			c.Status(http.StatusNoContent)
-			c.Abort()
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
 			return
 		}
 
-		// Skip CSRF check for login and register endpoints
-		if c.Request.URL.Path == "/api/auth/login" || c.Request.URL.Path == "/api/auth/register" {
+		if disabled || csrfExempt(c.Request.URL.Path, cfg.CSRFExemptPaths) || !hasCookieCredentials(c) {
 			c.Next()
 			return
 		}
 
-		// Allow GET, HEAD requests to bypass CSRF check
-		if c.Request.Method == "GET" || c.Request.Method == "HEAD" {
-			c.Next()
+		cookie, err := c.Cookie(CSRFCookieName)
+		header := c.GetHeader(CSRFHeaderName)
+		if err != nil || cookie == "" || header == "" ||
+			subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) != 1 {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "CSRF token invalid",
+				"code":  "csrf_invalid",
+			})
 			return
 		}
 
-		// For development purposes, we'll bypass CSRF protection
-		// and just set a new token for every request
-		log.Println("Development mode: Bypassing CSRF protection")
+		c.Next()
+	}
+}
 
-		// Set a new CSRF token
-		if err := SetCSRFToken(c); err != nil {
-			log.Printf("Error setting CSRF token: %v", err)
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to set CSRF token"})
-			return
+// csrfExempt reports whether a path is in the exemption list, where an entry
+// ending in * matches every path starting with the rest of it
+func csrfExempt(path string, exemptPaths []string) bool {
+	for _, exempt := range exemptPaths {
+		if prefix, ok := strings.CutSuffix(exempt, "*"); ok {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+		} else if path == exempt {
+			return true
 		}
+	}
+	return false
+}
 
-		// Continue with the request
-		c.Next()
+// hasCookieCredentials reports whether the request is authenticated by a
+// cookie the browser sends on its own, as opposed to an Authorization header
+// a script has to set
+func hasCookieCredentials(c *gin.Context) bool {
+	if token, err := c.Cookie("auth_token"); err == nil && token != "" {
+		return true
 	}
+	return c.GetHeader("Authorization") == ""
 }
@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	config "HabitBite/backend/Config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func TestCSRFMiddleware(t *testing.T) {
+	cfg := &config.Config{
+		Environment:     "production",
+		CSRFExemptPaths: []string{"/api/auth/login", "/api/webhooks/*"},
+	}
+
+	tests := []struct {
+		name          string
+		cfg           *config.Config
+		method        string
+		path          string
+		authCookie    bool
+		authorization string
+		csrfCookie    string
+		csrfHeader    string
+		want          int
+	}{
+		{name: "matching token", method: http.MethodPost, path: "/api/user", authCookie: true,
+			csrfCookie: "abc", csrfHeader: "abc", want: http.StatusOK},
+		{name: "mismatched token", method: http.MethodPost, path: "/api/user", authCookie: true,
+			csrfCookie: "abc", csrfHeader: "abd", want: http.StatusForbidden},
+		{name: "token of another length", method: http.MethodDelete, path: "/api/user", authCookie: true,
+			csrfCookie: "abc", csrfHeader: "abcd", want: http.StatusForbidden},
+		{name: "missing header", method: http.MethodPut, path: "/api/user", authCookie: true,
+			csrfCookie: "abc", want: http.StatusForbidden},
+		{name: "missing cookie", method: http.MethodPatch, path: "/api/user", authCookie: true,
+			csrfHeader: "abc", want: http.StatusForbidden},
+		{name: "both empty", method: http.MethodPost, path: "/api/user", authCookie: true,
+			want: http.StatusForbidden},
+		{name: "no credentials at all", method: http.MethodPost, path: "/api/user",
+			want: http.StatusForbidden},
+		{name: "safe method", method: http.MethodGet, path: "/api/user", authCookie: true,
+			want: http.StatusOK},
+		{name: "preflight", method: http.MethodOptions, path: "/api/user", authCookie: true,
+			want: http.StatusOK},
+		{name: "exempt path", method: http.MethodPost, path: "/api/auth/login",
+			want: http.StatusOK},
+		{name: "exempt prefix", method: http.MethodPost, path: "/api/webhooks/stripe", authCookie: true,
+			want: http.StatusOK},
+		{name: "exempt path is exact", method: http.MethodPost, path: "/api/auth/login/extra", authCookie: true,
+			want: http.StatusForbidden},
+		{name: "bearer token only", method: http.MethodPost, path: "/api/user",
+			authorization: "Bearer token", want: http.StatusOK},
+		{name: "bearer token beside auth cookie", method: http.MethodPost, path: "/api/user", authCookie: true,
+			authorization: "Bearer token", want: http.StatusForbidden},
+		{name: "disabled in production", cfg: &config.Config{Environment: "production", CSRFDisabled: true},
+			method: http.MethodPost, path: "/api/user", authCookie: true, want: http.StatusForbidden},
+		{name: "disabled in development", cfg: &config.Config{Environment: "development", CSRFDisabled: true},
+			method: http.MethodPost, path: "/api/user", authCookie: true, want: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testCfg := cfg
+			if tt.cfg != nil {
+				testCfg = tt.cfg
+			}
+
+			router := gin.New()
+			router.Use(CSRFMiddleware(testCfg))
+			router.Handle(tt.method, tt.path, func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.authCookie {
+				req.AddCookie(&http.Cookie{Name: "auth_token", Value: "token"})
+			}
+			if tt.csrfCookie != "" {
+				req.AddCookie(&http.Cookie{Name: CSRFCookieName, Value: tt.csrfCookie})
+			}
+			if tt.csrfHeader != "" {
+				req.Header.Set(CSRFHeaderName, tt.csrfHeader)
+			}
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("got status %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSRFExempt(t *testing.T) {
+	exempt := []string{"/api/auth/login", "/api/public/*"}
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/api/auth/login", true},
+		{"/api/auth/login/", false},
+		{"/api/auth/logout", false},
+		{"/api/public/", true},
+		{"/api/public/foods", true},
+		{"/api/publicity", false},
+		{"/", false},
+	}
+	for _, tt := range tests {
+		if got := csrfExempt(tt.path, exempt); got != tt.want {
+			t.Errorf("csrfExempt(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
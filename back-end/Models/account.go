@@ -0,0 +1,179 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	mailer "HabitBite/backend/Mailer"
+)
+
+// Account deletion errors
+var (
+	ErrDeletionAlreadyScheduled = errors.New("account deletion is already scheduled")
+	ErrDeletionNotScheduled     = errors.New("account deletion is not scheduled")
+)
+
+// purgeBatchSize limits how many due accounts one purge run deletes
+const purgeBatchSize = 100
+
+// DataTable holds every row stored about a user in one table
+type DataTable struct {
+	Name    string
+	Columns []string
+	Rows    [][]interface{}
+}
+
+// AccountRepository defines the account deletion and export storage.
+// ScheduleDeletion and CancelDeletion report whether the account changed.
+// PurgeUser deletes the user together with every row they own.
+// ExportUserData returns the user's rows from every table that holds them,
+// leaving out secrets such as password and token hashes.
+type AccountRepository interface {
+	ScheduleDeletion(ctx context.Context, userID int, at time.Time) (bool, error)
+	CancelDeletion(ctx context.Context, userID int) (bool, error)
+	FindDueDeletions(ctx context.Context, now time.Time, limit int) ([]int, error)
+	PurgeUser(ctx context.Context, userID int) error
+	ExportUserData(ctx context.Context, userID int) ([]DataTable, error)
+}
+
+// AccountService lets users delete their account and take their data with
+// them. A deletion only happens after a grace period, during which the user
+// can still sign in and cancel it.
+type AccountService struct {
+	repo        AccountRepository
+	userService *UserService
+	mailer      mailer.Mailer
+	grace       time.Duration
+	baseURL     string
+}
+
+// NewAccountService creates a new account service. Emails point at
+// baseURL + "/settings/account", where a deletion can be cancelled.
+func NewAccountService(repo AccountRepository, userService *UserService, m mailer.Mailer, grace time.Duration, baseURL string) *AccountService {
+	return &AccountService{
+		repo:        repo,
+		userService: userService,
+		mailer:      m,
+		grace:       grace,
+		baseURL:     baseURL,
+	}
+}
+
+// ScheduleDeletion schedules the user's account for deletion once the grace
+// period has passed and returns when that will be
+func (s *AccountService) ScheduleDeletion(ctx context.Context, user *User) (time.Time, error) {
+	if user.DeletionScheduledAt != nil {
+		return time.Time{}, ErrDeletionAlreadyScheduled
+	}
+
+	at := time.Now().Add(s.grace).Truncate(time.Second)
+	scheduled, err := s.repo.ScheduleDeletion(ctx, user.ID, at)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !scheduled {
+		return time.Time{}, ErrDeletionAlreadyScheduled
+	}
+
+	log.Printf("User %d scheduled their account for deletion at %s", user.ID, at.Format(time.RFC3339))
+	s.notify(ctx, user, "Your HabitBite account will be deleted", fmt.Sprintf(
+		"Your HabitBite account and all of its data will be deleted on %s.\n\n"+
+			"Changed your mind? Sign in and cancel the deletion before then:\n\n"+
+			"%s\n",
+		at.Format("2 January 2006 at 15:04 MST"), s.baseURL+"/settings/account"))
+
+	return at, nil
+}
+
+// CancelDeletion keeps an account that was scheduled for deletion
+func (s *AccountService) CancelDeletion(ctx context.Context, user *User) error {
+	cancelled, err := s.repo.CancelDeletion(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if !cancelled {
+		return ErrDeletionNotScheduled
+	}
+
+	log.Printf("User %d cancelled the deletion of their account", user.ID)
+	s.notify(ctx, user, "Your HabitBite account will not be deleted",
+		"The deletion of your HabitBite account has been cancelled. Your data stays as it is.\n")
+
+	return nil
+}
+
+// Export returns everything stored about the user
+func (s *AccountService) Export(ctx context.Context, userID int) (*AccountExport, error) {
+	tables, err := s.repo.ExportUserData(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AccountExport{
+		UserID:     userID,
+		ExportedAt: time.Now(),
+		Tables:     tables,
+	}, nil
+}
+
+// RunPurge periodically deletes accounts whose grace period has passed until ctx is cancelled
+func (s *AccountService) RunPurge(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.PurgeDue(ctx); err != nil {
+				log.Printf("Account purge failed: %v", err)
+			}
+		}
+	}
+}
+
+// PurgeDue deletes the accounts whose grace period has passed, telling each
+// user once their data is gone
+func (s *AccountService) PurgeDue(ctx context.Context) error {
+	userIDs, err := s.repo.FindDueDeletions(ctx, time.Now(), purgeBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, userID := range userIDs {
+		user, err := s.userService.FindByID(ctx, userID)
+		if err != nil {
+			log.Printf("Error loading user %d before purge: %v", userID, err)
+			continue
+		}
+
+		if err := s.repo.PurgeUser(ctx, userID); err != nil {
+			log.Printf("Error purging user %d: %v", userID, err)
+			continue
+		}
+
+		log.Printf("Purged account of user %d", userID)
+		s.notify(ctx, user, "Your HabitBite account has been deleted",
+			"As you asked, your HabitBite account and all of its data have been deleted.\n")
+	}
+
+	return nil
+}
+
+// notify emails the user about their account. Delivery failures are logged,
+// as they must not undo the change.
+func (s *AccountService) notify(ctx context.Context, user *User, subject, body string) {
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: subject,
+		Body:    fmt.Sprintf("Hi %s,\n\n%s", user.Username, body),
+	}
+
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		log.Printf("Failed to send account email to user %d: %v", user.ID, err)
+	}
+}
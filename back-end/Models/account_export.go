@@ -0,0 +1,107 @@
+package models
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// AccountExport is everything stored about a user, table by table
+type AccountExport struct {
+	UserID     int
+	ExportedAt time.Time
+	Tables     []DataTable
+}
+
+// MarshalJSON writes each table as a list of objects keyed by column name
+func (e *AccountExport) MarshalJSON() ([]byte, error) {
+	tables := make(map[string][]map[string]interface{}, len(e.Tables))
+	for _, table := range e.Tables {
+		rows := make([]map[string]interface{}, 0, len(table.Rows))
+		for _, row := range table.Rows {
+			record := make(map[string]interface{}, len(table.Columns))
+			for i, column := range table.Columns {
+				record[column] = row[i]
+			}
+			rows = append(rows, record)
+		}
+		tables[table.Name] = rows
+	}
+
+	return json.Marshal(struct {
+		UserID     int                                 `json:"userId"`
+		ExportedAt time.Time                           `json:"exportedAt"`
+		Tables     map[string][]map[string]interface{} `json:"tables"`
+	}{e.UserID, e.ExportedAt, tables})
+}
+
+// WriteArchive writes the export as a zip archive holding data.json and one
+// CSV file per table
+func (e *AccountExport) WriteArchive(w io.Writer) error {
+	archive := zip.NewWriter(w)
+
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	file, err := archive.Create("data.json")
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		return err
+	}
+
+	for _, table := range e.Tables {
+		file, err := archive.Create(table.Name + ".csv")
+		if err != nil {
+			return err
+		}
+		if err := writeTableCSV(file, table); err != nil {
+			return fmt.Errorf("failed to write %s.csv: %v", table.Name, err)
+		}
+	}
+
+	return archive.Close()
+}
+
+// writeTableCSV writes a table with a header row of column names
+func writeTableCSV(w io.Writer, table DataTable) error {
+	out := csv.NewWriter(w)
+	if err := out.Write(table.Columns); err != nil {
+		return err
+	}
+
+	record := make([]string, len(table.Columns))
+	for _, row := range table.Rows {
+		for i, value := range row {
+			record[i] = csvValue(value)
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+
+	out.Flush()
+	return out.Error()
+}
+
+// csvValue formats a column value for CSV; NULL becomes an empty field
+func csvValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
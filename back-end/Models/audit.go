@@ -0,0 +1,216 @@
+package models
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Audited actions
+const (
+	AuditLogin            = "auth.login"
+	AuditLoginFailed      = "auth.login_failed"
+	AuditGoalsUpdated     = "goals.update"
+	AuditGoalsRecalculate = "goals.recalculate"
+	AuditEntryDeleted     = "food_entry.delete"
+	AuditUsersListed      = "user.list"
+	AuditUserViewed       = "user.view"
+	AuditRoleChanged      = "user.role_change"
+	AuditUserDisabled     = "user.disable"
+	AuditUserEnabled      = "user.enable"
+	AuditPasswordReset    = "user.password_reset"
+	AuditUserUnlocked     = "user.unlock"
+
+	AuditImpersonationStarted = "impersonation.start"
+	AuditImpersonatedRequest  = "impersonation.request"
+)
+
+// Audit log listing limits
+const (
+	DefaultAuditLimit = 50
+	MaxAuditLimit     = 500
+)
+
+// maxAuditUserAgentLength is the longest user agent stored with an entry
+const maxAuditUserAgentLength = 512
+
+// AuditData is a JSON document stored with an audit entry. It is written
+// as is in responses and is null when empty.
+type AuditData []byte
+
+// Scan implements sql.Scanner
+func (d *AuditData) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*d = nil
+	case []byte:
+		*d = append(AuditData(nil), v...)
+	case string:
+		*d = AuditData(v)
+	default:
+		return fmt.Errorf("cannot scan %T into AuditData", value)
+	}
+	return nil
+}
+
+// Value implements driver.Valuer
+func (d AuditData) Value() (driver.Value, error) {
+	if len(d) == 0 {
+		return nil, nil
+	}
+	return string(d), nil
+}
+
+// MarshalJSON implements json.Marshaler
+func (d AuditData) MarshalJSON() ([]byte, error) {
+	if len(d) == 0 {
+		return []byte("null"), nil
+	}
+	return d, nil
+}
+
+// AuditEntry is one recorded event. ActorID is who did it and SubjectID the
+// user it was done to; either is nil when there is none, such as a failed
+// login for an unknown email.
+type AuditEntry struct {
+	ID        int64     `db:"id" json:"id"`
+	ActorID   *int      `db:"actor_id" json:"actorId"`
+	SubjectID *int      `db:"subject_id" json:"subjectId"`
+	Action    string    `db:"action" json:"action"`
+	IPAddress string    `db:"ip_address" json:"ipAddress"`
+	UserAgent string    `db:"user_agent" json:"userAgent"`
+	Before    AuditData `db:"before_data" json:"before"`
+	After     AuditData `db:"after_data" json:"after"`
+	CreatedAt time.Time `db:"created_at" json:"createdAt"`
+}
+
+// AuditEvent describes an event to record. Zero IDs mean nobody; Before
+// and After are stored as JSON and left out when nil.
+type AuditEvent struct {
+	ActorID   int
+	SubjectID int
+	Action    string
+	IPAddress string
+	UserAgent string
+	Before    interface{}
+	After     interface{}
+}
+
+// AuditQuery filters the audit log; zero fields match everything.
+// UserID matches entries where the user is either actor or subject.
+type AuditQuery struct {
+	ActorID   int
+	SubjectID int
+	UserID    int
+	Action    string
+	From      *time.Time
+	Before    *time.Time
+	Limit     int
+	Offset    int
+}
+
+// AuditRepository defines the audit log storage. It has no way to change
+// or remove entries; only purging an account strips its personal data from
+// them. SearchAudit returns one page of matching entries, newest first, and
+// the number of matches.
+type AuditRepository interface {
+	InsertAuditEntry(ctx context.Context, entry *AuditEntry) error
+	SearchAudit(ctx context.Context, query AuditQuery) ([]*AuditEntry, int, error)
+}
+
+// AuditService keeps an append-only record of security and data-changing
+// events. A nil service records nothing.
+type AuditService struct {
+	repo AuditRepository
+}
+
+// NewAuditService creates a new audit service
+func NewAuditService(repo AuditRepository) *AuditService {
+	return &AuditService{repo: repo}
+}
+
+// Record stores an event. A failure is logged rather than returned, so the
+// action being audited is not undone after the fact.
+func (s *AuditService) Record(ctx context.Context, event AuditEvent) {
+	if s == nil {
+		return
+	}
+
+	entry := &AuditEntry{
+		ActorID:   optionalUserID(event.ActorID),
+		SubjectID: optionalUserID(event.SubjectID),
+		Action:    event.Action,
+		IPAddress: event.IPAddress,
+		UserAgent: event.UserAgent,
+		CreatedAt: time.Now(),
+	}
+	if len(entry.UserAgent) > maxAuditUserAgentLength {
+		entry.UserAgent = entry.UserAgent[:maxAuditUserAgentLength]
+	}
+
+	var err error
+	if entry.Before, err = auditData(event.Before); err != nil {
+		log.Printf("Failed to encode audit data for %s: %v", event.Action, err)
+	}
+	if entry.After, err = auditData(event.After); err != nil {
+		log.Printf("Failed to encode audit data for %s: %v", event.Action, err)
+	}
+
+	if err := s.repo.InsertAuditEntry(ctx, entry); err != nil {
+		log.Printf("Failed to record audit event %s (actor %d, subject %d): %v",
+			event.Action, event.ActorID, event.SubjectID, err)
+	}
+}
+
+// RecordImpersonatedRequest stores a request an admin made as another user,
+// with the response status
+func (s *AuditService) RecordImpersonatedRequest(ctx context.Context, adminID, userID int, method, path, ipAddress, userAgent string, status int) {
+	s.Record(ctx, AuditEvent{
+		ActorID:   adminID,
+		SubjectID: userID,
+		Action:    AuditImpersonatedRequest,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		After:     map[string]interface{}{"method": method, "path": path, "status": status},
+	})
+}
+
+// Search returns one page of audit entries matching the query, newest
+// first, and the number of matches
+func (s *AuditService) Search(ctx context.Context, query AuditQuery) ([]*AuditEntry, int, error) {
+	if query.Limit <= 0 {
+		query.Limit = DefaultAuditLimit
+	}
+	if query.Limit > MaxAuditLimit {
+		query.Limit = MaxAuditLimit
+	}
+	if query.Offset < 0 {
+		query.Offset = 0
+	}
+
+	return s.repo.SearchAudit(ctx, query)
+}
+
+// optionalUserID returns nil for the zero ID
+func optionalUserID(id int) *int {
+	if id == 0 {
+		return nil
+	}
+	return &id
+}
+
+// auditData encodes a value for an audit entry, leaving nil values and nil
+// pointers out
+func auditData(v interface{}) (AuditData, error) {
+	if v == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil || string(data) == "null" {
+		return nil, err
+	}
+	return AuditData(data), nil
+}
@@ -0,0 +1,198 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Diet constants; an empty diet means no restriction
+const (
+	DietNone       = ""
+	DietVegetarian = "vegetarian"
+	DietVegan      = "vegan"
+	DietKeto       = "keto"
+)
+
+// Allergen constants
+const (
+	AllergenPeanuts   = "peanuts"
+	AllergenTreeNuts  = "tree_nuts"
+	AllergenGluten    = "gluten"
+	AllergenLactose   = "lactose"
+	AllergenEggs      = "eggs"
+	AllergenSoy       = "soy"
+	AllergenFish      = "fish"
+	AllergenShellfish = "shellfish"
+	AllergenSesame    = "sesame"
+)
+
+// Warning types reported when a food conflicts with a diet profile
+const (
+	WarningDiet     = "diet"
+	WarningAllergen = "allergen"
+)
+
+// StringList is a list of short identifiers stored as a comma-separated column.
+// The format matches MySQL's FIND_IN_SET so lists can be filtered in queries.
+type StringList []string
+
+// Scan implements sql.Scanner
+func (l *StringList) Scan(value interface{}) error {
+	var raw string
+	switch v := value.(type) {
+	case nil:
+		*l = StringList{}
+		return nil
+	case []byte:
+		raw = string(v)
+	case string:
+		raw = v
+	default:
+		return fmt.Errorf("cannot scan %T into StringList", value)
+	}
+
+	list := StringList{}
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	*l = list
+	return nil
+}
+
+// Value implements driver.Valuer
+func (l StringList) Value() (driver.Value, error) {
+	return strings.Join(l, ","), nil
+}
+
+// Contains reports whether the list holds item
+func (l StringList) Contains(item string) bool {
+	for _, v := range l {
+		if v == item {
+			return true
+		}
+	}
+	return false
+}
+
+// normalized returns a sorted, lower-cased copy of the list without duplicates
+func (l StringList) normalized() StringList {
+	seen := make(map[string]bool, len(l))
+	out := StringList{}
+	for _, item := range l {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == "" || seen[item] {
+			continue
+		}
+		seen[item] = true
+		out = append(out, item)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// DietProfile is a user's dietary pattern and allergens
+type DietProfile struct {
+	Diet      string     `json:"diet" binding:"omitempty,oneof=vegetarian vegan keto"`
+	Allergens StringList `json:"allergens" binding:"omitempty,max=20,dive,oneof=peanuts tree_nuts gluten lactose eggs soy fish shellfish sesame"`
+}
+
+// IsEmpty reports whether the profile restricts nothing
+func (p DietProfile) IsEmpty() bool {
+	return p.Diet == DietNone && len(p.Allergens) == 0
+}
+
+// Normalize lower-cases, sorts and de-duplicates the allergens
+func (p *DietProfile) Normalize() {
+	p.Allergens = p.Allergens.normalized()
+}
+
+// Conflicts lists the ways a catalog food conflicts with the profile
+func (p DietProfile) Conflicts(food *Food) []DietWarning {
+	var warnings []DietWarning
+
+	switch p.Diet {
+	case DietVegetarian:
+		if !food.Vegetarian {
+			warnings = append(warnings, DietWarning{Type: WarningDiet, Code: DietVegetarian,
+				Message: fmt.Sprintf("%s is not vegetarian", food.Name)})
+		}
+	case DietVegan:
+		if !food.Vegan {
+			warnings = append(warnings, DietWarning{Type: WarningDiet, Code: DietVegan,
+				Message: fmt.Sprintf("%s is not vegan", food.Name)})
+		}
+	case DietKeto:
+		if !food.KetoFriendly {
+			warnings = append(warnings, DietWarning{Type: WarningDiet, Code: DietKeto,
+				Message: fmt.Sprintf("%s is not keto-friendly", food.Name)})
+		}
+	}
+
+	for _, allergen := range p.Allergens {
+		if food.Allergens.Contains(allergen) {
+			warnings = append(warnings, DietWarning{Type: WarningAllergen, Code: allergen,
+				Message: fmt.Sprintf("%s contains %s", food.Name, strings.ReplaceAll(allergen, "_", " "))})
+		}
+	}
+
+	return warnings
+}
+
+// DietWarning describes one conflict between a food and a diet profile
+type DietWarning struct {
+	Type    string `json:"type"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Food is a catalog entry keyed by its USDA food ID, with per-100g
+// nutrition and the flags used for diet and allergen checks
+type Food struct {
+	FoodID       string     `db:"food_id" json:"foodId"`
+	Name         string     `db:"name" json:"name"`
+	Calories     float64    `db:"calories" json:"calories"`
+	Protein      float64    `db:"protein" json:"protein"`
+	Carbs        float64    `db:"carbs" json:"carbs"`
+	Fat          float64    `db:"fats" json:"fat"`
+	Vegetarian   bool       `db:"is_vegetarian" json:"vegetarian"`
+	Vegan        bool       `db:"is_vegan" json:"vegan"`
+	KetoFriendly bool       `db:"is_keto" json:"ketoFriendly"`
+	Allergens    StringList `db:"allergens" json:"allergens"`
+	CreatedAt    time.Time  `db:"created_at" json:"createdAt"`
+	UpdatedAt    time.Time  `db:"updated_at" json:"updatedAt"`
+}
+
+// Normalize makes the flags consistent: vegan foods are vegetarian and
+// allergens are stored sorted and lower-cased
+func (f *Food) Normalize() {
+	if f.Vegan {
+		f.Vegetarian = true
+	}
+	f.Allergens = f.Allergens.normalized()
+}
+
+// FoodRequest represents the request body for adding or updating a catalog food
+type FoodRequest struct {
+	Name         string     `json:"name" binding:"required,max=255"`
+	Calories     float64    `json:"calories" binding:"gte=0"`
+	Protein      float64    `json:"protein" binding:"gte=0"`
+	Carbs        float64    `json:"carbs" binding:"gte=0"`
+	Fat          float64    `json:"fat" binding:"gte=0"`
+	Vegetarian   bool       `json:"vegetarian"`
+	Vegan        bool       `json:"vegan"`
+	KetoFriendly bool       `json:"ketoFriendly"`
+	Allergens    StringList `json:"allergens" binding:"omitempty,max=20,dive,oneof=peanuts tree_nuts gluten lactose eggs soy fish shellfish sesame"`
+}
+
+// FoodSearch holds the parameters of a catalog search. When Exclude is set,
+// foods conflicting with that profile are left out.
+type FoodSearch struct {
+	Query   string
+	Limit   int
+	Exclude *DietProfile
+}
@@ -0,0 +1,123 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	mailer "HabitBite/backend/Mailer"
+)
+
+// Email change errors
+var (
+	ErrEmailChangeInvalid = errors.New("invalid or expired email change link")
+	ErrEmailUnchanged     = errors.New("new email is the same as the current one")
+	ErrEmailInUse         = errors.New("email address is already in use")
+)
+
+// RequestEmailChange emails a confirmation link to the new address. The
+// account keeps its current email until the link is used, and the current
+// address is told that a change was asked for.
+func (s *EmailVerificationService) RequestEmailChange(ctx context.Context, user *User, newEmail string) error {
+	newEmail = strings.ToLower(strings.TrimSpace(newEmail))
+	if strings.EqualFold(newEmail, user.Email) {
+		return ErrEmailUnchanged
+	}
+
+	taken, err := s.userService.EmailExists(ctx, newEmail)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrEmailInUse
+	}
+
+	token, err := s.tokens.IssueEmailChangeToken(user.ID, user.Email, newEmail)
+	if err != nil {
+		return err
+	}
+
+	link := s.baseURL + "/confirm-email-change?token=" + url.QueryEscape(token)
+	msg := mailer.Message{
+		To:      newEmail,
+		Subject: "Confirm your new HabitBite email address",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"You asked to use this address for your HabitBite account. Confirm the change by opening this link:\n\n"+
+			"%s\n\n"+
+			"If you did not ask for this, you can ignore this email and nothing will change.\n",
+			user.Username, link),
+	}
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		return err
+	}
+
+	s.notifyEmailChange(ctx, user, user.Email, fmt.Sprintf(
+		"Someone asked to change the email address of your HabitBite account to %s.\n"+
+			"The change only happens once the new address is confirmed.\n\n"+
+			"If this was not you, change your password now: %s\n",
+		newEmail, s.baseURL+"/forgot-password"))
+
+	return nil
+}
+
+// ConfirmEmailChange checks an email change token and moves the account to
+// the new address, which counts as verified. A link stops working once the
+// account's email is no longer the one it was issued from.
+func (s *EmailVerificationService) ConfirmEmailChange(ctx context.Context, token string) (*User, error) {
+	userID, oldEmail, newEmail, err := s.tokens.ParseEmailChangeToken(token)
+	if err != nil {
+		return nil, ErrEmailChangeInvalid
+	}
+
+	user, err := s.userService.FindByID(ctx, userID)
+	if err != nil {
+		log.Printf("Email change for missing user %d: %v", userID, err)
+		return nil, ErrEmailChangeInvalid
+	}
+
+	if !strings.EqualFold(user.Email, oldEmail) {
+		return nil, ErrEmailChangeInvalid
+	}
+
+	// The address may have been registered since the link was sent
+	taken, err := s.userService.EmailExists(ctx, newEmail)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, ErrEmailInUse
+	}
+
+	changed, err := s.userService.ChangeEmail(ctx, user.ID, user.Email, newEmail)
+	if err != nil {
+		return nil, err
+	}
+	if !changed {
+		return nil, ErrEmailChangeInvalid
+	}
+
+	log.Printf("User %d changed their email address", user.ID)
+	s.notifyEmailChange(ctx, user, oldEmail, fmt.Sprintf(
+		"The email address of your HabitBite account was changed to %s.\n\n"+
+			"If this was not you, contact support right away.\n",
+		newEmail))
+
+	return s.userService.FindByID(ctx, user.ID)
+}
+
+// notifyEmailChange sends a security notice to an address. Delivery
+// failures are logged, as they must not undo the change.
+func (s *EmailVerificationService) notifyEmailChange(ctx context.Context, user *User, to, body string) {
+	msg := mailer.Message{
+		To:      to,
+		Subject: "Email change on your HabitBite account",
+		Body:    fmt.Sprintf("Hi %s,\n\n%s", user.Username, body),
+	}
+
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		log.Printf("Failed to send email change notice to user %d: %v", user.ID, err)
+	}
+}
@@ -0,0 +1,120 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	mailer "HabitBite/backend/Mailer"
+)
+
+// Email verification errors
+var (
+	ErrEmailVerificationInvalid = errors.New("invalid or expired verification link")
+	ErrEmailAlreadyVerified     = errors.New("email is already verified")
+)
+
+// VerificationTokenIssuer signs and checks email verification and email
+// change tokens. It is defined here to avoid importing the token package.
+type VerificationTokenIssuer interface {
+	IssueEmailVerificationToken(userID int, email string) (string, error)
+	ParseEmailVerificationToken(raw string) (int, string, error)
+	IssueEmailChangeToken(userID int, oldEmail, newEmail string) (string, error)
+	ParseEmailChangeToken(raw string) (int, string, string, error)
+}
+
+// EmailVerificationService sends signed verification links and marks
+// addresses as verified when a link is used. A link is bound to the
+// address it was sent to, so it stops working if the email changes.
+type EmailVerificationService struct {
+	userService *UserService
+	tokens      VerificationTokenIssuer
+	mailer      mailer.Mailer
+	baseURL     string
+}
+
+// NewEmailVerificationService creates a new email verification service.
+// Verification links point at baseURL + "/verify-email".
+func NewEmailVerificationService(userService *UserService, tokens VerificationTokenIssuer, m mailer.Mailer, baseURL string) *EmailVerificationService {
+	return &EmailVerificationService{
+		userService: userService,
+		tokens:      tokens,
+		mailer:      m,
+		baseURL:     baseURL,
+	}
+}
+
+// SendVerification emails a verification link to the user's current address
+func (s *EmailVerificationService) SendVerification(ctx context.Context, user *User) error {
+	if user.EmailVerified {
+		return ErrEmailAlreadyVerified
+	}
+
+	token, err := s.tokens.IssueEmailVerificationToken(user.ID, user.Email)
+	if err != nil {
+		return err
+	}
+
+	link := s.baseURL + "/verify-email?token=" + url.QueryEscape(token)
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your HabitBite email address",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Please confirm that this is your email address by opening this link:\n\n"+
+			"%s\n\n"+
+			"If you did not create a HabitBite account, you can ignore this email.\n",
+			user.Username, link),
+	}
+
+	return s.mailer.Send(ctx, msg)
+}
+
+// ResendVerification sends a new verification link to a user
+func (s *EmailVerificationService) ResendVerification(ctx context.Context, userID int) error {
+	user, err := s.userService.FindByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return s.SendVerification(ctx, user)
+}
+
+// Verify checks a verification token and marks the address it was issued
+// for as verified. Using a link again after success is harmless.
+func (s *EmailVerificationService) Verify(ctx context.Context, token string) (*User, error) {
+	userID, email, err := s.tokens.ParseEmailVerificationToken(token)
+	if err != nil {
+		return nil, ErrEmailVerificationInvalid
+	}
+
+	user, err := s.userService.FindByID(ctx, userID)
+	if err != nil {
+		// Most often the account was deleted after the link was sent
+		log.Printf("Email verification for missing user %d: %v", userID, err)
+		return nil, ErrEmailVerificationInvalid
+	}
+
+	if !strings.EqualFold(user.Email, email) {
+		return nil, ErrEmailVerificationInvalid
+	}
+	if user.EmailVerified {
+		return user, nil
+	}
+
+	if _, err := s.userService.MarkEmailVerified(ctx, user.ID, user.Email); err != nil {
+		return nil, err
+	}
+
+	return s.userService.FindByID(ctx, user.ID)
+}
+
+// IsEmailVerified reports whether a user's email address is verified
+func (s *EmailVerificationService) IsEmailVerified(ctx context.Context, userID int) (bool, error) {
+	user, err := s.userService.FindByID(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return user.EmailVerified, nil
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"context"
+)
+
+// FoodRepository defines the food catalog storage the catalog service needs.
+// GetFood returns nil for foods missing from the catalog.
+type FoodRepository interface {
+	GetFood(ctx context.Context, foodID string) (*Food, error)
+	SearchFoods(ctx context.Context, search FoodSearch) ([]*Food, error)
+	SaveFood(ctx context.Context, food *Food) error
+}
+
+// FoodCatalogService checks catalog foods against users' diet profiles
+type FoodCatalogService struct {
+	userService *UserService
+	foodRepo    FoodRepository
+}
+
+// NewFoodCatalogService creates a new food catalog service
+func NewFoodCatalogService(userService *UserService, foodRepo FoodRepository) *FoodCatalogService {
+	return &FoodCatalogService{
+		userService: userService,
+		foodRepo:    foodRepo,
+	}
+}
+
+// GetFood returns a catalog food with any conflicts for the user's diet profile,
+// or a nil food if it is not in the catalog
+func (s *FoodCatalogService) GetFood(ctx context.Context, userID int, foodID string) (*Food, []DietWarning, error) {
+	user, err := s.userService.FindByID(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	food, err := s.foodRepo.GetFood(ctx, foodID)
+	if err != nil || food == nil {
+		return nil, nil, err
+	}
+
+	return food, user.DietProfile().Conflicts(food), nil
+}
+
+// SearchFoods searches the catalog; with excludeConflicts set, foods that
+// conflict with the user's diet profile are left out
+func (s *FoodCatalogService) SearchFoods(ctx context.Context, userID int, query string, limit int, excludeConflicts bool) ([]*Food, error) {
+	search := FoodSearch{Query: query, Limit: limit}
+
+	if excludeConflicts {
+		user, err := s.userService.FindByID(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if profile := user.DietProfile(); !profile.IsEmpty() {
+			search.Exclude = &profile
+		}
+	}
+
+	return s.foodRepo.SearchFoods(ctx, search)
+}
+
+// CheckFood returns the conflicts between a food and the user's diet profile.
+// Foods missing from the catalog carry no flags and produce no warnings.
+func (s *FoodCatalogService) CheckFood(ctx context.Context, userID int, foodID string) ([]DietWarning, error) {
+	user, err := s.userService.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	profile := user.DietProfile()
+	if profile.IsEmpty() {
+		return nil, nil
+	}
+
+	food, err := s.foodRepo.GetFood(ctx, foodID)
+	if err != nil || food == nil {
+		return nil, err
+	}
+
+	return profile.Conflicts(food), nil
+}
+
+// SaveFood adds or updates a catalog food
+func (s *FoodCatalogService) SaveFood(ctx context.Context, food *Food) error {
+	food.Normalize()
+	return s.foodRepo.SaveFood(ctx, food)
+}
@@ -35,6 +35,9 @@ type DailyNutrition struct {
 	TotalProtein  float64   `json:"total_protein"`
 	TotalCarbs    float64   `json:"total_carbs"`
 	TotalFats     float64   `json:"total_fats"`
+
+	// Targets that applied on this date, when requested
+	Targets *EffectiveGoals `json:"targets,omitempty"`
 }
 
 // FoodEntryRequest represents the request body for adding a food entry
@@ -0,0 +1,450 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"time"
+
+	nutrition "HabitBite/backend/Nutrition"
+)
+
+// Goal recalculation job statuses
+const (
+	GoalJobPending   = "pending"
+	GoalJobRunning   = "running"
+	GoalJobCompleted = "completed"
+	GoalJobFailed    = "failed"
+	GoalJobCancelled = "cancelled"
+)
+
+// Goal recalculation errors
+var (
+	ErrGoalJobNotFound   = errors.New("goal recalculation job not found")
+	ErrGoalJobNotActive  = errors.New("only pending or running jobs can be cancelled")
+	ErrGoalJobNotStopped = errors.New("only failed or cancelled jobs can be resumed")
+	ErrInvalidGoalType   = errors.New("goal type must be lose, maintain or gain")
+)
+
+// goalJobPageSize is how many users a job processes between saving its progress
+const goalJobPageSize = 200
+
+// goalJobLease is how long a running job may go without saving progress
+// before another worker takes it over, e.g. after a server restart
+const goalJobLease = 5 * time.Minute
+
+// Goal change listing limits
+const (
+	DefaultGoalChangeLimit = 50
+	MaxGoalChangeLimit     = 500
+)
+
+// GoalRecalculationJob recalculates the macro targets of every user, or of
+// those with one goal type, from their daily calorie goal. Users are
+// processed in ID order and CursorUserID is the last one done, so a job
+// that stops part way resumes where it left off. A dry run records the
+// changes it would make without saving them.
+type GoalRecalculationJob struct {
+	ID           int        `db:"id" json:"id"`
+	Status       string     `db:"status" json:"status"`
+	DryRun       bool       `db:"dry_run" json:"dryRun"`
+	GoalType     string     `db:"goal_type" json:"goalType,omitempty"`
+	RequestedBy  *int       `db:"requested_by" json:"requestedBy,omitempty"`
+	TotalUsers   int        `db:"total_users" json:"totalUsers"`
+	CursorUserID int        `db:"cursor_user_id" json:"cursorUserId"`
+	Processed    int        `db:"processed" json:"processed"`
+	Changed      int        `db:"changed" json:"changed"`
+	Failed       int        `db:"failed" json:"failed"`
+	Error        *string    `db:"error" json:"error,omitempty"`
+	CreatedAt    time.Time  `db:"created_at" json:"createdAt"`
+	StartedAt    *time.Time `db:"started_at" json:"startedAt,omitempty"`
+	HeartbeatAt  *time.Time `db:"heartbeat_at" json:"-"`
+	FinishedAt   *time.Time `db:"finished_at" json:"finishedAt,omitempty"`
+}
+
+// Progress returns the share of users processed, from 0 to 100
+func (j *GoalRecalculationJob) Progress() float64 {
+	if j.Status == GoalJobCompleted {
+		return 100
+	}
+	if j.TotalUsers == 0 {
+		return 0
+	}
+	return math.Min(100, math.Round(float64(j.Processed)*1000/float64(j.TotalUsers))/10)
+}
+
+// GoalChange is one user's macro targets before and after a recalculation
+type GoalChange struct {
+	JobID          int     `db:"job_id" json:"-"`
+	UserID         int     `db:"user_id" json:"userId"`
+	BeforeCalories int     `db:"before_calories" json:"beforeCalories"`
+	BeforeProtein  float64 `db:"before_protein" json:"beforeProtein"`
+	BeforeCarbs    float64 `db:"before_carbs" json:"beforeCarbs"`
+	BeforeFats     float64 `db:"before_fats" json:"beforeFats"`
+	AfterCalories  int     `db:"after_calories" json:"afterCalories"`
+	AfterProtein   float64 `db:"after_protein" json:"afterProtein"`
+	AfterCarbs     float64 `db:"after_carbs" json:"afterCarbs"`
+	AfterFats      float64 `db:"after_fats" json:"afterFats"`
+}
+
+// GoalJobProgress is what a job has done so far, saved after every page
+type GoalJobProgress struct {
+	CursorUserID int
+	Processed    int
+	Changed      int
+	Failed       int
+}
+
+// GoalJobRepository defines the job storage the service needs.
+// ClaimJob marks the job running for this worker if it is pending or its
+// lease ran out, reporting whether it did. SaveProgress and FinishJob only
+// change running jobs and report whether the job was still running.
+// FindUsersAfter returns up to limit users with IDs above afterID in ID
+// order; an empty goalType matches everyone. FindGoals returns the stored
+// goals of the given users, leaving out users without any.
+type GoalJobRepository interface {
+	CreateJob(ctx context.Context, job *GoalRecalculationJob) error
+	FindJob(ctx context.Context, id int) (*GoalRecalculationJob, error)
+	ListJobs(ctx context.Context, limit int) ([]*GoalRecalculationJob, error)
+	FindClaimableJob(ctx context.Context, staleBefore time.Time) (*GoalRecalculationJob, error)
+	ClaimJob(ctx context.Context, id int, now, staleBefore time.Time) (bool, error)
+	SaveProgress(ctx context.Context, id int, progress GoalJobProgress, changes []GoalChange, now time.Time) (bool, error)
+	FinishJob(ctx context.Context, id int, status string, jobErr *string, now time.Time) (bool, error)
+	SetJobStatus(ctx context.Context, id int, from []string, to string, now time.Time) (bool, error)
+	ListChanges(ctx context.Context, jobID, limit, offset int) ([]*GoalChange, int, error)
+	CountUsers(ctx context.Context, goalType string) (int, error)
+	FindUsersAfter(ctx context.Context, afterID int, goalType string, limit int) ([]*User, error)
+	FindGoals(ctx context.Context, userIDs []int) ([]*UserGoals, error)
+}
+
+// GoalRecalculationService queues goal recalculation jobs and runs them in
+// the background
+type GoalRecalculationService struct {
+	repo        GoalJobRepository
+	userService *UserService
+	wake        chan struct{}
+}
+
+// NewGoalRecalculationService creates a new goal recalculation service
+func NewGoalRecalculationService(repo GoalJobRepository, userService *UserService) *GoalRecalculationService {
+	return &GoalRecalculationService{
+		repo:        repo,
+		userService: userService,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// Start queues a job recalculating the goals of users with goalType, or of
+// everyone when it is empty. The worker picks it up straight away.
+func (s *GoalRecalculationService) Start(ctx context.Context, requestedBy int, goalType string, dryRun bool) (*GoalRecalculationJob, error) {
+	if goalType != "" && goalType != GoalLose && goalType != GoalMaintain && goalType != GoalGain {
+		return nil, ErrInvalidGoalType
+	}
+
+	total, err := s.repo.CountUsers(ctx, goalType)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &GoalRecalculationJob{
+		Status:      GoalJobPending,
+		DryRun:      dryRun,
+		GoalType:    goalType,
+		RequestedBy: &requestedBy,
+		TotalUsers:  total,
+		CreatedAt:   time.Now().Truncate(time.Second),
+	}
+	if err := s.repo.CreateJob(ctx, job); err != nil {
+		return nil, err
+	}
+
+	log.Printf("User %d queued goal recalculation job %d (goal type %q, dry run %t, %d users)",
+		requestedBy, job.ID, goalType, dryRun, total)
+	s.notify()
+
+	return job, nil
+}
+
+// Get returns a job
+func (s *GoalRecalculationService) Get(ctx context.Context, id int) (*GoalRecalculationJob, error) {
+	job, err := s.repo.FindJob(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		return nil, ErrGoalJobNotFound
+	}
+	return job, nil
+}
+
+// List returns the most recent jobs, newest first
+func (s *GoalRecalculationService) List(ctx context.Context, limit int) ([]*GoalRecalculationJob, error) {
+	return s.repo.ListJobs(ctx, limit)
+}
+
+// Changes returns one page of the goal changes a job made, or would make in
+// a dry run, and the total number of changes
+func (s *GoalRecalculationService) Changes(ctx context.Context, jobID, limit, offset int) ([]*GoalChange, int, error) {
+	if _, err := s.Get(ctx, jobID); err != nil {
+		return nil, 0, err
+	}
+	if limit <= 0 {
+		limit = DefaultGoalChangeLimit
+	}
+	if limit > MaxGoalChangeLimit {
+		limit = MaxGoalChangeLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return s.repo.ListChanges(ctx, jobID, limit, offset)
+}
+
+// Cancel stops a pending or running job after the page it is working on
+func (s *GoalRecalculationService) Cancel(ctx context.Context, id int) (*GoalRecalculationJob, error) {
+	return s.transition(ctx, id, []string{GoalJobPending, GoalJobRunning}, GoalJobCancelled, ErrGoalJobNotActive)
+}
+
+// Resume queues a failed or cancelled job again. It carries on after the
+// last user it finished.
+func (s *GoalRecalculationService) Resume(ctx context.Context, id int) (*GoalRecalculationJob, error) {
+	job, err := s.transition(ctx, id, []string{GoalJobFailed, GoalJobCancelled}, GoalJobPending, ErrGoalJobNotStopped)
+	if err != nil {
+		return nil, err
+	}
+	s.notify()
+	return job, nil
+}
+
+// transition moves a job from one of the from statuses to status to
+func (s *GoalRecalculationService) transition(ctx context.Context, id int, from []string, to string, invalid error) (*GoalRecalculationJob, error) {
+	if _, err := s.Get(ctx, id); err != nil {
+		return nil, err
+	}
+
+	changed, err := s.repo.SetJobStatus(ctx, id, from, to, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !changed {
+		return nil, invalid
+	}
+
+	return s.Get(ctx, id)
+}
+
+// notify wakes the worker without waiting for it
+func (s *GoalRecalculationService) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// RunWorker runs queued jobs one at a time until ctx is cancelled. It looks
+// for work every interval and whenever a job is queued on this server, and
+// takes over running jobs whose worker stopped saving progress.
+func (s *GoalRecalculationService) RunWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for s.runNext(ctx) {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// runNext claims and runs one job, reporting whether there was one
+func (s *GoalRecalculationService) runNext(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	now := time.Now()
+	job, err := s.repo.FindClaimableJob(ctx, now.Add(-goalJobLease))
+	if err != nil {
+		log.Printf("Failed to look for goal recalculation jobs: %v", err)
+		return false
+	}
+	if job == nil {
+		return false
+	}
+
+	claimed, err := s.repo.ClaimJob(ctx, job.ID, now, now.Add(-goalJobLease))
+	if err != nil {
+		log.Printf("Failed to claim goal recalculation job %d: %v", job.ID, err)
+		return false
+	}
+	if !claimed {
+		// Another worker got there first
+		return true
+	}
+
+	if job.CursorUserID > 0 {
+		log.Printf("Resuming goal recalculation job %d after user %d", job.ID, job.CursorUserID)
+	}
+	s.run(ctx, job)
+	return true
+}
+
+// run processes a claimed job page by page until it is done, cancelled or
+// the server shuts down
+func (s *GoalRecalculationService) run(ctx context.Context, job *GoalRecalculationJob) {
+	progress := GoalJobProgress{
+		CursorUserID: job.CursorUserID,
+		Processed:    job.Processed,
+		Changed:      job.Changed,
+		Failed:       job.Failed,
+	}
+
+	for {
+		if ctx.Err() != nil {
+			// Left running; the lease runs out and the job resumes after a restart
+			return
+		}
+
+		users, err := s.repo.FindUsersAfter(ctx, progress.CursorUserID, job.GoalType, goalJobPageSize)
+		if err != nil {
+			s.fail(ctx, job.ID, err)
+			return
+		}
+		if len(users) == 0 {
+			break
+		}
+
+		changes, err := s.recalculatePage(ctx, job, users, &progress)
+		if err != nil {
+			s.fail(ctx, job.ID, err)
+			return
+		}
+
+		running, err := s.repo.SaveProgress(ctx, job.ID, progress, changes, time.Now())
+		if err != nil {
+			s.fail(ctx, job.ID, err)
+			return
+		}
+		if !running {
+			log.Printf("Goal recalculation job %d stopped; it is no longer running", job.ID)
+			return
+		}
+	}
+
+	if _, err := s.repo.FinishJob(ctx, job.ID, GoalJobCompleted, nil, time.Now()); err != nil {
+		log.Printf("Failed to complete goal recalculation job %d: %v", job.ID, err)
+		return
+	}
+	log.Printf("Goal recalculation job %d completed: %d processed, %d changed, %d failed",
+		job.ID, progress.Processed, progress.Changed, progress.Failed)
+}
+
+// recalculatePage works out the new goals of one page of users and, unless
+// the job is a dry run, saves those that changed. A user whose goals cannot
+// be saved counts as failed without stopping the job.
+func (s *GoalRecalculationService) recalculatePage(ctx context.Context, job *GoalRecalculationJob, users []*User, progress *GoalJobProgress) ([]GoalChange, error) {
+	ids := make([]int, len(users))
+	for i, user := range users {
+		ids[i] = user.ID
+	}
+
+	stored, err := s.repo.FindGoals(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	goalsByUser := make(map[int]*UserGoals, len(stored))
+	for _, goals := range stored {
+		goalsByUser[goals.UserID] = goals
+	}
+
+	var changes []GoalChange
+	for _, user := range users {
+		before, ok := goalsByUser[user.ID]
+		if !ok {
+			before = defaultGoals(user)
+		}
+		after := recalculatedGoals(user, before)
+
+		progress.CursorUserID = user.ID
+		progress.Processed++
+
+		if !goalsDiffer(before, after) {
+			continue
+		}
+
+		if !job.DryRun {
+			if err := s.userService.UpdateUserGoals(ctx, after); err != nil {
+				log.Printf("Goal recalculation job %d failed to update user %d: %v", job.ID, user.ID, err)
+				progress.Failed++
+				continue
+			}
+		}
+
+		progress.Changed++
+		changes = append(changes, GoalChange{
+			JobID:          job.ID,
+			UserID:         user.ID,
+			BeforeCalories: before.TargetCalories,
+			BeforeProtein:  before.TargetProtein,
+			BeforeCarbs:    before.TargetCarbs,
+			BeforeFats:     before.TargetFats,
+			AfterCalories:  after.TargetCalories,
+			AfterProtein:   after.TargetProtein,
+			AfterCarbs:     after.TargetCarbs,
+			AfterFats:      after.TargetFats,
+		})
+	}
+
+	return changes, nil
+}
+
+// fail marks a job failed so an admin can look into it and resume it
+func (s *GoalRecalculationService) fail(ctx context.Context, id int, err error) {
+	log.Printf("Goal recalculation job %d failed: %v", id, err)
+
+	message := err.Error()
+	if _, finishErr := s.repo.FinishJob(ctx, id, GoalJobFailed, &message, time.Now()); finishErr != nil {
+		log.Printf("Failed to record failure of goal recalculation job %d: %v", id, finishErr)
+	}
+}
+
+// defaultGoals returns the goals a user without stored goals starts from,
+// the same ones GetUserGoals would create for them
+func defaultGoals(user *User) *UserGoals {
+	macros := nutrition.MacrosFromSplit(user.DailyCalorieGoal, nutrition.DefaultSplitForGoal(user.GoalType))
+	return &UserGoals{
+		UserID:         user.ID,
+		TargetCalories: user.DailyCalorieGoal,
+		TargetProtein:  macros.Protein,
+		TargetCarbs:    macros.Carbs,
+		TargetFats:     macros.Fats,
+		TargetWeight:   user.Weight,
+	}
+}
+
+// recalculatedGoals returns the user's goals with the calorie target taken
+// from their daily calorie goal and the macro targets worked out again from
+// their stored macro preference
+func recalculatedGoals(user *User, goals *UserGoals) *UserGoals {
+	after := *goals
+	after.TargetCalories = user.DailyCalorieGoal
+	after.ApplyMacroTargets(nutrition.MacrosOrDefault(
+		after.TargetCalories, user.Weight, user.GoalType, after.MacroPreference()))
+	return &after
+}
+
+// goalsDiffer reports whether two sets of targets differ at the precision
+// they are stored with
+func goalsDiffer(a, b *UserGoals) bool {
+	round := func(v float64) float64 { return math.Round(v * 100) }
+	return a.TargetCalories != b.TargetCalories ||
+		round(a.TargetProtein) != round(b.TargetProtein) ||
+		round(a.TargetCarbs) != round(b.TargetCarbs) ||
+		round(a.TargetFats) != round(b.TargetFats)
+}
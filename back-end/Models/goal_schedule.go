@@ -0,0 +1,97 @@
+package models
+
+import (
+	"time"
+)
+
+// Goal schedule types
+const (
+	ScheduleWeekday = "weekday"
+	ScheduleTag     = "tag"
+)
+
+// Goal sources reported with effective goals
+const (
+	GoalSourceDefault = "default"
+	GoalSourceWeekday = ScheduleWeekday
+	GoalSourceTag     = ScheduleTag
+)
+
+// Common day tags; any lowercase tag name is accepted
+const (
+	DayTagTraining = "training"
+	DayTagRest     = "rest"
+)
+
+// GoalOverride replaces the flat daily targets on matching days.
+// ScheduleKey is a lowercase weekday name ("monday") for weekday overrides
+// or a tag name ("training") for tag overrides. Zero macros are derived from
+// TargetCalories using the user's macro preference.
+type GoalOverride struct {
+	UserID         int     `db:"user_id" json:"-"`
+	ScheduleType   string  `db:"schedule_type" json:"type" binding:"required,oneof=weekday tag"`
+	ScheduleKey    string  `db:"schedule_key" json:"key" binding:"required,max=30"`
+	TargetCalories int     `db:"target_calories" json:"targetCalories" binding:"required,gte=800,lte=10000"`
+	TargetProtein  float64 `db:"target_protein" json:"targetProtein" binding:"gte=0"`
+	TargetCarbs    float64 `db:"target_carbs" json:"targetCarbs" binding:"gte=0"`
+	TargetFats     float64 `db:"target_fats" json:"targetFats" binding:"gte=0"`
+}
+
+// HasMacros reports whether the override specifies its own macro targets
+func (o *GoalOverride) HasMacros() bool {
+	return o.TargetProtein > 0 || o.TargetCarbs > 0 || o.TargetFats > 0
+}
+
+// DayTag marks a calendar day with a tag such as "training" or "rest"
+type DayTag struct {
+	UserID int       `db:"user_id" json:"-"`
+	Date   time.Time `db:"tag_date" json:"date"`
+	Tag    string    `db:"tag" json:"tag"`
+}
+
+// EffectiveGoals are the targets that apply on a specific date
+type EffectiveGoals struct {
+	UserGoals
+	Date   string `json:"date"`
+	Source string `json:"source"`
+	DayTag string `json:"dayTag,omitempty"`
+}
+
+// WeekdayKey returns the schedule key used for a date's weekday
+func WeekdayKey(date time.Time) string {
+	switch date.Weekday() {
+	case time.Monday:
+		return "monday"
+	case time.Tuesday:
+		return "tuesday"
+	case time.Wednesday:
+		return "wednesday"
+	case time.Thursday:
+		return "thursday"
+	case time.Friday:
+		return "friday"
+	case time.Saturday:
+		return "saturday"
+	default:
+		return "sunday"
+	}
+}
+
+// IsWeekdayKey reports whether key is a valid weekday schedule key
+func IsWeekdayKey(key string) bool {
+	switch key {
+	case "monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday":
+		return true
+	}
+	return false
+}
+
+// GoalScheduleRequest represents the request body for replacing a user's goal schedule
+type GoalScheduleRequest struct {
+	Overrides []GoalOverride `json:"overrides" binding:"dive"`
+}
+
+// DayTagRequest represents the request body for tagging a day
+type DayTagRequest struct {
+	Tag string `json:"tag" binding:"required,max=30"`
+}
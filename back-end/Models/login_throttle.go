@@ -0,0 +1,267 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	mailer "HabitBite/backend/Mailer"
+)
+
+// Login throttling settings that are not configurable
+const (
+	// loginBaseDelay is the wait imposed by the first failure past the backoff threshold
+	loginBaseDelay = time.Second
+
+	// loginFailureWindow is how long a failure counts; a streak with no
+	// failure for this long starts again from zero
+	loginFailureWindow = 24 * time.Hour
+)
+
+// LoginPolicy configures per-account protection against password guessing.
+// After BackoffAfter failures in a row each further attempt must wait twice
+// as long as the one before; after LockoutAfter failures the account is
+// locked for LockoutDuration. The user is emailed once per streak when it
+// reaches NotifyAfter failures.
+type LoginPolicy struct {
+	BackoffAfter    int
+	LockoutAfter    int
+	LockoutDuration time.Duration
+	NotifyAfter     int
+}
+
+// LoginFailures is the failed-login streak of an account
+type LoginFailures struct {
+	UserID       int        `db:"user_id" json:"userId"`
+	FailedCount  int        `db:"failed_count" json:"failedCount"`
+	LastFailedAt time.Time  `db:"last_failed_at" json:"lastFailedAt"`
+	LockedUntil  *time.Time `db:"locked_until" json:"lockedUntil,omitempty"`
+	NotifiedAt   *time.Time `db:"notified_at" json:"-"`
+}
+
+// LoginFailuresUpdate decides a streak's next state from the current one,
+// which is nil when there is none. Returning nil leaves the streak as it was.
+type LoginFailuresUpdate func(current *LoginFailures) *LoginFailures
+
+// LoginThrottleRepository defines the failed-login storage the service needs.
+// GetLoginFailures returns nil when the account has no failures.
+// UpdateLoginFailures and UpdateEmailLoginFailures run update while holding
+// a lock on the streak, so concurrent attempts are decided one at a time;
+// the email variant tracks addresses that belong to no account, by hash.
+// MarkLoginFailureNotified reports whether this call was the one to mark it.
+type LoginThrottleRepository interface {
+	GetLoginFailures(ctx context.Context, userID int) (*LoginFailures, error)
+	UpdateLoginFailures(ctx context.Context, userID int, update LoginFailuresUpdate) error
+	UpdateEmailLoginFailures(ctx context.Context, emailHash string, update LoginFailuresUpdate) error
+	DeleteStaleEmailLoginFailures(ctx context.Context, before time.Time) (int64, error)
+	MarkLoginFailureNotified(ctx context.Context, userID int) (bool, error)
+	ClearLoginFailures(ctx context.Context, userID int) error
+}
+
+// LoginThrottleService tracks failed logins per account, so guessing a
+// user's password is slow no matter how many IP addresses it comes from
+type LoginThrottleService struct {
+	repo    LoginThrottleRepository
+	mailer  mailer.Mailer
+	policy  LoginPolicy
+	baseURL string
+}
+
+// NewLoginThrottleService creates a new login throttle. Notification emails
+// point at baseURL + "/forgot-password".
+func NewLoginThrottleService(repo LoginThrottleRepository, m mailer.Mailer, policy LoginPolicy, baseURL string) *LoginThrottleService {
+	return &LoginThrottleService{
+		repo:    repo,
+		mailer:  m,
+		policy:  policy,
+		baseURL: baseURL,
+	}
+}
+
+// RetryAfter returns how long the account must wait before the next login
+// attempt, or 0 if it may try now
+func (s *LoginThrottleService) RetryAfter(ctx context.Context, userID int) (time.Duration, error) {
+	failures, err := s.repo.GetLoginFailures(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	return s.wait(failures, time.Now()), nil
+}
+
+// ReserveAttempt is called before the password is checked. It returns how
+// long the account must still wait, or otherwise counts the attempt as a
+// failure straight away, locking the account once the lockout threshold is
+// reached; RecordSuccess ends the streak if the password turns out right.
+// Parallel guesses are therefore each counted before any is checked and
+// cannot all slip through the same gap. A locked account gives nothing away
+// about whether a guess was right.
+func (s *LoginThrottleService) ReserveAttempt(ctx context.Context, userID int) (time.Duration, error) {
+	return s.reserve(func(update LoginFailuresUpdate) error {
+		return s.repo.UpdateLoginFailures(ctx, userID, update)
+	})
+}
+
+// ReserveUnknownAttempt is ReserveAttempt for an email address that belongs
+// to no account. Such attempts are slowed down and locked out like real
+// ones, so the responses do not reveal which addresses are registered.
+func (s *LoginThrottleService) ReserveUnknownAttempt(ctx context.Context, email string) (time.Duration, error) {
+	return s.reserve(func(update LoginFailuresUpdate) error {
+		return s.repo.UpdateEmailLoginFailures(ctx, HashToken(email), update)
+	})
+}
+
+// RecordFailure handles a wrong password for an attempt ReserveAttempt has
+// already counted, notifying the user when the threshold is reached
+func (s *LoginThrottleService) RecordFailure(ctx context.Context, user *User) error {
+	failures, err := s.repo.GetLoginFailures(ctx, user.ID)
+	if err != nil || failures == nil {
+		return err
+	}
+
+	if failures.FailedCount >= s.policy.NotifyAfter {
+		first, err := s.repo.MarkLoginFailureNotified(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		if first {
+			s.notify(ctx, user, failures.FailedCount)
+		}
+	}
+
+	return nil
+}
+
+// RecordSuccess ends the user's failure streak after a correct password
+func (s *LoginThrottleService) RecordSuccess(ctx context.Context, userID int) error {
+	return s.repo.ClearLoginFailures(ctx, userID)
+}
+
+// Unlock clears the failure streak and any lockout, for admins
+func (s *LoginThrottleService) Unlock(ctx context.Context, userID int) error {
+	return s.repo.ClearLoginFailures(ctx, userID)
+}
+
+// Status returns the account's failure streak, or nil if it has none
+func (s *LoginThrottleService) Status(ctx context.Context, userID int) (*LoginFailures, error) {
+	return s.repo.GetLoginFailures(ctx, userID)
+}
+
+// RunCleanup periodically drops the failure streaks of unknown email
+// addresses that have run out, until ctx is cancelled
+func (s *LoginThrottleService) RunCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			removed, err := s.repo.DeleteStaleEmailLoginFailures(ctx, time.Now().Add(-loginFailureWindow))
+			if err != nil {
+				log.Printf("Login failure cleanup failed: %v", err)
+				continue
+			}
+			if removed > 0 {
+				log.Printf("Login failure cleanup removed %d expired entries", removed)
+			}
+		}
+	}
+}
+
+// reserve runs the reservation through one of the repository's locked updates
+func (s *LoginThrottleService) reserve(run func(LoginFailuresUpdate) error) (time.Duration, error) {
+	now := time.Now()
+
+	var wait time.Duration
+	err := run(func(current *LoginFailures) *LoginFailures {
+		if wait = s.wait(current, now); wait > 0 {
+			return nil
+		}
+		return s.nextFailure(current, now)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return wait, nil
+}
+
+// wait returns how long a streak must wait at now before the next attempt
+func (s *LoginThrottleService) wait(failures *LoginFailures, now time.Time) time.Duration {
+	if failures == nil || now.Sub(failures.LastFailedAt) > loginFailureWindow {
+		return 0
+	}
+
+	var until time.Time
+	if failures.LockedUntil != nil {
+		until = *failures.LockedUntil
+	}
+	if next := failures.LastFailedAt.Add(s.delay(failures.FailedCount)); next.After(until) {
+		until = next
+	}
+
+	if wait := until.Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// nextFailure returns the streak after one more failure at now. A streak
+// whose last failure has left the window starts again at one, with its lock
+// and notification cleared.
+func (s *LoginThrottleService) nextFailure(current *LoginFailures, now time.Time) *LoginFailures {
+	next := &LoginFailures{FailedCount: 1, LastFailedAt: now}
+	if current != nil {
+		next.UserID = current.UserID
+		if now.Sub(current.LastFailedAt) <= loginFailureWindow {
+			next.FailedCount = current.FailedCount + 1
+			next.LockedUntil = current.LockedUntil
+			next.NotifiedAt = current.NotifiedAt
+		}
+	}
+
+	if next.FailedCount >= s.policy.LockoutAfter {
+		until := now.Add(s.policy.LockoutDuration)
+		next.LockedUntil = &until
+	}
+	return next
+}
+
+// delay returns the wait after the given number of failures in a row,
+// doubling from loginBaseDelay and capped at the lockout duration
+func (s *LoginThrottleService) delay(failedCount int) time.Duration {
+	over := failedCount - s.policy.BackoffAfter
+	if over < 0 {
+		return 0
+	}
+
+	delay := loginBaseDelay
+	for i := 0; i < over && delay < s.policy.LockoutDuration; i++ {
+		delay *= 2
+	}
+	if delay > s.policy.LockoutDuration {
+		delay = s.policy.LockoutDuration
+	}
+	return delay
+}
+
+// notify tells the user about repeated failed logins. Delivery failures are
+// logged, as they must not change the login response.
+func (s *LoginThrottleService) notify(ctx context.Context, user *User, failedCount int) {
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "Failed sign-in attempts on your HabitBite account",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"There have been %d failed attempts to sign in to your HabitBite account.\n"+
+			"Further attempts are being slowed down, and the account is locked for a while if they continue.\n\n"+
+			"If this was you, you can ignore this email. If not, someone may be trying to guess your password;\n"+
+			"you can choose a new one here:\n\n"+
+			"%s\n",
+			user.Username, failedCount, s.baseURL+"/forgot-password"),
+	}
+
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		log.Printf("Failed to send failed-login notification to user %d: %v", user.ID, err)
+	}
+}
@@ -0,0 +1,281 @@
+package models
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	mailer "HabitBite/backend/Mailer"
+)
+
+var testLoginPolicy = LoginPolicy{
+	BackoffAfter:    3,
+	LockoutAfter:    10,
+	LockoutDuration: 15 * time.Minute,
+	NotifyAfter:     5,
+}
+
+// memoryLoginFailures is an in-memory LoginThrottleRepository whose updates
+// are serialised like the row lock in the database
+type memoryLoginFailures struct {
+	mu       sync.Mutex
+	accounts map[int]*LoginFailures
+	emails   map[string]*LoginFailures
+}
+
+func newMemoryLoginFailures() *memoryLoginFailures {
+	return &memoryLoginFailures{
+		accounts: make(map[int]*LoginFailures),
+		emails:   make(map[string]*LoginFailures),
+	}
+}
+
+func (m *memoryLoginFailures) GetLoginFailures(ctx context.Context, userID int) (*LoginFailures, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if f, ok := m.accounts[userID]; ok {
+		found := *f
+		return &found, nil
+	}
+	return nil, nil
+}
+
+func (m *memoryLoginFailures) UpdateLoginFailures(ctx context.Context, userID int, update LoginFailuresUpdate) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if next := update(m.accounts[userID]); next != nil {
+		next.UserID = userID
+		m.accounts[userID] = next
+	}
+	return nil
+}
+
+func (m *memoryLoginFailures) UpdateEmailLoginFailures(ctx context.Context, emailHash string, update LoginFailuresUpdate) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if next := update(m.emails[emailHash]); next != nil {
+		m.emails[emailHash] = next
+	}
+	return nil
+}
+
+func (m *memoryLoginFailures) DeleteStaleEmailLoginFailures(ctx context.Context, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var removed int64
+	for hash, f := range m.emails {
+		if f.LastFailedAt.Before(before) {
+			delete(m.emails, hash)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+func (m *memoryLoginFailures) MarkLoginFailureNotified(ctx context.Context, userID int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.accounts[userID]
+	if !ok || f.NotifiedAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	f.NotifiedAt = &now
+	return true, nil
+}
+
+func (m *memoryLoginFailures) ClearLoginFailures(ctx context.Context, userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.accounts, userID)
+	return nil
+}
+
+func TestLoginThrottleDelay(t *testing.T) {
+	s := NewLoginThrottleService(nil, nil, testLoginPolicy, "")
+
+	tests := []struct {
+		failedCount int
+		want        time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{5, 4 * time.Second},
+		{9, 64 * time.Second},
+		{12, 512 * time.Second},
+		{13, 15 * time.Minute},
+		{100, 15 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := s.delay(tt.failedCount); got != tt.want {
+			t.Errorf("delay(%d) = %v, want %v", tt.failedCount, got, tt.want)
+		}
+	}
+}
+
+func TestLoginThrottleWait(t *testing.T) {
+	s := NewLoginThrottleService(nil, nil, testLoginPolicy, "")
+	now := time.Now()
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+
+	tests := []struct {
+		name     string
+		failures *LoginFailures
+		want     time.Duration
+	}{
+		{"no streak", nil, 0},
+		{"below backoff", &LoginFailures{FailedCount: 2, LastFailedAt: now}, 0},
+		{"first backoff", &LoginFailures{FailedCount: 3, LastFailedAt: now}, time.Second},
+		{"backoff partly waited", &LoginFailures{FailedCount: 5, LastFailedAt: now.Add(-time.Second)}, 3 * time.Second},
+		{"backoff over", &LoginFailures{FailedCount: 5, LastFailedAt: now.Add(-time.Minute)}, 0},
+		{"locked", &LoginFailures{FailedCount: 10, LastFailedAt: now, LockedUntil: at(15 * time.Minute)}, 15 * time.Minute},
+		{"lock over but backoff pending", &LoginFailures{FailedCount: 13, LastFailedAt: now.Add(-10 * time.Minute), LockedUntil: at(-time.Minute)}, 5 * time.Minute},
+		{"streak out of window", &LoginFailures{FailedCount: 100, LastFailedAt: now.Add(-loginFailureWindow - time.Second), LockedUntil: at(time.Hour)}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.wait(tt.failures, now); got != tt.want {
+				t.Errorf("wait() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoginThrottleNextFailure(t *testing.T) {
+	s := NewLoginThrottleService(nil, nil, testLoginPolicy, "")
+	now := time.Now()
+	earlier := now.Add(-time.Hour)
+
+	tests := []struct {
+		name         string
+		current      *LoginFailures
+		wantCount    int
+		wantLocked   bool
+		wantNotified bool
+	}{
+		{"first failure", nil, 1, false, false},
+		{"continues streak", &LoginFailures{FailedCount: 4, LastFailedAt: earlier, NotifiedAt: &earlier}, 5, false, true},
+		{"reaches lockout", &LoginFailures{FailedCount: 9, LastFailedAt: earlier}, 10, true, false},
+		{"restarts stale streak", &LoginFailures{FailedCount: 9, LastFailedAt: now.Add(-loginFailureWindow - time.Second), LockedUntil: &earlier, NotifiedAt: &earlier}, 1, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := s.nextFailure(tt.current, now)
+			if next.FailedCount != tt.wantCount {
+				t.Errorf("FailedCount = %d, want %d", next.FailedCount, tt.wantCount)
+			}
+			if locked := next.LockedUntil != nil && next.LockedUntil.After(now); locked != tt.wantLocked {
+				t.Errorf("locked = %v, want %v", locked, tt.wantLocked)
+			}
+			if notified := next.NotifiedAt != nil; notified != tt.wantNotified {
+				t.Errorf("notified = %v, want %v", notified, tt.wantNotified)
+			}
+			if !next.LastFailedAt.Equal(now) {
+				t.Errorf("LastFailedAt = %v, want %v", next.LastFailedAt, now)
+			}
+		})
+	}
+}
+
+func TestLoginThrottleReserveAttempt(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemoryLoginFailures()
+	s := NewLoginThrottleService(repo, mailer.NewMemoryMailer(), testLoginPolicy, "")
+
+	// Parallel guesses are counted one at a time, so only those before the
+	// backoff threshold get through
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait, err := s.ReserveAttempt(ctx, 1)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if wait == 0 {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != testLoginPolicy.BackoffAfter {
+		t.Errorf("%d parallel attempts allowed, want %d", allowed, testLoginPolicy.BackoffAfter)
+	}
+	if wait, err := s.RetryAfter(ctx, 1); err != nil || wait <= 0 || wait > time.Second {
+		t.Errorf("RetryAfter() = %v, %v; want up to 1s", wait, err)
+	}
+
+	// A correct password ends the streak
+	if err := s.RecordSuccess(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if wait, err := s.RetryAfter(ctx, 1); err != nil || wait != 0 {
+		t.Errorf("RetryAfter() after success = %v, %v; want 0", wait, err)
+	}
+}
+
+func TestLoginThrottleReserveUnknownAttempt(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemoryLoginFailures()
+	s := NewLoginThrottleService(repo, mailer.NewMemoryMailer(), testLoginPolicy, "")
+
+	for i := 0; i < testLoginPolicy.BackoffAfter; i++ {
+		if wait, err := s.ReserveUnknownAttempt(ctx, "nobody@example.com"); err != nil || wait != 0 {
+			t.Fatalf("attempt %d: got %v, %v; want 0", i+1, wait, err)
+		}
+	}
+	if wait, err := s.ReserveUnknownAttempt(ctx, "nobody@example.com"); err != nil || wait == 0 {
+		t.Fatalf("attempt past backoff: got %v, %v; want a wait", wait, err)
+	}
+	if wait, err := s.ReserveUnknownAttempt(ctx, "someone@example.com"); err != nil || wait != 0 {
+		t.Fatalf("other address: got %v, %v; want 0", wait, err)
+	}
+
+	if _, ok := repo.emails[HashToken("nobody@example.com")]; !ok {
+		t.Error("unknown addresses must be stored by hash")
+	}
+	if len(repo.accounts) != 0 {
+		t.Error("unknown addresses must not touch account streaks")
+	}
+}
+
+func TestLoginThrottleRecordFailureNotifiesOnce(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemoryLoginFailures()
+	mail := mailer.NewMemoryMailer()
+	s := NewLoginThrottleService(repo, mail, testLoginPolicy, "https://habitbite.test")
+	user := &User{ID: 1, Email: "a@example.com", Username: "a"}
+
+	now := time.Now()
+	for i := 0; i < testLoginPolicy.NotifyAfter+2; i++ {
+		// Count the failure as ReserveAttempt would, without its backoff
+		if err := repo.UpdateLoginFailures(ctx, user.ID, func(current *LoginFailures) *LoginFailures {
+			return s.nextFailure(current, now)
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.RecordFailure(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := len(mail.Messages()); got != 1 {
+		t.Fatalf("sent %d notifications, want 1", got)
+	}
+	if msg, _ := mail.Last(user.Email); msg.To != user.Email {
+		t.Errorf("notification sent to %q", msg.To)
+	}
+}
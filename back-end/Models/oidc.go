@@ -0,0 +1,418 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	nutrition "HabitBite/backend/Nutrition"
+	oidc "HabitBite/backend/OIDC"
+)
+
+// OpenID Connect errors
+var (
+	ErrOIDCUnknownProvider  = errors.New("unknown sign-in provider")
+	ErrOIDCInvalidState     = errors.New("sign-in request expired or was already used")
+	ErrOIDCLoginFailed      = errors.New("sign-in with the provider failed")
+	ErrOIDCEmailNotVerified = errors.New("the provider did not confirm a verified email address")
+	ErrOIDCAccountNotLinked = errors.New("an account with this email exists; sign in with your password and link the provider from settings")
+	ErrOIDCIdentityInUse    = errors.New("this provider account is linked to another user")
+	ErrOIDCAlreadyLinked    = errors.New("another account from this provider is already linked")
+	ErrOIDCIdentityNotFound = errors.New("no account from this provider is linked")
+	ErrOIDCLastSignInMethod = errors.New("set a password or link another provider before unlinking this one")
+)
+
+// OIDCFlowTTL is how long a user has to finish signing in at the provider
+const OIDCFlowTTL = 10 * time.Minute
+
+// Placeholder measurements for accounts created through a provider. They
+// give a usable calorie goal until the user completes their profile.
+const (
+	oidcDefaultAge    = 30
+	oidcDefaultHeight = 170.0
+	oidcDefaultWeight = 70.0
+)
+
+// OIDCFlow is a started sign-in, keyed by a hash of the state parameter.
+// UserID is set when a signed-in user is linking a provider.
+type OIDCFlow struct {
+	StateHash    string    `db:"state_hash"`
+	Provider     string    `db:"provider"`
+	Nonce        string    `db:"nonce"`
+	CodeVerifier string    `db:"code_verifier"`
+	UserID       *int      `db:"user_id"`
+	ExpiresAt    time.Time `db:"expires_at"`
+	CreatedAt    time.Time `db:"created_at"`
+}
+
+// UserIdentity links a user to an account at an OpenID Connect provider
+type UserIdentity struct {
+	ID          int        `db:"id" json:"id"`
+	UserID      int        `db:"user_id" json:"-"`
+	Provider    string     `db:"provider" json:"provider"`
+	Subject     string     `db:"subject" json:"-"`
+	Email       string     `db:"email" json:"email"`
+	CreatedAt   time.Time  `db:"created_at" json:"createdAt"`
+	LastLoginAt *time.Time `db:"last_login_at" json:"lastLoginAt,omitempty"`
+}
+
+// OIDCProviderInfo describes a configured provider for the sign-in page
+type OIDCProviderInfo struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+// OIDCResult is the outcome of a completed sign-in
+type OIDCResult struct {
+	User    *User
+	Linking bool // The flow was started by a signed-in user linking a provider
+	Linked  bool // The identity was linked to an existing account
+	Created bool // A new account was created for the identity
+}
+
+// OIDCRepository defines the storage the OIDC service needs.
+// ConsumeOIDCFlow and FindIdentity return nil when nothing matches, and
+// FindUserIDByEmail returns 0 when no account uses the address.
+type OIDCRepository interface {
+	CreateOIDCFlow(ctx context.Context, flow *OIDCFlow) error
+	ConsumeOIDCFlow(ctx context.Context, stateHash string) (*OIDCFlow, error)
+
+	FindIdentity(ctx context.Context, provider, subject string) (*UserIdentity, error)
+	ListIdentities(ctx context.Context, userID int) ([]*UserIdentity, error)
+	CreateIdentity(ctx context.Context, identity *UserIdentity) error
+	TouchIdentity(ctx context.Context, id int) error
+	DeleteIdentity(ctx context.Context, userID int, provider string) (bool, error)
+
+	FindUserIDByEmail(ctx context.Context, email string) (int, error)
+	UsernameTaken(ctx context.Context, username string) (bool, error)
+}
+
+// OIDCService signs users in with OpenID Connect providers. A provider
+// account is matched by its subject; on first use it is linked to the
+// account with the same verified email, or a new account is created.
+type OIDCService struct {
+	providers   map[string]*oidc.Provider
+	order       []string
+	repo        OIDCRepository
+	userService *UserService
+}
+
+// NewOIDCService creates a new OIDC service for the given providers
+func NewOIDCService(providers []*oidc.Provider, repo OIDCRepository, userService *UserService) *OIDCService {
+	s := &OIDCService{
+		providers:   make(map[string]*oidc.Provider, len(providers)),
+		repo:        repo,
+		userService: userService,
+	}
+	for _, p := range providers {
+		s.providers[p.Name()] = p
+		s.order = append(s.order, p.Name())
+	}
+	return s
+}
+
+// Providers lists the configured providers in configuration order
+func (s *OIDCService) Providers() []OIDCProviderInfo {
+	infos := make([]OIDCProviderInfo, 0, len(s.order))
+	for _, name := range s.order {
+		infos = append(infos, OIDCProviderInfo{Name: name, DisplayName: s.providers[name].DisplayName()})
+	}
+	return infos
+}
+
+// Start begins a sign-in and returns the provider URL to send the browser
+// to, along with the state the callback must carry. linkUserID is the
+// signed-in user linking the provider, or 0 for a sign-in.
+func (s *OIDCService) Start(ctx context.Context, providerName string, linkUserID int) (authURL, state string, err error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return "", "", ErrOIDCUnknownProvider
+	}
+
+	state, stateHash, err := NewOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := oidc.NewNonce()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := oidc.NewVerifier()
+	if err != nil {
+		return "", "", err
+	}
+
+	authURL, err = provider.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		return "", "", err
+	}
+
+	now := time.Now()
+	flow := &OIDCFlow{
+		StateHash:    stateHash,
+		Provider:     providerName,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    now.Add(OIDCFlowTTL),
+		CreatedAt:    now,
+	}
+	if linkUserID != 0 {
+		flow.UserID = &linkUserID
+	}
+	if err := s.repo.CreateOIDCFlow(ctx, flow); err != nil {
+		return "", "", err
+	}
+
+	return authURL, state, nil
+}
+
+// Complete finishes a sign-in with the state and code from the provider's
+// callback. For a linking flow the identity is attached to the user who
+// started it; otherwise the identity's user is returned, creating an
+// account on first use or linking one whose email is already verified.
+func (s *OIDCService) Complete(ctx context.Context, providerName, state, code string) (*OIDCResult, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return nil, ErrOIDCUnknownProvider
+	}
+
+	flow, err := s.repo.ConsumeOIDCFlow(ctx, HashToken(state))
+	if err != nil {
+		return nil, err
+	}
+	if flow == nil || flow.Provider != providerName || time.Now().After(flow.ExpiresAt) {
+		return nil, ErrOIDCInvalidState
+	}
+
+	identity, err := provider.Exchange(ctx, code, flow.CodeVerifier, flow.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCLoginFailed, err)
+	}
+
+	existing, err := s.repo.FindIdentity(ctx, providerName, identity.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	if flow.UserID != nil {
+		result, err := s.link(ctx, *flow.UserID, identity, existing)
+		if err != nil {
+			return nil, err
+		}
+		result.Linking = true
+		return result, nil
+	}
+
+	if existing != nil {
+		if err := s.repo.TouchIdentity(ctx, existing.ID); err != nil {
+			return nil, err
+		}
+		user, err := s.userService.FindByID(ctx, existing.UserID)
+		if err != nil {
+			return nil, err
+		}
+		return &OIDCResult{User: user}, nil
+	}
+
+	// Matching or creating an account by email is only safe when the
+	// provider vouches for the address
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, ErrOIDCEmailNotVerified
+	}
+
+	userID, err := s.repo.FindUserIDByEmail(ctx, identity.Email)
+	if err != nil {
+		return nil, err
+	}
+	if userID != 0 {
+		// An unverified address proves nothing about who made the account:
+		// anyone could have registered it with their own password and would
+		// keep access once the owner's provider were linked
+		user, err := s.userService.FindByID(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if !user.EmailVerified {
+			return nil, ErrOIDCAccountNotLinked
+		}
+		return s.link(ctx, userID, identity, nil)
+	}
+
+	user, err := s.createUser(ctx, identity)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.createIdentity(ctx, user.ID, identity); err != nil {
+		return nil, err
+	}
+	return &OIDCResult{User: user, Created: true}, nil
+}
+
+// Identities lists the providers linked to a user
+func (s *OIDCService) Identities(ctx context.Context, userID int) ([]*UserIdentity, error) {
+	return s.repo.ListIdentities(ctx, userID)
+}
+
+// Unlink removes a provider from a user. The last way to sign in cannot be
+// removed: a user without a password must keep at least one provider.
+func (s *OIDCService) Unlink(ctx context.Context, user *User, providerName string) error {
+	identities, err := s.repo.ListIdentities(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, identity := range identities {
+		if identity.Provider == providerName {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return ErrOIDCIdentityNotFound
+	}
+	if !user.HasPassword() && len(identities) == 1 {
+		return ErrOIDCLastSignInMethod
+	}
+
+	deleted, err := s.repo.DeleteIdentity(ctx, user.ID, providerName)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrOIDCIdentityNotFound
+	}
+	return nil
+}
+
+// link attaches an identity to a user. existing is the identity already
+// stored for the provider subject, if any.
+func (s *OIDCService) link(ctx context.Context, userID int, identity *oidc.Identity, existing *UserIdentity) (*OIDCResult, error) {
+	if existing != nil && existing.UserID != userID {
+		return nil, ErrOIDCIdentityInUse
+	}
+
+	if existing == nil {
+		identities, err := s.repo.ListIdentities(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		for _, other := range identities {
+			if other.Provider == identity.Provider {
+				return nil, ErrOIDCAlreadyLinked
+			}
+		}
+		if err := s.createIdentity(ctx, userID, identity); err != nil {
+			return nil, err
+		}
+	}
+
+	user, err := s.userService.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &OIDCResult{User: user, Linked: existing == nil}, nil
+}
+
+// createIdentity stores a new identity for a user
+func (s *OIDCService) createIdentity(ctx context.Context, userID int, identity *oidc.Identity) error {
+	now := time.Now()
+	return s.repo.CreateIdentity(ctx, &UserIdentity{
+		UserID:      userID,
+		Provider:    identity.Provider,
+		Subject:     identity.Subject,
+		Email:       identity.Email,
+		CreatedAt:   now,
+		LastLoginAt: &now,
+	})
+}
+
+// createUser creates an account for a provider identity. The account has
+// no password and placeholder measurements, and is flagged so the app asks
+// the user to complete their profile.
+func (s *OIDCService) createUser(ctx context.Context, identity *oidc.Identity) (*User, error) {
+	username, err := s.availableUsername(ctx, identity.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	fullName := strings.TrimSpace(identity.Name)
+	if fullName == "" {
+		fullName = username
+	}
+
+	now := time.Now()
+	user := &User{
+		Email:           identity.Email,
+		EmailVerified:   true,
+		EmailVerifiedAt: &now,
+		Username:        username,
+		FullName:        fullName,
+		Birthdate:       time.Date(now.Year()-oidcDefaultAge, now.Month(), 1, 0, 0, 0, 0, time.UTC),
+		Gender:          "other",
+		Height:          oidcDefaultHeight,
+		Weight:          oidcDefaultWeight,
+		GoalType:        GoalMaintain,
+		ActivityLevel:   ActivityModerate,
+		EnergyFormula:   nutrition.DefaultFormula,
+		Role:            RoleUser,
+		ProfileComplete: false,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+
+	energy, err := user.EstimateEnergy(now)
+	if err != nil {
+		return nil, err
+	}
+	user.DailyCalorieGoal = energy.TargetCalories
+
+	if err := s.userService.CreateUser(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// availableUsername derives a free username from the local part of an email
+func (s *OIDCService) availableUsername(ctx context.Context, email string) (string, error) {
+	local := email
+	if at := strings.IndexByte(email, '@'); at >= 0 {
+		local = email[:at]
+	}
+
+	base := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return -1
+	}, strings.ToLower(local))
+	if len(base) > 40 {
+		base = base[:40]
+	}
+	if len(base) < 3 {
+		base = "user" + base
+	}
+
+	candidate := base
+	for attempt := 0; attempt < 5; attempt++ {
+		taken, err := s.repo.UsernameTaken(ctx, candidate)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return candidate, nil
+		}
+
+		suffix, err := rand.Int(rand.Reader, big.NewInt(1000000))
+		if err != nil {
+			return "", fmt.Errorf("failed to generate username: %v", err)
+		}
+		candidate = fmt.Sprintf("%s%d", base, suffix.Int64())
+	}
+
+	return "", fmt.Errorf("failed to find a free username for %q", base)
+}
@@ -0,0 +1,191 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	mailer "HabitBite/backend/Mailer"
+)
+
+// ErrPasswordResetInvalid is returned for unknown, expired or already used reset tokens
+var ErrPasswordResetInvalid = errors.New("invalid or expired password reset token")
+
+// DefaultPasswordResetTTL is how long a password reset link stays valid
+const DefaultPasswordResetTTL = 30 * time.Minute
+
+// PasswordReset is a stored password reset token. Only a hash of the token
+// is stored, and the row is deleted when the token is used.
+type PasswordReset struct {
+	ID        int       `db:"id"`
+	UserID    int       `db:"user_id"`
+	TokenHash string    `db:"token_hash"`
+	ExpiresAt time.Time `db:"expires_at"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// PasswordResetRepository defines the reset token storage the service needs.
+// FindPasswordReset returns nil for unknown tokens, and ConsumePasswordReset
+// reports false if the token was consumed concurrently.
+type PasswordResetRepository interface {
+	CreatePasswordReset(ctx context.Context, reset *PasswordReset) error
+	FindPasswordReset(ctx context.Context, tokenHash string) (*PasswordReset, error)
+	ConsumePasswordReset(ctx context.Context, id int) (bool, error)
+	DeleteUserPasswordResets(ctx context.Context, userID int) error
+}
+
+// PasswordResetService handles forgotten passwords: it emails a single-use
+// reset link and, when the link is used, sets the new password and ends
+// every existing session of the user
+type PasswordResetService struct {
+	userService *UserService
+	repo        PasswordResetRepository
+	mailer      mailer.Mailer
+	sessions    *SessionService
+	revocations *TokenRevocationService
+	ttl         time.Duration
+	baseURL     string
+}
+
+// NewPasswordResetService creates a new password reset service. Reset links
+// point at baseURL + "/reset-password".
+func NewPasswordResetService(userService *UserService, repo PasswordResetRepository, m mailer.Mailer,
+	sessions *SessionService, revocations *TokenRevocationService, ttl time.Duration, baseURL string) *PasswordResetService {
+	if ttl <= 0 {
+		ttl = DefaultPasswordResetTTL
+	}
+	return &PasswordResetService{
+		userService: userService,
+		repo:        repo,
+		mailer:      m,
+		sessions:    sessions,
+		revocations: revocations,
+		ttl:         ttl,
+		baseURL:     baseURL,
+	}
+}
+
+// RequestReset emails a reset link if the address belongs to an account.
+// Unknown addresses are not reported, so the endpoint cannot be used to
+// find out who has an account. Any earlier link for the user stops working.
+func (s *PasswordResetService) RequestReset(ctx context.Context, email string) error {
+	user, err := s.userService.FindUserByEmail(ctx, email)
+	if err != nil || user == nil {
+		// Most often the address has no account; either way there is nothing to send
+		log.Printf("Password reset email not sent: %v", err)
+		return nil
+	}
+
+	return s.sendResetLink(ctx, user, "Someone asked to reset the password for your HabitBite account.\n"+
+		"If it was you, open this link within %d minutes to choose a new password:\n\n"+
+		"%s\n\n"+
+		"If you did not ask for this, you can ignore this email; your password will not change.\n")
+}
+
+// ForceReset emails the user a link to choose a new password after an
+// admin has cleared their old one. Any earlier link stops working.
+func (s *PasswordResetService) ForceReset(ctx context.Context, user *User) error {
+	return s.sendResetLink(ctx, user, "An administrator has reset the password for your HabitBite account.\n"+
+		"Open this link within %d minutes to choose a new password:\n\n"+
+		"%s\n\n"+
+		"If the link has expired, use \"Forgot password\" on the login page to get a new one.\n")
+}
+
+// sendResetLink replaces the user's reset links with a new one and emails
+// it. body is a format taking the link lifetime in minutes and the link.
+func (s *PasswordResetService) sendResetLink(ctx context.Context, user *User, body string) error {
+	if err := s.repo.DeleteUserPasswordResets(ctx, user.ID); err != nil {
+		return err
+	}
+
+	raw, hash, err := NewOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	reset := &PasswordReset{
+		UserID:    user.ID,
+		TokenHash: hash,
+		ExpiresAt: now.Add(s.ttl),
+		CreatedAt: now,
+	}
+	if err := s.repo.CreatePasswordReset(ctx, reset); err != nil {
+		return err
+	}
+
+	link := s.baseURL + "/reset-password?token=" + url.QueryEscape(raw)
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your HabitBite password",
+		Body:    fmt.Sprintf("Hi %s,\n\n"+body, user.Username, int(s.ttl.Minutes()), link),
+	}
+
+	// Delivery failures are logged rather than returned, so a failing mail
+	// server does not reveal which addresses have accounts
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		log.Printf("Failed to send password reset email to user %d: %v", user.ID, err)
+	}
+
+	return nil
+}
+
+// ResetPassword consumes a reset token, sets the new password and revokes
+// every refresh and access token the user holds. A password the policy
+// rejects gives a *passwords.PolicyError.
+func (s *PasswordResetService) ResetPassword(ctx context.Context, raw, newPassword string) error {
+	reset, err := s.repo.FindPasswordReset(ctx, HashToken(raw))
+	if err != nil {
+		return err
+	}
+	if reset == nil || time.Now().After(reset.ExpiresAt) {
+		return ErrPasswordResetInvalid
+	}
+
+	// Check the policy first, so a rejected password leaves the link usable
+	user, err := s.userService.FindByID(ctx, reset.UserID)
+	if err != nil {
+		return err
+	}
+	if err := s.userService.ValidatePassword(ctx, user, newPassword); err != nil {
+		return err
+	}
+
+	// Only one of two concurrent resets with the same token may succeed
+	consumed, err := s.repo.ConsumePasswordReset(ctx, reset.ID)
+	if err != nil {
+		return err
+	}
+	if !consumed {
+		return ErrPasswordResetInvalid
+	}
+
+	if err := s.userService.ChangePassword(ctx, reset.UserID, newPassword); err != nil {
+		return err
+	}
+
+	// Outstanding links for the same account are void once the password changed
+	if err := s.repo.DeleteUserPasswordResets(ctx, reset.UserID); err != nil {
+		return err
+	}
+
+	return s.revokeSessions(ctx, reset.UserID)
+}
+
+// revokeSessions logs the user out everywhere
+func (s *PasswordResetService) revokeSessions(ctx context.Context, userID int) error {
+	if s.sessions != nil {
+		if err := s.sessions.RevokeAll(ctx, userID); err != nil {
+			return err
+		}
+	}
+	if s.revocations != nil {
+		if err := s.revocations.RevokeAllForUser(ctx, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
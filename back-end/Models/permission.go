@@ -0,0 +1,197 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Permissions a role can grant
+const (
+	PermFoodsWrite       = "foods:write"        // Edit the shared food catalog
+	PermClientsManage    = "clients:manage"     // Set goals for assigned clients
+	PermClientsManageAny = "clients:manage_any" // Set goals for any user, assigned or not
+	PermUsersRead        = "users:read"         // List users and view their profiles
+	PermUsersManage      = "users:manage"       // Change roles, disable accounts and reset passwords
+	PermUsersImpersonate = "users:impersonate"  // View the app as another user
+	PermGoalsRecalculate = "goals:recalculate"  // Recalculate every user's goals
+	PermAuditRead        = "audit:read"         // Search the audit log
+)
+
+// AllPermissions lists every permission, for validating role mappings
+var AllPermissions = []string{
+	PermFoodsWrite,
+	PermClientsManage,
+	PermClientsManageAny,
+	PermUsersRead,
+	PermUsersManage,
+	PermUsersImpersonate,
+	PermGoalsRecalculate,
+	PermAuditRead,
+}
+
+// RolePermissions maps each role to the permissions it grants
+type RolePermissions map[string][]string
+
+// DefaultRolePermissions is used unless ROLE_PERMISSIONS_FILE replaces it
+var DefaultRolePermissions = RolePermissions{
+	RoleUser:      {},
+	RoleDietitian: {PermFoodsWrite, PermClientsManage},
+	RoleAdmin:     AllPermissions,
+}
+
+// accessCacheTTL is how long a user's role and disabled status are
+// remembered between lookups. Changes made on another server apply within
+// this time.
+const accessCacheTTL = 30 * time.Second
+
+// LoadRolePermissions reads a JSON object mapping role names to lists of
+// permissions, e.g. {"dietitian": ["foods:write"]}. Roles missing from the
+// file grant nothing.
+func LoadRolePermissions(path string) (RolePermissions, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read role permissions: %v", err)
+	}
+
+	var mapping RolePermissions
+	if err := json.Unmarshal(data, &mapping); err != nil {
+		return nil, fmt.Errorf("role permissions must be a JSON object of permission lists: %v", err)
+	}
+
+	known := StringList(AllPermissions)
+	for role, permissions := range mapping {
+		if role != RoleUser && role != RoleDietitian && role != RoleAdmin {
+			return nil, fmt.Errorf("role permissions name unknown role %q", role)
+		}
+		for _, permission := range permissions {
+			if !known.Contains(permission) {
+				return nil, fmt.Errorf("role %s has unknown permission %q", role, permission)
+			}
+		}
+	}
+
+	return mapping, nil
+}
+
+// UserAccess is what decides whether and how a user may use the API
+type UserAccess struct {
+	Role       string     `db:"role"`
+	DisabledAt *time.Time `db:"disabled_at"`
+}
+
+// AccessRepository looks up a user's current access. It returns nil when
+// the user does not exist.
+type AccessRepository interface {
+	FindUserAccess(ctx context.Context, userID int) (*UserAccess, error)
+}
+
+// cachedAccess is an access lookup and when it stops being trusted
+type cachedAccess struct {
+	access  *UserAccess
+	expires time.Time
+}
+
+// PermissionService decides what each role may do and looks up users'
+// current roles and disabled status, so changes apply to tokens issued
+// before them
+type PermissionService struct {
+	grants map[string]map[string]bool
+	repo   AccessRepository
+
+	mu       sync.Mutex
+	accesses map[int]cachedAccess
+}
+
+// NewPermissionService creates a permission service for a role mapping
+func NewPermissionService(mapping RolePermissions, repo AccessRepository) *PermissionService {
+	grants := make(map[string]map[string]bool, len(mapping))
+	for role, permissions := range mapping {
+		grants[role] = make(map[string]bool, len(permissions))
+		for _, permission := range permissions {
+			grants[role][permission] = true
+		}
+	}
+
+	return &PermissionService{
+		grants:   grants,
+		repo:     repo,
+		accesses: make(map[int]cachedAccess),
+	}
+}
+
+// HasPermission reports whether a role grants a permission
+func (s *PermissionService) HasPermission(role, permission string) bool {
+	return s.grants[role][permission]
+}
+
+// Permissions returns the permissions a role grants, sorted
+func (s *PermissionService) Permissions(role string) []string {
+	permissions := make([]string, 0, len(s.grants[role]))
+	for permission := range s.grants[role] {
+		permissions = append(permissions, permission)
+	}
+	sort.Strings(permissions)
+	return permissions
+}
+
+// CurrentRole returns the user's role as stored now, reporting false if the
+// user no longer exists
+func (s *PermissionService) CurrentRole(ctx context.Context, userID int) (string, bool, error) {
+	access, err := s.access(ctx, userID)
+	if err != nil || access == nil {
+		return "", false, err
+	}
+	return access.Role, true, nil
+}
+
+// IsDisabled reports whether the user's account is disabled now
+func (s *PermissionService) IsDisabled(ctx context.Context, userID int) (bool, error) {
+	access, err := s.access(ctx, userID)
+	if err != nil || access == nil {
+		return false, err
+	}
+	return access.DisabledAt != nil, nil
+}
+
+// Forget drops a user's cached access after their role or status changes
+func (s *PermissionService) Forget(userID int) {
+	s.mu.Lock()
+	delete(s.accesses, userID)
+	s.mu.Unlock()
+}
+
+// access returns the user's access, from the cache while it is fresh
+func (s *PermissionService) access(ctx context.Context, userID int) (*UserAccess, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	cached, ok := s.accesses[userID]
+	s.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.access, nil
+	}
+
+	access, err := s.repo.FindUserAccess(ctx, userID)
+	if err != nil || access == nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.accesses[userID] = cachedAccess{access: access, expires: now.Add(accessCacheTTL)}
+	// Drop expired entries now and then so the cache cannot grow forever
+	if len(s.accesses) > 10000 {
+		for id, entry := range s.accesses {
+			if now.After(entry.expires) {
+				delete(s.accesses, id)
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	return access, nil
+}
@@ -0,0 +1,188 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	tokens "HabitBite/backend/Tokens"
+)
+
+// Personal access token scopes
+const (
+	ScopeReadEntries  = "read:entries"
+	ScopeWriteEntries = "write:entries"
+	ScopeReadGoals    = "read:goals"
+)
+
+// PersonalTokenScopes lists every scope a personal access token can be given
+var PersonalTokenScopes = []string{ScopeReadEntries, ScopeWriteEntries, ScopeReadGoals}
+
+// Personal access token limits
+const (
+	DefaultPersonalTokenTTL = 90 * 24 * time.Hour
+	MaxPersonalTokenTTL     = 365 * 24 * time.Hour
+	MaxPersonalTokens       = 20
+	maxPersonalTokenName    = 100
+)
+
+// Personal access token errors
+var (
+	ErrPersonalTokenNotFound = errors.New("personal access token not found")
+	ErrPersonalTokenLimit    = fmt.Errorf("an account can have at most %d personal access tokens", MaxPersonalTokens)
+	ErrPersonalTokenName     = fmt.Errorf("token name must be 1 to %d characters", maxPersonalTokenName)
+	ErrPersonalTokenScopes   = errors.New("at least one valid scope is required")
+	ErrPersonalTokenTTL      = fmt.Errorf("token lifetime must be between 1 day and %d days", int(MaxPersonalTokenTTL.Hours()/24))
+)
+
+// PersonalAccessToken lets a script act for a user within its scopes until
+// it expires or is revoked. Only a hash of the token is stored; the token
+// itself is shown once, when it is created. MFA records whether it was
+// created from a login that used a second factor.
+type PersonalAccessToken struct {
+	ID         int        `db:"id" json:"id"`
+	UserID     int        `db:"user_id" json:"-"`
+	Name       string     `db:"name" json:"name"`
+	TokenHash  string     `db:"token_hash" json:"-"`
+	Scopes     StringList `db:"scopes" json:"scopes"`
+	MFA        bool       `db:"mfa" json:"-"`
+	ExpiresAt  time.Time  `db:"expires_at" json:"expiresAt"`
+	LastUsedAt *time.Time `db:"last_used_at" json:"lastUsedAt"`
+	CreatedAt  time.Time  `db:"created_at" json:"createdAt"`
+}
+
+// PersonalTokenRepository defines the personal access token storage the
+// service needs. FindPersonalToken returns nil for unknown tokens, and
+// DeletePersonalToken reports whether the user's token was deleted.
+type PersonalTokenRepository interface {
+	CreatePersonalToken(ctx context.Context, token *PersonalAccessToken) error
+	FindPersonalToken(ctx context.Context, tokenHash string) (*PersonalAccessToken, error)
+	ListPersonalTokens(ctx context.Context, userID int) ([]*PersonalAccessToken, error)
+	TouchPersonalToken(ctx context.Context, id int, now time.Time) error
+	DeletePersonalToken(ctx context.Context, id, userID int) (bool, error)
+}
+
+// PersonalTokenService creates personal access tokens and resolves them on requests
+type PersonalTokenService struct {
+	repo        PersonalTokenRepository
+	userService *UserService
+}
+
+// NewPersonalTokenService creates a new personal access token service
+func NewPersonalTokenService(repo PersonalTokenRepository, userService *UserService) *PersonalTokenService {
+	return &PersonalTokenService{
+		repo:        repo,
+		userService: userService,
+	}
+}
+
+// Create issues a token for the user and returns it with its stored record.
+// A ttl of zero uses DefaultPersonalTokenTTL; mfa records whether the
+// creating login used a second factor.
+func (s *PersonalTokenService) Create(ctx context.Context, userID int, name string, scopes []string, ttl time.Duration, mfa bool) (string, *PersonalAccessToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxPersonalTokenName {
+		return "", nil, ErrPersonalTokenName
+	}
+
+	granted := StringList{}
+	for _, scope := range scopes {
+		if !StringList(PersonalTokenScopes).Contains(scope) {
+			return "", nil, fmt.Errorf("%w: unknown scope %q", ErrPersonalTokenScopes, scope)
+		}
+		if !granted.Contains(scope) {
+			granted = append(granted, scope)
+		}
+	}
+	if len(granted) == 0 {
+		return "", nil, ErrPersonalTokenScopes
+	}
+
+	if ttl == 0 {
+		ttl = DefaultPersonalTokenTTL
+	}
+	if ttl < 24*time.Hour || ttl > MaxPersonalTokenTTL {
+		return "", nil, ErrPersonalTokenTTL
+	}
+
+	existing, err := s.repo.ListPersonalTokens(ctx, userID)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(existing) >= MaxPersonalTokens {
+		return "", nil, ErrPersonalTokenLimit
+	}
+
+	raw, hash, err := NewOpaqueToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	token := &PersonalAccessToken{
+		UserID:    userID,
+		Name:      name,
+		TokenHash: hash,
+		Scopes:    granted,
+		MFA:       mfa,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+	if err := s.repo.CreatePersonalToken(ctx, token); err != nil {
+		return "", nil, err
+	}
+
+	// The prefix is not part of the hash, so stored tokens stay plain opaque tokens
+	return tokens.PersonalAccessTokenPrefix + raw, token, nil
+}
+
+// List returns the user's tokens, newest first
+func (s *PersonalTokenService) List(ctx context.Context, userID int) ([]*PersonalAccessToken, error) {
+	return s.repo.ListPersonalTokens(ctx, userID)
+}
+
+// Revoke deletes one of the user's tokens
+func (s *PersonalTokenService) Revoke(ctx context.Context, userID, tokenID int) error {
+	deleted, err := s.repo.DeletePersonalToken(ctx, tokenID, userID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrPersonalTokenNotFound
+	}
+	return nil
+}
+
+// AuthenticatePersonalToken returns the claims a presented token grants, or
+// nil if it is unknown or expired. It records the token's use.
+func (s *PersonalTokenService) AuthenticatePersonalToken(ctx context.Context, raw string) (*tokens.Claims, error) {
+	raw, ok := strings.CutPrefix(raw, tokens.PersonalAccessTokenPrefix)
+	if !ok {
+		return nil, nil
+	}
+
+	token, err := s.repo.FindPersonalToken(ctx, HashToken(raw))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if token == nil || !now.Before(token.ExpiresAt) {
+		return nil, nil
+	}
+
+	user, err := s.userService.FindByID(ctx, token.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > sessionTouchInterval {
+		if err := s.repo.TouchPersonalToken(ctx, token.ID, now); err != nil {
+			log.Printf("Error recording use of personal access token %d: %v", token.ID, err)
+		}
+	}
+
+	return tokens.PersonalAccessClaims(token.ID, user.ID, user.Role, token.Scopes, token.MFA), nil
+}
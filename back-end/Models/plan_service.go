@@ -0,0 +1,356 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"time"
+
+	nutrition "HabitBite/backend/Nutrition"
+)
+
+// calorieChangeThreshold is the smallest change worth applying to a calorie goal
+const calorieChangeThreshold = 50
+
+// adaptiveReevaluationInterval is how often auto-applying plans are re-estimated
+const adaptiveReevaluationInterval = 7 * 24 * time.Hour
+
+// WeightRepository defines the weigh-in and weight plan storage the plan service needs
+type WeightRepository interface {
+	LogWeight(ctx context.Context, entry *WeightEntry) error
+	GetWeightEntries(ctx context.Context, userID int, startDate, endDate time.Time) ([]*WeightEntry, error)
+	GetLatestWeightEntry(ctx context.Context, userID int) (*WeightEntry, error)
+	GetWeightPlan(ctx context.Context, userID int) (*WeightPlan, error)
+	SaveWeightPlan(ctx context.Context, plan *WeightPlan) error
+	DeleteWeightPlan(ctx context.Context, userID int) error
+	ListAutoApplyPlans(ctx context.Context, evaluatedBefore time.Time) ([]*WeightPlan, error)
+}
+
+// IntakeHistory provides daily intake totals (implemented by the food entry repository)
+type IntakeHistory interface {
+	GetNutritionHistory(ctx context.Context, userID int, startDate, endDate time.Time) ([]*DailyNutrition, error)
+}
+
+// PlanEvaluation is the outcome of evaluating a weight plan against the latest data
+type PlanEvaluation struct {
+	Plan               *WeightPlan                 `json:"plan"`
+	CurrentWeight      float64                     `json:"currentWeight"`
+	TDEE               float64                     `json:"tdee"`
+	TDEESource         string                      `json:"tdeeSource"`
+	Formula            *nutrition.EnergyBreakdown  `json:"formula"`
+	Adaptive           *nutrition.AdaptiveEstimate `json:"adaptive,omitempty"`
+	Result             *nutrition.PlanResult       `json:"result"`
+	CurrentCalorieGoal int                         `json:"currentCalorieGoal"`
+	SuggestedCalories  int                         `json:"suggestedCalories"`
+	Applied            bool                        `json:"applied"`
+}
+
+// PlanService manages target-weight plans and adaptive calorie targets
+type PlanService struct {
+	userService *UserService
+	weightRepo  WeightRepository
+	intake      IntakeHistory
+}
+
+// NewPlanService creates a new plan service
+func NewPlanService(userService *UserService, weightRepo WeightRepository, intake IntakeHistory) *PlanService {
+	return &PlanService{
+		userService: userService,
+		weightRepo:  weightRepo,
+		intake:      intake,
+	}
+}
+
+// LogWeight records a weigh-in and updates the user's current weight if it is the latest one
+func (s *PlanService) LogWeight(ctx context.Context, userID int, weight float64, date time.Time) (*WeightEntry, error) {
+	latest, err := s.weightRepo.GetLatestWeightEntry(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &WeightEntry{UserID: userID, Weight: weight, Date: date}
+	if err := s.weightRepo.LogWeight(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	// Back-filled weigh-ins don't change the current weight
+	if latest != nil && date.Before(latest.Date) {
+		return entry, nil
+	}
+
+	user, err := s.userService.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	user.Weight = weight
+	if err := s.userService.UpdateUser(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// GetWeightEntries returns weigh-ins for a date range
+func (s *PlanService) GetWeightEntries(ctx context.Context, userID int, startDate, endDate time.Time) ([]*WeightEntry, error) {
+	return s.weightRepo.GetWeightEntries(ctx, userID, startDate, endDate)
+}
+
+// SetPlan creates or replaces a user's target-weight plan. The user's goal type
+// follows the plan direction, and the new calorie target is applied immediately
+// when autoApply is set.
+func (s *PlanService) SetPlan(ctx context.Context, userID int, targetWeight float64, targetDate time.Time, autoApply bool) (*PlanEvaluation, error) {
+	user, err := s.userService.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	currentWeight, err := s.currentWeight(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	plan := &WeightPlan{
+		UserID:       userID,
+		StartWeight:  currentWeight,
+		TargetWeight: targetWeight,
+		StartDate:    now,
+		TargetDate:   targetDate,
+		AutoApply:    autoApply,
+	}
+
+	// Keep the creation time of a plan that is being replaced
+	if existing, err := s.weightRepo.GetWeightPlan(ctx, userID); err == nil {
+		plan.CreatedAt = existing.CreatedAt
+	}
+
+	evaluation, err := s.evaluate(ctx, user, plan, now)
+	if err != nil {
+		return nil, err
+	}
+
+	// Point the goal type at the plan so default macros match the direction
+	if user.GoalType != evaluation.Result.Direction {
+		user.GoalType = evaluation.Result.Direction
+		if err := s.userService.UpdateUser(ctx, user); err != nil {
+			return nil, err
+		}
+	}
+
+	if autoApply {
+		if err := s.apply(ctx, evaluation); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.weightRepo.SaveWeightPlan(ctx, plan); err != nil {
+		return nil, err
+	}
+
+	return evaluation, nil
+}
+
+// GetPlan returns the user's plan evaluated against the latest data without applying it
+func (s *PlanService) GetPlan(ctx context.Context, userID int) (*PlanEvaluation, error) {
+	return s.Evaluate(ctx, userID, false)
+}
+
+// DeletePlan removes the user's target-weight plan
+func (s *PlanService) DeletePlan(ctx context.Context, userID int) error {
+	return s.weightRepo.DeleteWeightPlan(ctx, userID)
+}
+
+// Evaluate re-estimates TDEE for a user's plan and suggests a new calorie target.
+// The suggestion is applied if apply is true or the plan is set to auto-apply.
+func (s *PlanService) Evaluate(ctx context.Context, userID int, apply bool) (*PlanEvaluation, error) {
+	plan, err := s.weightRepo.GetWeightPlan(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userService.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	evaluation, err := s.evaluate(ctx, user, plan, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if apply || plan.AutoApply {
+		if err := s.apply(ctx, evaluation); err != nil {
+			return nil, err
+		}
+	}
+
+	// Only record the evaluation when something acted on it, so that viewing
+	// a plan does not postpone the scheduled re-estimate
+	if evaluation.Applied || apply {
+		if err := s.weightRepo.SaveWeightPlan(ctx, plan); err != nil {
+			return nil, err
+		}
+	}
+
+	return evaluation, nil
+}
+
+// RunAdaptiveAdjustments re-evaluates every auto-applying plan that is due and
+// returns the number of calorie goals that were changed
+func (s *PlanService) RunAdaptiveAdjustments(ctx context.Context) (int, error) {
+	plans, err := s.weightRepo.ListAutoApplyPlans(ctx, time.Now().Add(-adaptiveReevaluationInterval))
+	if err != nil {
+		return 0, err
+	}
+
+	adjusted := 0
+	for _, plan := range plans {
+		evaluation, err := s.Evaluate(ctx, plan.UserID, true)
+		if err != nil {
+			log.Printf("Adaptive plan evaluation failed for user %d: %v", plan.UserID, err)
+			continue
+		}
+		if evaluation.Applied {
+			adjusted++
+		}
+	}
+
+	return adjusted, nil
+}
+
+// RunScheduler periodically runs RunAdaptiveAdjustments until ctx is cancelled
+func (s *PlanService) RunScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			adjusted, err := s.RunAdaptiveAdjustments(ctx)
+			if err != nil {
+				log.Printf("Adaptive plan adjustment run failed: %v", err)
+				continue
+			}
+			log.Printf("Adaptive plan adjustment run complete: %d calorie goals updated", adjusted)
+		}
+	}
+}
+
+// evaluate computes TDEE and the plan's calorie target for a user at the given time
+func (s *PlanService) evaluate(ctx context.Context, user *User, plan *WeightPlan, now time.Time) (*PlanEvaluation, error) {
+	currentWeight, err := s.currentWeight(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	// The formula estimate is always computed so users can compare it with the adaptive one
+	profileUser := *user
+	profileUser.Weight = currentWeight
+	formula, err := profileUser.EstimateEnergy(now)
+	if err != nil {
+		return nil, err
+	}
+
+	evaluation := &PlanEvaluation{
+		Plan:               plan,
+		CurrentWeight:      currentWeight,
+		TDEE:               formula.TDEE,
+		TDEESource:         TDEESourceFormula,
+		Formula:            formula,
+		CurrentCalorieGoal: user.DailyCalorieGoal,
+	}
+
+	adaptive, err := s.estimateAdaptiveTDEE(ctx, user.ID, now)
+	switch {
+	case err == nil:
+		evaluation.TDEE = adaptive.TDEE
+		evaluation.TDEESource = TDEESourceAdaptive
+		evaluation.Adaptive = adaptive
+		estimated := int(math.Round(adaptive.TDEE))
+		plan.EstimatedTDEE = &estimated
+	case errors.Is(err, nutrition.ErrInsufficientPlanData):
+		// Fall back to the formula estimate until enough data has been logged
+	default:
+		return nil, err
+	}
+
+	result, err := nutrition.PlanCalories(nutrition.PlanInput{
+		CurrentWeight: currentWeight,
+		TargetWeight:  plan.TargetWeight,
+		TDEE:          evaluation.TDEE,
+		Gender:        user.Gender,
+		Today:         now,
+		TargetDate:    plan.TargetDate,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	evaluation.Result = result
+	evaluation.SuggestedCalories = result.TargetCalories
+	plan.LastEvaluatedAt = &now
+
+	return evaluation, nil
+}
+
+// estimateAdaptiveTDEE estimates TDEE from the intake and weight logged in the recent window
+func (s *PlanService) estimateAdaptiveTDEE(ctx context.Context, userID int, now time.Time) (*nutrition.AdaptiveEstimate, error) {
+	endDate := now
+	startDate := now.AddDate(0, 0, -nutrition.AdaptiveWindowDays)
+
+	history, err := s.intake.GetNutritionHistory(ctx, userID, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+
+	weights, err := s.weightRepo.GetWeightEntries(ctx, userID, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+
+	intake := make([]nutrition.DailyIntake, 0, len(history))
+	for _, day := range history {
+		intake = append(intake, nutrition.DailyIntake{Date: day.Date, Calories: day.TotalCalories})
+	}
+
+	samples := make([]nutrition.WeightSample, 0, len(weights))
+	for _, w := range weights {
+		samples = append(samples, nutrition.WeightSample{Date: w.Date, Weight: w.Weight})
+	}
+
+	return nutrition.EstimateAdaptiveTDEE(intake, samples)
+}
+
+// apply stores the suggested calorie target if it differs enough from the current goal
+func (s *PlanService) apply(ctx context.Context, evaluation *PlanEvaluation) error {
+	diff := evaluation.SuggestedCalories - evaluation.CurrentCalorieGoal
+	if diff > -calorieChangeThreshold && diff < calorieChangeThreshold {
+		return nil
+	}
+
+	if err := s.userService.UpdateCalorieGoal(ctx, evaluation.Plan.UserID, evaluation.SuggestedCalories); err != nil {
+		return err
+	}
+
+	log.Printf("Weight plan changed calorie goal for user %d from %d to %d (%s TDEE %.0f)",
+		evaluation.Plan.UserID, evaluation.CurrentCalorieGoal, evaluation.SuggestedCalories,
+		evaluation.TDEESource, evaluation.TDEE)
+	evaluation.Applied = true
+	return nil
+}
+
+// currentWeight returns the latest logged weight, falling back to the profile weight
+func (s *PlanService) currentWeight(ctx context.Context, user *User) (float64, error) {
+	latest, err := s.weightRepo.GetLatestWeightEntry(ctx, user.ID)
+	if err != nil {
+		return 0, err
+	}
+	if latest != nil {
+		return latest.Weight, nil
+	}
+	return user.Weight, nil
+}
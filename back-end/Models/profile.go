@@ -0,0 +1,114 @@
+package models
+
+import (
+	"context"
+	"log"
+	"time"
+
+	nutrition "HabitBite/backend/Nutrition"
+)
+
+// ProfileUpdate holds the profile fields a user changes; nil fields are kept
+type ProfileUpdate struct {
+	FullName      *string
+	Birthdate     *time.Time
+	Gender        *string
+	Height        *float64
+	Weight        *float64
+	GoalType      *string
+	ActivityLevel *string
+	BodyFatPct    *float64
+	EnergyFormula *string
+
+	// ClearBodyFat removes a stored body-fat percentage
+	ClearBodyFat bool
+}
+
+// ProfileResult is a user after a profile update, with the energy estimate
+// behind a recalculated calorie goal
+type ProfileResult struct {
+	User                *User
+	PreviousCalorieGoal int
+	Energy              *nutrition.EnergyBreakdown
+}
+
+// GoalRecalculated reports whether the update changed the calorie goal
+func (r *ProfileResult) GoalRecalculated() bool {
+	return r.Energy != nil
+}
+
+// UpdateProfile applies a profile update. When anything the energy estimate
+// depends on changes, the daily calorie goal is estimated again and the
+// macro targets follow it. The profile counts as complete afterwards.
+func (s *UserService) UpdateProfile(ctx context.Context, userID int, update ProfileUpdate) (*ProfileResult, error) {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ProfileResult{User: user, PreviousCalorieGoal: user.DailyCalorieGoal}
+	statsChanged := false
+
+	if update.FullName != nil {
+		user.FullName = *update.FullName
+	}
+	if update.Birthdate != nil && !update.Birthdate.Equal(user.Birthdate) {
+		user.Birthdate = *update.Birthdate
+		statsChanged = true
+	}
+	if update.Gender != nil && *update.Gender != user.Gender {
+		user.Gender = *update.Gender
+		statsChanged = true
+	}
+	if update.Height != nil && *update.Height != user.Height {
+		user.Height = *update.Height
+		statsChanged = true
+	}
+	if update.Weight != nil && *update.Weight != user.Weight {
+		user.Weight = *update.Weight
+		statsChanged = true
+	}
+	if update.GoalType != nil && *update.GoalType != user.GoalType {
+		user.GoalType = *update.GoalType
+		statsChanged = true
+	}
+	if update.ActivityLevel != nil && *update.ActivityLevel != user.ActivityLevel {
+		user.ActivityLevel = *update.ActivityLevel
+		statsChanged = true
+	}
+	if update.ClearBodyFat && user.BodyFatPct != nil {
+		user.BodyFatPct = nil
+		statsChanged = true
+	} else if update.BodyFatPct != nil && (user.BodyFatPct == nil || *update.BodyFatPct != *user.BodyFatPct) {
+		pct := *update.BodyFatPct
+		user.BodyFatPct = &pct
+		statsChanged = true
+	}
+	if update.EnergyFormula != nil && *update.EnergyFormula != user.EnergyFormula {
+		user.EnergyFormula = *update.EnergyFormula
+		statsChanged = true
+	}
+
+	// Accounts created through single sign-on start with placeholder stats,
+	// so their first profile save always sets a real goal
+	if statsChanged || !user.ProfileComplete {
+		energy, err := user.EstimateEnergy(time.Now())
+		if err != nil {
+			return nil, err
+		}
+		user.DailyCalorieGoal = energy.TargetCalories
+		result.Energy = energy
+	}
+	user.ProfileComplete = true
+
+	if err := s.UpdateUser(ctx, user); err != nil {
+		return nil, err
+	}
+
+	if result.GoalRecalculated() {
+		log.Printf("Profile update for user %d recalculated the calorie goal from %d to %d (%s)",
+			userID, result.PreviousCalorieGoal, user.DailyCalorieGoal, result.Energy.Formula)
+	}
+
+	return result, nil
+}
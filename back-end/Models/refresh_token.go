@@ -0,0 +1,183 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Refresh token errors
+var (
+	ErrRefreshTokenInvalid = errors.New("invalid refresh token")
+	ErrRefreshTokenExpired = errors.New("refresh token expired")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+)
+
+// DefaultRefreshTokenTTL is how long a refresh token stays valid
+const DefaultRefreshTokenTTL = 7 * 24 * time.Hour
+
+// RefreshToken is a stored, single-use refresh token. Every login starts a
+// new family; each refresh consumes the presented token and issues its
+// successor in the same family. Only a hash of the token is stored.
+// MFA records whether the login that started the family used a second
+// factor, so access tokens issued on refresh keep that status.
+type RefreshToken struct {
+	ID        int        `db:"id" json:"-"`
+	UserID    int        `db:"user_id" json:"-"`
+	FamilyID  string     `db:"family_id" json:"-"`
+	TokenHash string     `db:"token_hash" json:"-"`
+	ExpiresAt time.Time  `db:"expires_at" json:"-"`
+	CreatedAt time.Time  `db:"created_at" json:"-"`
+	UsedAt    *time.Time `db:"used_at" json:"-"`
+	RevokedAt *time.Time `db:"revoked_at" json:"-"`
+	MFA       bool       `db:"mfa" json:"-"`
+}
+
+// RefreshTokenRepository defines the refresh token storage the token service needs.
+// FindRefreshToken returns nil for unknown tokens, and MarkRefreshTokenUsed
+// reports false if the token had already been used or revoked.
+type RefreshTokenRepository interface {
+	CreateRefreshToken(ctx context.Context, token *RefreshToken) error
+	FindRefreshToken(ctx context.Context, tokenHash string) (*RefreshToken, error)
+	MarkRefreshTokenUsed(ctx context.Context, id int) (bool, error)
+	RevokeRefreshFamily(ctx context.Context, familyID string) error
+	RevokeUserRefreshTokens(ctx context.Context, userID int) error
+}
+
+// RefreshTokenService issues and rotates refresh tokens
+type RefreshTokenService struct {
+	repo RefreshTokenRepository
+	ttl  time.Duration
+}
+
+// NewRefreshTokenService creates a new refresh token service
+func NewRefreshTokenService(repo RefreshTokenRepository, ttl time.Duration) *RefreshTokenService {
+	if ttl <= 0 {
+		ttl = DefaultRefreshTokenTTL
+	}
+	return &RefreshTokenService{
+		repo: repo,
+		ttl:  ttl,
+	}
+}
+
+// TTL returns how long issued refresh tokens stay valid
+func (s *RefreshTokenService) TTL() time.Duration {
+	return s.ttl
+}
+
+// Issue starts a new token family for a user and returns its first token.
+// mfa records whether the login used a second factor.
+func (s *RefreshTokenService) Issue(ctx context.Context, userID int, mfa bool) (string, *RefreshToken, error) {
+	familyID, _, err := NewOpaqueToken()
+	if err != nil {
+		return "", nil, err
+	}
+	return s.issue(ctx, userID, familyID, mfa)
+}
+
+// Rotate consumes a refresh token and returns its successor.
+//
+// Presenting a token that was already used or revoked means it has leaked,
+// so the whole family is revoked and ErrRefreshTokenReused is returned.
+func (s *RefreshTokenService) Rotate(ctx context.Context, raw string) (string, *RefreshToken, error) {
+	current, err := s.repo.FindRefreshToken(ctx, HashToken(raw))
+	if err != nil {
+		return "", nil, err
+	}
+	if current == nil {
+		return "", nil, ErrRefreshTokenInvalid
+	}
+
+	if current.UsedAt != nil || current.RevokedAt != nil {
+		return "", nil, s.revokeReusedFamily(ctx, current)
+	}
+
+	if time.Now().After(current.ExpiresAt) {
+		return "", nil, ErrRefreshTokenExpired
+	}
+
+	// A concurrent refresh with the same token loses the race and counts as reuse
+	consumed, err := s.repo.MarkRefreshTokenUsed(ctx, current.ID)
+	if err != nil {
+		return "", nil, err
+	}
+	if !consumed {
+		return "", nil, s.revokeReusedFamily(ctx, current)
+	}
+
+	return s.issue(ctx, current.UserID, current.FamilyID, current.MFA)
+}
+
+// Revoke revokes the family a refresh token belongs to. Unknown tokens are ignored.
+func (s *RefreshTokenService) Revoke(ctx context.Context, raw string) error {
+	token, err := s.repo.FindRefreshToken(ctx, HashToken(raw))
+	if err != nil || token == nil {
+		return err
+	}
+	return s.repo.RevokeRefreshFamily(ctx, token.FamilyID)
+}
+
+// RevokeFamily revokes every token in a family
+func (s *RefreshTokenService) RevokeFamily(ctx context.Context, familyID string) error {
+	return s.repo.RevokeRefreshFamily(ctx, familyID)
+}
+
+// RevokeAll revokes every refresh token a user holds
+func (s *RefreshTokenService) RevokeAll(ctx context.Context, userID int) error {
+	return s.repo.RevokeUserRefreshTokens(ctx, userID)
+}
+
+// issue creates and stores a new token in the given family
+func (s *RefreshTokenService) issue(ctx context.Context, userID int, familyID string, mfa bool) (string, *RefreshToken, error) {
+	raw, hash, err := NewOpaqueToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	token := &RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hash,
+		ExpiresAt: now.Add(s.ttl),
+		CreatedAt: now,
+		MFA:       mfa,
+	}
+	if err := s.repo.CreateRefreshToken(ctx, token); err != nil {
+		return "", nil, err
+	}
+
+	return raw, token, nil
+}
+
+// revokeReusedFamily revokes a family after a replayed token and returns ErrRefreshTokenReused
+func (s *RefreshTokenService) revokeReusedFamily(ctx context.Context, token *RefreshToken) error {
+	log.Printf("Refresh token reuse detected for user %d; revoking token family", token.UserID)
+	if err := s.repo.RevokeRefreshFamily(ctx, token.FamilyID); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// NewOpaqueToken returns a random URL-safe token and its storage hash
+func NewOpaqueToken() (raw string, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("failed to generate token: %v", err)
+	}
+	raw = base64.RawURLEncoding.EncodeToString(b)
+	return raw, HashToken(raw), nil
+}
+
+// HashToken returns the hex SHA-256 hash under which an opaque token is stored
+func HashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
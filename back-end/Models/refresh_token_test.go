@@ -0,0 +1,236 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// memoryRefreshTokens is an in-memory RefreshTokenRepository
+type memoryRefreshTokens struct {
+	tokens []*RefreshToken
+	// loseRace makes MarkRefreshTokenUsed report that another request
+	// consumed the token first
+	loseRace bool
+}
+
+func (m *memoryRefreshTokens) CreateRefreshToken(ctx context.Context, token *RefreshToken) error {
+	token.ID = len(m.tokens) + 1
+	m.tokens = append(m.tokens, token)
+	return nil
+}
+
+func (m *memoryRefreshTokens) FindRefreshToken(ctx context.Context, tokenHash string) (*RefreshToken, error) {
+	for _, t := range m.tokens {
+		if t.TokenHash == tokenHash {
+			found := *t
+			return &found, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *memoryRefreshTokens) MarkRefreshTokenUsed(ctx context.Context, id int) (bool, error) {
+	t := m.tokens[id-1]
+	if m.loseRace || t.UsedAt != nil || t.RevokedAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	t.UsedAt = &now
+	return true, nil
+}
+
+func (m *memoryRefreshTokens) RevokeRefreshFamily(ctx context.Context, familyID string) error {
+	now := time.Now()
+	for _, t := range m.tokens {
+		if t.FamilyID == familyID && t.RevokedAt == nil {
+			t.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *memoryRefreshTokens) RevokeUserRefreshTokens(ctx context.Context, userID int) error {
+	now := time.Now()
+	for _, t := range m.tokens {
+		if t.UserID == userID && t.RevokedAt == nil {
+			t.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+// familyRevoked reports whether every token in a family is revoked
+func (m *memoryRefreshTokens) familyRevoked(familyID string) bool {
+	for _, t := range m.tokens {
+		if t.FamilyID == familyID && t.RevokedAt == nil {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRefreshTokenRotate(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		// setup issues tokens and returns the one to present
+		setup             func(t *testing.T, s *RefreshTokenService, repo *memoryRefreshTokens) string
+		wantErr           error
+		wantFamilyRevoked bool
+	}{
+		{
+			name: "fresh token",
+			setup: func(t *testing.T, s *RefreshTokenService, repo *memoryRefreshTokens) string {
+				raw, _, err := s.Issue(ctx, 1, true)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return raw
+			},
+		},
+		{
+			name: "successor of a rotated token",
+			setup: func(t *testing.T, s *RefreshTokenService, repo *memoryRefreshTokens) string {
+				raw, _, err := s.Issue(ctx, 1, true)
+				if err != nil {
+					t.Fatal(err)
+				}
+				next, _, err := s.Rotate(ctx, raw)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return next
+			},
+		},
+		{
+			name: "unknown token",
+			setup: func(t *testing.T, s *RefreshTokenService, repo *memoryRefreshTokens) string {
+				return "not-a-token"
+			},
+			wantErr: ErrRefreshTokenInvalid,
+		},
+		{
+			name: "expired token",
+			setup: func(t *testing.T, s *RefreshTokenService, repo *memoryRefreshTokens) string {
+				raw, token, err := s.Issue(ctx, 1, false)
+				if err != nil {
+					t.Fatal(err)
+				}
+				token.ExpiresAt = time.Now().Add(-time.Second)
+				return raw
+			},
+			wantErr: ErrRefreshTokenExpired,
+		},
+		{
+			name: "replayed token revokes the family",
+			setup: func(t *testing.T, s *RefreshTokenService, repo *memoryRefreshTokens) string {
+				raw, _, err := s.Issue(ctx, 1, false)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, _, err := s.Rotate(ctx, raw); err != nil {
+					t.Fatal(err)
+				}
+				return raw
+			},
+			wantErr:           ErrRefreshTokenReused,
+			wantFamilyRevoked: true,
+		},
+		{
+			name: "revoked token",
+			setup: func(t *testing.T, s *RefreshTokenService, repo *memoryRefreshTokens) string {
+				raw, _, err := s.Issue(ctx, 1, false)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := s.Revoke(ctx, raw); err != nil {
+					t.Fatal(err)
+				}
+				return raw
+			},
+			wantErr:           ErrRefreshTokenReused,
+			wantFamilyRevoked: true,
+		},
+		{
+			name: "concurrent refresh loses the race",
+			setup: func(t *testing.T, s *RefreshTokenService, repo *memoryRefreshTokens) string {
+				raw, _, err := s.Issue(ctx, 1, false)
+				if err != nil {
+					t.Fatal(err)
+				}
+				repo.loseRace = true
+				return raw
+			},
+			wantErr:           ErrRefreshTokenReused,
+			wantFamilyRevoked: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &memoryRefreshTokens{}
+			s := NewRefreshTokenService(repo, time.Hour)
+			raw := tt.setup(t, s, repo)
+
+			next, token, err := s.Rotate(ctx, raw)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got error %v, want %v", err, tt.wantErr)
+				}
+				if len(repo.tokens) > 0 && repo.familyRevoked(repo.tokens[0].FamilyID) != tt.wantFamilyRevoked {
+					t.Errorf("family revoked = %v, want %v", !tt.wantFamilyRevoked, tt.wantFamilyRevoked)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			first := repo.tokens[0]
+			if token.FamilyID != first.FamilyID || token.UserID != first.UserID || token.MFA != first.MFA {
+				t.Errorf("successor %+v does not continue family %+v", token, first)
+			}
+			if next == raw || token.TokenHash != HashToken(next) {
+				t.Error("successor must be a new token stored by its hash")
+			}
+			if repo.familyRevoked(first.FamilyID) {
+				t.Error("a normal rotation must not revoke the family")
+			}
+		})
+	}
+}
+
+func TestRefreshTokenReuseAfterRotation(t *testing.T) {
+	ctx := context.Background()
+	repo := &memoryRefreshTokens{}
+	s := NewRefreshTokenService(repo, time.Hour)
+
+	first, _, err := s.Issue(ctx, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _, err := s.Rotate(ctx, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An attacker replays the first token; the legitimate successor dies with it
+	if _, _, err := s.Rotate(ctx, first); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("replay: got error %v, want %v", err, ErrRefreshTokenReused)
+	}
+	if _, _, err := s.Rotate(ctx, second); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("successor after replay: got error %v, want %v", err, ErrRefreshTokenReused)
+	}
+
+	// Other families are untouched
+	other, _, err := s.Issue(ctx, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Rotate(ctx, other); err != nil {
+		t.Fatalf("other family: unexpected error %v", err)
+	}
+}
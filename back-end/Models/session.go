@@ -0,0 +1,225 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+)
+
+// ErrSessionNotFound is returned when a session does not exist or belongs to another user
+var ErrSessionNotFound = errors.New("session not found")
+
+// sessionTouchInterval is how stale a session's last use may get before a
+// request records it again, so busy sessions do not write on every request
+const sessionTouchInterval = 5 * time.Minute
+
+// maxUserAgentLength is the longest user agent stored with a session
+const maxUserAgentLength = 512
+
+// Session is one login on one device. Its ID is the family ID of the
+// refresh tokens it uses, and access tokens carry it in their "sid" claim.
+type Session struct {
+	ID         string     `db:"id" json:"id"`
+	UserID     int        `db:"user_id" json:"-"`
+	Device     string     `db:"device" json:"device"`
+	UserAgent  string     `db:"user_agent" json:"userAgent"`
+	IPAddress  string     `db:"ip_address" json:"ipAddress"`
+	CreatedAt  time.Time  `db:"created_at" json:"createdAt"`
+	LastUsedAt time.Time  `db:"last_used_at" json:"lastUsedAt"`
+	RevokedAt  *time.Time `db:"revoked_at" json:"-"`
+}
+
+// SessionRepository defines the session storage the service needs.
+// FindSession returns nil for unknown sessions. ListActiveSessions returns
+// the user's sessions that are not revoked and still hold a usable refresh
+// token. RevokeSession reports whether the user's session was revoked.
+type SessionRepository interface {
+	CreateSession(ctx context.Context, session *Session) error
+	FindSession(ctx context.Context, id string) (*Session, error)
+	ListActiveSessions(ctx context.Context, userID int, now time.Time) ([]*Session, error)
+	TouchSession(ctx context.Context, id string, now time.Time, ipAddress string) error
+	RevokeSession(ctx context.Context, id string, userID int) (bool, error)
+	RevokeUserSessions(ctx context.Context, userID int) error
+}
+
+// SessionService records logins per device so users can see where they are
+// signed in and end a session from elsewhere
+type SessionService struct {
+	repo          SessionRepository
+	refreshTokens *RefreshTokenService
+}
+
+// NewSessionService creates a new session service on top of the refresh tokens
+func NewSessionService(repo SessionRepository, refreshTokens *RefreshTokenService) *SessionService {
+	return &SessionService{
+		repo:          repo,
+		refreshTokens: refreshTokens,
+	}
+}
+
+// Start begins a session for a login and returns its first refresh token.
+// mfa records whether the login used a second factor.
+func (s *SessionService) Start(ctx context.Context, userID int, mfa bool, userAgent, ipAddress string) (string, *Session, error) {
+	raw, token, err := s.refreshTokens.Issue(ctx, userID, mfa)
+	if err != nil {
+		return "", nil, err
+	}
+
+	session := newSession(token, userAgent, ipAddress)
+	if err := s.repo.CreateSession(ctx, session); err != nil {
+		return "", nil, err
+	}
+
+	return raw, session, nil
+}
+
+// List returns the user's active sessions, most recently used first
+func (s *SessionService) List(ctx context.Context, userID int) ([]*Session, error) {
+	return s.repo.ListActiveSessions(ctx, userID, time.Now())
+}
+
+// Check reports whether a session of the user is still active, recording
+// its use when it was last seen a while ago
+func (s *SessionService) Check(ctx context.Context, sessionID string, userID int, ipAddress string) (bool, error) {
+	session, err := s.repo.FindSession(ctx, sessionID)
+	if err != nil {
+		return false, err
+	}
+	if session == nil || session.UserID != userID || session.RevokedAt != nil {
+		return false, nil
+	}
+
+	if now := time.Now(); now.Sub(session.LastUsedAt) > sessionTouchInterval {
+		if err := s.repo.TouchSession(ctx, sessionID, now, ipAddress); err != nil {
+			log.Printf("Error recording use of session for user %d: %v", userID, err)
+		}
+	}
+
+	return true, nil
+}
+
+// Refreshed records that a session's refresh token was rotated and returns
+// the session ID. Families started before sessions were recorded get a
+// session on their first refresh, so those logins keep working.
+func (s *SessionService) Refreshed(ctx context.Context, token *RefreshToken, userAgent, ipAddress string) (string, error) {
+	session, err := s.repo.FindSession(ctx, token.FamilyID)
+	if err != nil {
+		return "", err
+	}
+
+	if session == nil {
+		session = newSession(token, userAgent, ipAddress)
+		if err := s.repo.CreateSession(ctx, session); err != nil {
+			return "", err
+		}
+		return session.ID, nil
+	}
+
+	if session.RevokedAt != nil || session.UserID != token.UserID {
+		return "", ErrSessionNotFound
+	}
+	if err := s.repo.TouchSession(ctx, session.ID, time.Now(), ipAddress); err != nil {
+		return "", err
+	}
+
+	return session.ID, nil
+}
+
+// Revoke ends one of the user's sessions. Its refresh tokens stop working
+// and its access tokens are rejected from the next request on.
+func (s *SessionService) Revoke(ctx context.Context, userID int, sessionID string) error {
+	revoked, err := s.repo.RevokeSession(ctx, sessionID, userID)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return ErrSessionNotFound
+	}
+
+	return s.refreshTokens.RevokeFamily(ctx, sessionID)
+}
+
+// RevokeAll ends every session of the user
+func (s *SessionService) RevokeAll(ctx context.Context, userID int) error {
+	if err := s.repo.RevokeUserSessions(ctx, userID); err != nil {
+		return err
+	}
+	return s.refreshTokens.RevokeAll(ctx, userID)
+}
+
+// newSession describes the session of a refresh token family
+func newSession(token *RefreshToken, userAgent, ipAddress string) *Session {
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	return &Session{
+		ID:         token.FamilyID,
+		UserID:     token.UserID,
+		Device:     DescribeDevice(userAgent),
+		UserAgent:  userAgent,
+		IPAddress:  ipAddress,
+		CreatedAt:  token.CreatedAt,
+		LastUsedAt: token.CreatedAt,
+	}
+}
+
+// DescribeDevice gives a short, readable name such as "Firefox on Windows"
+// for a user agent
+func DescribeDevice(userAgent string) string {
+	if userAgent == "" {
+		return "Unknown device"
+	}
+
+	var browser string
+	switch {
+	case strings.Contains(userAgent, "Edg/"):
+		browser = "Edge"
+	case strings.Contains(userAgent, "OPR/"):
+		browser = "Opera"
+	case strings.Contains(userAgent, "Firefox/"):
+		browser = "Firefox"
+	case strings.Contains(userAgent, "Chrome/"):
+		browser = "Chrome"
+	case strings.Contains(userAgent, "Safari/"):
+		browser = "Safari"
+	}
+
+	var os string
+	switch {
+	case strings.Contains(userAgent, "iPhone"):
+		os = "iPhone"
+	case strings.Contains(userAgent, "iPad"):
+		os = "iPad"
+	case strings.Contains(userAgent, "Android"):
+		os = "Android"
+	case strings.Contains(userAgent, "Windows"):
+		os = "Windows"
+	case strings.Contains(userAgent, "Mac OS X"), strings.Contains(userAgent, "Macintosh"):
+		os = "macOS"
+	case strings.Contains(userAgent, "CrOS"):
+		os = "ChromeOS"
+	case strings.Contains(userAgent, "Linux"):
+		os = "Linux"
+	}
+
+	switch {
+	case browser != "" && os != "":
+		return browser + " on " + os
+	case browser != "":
+		return browser
+	case os != "":
+		return os
+	}
+
+	// Scripts and apps, e.g. "curl/8.4.0"
+	name := userAgent
+	if i := strings.IndexAny(name, "/ "); i > 0 {
+		name = name[:i]
+	}
+	if len(name) > 50 {
+		name = name[:50]
+	}
+	return name
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// TokenRevocationRepository defines the access token revocation storage.
+// IsTokenRevoked reports whether the token's ID was revoked or the user
+// revoked all tokens issued at or before issuedAt.
+type TokenRevocationRepository interface {
+	RevokeToken(ctx context.Context, jti string, userID int, expiresAt time.Time) error
+	RevokeUserTokens(ctx context.Context, userID int, issuedBefore time.Time) error
+	IsTokenRevoked(ctx context.Context, jti string, userID int, issuedAt time.Time) (bool, error)
+	DeleteExpiredRevocations(ctx context.Context, now time.Time) (int64, error)
+}
+
+// TokenRevocationService revokes access tokens before they expire
+type TokenRevocationService struct {
+	repo TokenRevocationRepository
+}
+
+// NewTokenRevocationService creates a new token revocation service
+func NewTokenRevocationService(repo TokenRevocationRepository) *TokenRevocationService {
+	return &TokenRevocationService{
+		repo: repo,
+	}
+}
+
+// RevokeToken revokes a single access token until it would have expired anyway
+func (s *TokenRevocationService) RevokeToken(ctx context.Context, jti string, userID int, expiresAt time.Time) error {
+	return s.repo.RevokeToken(ctx, jti, userID, expiresAt)
+}
+
+// RevokeAllForUser revokes every access token issued to a user so far
+func (s *TokenRevocationService) RevokeAllForUser(ctx context.Context, userID int) error {
+	return s.repo.RevokeUserTokens(ctx, userID, time.Now().Truncate(time.Second))
+}
+
+// IsRevoked reports whether an access token has been revoked
+func (s *TokenRevocationService) IsRevoked(ctx context.Context, jti string, userID int, issuedAt time.Time) (bool, error) {
+	return s.repo.IsTokenRevoked(ctx, jti, userID, issuedAt)
+}
+
+// RunCleanup periodically removes revocations of tokens that have expired until ctx is cancelled
+func (s *TokenRevocationService) RunCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			removed, err := s.repo.DeleteExpiredRevocations(ctx, time.Now())
+			if err != nil {
+				log.Printf("Token revocation cleanup failed: %v", err)
+				continue
+			}
+			if removed > 0 {
+				log.Printf("Token revocation cleanup removed %d expired entries", removed)
+			}
+		}
+	}
+}
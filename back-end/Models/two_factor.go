@@ -0,0 +1,314 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	totp "HabitBite/backend/TOTP"
+)
+
+// Two-factor authentication errors
+var (
+	ErrTwoFactorNotEnrolled     = errors.New("two-factor authentication is not set up")
+	ErrTwoFactorAlreadyEnabled  = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorInvalidCode     = errors.New("invalid two-factor code")
+	ErrTwoFactorLocked          = errors.New("too many invalid two-factor codes; try again later")
+	ErrTwoFactorRequiredForRole = errors.New("two-factor authentication is required for this account")
+)
+
+// Two-factor settings
+const (
+	// totpSkew accepts codes from one step before or after the current one
+	totpSkew = 1
+
+	recoveryCodeCount = 10
+
+	// After maxTwoFactorFailures invalid codes in a row, verification is
+	// refused for twoFactorLockout
+	maxTwoFactorFailures = 5
+	twoFactorLockout     = 15 * time.Minute
+)
+
+// recoveryAlphabet avoids characters that are easy to confuse when typed.
+// It has 32 characters, so a random byte maps onto it without bias.
+const recoveryAlphabet = "abcdefghjkmnpqrstuvwxyz023456789"
+
+// TwoFactor is a user's TOTP enrollment. It is pending until the first
+// code confirms it, which sets EnabledAt.
+type TwoFactor struct {
+	UserID         int        `db:"user_id"`
+	Secret         string     `db:"secret"`
+	EnabledAt      *time.Time `db:"enabled_at"`
+	LastUsedStep   int64      `db:"last_used_step"`
+	FailedAttempts int        `db:"failed_attempts"`
+	LockedUntil    *time.Time `db:"locked_until"`
+	CreatedAt      time.Time  `db:"created_at"`
+}
+
+// Enabled reports whether the enrollment has been confirmed
+func (t *TwoFactor) Enabled() bool {
+	return t != nil && t.EnabledAt != nil
+}
+
+// TwoFactorStatus describes a user's two-factor setup for API responses
+type TwoFactorStatus struct {
+	Enabled                bool       `json:"enabled"`
+	Required               bool       `json:"required"`
+	EnforcedFrom           *time.Time `json:"enforcedFrom,omitempty"` // Enrollment deadline while it is in the future
+	RecoveryCodesRemaining int        `json:"recoveryCodesRemaining"`
+}
+
+// TwoFactorEnrollment is returned when enrollment starts
+type TwoFactorEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauthUri"`
+}
+
+// TwoFactorRepository defines the two-factor storage the service needs.
+// GetTwoFactor returns nil when the user has no enrollment. UseTwoFactorStep
+// and UseRecoveryCode report false if the step or code was already used.
+type TwoFactorRepository interface {
+	GetTwoFactor(ctx context.Context, userID int) (*TwoFactor, error)
+	SaveTwoFactorSecret(ctx context.Context, userID int, secret string) error
+	EnableTwoFactor(ctx context.Context, userID int, step int64) error
+	UseTwoFactorStep(ctx context.Context, userID int, step int64) (bool, error)
+	RecordTwoFactorFailure(ctx context.Context, userID int, maxFailures int, lockUntil time.Time) error
+	DeleteTwoFactor(ctx context.Context, userID int) error
+
+	ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error
+	UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error)
+	CountRecoveryCodes(ctx context.Context, userID int) (int, error)
+}
+
+// TwoFactorService manages TOTP enrollment and verification
+type TwoFactorService struct {
+	repo          TwoFactorRepository
+	issuer        string
+	requiredRoles []string
+	enforceAfter  time.Time
+}
+
+// NewTwoFactorService creates a new two-factor service. issuer names the
+// app in authenticators; users with one of requiredRoles must use 2FA,
+// though until enforceAfter they are only asked to enroll.
+func NewTwoFactorService(repo TwoFactorRepository, issuer string, requiredRoles []string,
+	enforceAfter time.Time) *TwoFactorService {
+	return &TwoFactorService{
+		repo:          repo,
+		issuer:        issuer,
+		requiredRoles: requiredRoles,
+		enforceAfter:  enforceAfter,
+	}
+}
+
+// EnrollmentDeadline returns when 2FA starts being enforced for required
+// roles, or nil when it already is
+func (s *TwoFactorService) EnrollmentDeadline() *time.Time {
+	if !time.Now().Before(s.enforceAfter) {
+		return nil
+	}
+	deadline := s.enforceAfter
+	return &deadline
+}
+
+// IsRequiredForRole reports whether users with the role must use 2FA
+func (s *TwoFactorService) IsRequiredForRole(role string) bool {
+	for _, r := range s.requiredRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// IsEnabled reports whether a user has confirmed 2FA
+func (s *TwoFactorService) IsEnabled(ctx context.Context, userID int) (bool, error) {
+	tf, err := s.repo.GetTwoFactor(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return tf.Enabled(), nil
+}
+
+// Status returns a user's two-factor setup
+func (s *TwoFactorService) Status(ctx context.Context, user *User) (*TwoFactorStatus, error) {
+	tf, err := s.repo.GetTwoFactor(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &TwoFactorStatus{
+		Enabled:  tf.Enabled(),
+		Required: s.IsRequiredForRole(user.Role),
+	}
+	if status.Required {
+		status.EnforcedFrom = s.EnrollmentDeadline()
+	}
+	if status.Enabled {
+		if status.RecoveryCodesRemaining, err = s.repo.CountRecoveryCodes(ctx, user.ID); err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// Enroll starts (or restarts) enrollment with a new secret. 2FA is not
+// enforced until Confirm succeeds with a code from the authenticator.
+func (s *TwoFactorService) Enroll(ctx context.Context, user *User) (*TwoFactorEnrollment, error) {
+	tf, err := s.repo.GetTwoFactor(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if tf.Enabled() {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.SaveTwoFactorSecret(ctx, user.ID, secret); err != nil {
+		return nil, err
+	}
+
+	return &TwoFactorEnrollment{
+		Secret:     secret,
+		OTPAuthURI: totp.URI(s.issuer, user.Email, secret),
+	}, nil
+}
+
+// Confirm enables 2FA with a first code from the authenticator and returns
+// a fresh set of recovery codes. The codes are only shown this once.
+func (s *TwoFactorService) Confirm(ctx context.Context, userID int, code string) ([]string, error) {
+	tf, err := s.repo.GetTwoFactor(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if tf == nil {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+	if tf.Enabled() {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	step, ok := totp.Validate(tf.Secret, code, time.Now(), totpSkew)
+	if !ok {
+		return nil, ErrTwoFactorInvalidCode
+	}
+
+	if err := s.repo.EnableTwoFactor(ctx, userID, step); err != nil {
+		return nil, err
+	}
+
+	return s.newRecoveryCodes(ctx, userID)
+}
+
+// Verify checks a TOTP code or an unused recovery code for a user with 2FA
+// enabled. Each TOTP step and each recovery code can be used only once.
+func (s *TwoFactorService) Verify(ctx context.Context, userID int, code string) error {
+	tf, err := s.repo.GetTwoFactor(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !tf.Enabled() {
+		return ErrTwoFactorNotEnrolled
+	}
+
+	now := time.Now()
+	if tf.LockedUntil != nil && now.Before(*tf.LockedUntil) {
+		return ErrTwoFactorLocked
+	}
+
+	if step, ok := totp.Validate(tf.Secret, code, now, totpSkew); ok {
+		fresh, err := s.repo.UseTwoFactorStep(ctx, userID, step)
+		if err != nil {
+			return err
+		}
+		if fresh {
+			return nil
+		}
+	} else if normalized := normalizeRecoveryCode(code); len(normalized) > totp.Digits {
+		used, err := s.repo.UseRecoveryCode(ctx, userID, HashToken(normalized))
+		if err != nil {
+			return err
+		}
+		if used {
+			return nil
+		}
+	}
+
+	if err := s.repo.RecordTwoFactorFailure(ctx, userID, maxTwoFactorFailures, now.Add(twoFactorLockout)); err != nil {
+		return err
+	}
+	return ErrTwoFactorInvalidCode
+}
+
+// Disable turns 2FA off after checking a current code. Users whose role
+// requires 2FA cannot turn it off.
+func (s *TwoFactorService) Disable(ctx context.Context, user *User, code string) error {
+	if s.IsRequiredForRole(user.Role) {
+		return ErrTwoFactorRequiredForRole
+	}
+	if err := s.Verify(ctx, user.ID, code); err != nil {
+		return err
+	}
+	return s.repo.DeleteTwoFactor(ctx, user.ID)
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes after checking a current code
+func (s *TwoFactorService) RegenerateRecoveryCodes(ctx context.Context, userID int, code string) ([]string, error) {
+	if err := s.Verify(ctx, userID, code); err != nil {
+		return nil, err
+	}
+	return s.newRecoveryCodes(ctx, userID)
+}
+
+// newRecoveryCodes generates recovery codes and stores only their hashes
+func (s *TwoFactorService) newRecoveryCodes(ctx context.Context, userID int) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		hashes[i] = HashToken(normalizeRecoveryCode(code))
+	}
+
+	if err := s.repo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// newRecoveryCode returns a random code formatted as "xxxxx-xxxxx"
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate recovery code: %v", err)
+	}
+
+	var sb strings.Builder
+	for i, v := range b {
+		if i == 5 {
+			sb.WriteByte('-')
+		}
+		sb.WriteByte(recoveryAlphabet[int(v)%len(recoveryAlphabet)])
+	}
+	return sb.String(), nil
+}
+
+// normalizeRecoveryCode lower-cases a code and drops separators and spaces
+func normalizeRecoveryCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(code)))
+}
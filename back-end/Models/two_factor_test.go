@@ -0,0 +1,271 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	totp "HabitBite/backend/TOTP"
+)
+
+// memoryTwoFactor is an in-memory TwoFactorRepository for one user
+type memoryTwoFactor struct {
+	tf            *TwoFactor
+	recoveryCodes map[string]bool // hash -> used
+}
+
+func (m *memoryTwoFactor) GetTwoFactor(ctx context.Context, userID int) (*TwoFactor, error) {
+	if m.tf == nil {
+		return nil, nil
+	}
+	found := *m.tf
+	return &found, nil
+}
+
+func (m *memoryTwoFactor) SaveTwoFactorSecret(ctx context.Context, userID int, secret string) error {
+	m.tf = &TwoFactor{UserID: userID, Secret: secret, CreatedAt: time.Now()}
+	return nil
+}
+
+func (m *memoryTwoFactor) EnableTwoFactor(ctx context.Context, userID int, step int64) error {
+	now := time.Now()
+	m.tf.EnabledAt = &now
+	m.tf.LastUsedStep = step
+	return nil
+}
+
+func (m *memoryTwoFactor) UseTwoFactorStep(ctx context.Context, userID int, step int64) (bool, error) {
+	if !m.tf.Enabled() || m.tf.LastUsedStep >= step {
+		return false, nil
+	}
+	m.tf.LastUsedStep = step
+	m.tf.FailedAttempts = 0
+	m.tf.LockedUntil = nil
+	return true, nil
+}
+
+func (m *memoryTwoFactor) RecordTwoFactorFailure(ctx context.Context, userID int, maxFailures int, lockUntil time.Time) error {
+	if m.tf.FailedAttempts+1 >= maxFailures {
+		m.tf.LockedUntil = &lockUntil
+		m.tf.FailedAttempts = 0
+		return nil
+	}
+	m.tf.FailedAttempts++
+	return nil
+}
+
+func (m *memoryTwoFactor) DeleteTwoFactor(ctx context.Context, userID int) error {
+	m.tf = nil
+	m.recoveryCodes = nil
+	return nil
+}
+
+func (m *memoryTwoFactor) ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error {
+	m.recoveryCodes = make(map[string]bool)
+	for _, hash := range codeHashes {
+		m.recoveryCodes[hash] = false
+	}
+	return nil
+}
+
+func (m *memoryTwoFactor) UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error) {
+	used, ok := m.recoveryCodes[codeHash]
+	if !ok || used {
+		return false, nil
+	}
+	m.recoveryCodes[codeHash] = true
+	return true, nil
+}
+
+func (m *memoryTwoFactor) CountRecoveryCodes(ctx context.Context, userID int) (int, error) {
+	count := 0
+	for _, used := range m.recoveryCodes {
+		if !used {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// enrolledTwoFactor returns a service with 2FA confirmed for user 1 at a
+// step before the current one, and the recovery codes it issued
+func enrolledTwoFactor(t *testing.T) (*TwoFactorService, *memoryTwoFactor, []string) {
+	t.Helper()
+	ctx := context.Background()
+	repo := &memoryTwoFactor{}
+	s := NewTwoFactorService(repo, "HabitBite", nil, time.Time{})
+
+	if _, err := s.Enroll(ctx, &User{ID: 1, Email: "a@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	code, err := totp.Code(repo.tf.Secret, totp.Step(time.Now())-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, err := s.Confirm(ctx, 1, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, repo, codes
+}
+
+func TestTwoFactorVerify(t *testing.T) {
+	ctx := context.Background()
+	current := func(repo *memoryTwoFactor) string {
+		code, err := totp.Code(repo.tf.Secret, totp.Step(time.Now()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	tests := []struct {
+		name string
+		// codes returns the codes to verify in order; all but the last must pass
+		codes   func(repo *memoryTwoFactor, recovery []string) []string
+		wantErr error
+	}{
+		{
+			name: "current code",
+			codes: func(repo *memoryTwoFactor, recovery []string) []string {
+				return []string{current(repo)}
+			},
+		},
+		{
+			name: "replayed code",
+			codes: func(repo *memoryTwoFactor, recovery []string) []string {
+				code := current(repo)
+				return []string{code, code}
+			},
+			wantErr: ErrTwoFactorInvalidCode,
+		},
+		{
+			name: "code from the confirmed step",
+			codes: func(repo *memoryTwoFactor, recovery []string) []string {
+				code, _ := totp.Code(repo.tf.Secret, repo.tf.LastUsedStep)
+				return []string{code}
+			},
+			wantErr: ErrTwoFactorInvalidCode,
+		},
+		{
+			name: "recovery code",
+			codes: func(repo *memoryTwoFactor, recovery []string) []string {
+				return []string{recovery[0]}
+			},
+		},
+		{
+			name: "recovery code typed differently",
+			codes: func(repo *memoryTwoFactor, recovery []string) []string {
+				return []string{" " + strings.ToUpper(strings.ReplaceAll(recovery[0], "-", " ")) + " "}
+			},
+		},
+		{
+			name: "recovery code used twice",
+			codes: func(repo *memoryTwoFactor, recovery []string) []string {
+				return []string{recovery[0], recovery[1], recovery[0]}
+			},
+			wantErr: ErrTwoFactorInvalidCode,
+		},
+		{
+			name: "unknown recovery code",
+			codes: func(repo *memoryTwoFactor, recovery []string) []string {
+				return []string{"aaaaa-aaaaa"}
+			},
+			wantErr: ErrTwoFactorInvalidCode,
+		},
+		{
+			name: "locked after repeated failures",
+			codes: func(repo *memoryTwoFactor, recovery []string) []string {
+				codes := []string{"000000", "000000", "000000", "000000", "000000"}
+				return append(codes, current(repo))
+			},
+			wantErr: ErrTwoFactorLocked,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, repo, recovery := enrolledTwoFactor(t)
+			codes := tt.codes(repo, recovery)
+
+			var err error
+			for i, code := range codes {
+				err = s.Verify(ctx, 1, code)
+				// Codes before the last may be failures that set up a lockout
+				if i < len(codes)-1 && err != nil && !errors.Is(err, ErrTwoFactorInvalidCode) {
+					t.Fatalf("code %d: unexpected error %v", i+1, err)
+				}
+			}
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTwoFactorRecoveryCodes(t *testing.T) {
+	ctx := context.Background()
+	s, repo, recovery := enrolledTwoFactor(t)
+
+	if len(recovery) != recoveryCodeCount {
+		t.Fatalf("got %d recovery codes, want %d", len(recovery), recoveryCodeCount)
+	}
+	seen := make(map[string]bool)
+	for _, code := range recovery {
+		if len(code) != 11 || code[5] != '-' || seen[code] {
+			t.Errorf("bad or repeated recovery code %q", code)
+		}
+		seen[code] = true
+		if _, stored := repo.recoveryCodes[HashToken(code)]; stored {
+			t.Errorf("recovery code %q stored with its separator", code)
+		}
+	}
+
+	if err := s.Verify(ctx, 1, recovery[0]); err != nil {
+		t.Fatal(err)
+	}
+	status, err := s.Status(ctx, &User{ID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.RecoveryCodesRemaining != recoveryCodeCount-1 {
+		t.Errorf("%d recovery codes remaining, want %d", status.RecoveryCodesRemaining, recoveryCodeCount-1)
+	}
+}
+
+func TestTwoFactorEnrollmentDeadline(t *testing.T) {
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name         string
+		enforceAfter time.Time
+		role         string
+		wantRequired bool
+		wantDeadline bool
+	}{
+		{"enforced at once", time.Time{}, "admin", true, false},
+		{"before the deadline", future, "admin", true, true},
+		{"after the deadline", time.Now().Add(-time.Hour), "admin", true, false},
+		{"role not required", future, "user", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewTwoFactorService(&memoryTwoFactor{}, "HabitBite", []string{"admin"}, tt.enforceAfter)
+			status, err := s.Status(context.Background(), &User{ID: 1, Role: tt.role})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status.Required != tt.wantRequired {
+				t.Errorf("Required = %v, want %v", status.Required, tt.wantRequired)
+			}
+			if got := status.EnforcedFrom != nil; got != tt.wantDeadline {
+				t.Errorf("has deadline = %v, want %v", got, tt.wantDeadline)
+			}
+		})
+	}
+}
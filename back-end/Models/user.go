@@ -3,26 +3,37 @@ package models
 import (
 	"time"
 
+	nutrition "HabitBite/backend/Nutrition"
+
 	"golang.org/x/crypto/bcrypt"
 )
 
 // User represents a user in the system
 type User struct {
-	ID               int       `db:"id" json:"id"`
-	Email            string    `db:"email" json:"email"`
-	Username         string    `db:"username" json:"username"`
-	PasswordHash     string    `db:"password_hash" json:"-"`
-	FullName         string    `db:"full_name" json:"fullName"`
-	Birthdate        time.Time `db:"birthdate" json:"birthdate"`
-	Gender           string    `db:"gender" json:"gender"`
-	Height           float64   `db:"height" json:"height"`
-	Weight           float64   `db:"weight" json:"weight"`
-	GoalType         string    `db:"goal_type" json:"goalType"`
-	ActivityLevel    string    `db:"activity_level" json:"activityLevel"`
-	DailyCalorieGoal int       `db:"daily_calorie_goal" json:"dailyCalorieGoal"`
-	Role             string    `db:"role" json:"role"`
-	CreatedAt        time.Time `db:"created_at" json:"createdAt"`
-	UpdatedAt        time.Time `db:"updated_at" json:"updatedAt"`
+	ID                  int        `db:"id" json:"id"`
+	Email               string     `db:"email" json:"email"`
+	EmailVerified       bool       `db:"email_verified" json:"emailVerified"`
+	EmailVerifiedAt     *time.Time `db:"email_verified_at" json:"-"`
+	Username            string     `db:"username" json:"username"`
+	PasswordHash        string     `db:"password_hash" json:"-"`
+	FullName            string     `db:"full_name" json:"fullName"`
+	Birthdate           time.Time  `db:"birthdate" json:"birthdate"`
+	Gender              string     `db:"gender" json:"gender"`
+	Height              float64    `db:"height" json:"height"`
+	Weight              float64    `db:"weight" json:"weight"`
+	GoalType            string     `db:"goal_type" json:"goalType"`
+	ActivityLevel       string     `db:"activity_level" json:"activityLevel"`
+	DailyCalorieGoal    int        `db:"daily_calorie_goal" json:"dailyCalorieGoal"`
+	BodyFatPct          *float64   `db:"body_fat_pct" json:"bodyFatPct,omitempty"`
+	EnergyFormula       string     `db:"energy_formula" json:"energyFormula"`
+	Diet                string     `db:"diet" json:"diet"`
+	Allergens           StringList `db:"allergens" json:"allergens"`
+	Role                string     `db:"role" json:"role"`
+	ProfileComplete     bool       `db:"profile_complete" json:"profileComplete"`
+	DeletionScheduledAt *time.Time `db:"deletion_scheduled_at" json:"deletionScheduledAt,omitempty"`
+	DisabledAt          *time.Time `db:"disabled_at" json:"disabledAt,omitempty"`
+	CreatedAt           time.Time  `db:"created_at" json:"createdAt"`
+	UpdatedAt           time.Time  `db:"updated_at" json:"updatedAt"`
 }
 
 // SetPassword hashes and sets the user's password
@@ -35,12 +46,48 @@ func (u *User) SetPassword(password string) error {
 	return nil
 }
 
+// IsDisabled reports whether an admin has disabled the account
+func (u *User) IsDisabled() bool {
+	return u.DisabledAt != nil
+}
+
+// HasPassword reports whether the user can sign in with a password. Accounts
+// created through an OpenID Connect provider have none until they set one.
+func (u *User) HasPassword() bool {
+	return u.PasswordHash != ""
+}
+
 // CheckPassword checks if the provided password matches the stored hash
 func (u *User) CheckPassword(password string) bool {
+	if !u.HasPassword() {
+		return false
+	}
+
 	err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password))
 	return err == nil
 }
 
+// BodyProfile returns the measurements used for energy estimates, with age computed on the given date
+func (u *User) BodyProfile(on time.Time) nutrition.BodyProfile {
+	return nutrition.BodyProfile{
+		WeightKg:   u.Weight,
+		HeightCm:   u.Height,
+		Age:        nutrition.AgeOn(u.Birthdate, on),
+		Gender:     u.Gender,
+		BodyFatPct: u.BodyFatPct,
+	}
+}
+
+// EstimateEnergy estimates the user's BMR, TDEE and daily calorie target from their stored profile
+func (u *User) EstimateEnergy(on time.Time) (*nutrition.EnergyBreakdown, error) {
+	return nutrition.DailyCalorieGoal(u.EnergyFormula, u.BodyProfile(on), u.ActivityLevel, u.GoalType)
+}
+
+// DietProfile returns the user's diet and allergens
+func (u *User) DietProfile() DietProfile {
+	return DietProfile{Diet: u.Diet, Allergens: u.Allergens}
+}
+
 // SanitizeUser removes sensitive information for API responses
 func (u *User) SanitizeUser() *User {
 	// Create a copy of the user
@@ -77,35 +124,49 @@ const (
 
 // AuthUser contains user information for authentication responses
 type AuthUser struct {
-	ID               int       `json:"id"`
-	Email            string    `json:"email"`
-	Username         string    `json:"username"`
-	FullName         string    `json:"fullName"`
-	Role             string    `json:"role"`
-	GoalType         string    `json:"goalType"`
-	ActivityLevel    string    `json:"activityLevel"`
-	Gender           string    `json:"gender"`
-	Height           float64   `json:"height"`
-	Weight           float64   `json:"weight"`
-	Birthdate        time.Time `json:"birthdate"`
-	DailyCalorieGoal int       `json:"dailyCalorieGoal"`
+	ID                  int        `json:"id"`
+	Email               string     `json:"email"`
+	EmailVerified       bool       `json:"emailVerified"`
+	Username            string     `json:"username"`
+	FullName            string     `json:"fullName"`
+	Role                string     `json:"role"`
+	GoalType            string     `json:"goalType"`
+	ActivityLevel       string     `json:"activityLevel"`
+	Gender              string     `json:"gender"`
+	Height              float64    `json:"height"`
+	Weight              float64    `json:"weight"`
+	Birthdate           time.Time  `json:"birthdate"`
+	DailyCalorieGoal    int        `json:"dailyCalorieGoal"`
+	BodyFatPct          *float64   `json:"bodyFatPct,omitempty"`
+	EnergyFormula       string     `json:"energyFormula"`
+	Diet                string     `json:"diet"`
+	Allergens           StringList `json:"allergens"`
+	ProfileComplete     bool       `json:"profileComplete"`
+	DeletionScheduledAt *time.Time `json:"deletionScheduledAt,omitempty"`
 }
 
 // ToAuthUser converts a User to AuthUser
 func (u *User) ToAuthUser() *AuthUser {
 	return &AuthUser{
-		ID:               u.ID,
-		Email:            u.Email,
-		Username:         u.Username,
-		FullName:         u.FullName,
-		Role:             u.Role,
-		GoalType:         u.GoalType,
-		ActivityLevel:    u.ActivityLevel,
-		Gender:           u.Gender,
-		Height:           u.Height,
-		Weight:           u.Weight,
-		Birthdate:        u.Birthdate,
-		DailyCalorieGoal: u.DailyCalorieGoal,
+		ID:                  u.ID,
+		Email:               u.Email,
+		EmailVerified:       u.EmailVerified,
+		Username:            u.Username,
+		FullName:            u.FullName,
+		Role:                u.Role,
+		GoalType:            u.GoalType,
+		ActivityLevel:       u.ActivityLevel,
+		Gender:              u.Gender,
+		Height:              u.Height,
+		Weight:              u.Weight,
+		Birthdate:           u.Birthdate,
+		DailyCalorieGoal:    u.DailyCalorieGoal,
+		BodyFatPct:          u.BodyFatPct,
+		EnergyFormula:       u.EnergyFormula,
+		Diet:                u.Diet,
+		Allergens:           u.Allergens,
+		ProfileComplete:     u.ProfileComplete,
+		DeletionScheduledAt: u.DeletionScheduledAt,
 	}
 }
 
@@ -117,4 +178,40 @@ type UserGoals struct {
 	TargetCarbs    float64 `db:"target_carbs" json:"targetCarbs"`
 	TargetFats     float64 `db:"target_fats" json:"targetFats"`
 	TargetWeight   float64 `db:"target_weight" json:"targetWeight"`
+
+	// Macro split preference; all zero means the goal-type default split
+	MacroPreset  string  `db:"macro_preset" json:"macroPreset"`
+	ProteinPct   float64 `db:"protein_pct" json:"proteinPct"`
+	CarbsPct     float64 `db:"carbs_pct" json:"carbsPct"`
+	FatPct       float64 `db:"fat_pct" json:"fatPct"`
+	ProteinPerKg float64 `db:"protein_per_kg" json:"proteinPerKg"`
+}
+
+// MacroPreference returns the macro split preference stored with the goals
+func (g *UserGoals) MacroPreference() nutrition.MacroPreference {
+	return nutrition.MacroPreference{
+		Preset: g.MacroPreset,
+		Split: nutrition.MacroSplit{
+			ProteinPct: g.ProteinPct,
+			CarbsPct:   g.CarbsPct,
+			FatPct:     g.FatPct,
+		},
+		ProteinPerKg: g.ProteinPerKg,
+	}
+}
+
+// SetMacroPreference stores a macro split preference on the goals
+func (g *UserGoals) SetMacroPreference(pref nutrition.MacroPreference) {
+	g.MacroPreset = pref.Preset
+	g.ProteinPct = pref.Split.ProteinPct
+	g.CarbsPct = pref.Split.CarbsPct
+	g.FatPct = pref.Split.FatPct
+	g.ProteinPerKg = pref.ProteinPerKg
+}
+
+// ApplyMacroTargets copies calculated gram targets onto the goals
+func (g *UserGoals) ApplyMacroTargets(targets nutrition.MacroTargets) {
+	g.TargetProtein = targets.Protein
+	g.TargetCarbs = targets.Carbs
+	g.TargetFats = targets.Fats
 }
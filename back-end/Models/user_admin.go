@@ -0,0 +1,222 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// User account statuses for filtering
+const (
+	UserStatusActive   = "active"
+	UserStatusDisabled = "disabled"
+)
+
+// Admin user listing limits
+const (
+	DefaultUserListLimit = 25
+	MaxUserListLimit     = 100
+)
+
+// User administration errors
+var (
+	ErrInvalidRole         = errors.New("role must be user, dietitian or admin")
+	ErrOwnAccount          = errors.New("admins cannot change the role or status of their own account")
+	ErrUserAlreadyDisabled = errors.New("user is already disabled")
+	ErrUserNotDisabled     = errors.New("user is not disabled")
+	ErrImpersonateSelf     = errors.New("admins cannot impersonate themselves")
+	ErrImpersonateAdmin    = errors.New("admins cannot be impersonated")
+	ErrImpersonateDisabled = errors.New("disabled users cannot be impersonated")
+)
+
+// UserSearch describes an admin user listing. Query matches the email,
+// username or full name; the other fields are left out when empty.
+type UserSearch struct {
+	Query         string
+	Role          string
+	Status        string
+	CreatedFrom   *time.Time
+	CreatedBefore *time.Time
+	Limit         int
+	Offset        int
+}
+
+// UserAdminRepository defines the user storage administration needs.
+// SearchUsers returns one page of matching users and the number of matches.
+type UserAdminRepository interface {
+	SearchUsers(ctx context.Context, search UserSearch) ([]*User, int, error)
+	SetUserRole(ctx context.Context, userID int, role string) error
+	SetUserDisabled(ctx context.Context, userID int, disabledAt *time.Time) error
+	ClearPassword(ctx context.Context, userID int) error
+}
+
+// UserAdminService lets admins find users and manage their accounts
+type UserAdminService struct {
+	repo           UserAdminRepository
+	userService    *UserService
+	permissions    *PermissionService
+	sessions       *SessionService
+	revocations    *TokenRevocationService
+	passwordResets *PasswordResetService
+}
+
+// NewUserAdminService creates a new user administration service
+func NewUserAdminService(repo UserAdminRepository, userService *UserService, permissions *PermissionService,
+	sessions *SessionService, revocations *TokenRevocationService, passwordResets *PasswordResetService) *UserAdminService {
+	return &UserAdminService{
+		repo:           repo,
+		userService:    userService,
+		permissions:    permissions,
+		sessions:       sessions,
+		revocations:    revocations,
+		passwordResets: passwordResets,
+	}
+}
+
+// List returns one page of users matching the search, newest first, and
+// the total number of matches
+func (s *UserAdminService) List(ctx context.Context, search UserSearch) ([]*User, int, error) {
+	if search.Limit <= 0 {
+		search.Limit = DefaultUserListLimit
+	}
+	if search.Limit > MaxUserListLimit {
+		search.Limit = MaxUserListLimit
+	}
+	if search.Offset < 0 {
+		search.Offset = 0
+	}
+
+	return s.repo.SearchUsers(ctx, search)
+}
+
+// Get returns a user's profile and goals
+func (s *UserAdminService) Get(ctx context.Context, userID int) (*User, *UserGoals, error) {
+	return s.userService.GetUserWithGoals(ctx, userID)
+}
+
+// ChangeRole gives a user a new role and returns the user with the role
+// they had before. It applies from the user's next request.
+func (s *UserAdminService) ChangeRole(ctx context.Context, adminID, userID int, role string) (*User, string, error) {
+	if role != RoleUser && role != RoleDietitian && role != RoleAdmin {
+		return nil, "", ErrInvalidRole
+	}
+	if adminID == userID {
+		return nil, "", ErrOwnAccount
+	}
+
+	user, err := s.userService.FindByID(ctx, userID)
+	if err != nil {
+		return nil, "", err
+	}
+	previous := user.Role
+	if previous == role {
+		return user, previous, nil
+	}
+
+	if err := s.repo.SetUserRole(ctx, userID, role); err != nil {
+		return nil, "", err
+	}
+	s.permissions.Forget(userID)
+
+	user.Role = role
+	return user, previous, nil
+}
+
+// Disable stops a user from signing in and signs them out everywhere
+func (s *UserAdminService) Disable(ctx context.Context, adminID, userID int) (*User, error) {
+	if adminID == userID {
+		return nil, ErrOwnAccount
+	}
+
+	user, err := s.userService.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.IsDisabled() {
+		return nil, ErrUserAlreadyDisabled
+	}
+
+	now := time.Now()
+	if err := s.repo.SetUserDisabled(ctx, userID, &now); err != nil {
+		return nil, err
+	}
+	s.permissions.Forget(userID)
+
+	if err := s.signOut(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	user.DisabledAt = &now
+	return user, nil
+}
+
+// Enable lets a disabled user sign in again
+func (s *UserAdminService) Enable(ctx context.Context, adminID, userID int) (*User, error) {
+	if adminID == userID {
+		return nil, ErrOwnAccount
+	}
+
+	user, err := s.userService.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsDisabled() {
+		return nil, ErrUserNotDisabled
+	}
+
+	if err := s.repo.SetUserDisabled(ctx, userID, nil); err != nil {
+		return nil, err
+	}
+	s.permissions.Forget(userID)
+
+	user.DisabledAt = nil
+	return user, nil
+}
+
+// ForcePasswordReset clears the user's password, signs them out everywhere
+// and emails them a link to choose a new one
+func (s *UserAdminService) ForcePasswordReset(ctx context.Context, userID int) error {
+	user, err := s.userService.FindByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.ClearPassword(ctx, userID); err != nil {
+		return err
+	}
+	if err := s.signOut(ctx, userID); err != nil {
+		return err
+	}
+
+	return s.passwordResets.ForceReset(ctx, user)
+}
+
+// CheckImpersonation returns the user an admin wants to impersonate, or an
+// error if they may not. Other admins are off limits, so impersonation
+// cannot be used to borrow permissions.
+func (s *UserAdminService) CheckImpersonation(ctx context.Context, adminID, userID int) (*User, error) {
+	if adminID == userID {
+		return nil, ErrImpersonateSelf
+	}
+
+	user, err := s.userService.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Role == RoleAdmin {
+		return nil, ErrImpersonateAdmin
+	}
+	if user.IsDisabled() {
+		return nil, ErrImpersonateDisabled
+	}
+
+	return user, nil
+}
+
+// signOut ends every session of the user and revokes their access tokens
+func (s *UserAdminService) signOut(ctx context.Context, userID int) error {
+	if err := s.sessions.RevokeAll(ctx, userID); err != nil {
+		return err
+	}
+	return s.revocations.RevokeAllForUser(ctx, userID)
+}
@@ -2,13 +2,31 @@ package models
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"regexp"
+	"time"
+
+	nutrition "HabitBite/backend/Nutrition"
+	passwords "HabitBite/backend/Passwords"
 )
 
+// ErrInvalidGoalSchedule is returned when a goal schedule or day tag fails validation
+var ErrInvalidGoalSchedule = errors.New("invalid goal schedule")
+
+// ErrNotADietitian is returned when linking to an account that is not a dietitian
+var ErrNotADietitian = errors.New("account is not a dietitian")
+
+// dayTagPattern restricts day tags to short lowercase identifiers
+var dayTagPattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,29}$`)
+
 // UserService provides higher-level operations for user management
 // with automatic synchronization between users and user_goals tables
 type UserService struct {
-	userRepo UserRepository
+	userRepo     UserRepository
+	scheduleRepo GoalScheduleRepository
+	passwords    *passwords.Policy
 }
 
 // UserRepository defines the interface that the repository must implement
@@ -19,16 +37,35 @@ type UserRepository interface {
 	FindByUsername(ctx context.Context, username string) (*User, error)
 	FindByID(ctx context.Context, id int) (*User, error)
 	UpdateUser(ctx context.Context, user *User) error
+	UpdatePassword(ctx context.Context, userID int, passwordHash string) error
+	MarkEmailVerified(ctx context.Context, userID int, email string) (bool, error)
+	ChangeEmail(ctx context.Context, userID int, oldEmail, newEmail string) (bool, error)
+	EmailExists(ctx context.Context, email string) (bool, error)
 	DeleteUser(ctx context.Context, id int) error
 	GetUserGoals(ctx context.Context, userID int) (*UserGoals, error)
 	UpdateUserGoals(ctx context.Context, goals *UserGoals) error
 	SyncUserCalorieGoal(ctx context.Context, userID int, calorieGoal int) error
+	IsAssignedDietitian(ctx context.Context, dietitianID, userID int) (bool, error)
+	AssignDietitian(ctx context.Context, dietitianID, userID int) error
+	UnassignDietitian(ctx context.Context, dietitianID, userID int) error
 }
 
-// NewUserService creates a new user service
-func NewUserService(repo UserRepository) *UserService {
+// GoalScheduleRepository defines the per-day goal storage the service needs
+type GoalScheduleRepository interface {
+	GetGoalOverrides(ctx context.Context, userID int) ([]*GoalOverride, error)
+	ReplaceGoalOverrides(ctx context.Context, userID int, overrides []GoalOverride) error
+	GetDayTags(ctx context.Context, userID int, startDate, endDate time.Time) ([]*DayTag, error)
+	SetDayTag(ctx context.Context, tag *DayTag) error
+	DeleteDayTag(ctx context.Context, userID int, date time.Time) error
+}
+
+// NewUserService creates a new user service. New passwords must pass the
+// policy; a nil policy accepts any password.
+func NewUserService(repo UserRepository, scheduleRepo GoalScheduleRepository, policy *passwords.Policy) *UserService {
 	return &UserService{
-		userRepo: repo,
+		userRepo:     repo,
+		scheduleRepo: scheduleRepo,
+		passwords:    policy,
 	}
 }
 
@@ -95,15 +132,20 @@ func (s *UserService) GetUserWithGoals(ctx context.Context, userID int) (*User,
 	return user, goals, nil
 }
 
-// UpdateUserGoals updates a user's goals and ensures calorie goals are synchronized
+// UpdateUserGoals updates a user's goals and ensures calorie goals are synchronized.
+// The macro split preference is not changed here; see UpdateMacroPreference.
 func (s *UserService) UpdateUserGoals(ctx context.Context, goals *UserGoals) error {
 	// First, check if the goals exist
 	existingGoals, err := s.userRepo.GetUserGoals(ctx, goals.UserID)
 	if err != nil {
 		// If goals don't exist, create them
+		goals.SetMacroPreference(nutrition.MacroPreference{})
 		return s.userRepo.UpdateUserGoals(ctx, goals)
 	}
 
+	// Keep the stored macro preference
+	goals.SetMacroPreference(existingGoals.MacroPreference())
+
 	// Check if calorie goal has changed
 	if existingGoals.TargetCalories != goals.TargetCalories {
 		log.Printf("Target calories changed from %d to %d for user %d",
@@ -122,6 +164,60 @@ func (s *UserService) UpdateUserGoals(ctx context.Context, goals *UserGoals) err
 	return s.userRepo.UpdateUserGoals(ctx, goals)
 }
 
+// UpdateMacroPreference validates and stores a user's macro split preference
+// and recalculates their macro targets from it
+func (s *UserService) UpdateMacroPreference(ctx context.Context, userID int, pref nutrition.MacroPreference) (*UserGoals, error) {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	goals, err := s.GetUserGoals(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reject preferences that cannot be applied to the current calorie goal
+	if _, err := nutrition.CalculateMacros(goals.TargetCalories, user.Weight, user.GoalType, pref); err != nil {
+		return nil, err
+	}
+
+	goals.SetMacroPreference(pref)
+	if err := s.userRepo.UpdateUserGoals(ctx, goals); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Macro preference for user %d set to %q", userID, pref.Preset)
+	return goals, nil
+}
+
+// IsAssignedDietitian reports whether the dietitian is assigned to the user
+func (s *UserService) IsAssignedDietitian(ctx context.Context, dietitianID, userID int) (bool, error) {
+	return s.userRepo.IsAssignedDietitian(ctx, dietitianID, userID)
+}
+
+// AssignDietitian links a user to a dietitian
+func (s *UserService) AssignDietitian(ctx context.Context, userID, dietitianID int) error {
+	if userID == dietitianID {
+		return ErrNotADietitian
+	}
+
+	dietitian, err := s.userRepo.FindByID(ctx, dietitianID)
+	if err != nil {
+		return err
+	}
+	if dietitian.Role != RoleDietitian {
+		return ErrNotADietitian
+	}
+
+	return s.userRepo.AssignDietitian(ctx, dietitianID, userID)
+}
+
+// UnassignDietitian removes the link between a user and a dietitian
+func (s *UserService) UnassignDietitian(ctx context.Context, userID, dietitianID int) error {
+	return s.userRepo.UnassignDietitian(ctx, dietitianID, userID)
+}
+
 // UpdateCalorieGoal updates both user and goals calorie values atomically
 func (s *UserService) UpdateCalorieGoal(ctx context.Context, userID int, calorieGoal int) error {
 	return s.userRepo.SyncUserCalorieGoal(ctx, userID, calorieGoal)
@@ -158,6 +254,199 @@ func (s *UserService) GetUserGoals(ctx context.Context, userID int) (*UserGoals,
 	return goals, nil
 }
 
+// GetEffectiveGoals returns the targets that apply on a date, taking
+// day-tag and weekday overrides into account
+func (s *UserService) GetEffectiveGoals(ctx context.Context, userID int, date time.Time) (*EffectiveGoals, error) {
+	byDate, err := s.GetEffectiveGoalsRange(ctx, userID, date, date)
+	if err != nil {
+		return nil, err
+	}
+	return byDate[date.Format("2006-01-02")], nil
+}
+
+// GetEffectiveGoalsRange returns the effective targets for every day in a
+// date range, keyed by "YYYY-MM-DD".
+//
+// A day's tag override wins over its weekday override, which wins over the
+// flat targets in user_goals.
+func (s *UserService) GetEffectiveGoalsRange(ctx context.Context, userID int, startDate, endDate time.Time) (map[string]*EffectiveGoals, error) {
+	user, goals, err := s.GetUserWithGoals(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	overrides, err := s.scheduleRepo.GetGoalOverrides(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	byKey := make(map[string]*GoalOverride, len(overrides))
+	for _, o := range overrides {
+		byKey[o.ScheduleType+":"+o.ScheduleKey] = o
+	}
+
+	tags, err := s.scheduleRepo.GetDayTags(ctx, userID, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	tagByDate := make(map[string]string, len(tags))
+	for _, t := range tags {
+		tagByDate[t.Date.Format("2006-01-02")] = t.Tag
+	}
+
+	result := make(map[string]*EffectiveGoals)
+	day := time.Date(startDate.Year(), startDate.Month(), startDate.Day(), 0, 0, 0, 0, startDate.Location())
+	for !day.After(endDate) {
+		key := day.Format("2006-01-02")
+		effective := &EffectiveGoals{
+			UserGoals: *goals,
+			Date:      key,
+			Source:    GoalSourceDefault,
+			DayTag:    tagByDate[key],
+		}
+
+		override := byKey[ScheduleWeekday+":"+WeekdayKey(day)]
+		if effective.DayTag != "" {
+			if tagged, ok := byKey[ScheduleTag+":"+effective.DayTag]; ok {
+				override = tagged
+			}
+		}
+
+		if override != nil {
+			effective.Source = override.ScheduleType
+			effective.TargetCalories = override.TargetCalories
+			if override.HasMacros() {
+				effective.TargetProtein = override.TargetProtein
+				effective.TargetCarbs = override.TargetCarbs
+				effective.TargetFats = override.TargetFats
+			} else {
+				effective.ApplyMacroTargets(nutrition.MacrosOrDefault(
+					override.TargetCalories, user.Weight, user.GoalType, goals.MacroPreference()))
+			}
+		}
+
+		result[key] = effective
+		day = day.AddDate(0, 0, 1)
+	}
+
+	return result, nil
+}
+
+// GetGoalSchedule returns a user's weekday and tag overrides
+func (s *UserService) GetGoalSchedule(ctx context.Context, userID int) ([]*GoalOverride, error) {
+	return s.scheduleRepo.GetGoalOverrides(ctx, userID)
+}
+
+// UpdateGoalSchedule validates and replaces a user's weekday and tag overrides
+func (s *UserService) UpdateGoalSchedule(ctx context.Context, userID int, overrides []GoalOverride) error {
+	seen := make(map[string]bool, len(overrides))
+	for i := range overrides {
+		o := &overrides[i]
+		switch o.ScheduleType {
+		case ScheduleWeekday:
+			if !IsWeekdayKey(o.ScheduleKey) {
+				return fmt.Errorf("%w: %q is not a weekday", ErrInvalidGoalSchedule, o.ScheduleKey)
+			}
+		case ScheduleTag:
+			if !dayTagPattern.MatchString(o.ScheduleKey) {
+				return fmt.Errorf("%w: %q is not a valid tag", ErrInvalidGoalSchedule, o.ScheduleKey)
+			}
+		default:
+			return fmt.Errorf("%w: unknown schedule type %q", ErrInvalidGoalSchedule, o.ScheduleType)
+		}
+
+		key := o.ScheduleType + ":" + o.ScheduleKey
+		if seen[key] {
+			return fmt.Errorf("%w: duplicate %s %q", ErrInvalidGoalSchedule, o.ScheduleType, o.ScheduleKey)
+		}
+		seen[key] = true
+
+		// Macros are either all given or all derived from calories
+		if o.HasMacros() && (o.TargetProtein == 0 || o.TargetCarbs == 0 || o.TargetFats == 0) {
+			return fmt.Errorf("%w: give protein, carbs and fats together or none of them", ErrInvalidGoalSchedule)
+		}
+	}
+
+	return s.scheduleRepo.ReplaceGoalOverrides(ctx, userID, overrides)
+}
+
+// GetDayTags returns the day tags in a date range
+func (s *UserService) GetDayTags(ctx context.Context, userID int, startDate, endDate time.Time) ([]*DayTag, error) {
+	return s.scheduleRepo.GetDayTags(ctx, userID, startDate, endDate)
+}
+
+// SetDayTag tags a day for a user
+func (s *UserService) SetDayTag(ctx context.Context, userID int, date time.Time, tag string) error {
+	if !dayTagPattern.MatchString(tag) {
+		return fmt.Errorf("%w: %q is not a valid tag", ErrInvalidGoalSchedule, tag)
+	}
+	return s.scheduleRepo.SetDayTag(ctx, &DayTag{UserID: userID, Date: date, Tag: tag})
+}
+
+// DeleteDayTag removes a day's tag
+func (s *UserService) DeleteDayTag(ctx context.Context, userID int, date time.Time) error {
+	return s.scheduleRepo.DeleteDayTag(ctx, userID, date)
+}
+
+// UpdateDietProfile sets a user's diet and allergens
+func (s *UserService) UpdateDietProfile(ctx context.Context, userID int, profile DietProfile) (*User, error) {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	profile.Normalize()
+	user.Diet = profile.Diet
+	user.Allergens = profile.Allergens
+
+	if err := s.userRepo.UpdateUser(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// ValidatePassword checks a new password for the user against the password
+// policy. A rejected password gives a *passwords.PolicyError.
+func (s *UserService) ValidatePassword(ctx context.Context, user *User, password string) error {
+	if s.passwords == nil {
+		return nil
+	}
+	return s.passwords.Check(ctx, password, user.Email, user.Username)
+}
+
+// ChangePassword checks a new password against the policy, then hashes and
+// stores it for the user
+func (s *UserService) ChangePassword(ctx context.Context, userID int, password string) error {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.ValidatePassword(ctx, user, password); err != nil {
+		return err
+	}
+
+	if err := user.SetPassword(password); err != nil {
+		return fmt.Errorf("failed to hash password: %v", err)
+	}
+	return s.userRepo.UpdatePassword(ctx, userID, user.PasswordHash)
+}
+
+// MarkEmailVerified marks the user's email as verified if it is still the given address
+func (s *UserService) MarkEmailVerified(ctx context.Context, userID int, email string) (bool, error) {
+	return s.userRepo.MarkEmailVerified(ctx, userID, email)
+}
+
+// ChangeEmail moves the user to a new, already verified address if their
+// email is still oldEmail
+func (s *UserService) ChangeEmail(ctx context.Context, userID int, oldEmail, newEmail string) (bool, error) {
+	return s.userRepo.ChangeEmail(ctx, userID, oldEmail, newEmail)
+}
+
+// EmailExists reports whether an account uses the email address
+func (s *UserService) EmailExists(ctx context.Context, email string) (bool, error) {
+	return s.userRepo.EmailExists(ctx, email)
+}
+
 // FindUserByEmail retrieves a user by their email address
 func (s *UserService) FindUserByEmail(ctx context.Context, email string) (*User, error) {
 	return s.userRepo.FindByEmail(ctx, email)
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+)
+
+// WeightEntry represents a single weigh-in logged by a user
+type WeightEntry struct {
+	ID        int       `db:"id" json:"id"`
+	UserID    int       `db:"user_id" json:"userId"`
+	Weight    float64   `db:"weight" json:"weight"`
+	Date      time.Time `db:"entry_date" json:"date"`
+	CreatedAt time.Time `db:"created_at" json:"createdAt"`
+}
+
+// WeightPlan represents a user's target-weight plan
+type WeightPlan struct {
+	UserID          int        `db:"user_id" json:"userId"`
+	StartWeight     float64    `db:"start_weight" json:"startWeight"`
+	TargetWeight    float64    `db:"target_weight" json:"targetWeight"`
+	StartDate       time.Time  `db:"start_date" json:"startDate"`
+	TargetDate      time.Time  `db:"target_date" json:"targetDate"`
+	AutoApply       bool       `db:"auto_apply" json:"autoApply"`
+	EstimatedTDEE   *int       `db:"estimated_tdee" json:"estimatedTdee,omitempty"`
+	LastEvaluatedAt *time.Time `db:"last_evaluated_at" json:"lastEvaluatedAt,omitempty"`
+	CreatedAt       time.Time  `db:"created_at" json:"createdAt"`
+	UpdatedAt       time.Time  `db:"updated_at" json:"updatedAt"`
+}
+
+// TDEE source constants
+const (
+	TDEESourceFormula  = "formula"
+	TDEESourceAdaptive = "adaptive"
+)
+
+// WeightPlanRequest represents the request body for setting a target-weight plan
+type WeightPlanRequest struct {
+	TargetWeight float64 `json:"targetWeight" binding:"required,gt=0"`
+	TargetDate   string  `json:"targetDate" binding:"required"`
+	AutoApply    bool    `json:"autoApply"`
+}
+
+// WeightEntryRequest represents the request body for logging a weigh-in
+type WeightEntryRequest struct {
+	Weight float64 `json:"weight" binding:"required,gt=0,lt=500"`
+	Date   string  `json:"date"`
+}
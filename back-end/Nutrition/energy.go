@@ -0,0 +1,272 @@
+package nutrition
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// Energy formula names
+const (
+	FormulaMifflinStJeor  = "mifflin_st_jeor"
+	FormulaHarrisBenedict = "harris_benedict"
+	FormulaKatchMcArdle   = "katch_mcardle"
+	FormulaCunningham     = "cunningham"
+)
+
+// DefaultFormula is used when a user has not chosen one
+const DefaultFormula = FormulaMifflinStJeor
+
+// Daily calorie adjustment applied for weight loss or gain goals
+const GoalCalorieAdjustment = 500
+
+// Common errors
+var (
+	ErrUnknownFormula     = errors.New("unknown energy formula")
+	ErrBodyFatRequired    = errors.New("this formula requires a body-fat percentage")
+	ErrInvalidBodyFat     = errors.New("body-fat percentage must be between 2 and 70")
+	ErrInvalidBodyMetrics = errors.New("weight and height must be positive")
+)
+
+// BodyProfile holds the measurements used to estimate energy expenditure
+type BodyProfile struct {
+	WeightKg   float64  `json:"weightKg"`
+	HeightCm   float64  `json:"heightCm"`
+	Age        int      `json:"age"`
+	Gender     string   `json:"gender"`
+	BodyFatPct *float64 `json:"bodyFatPct,omitempty"`
+}
+
+// LeanMass returns fat-free mass in kg, or an error if body fat is unknown
+func (p BodyProfile) LeanMass() (float64, error) {
+	if p.BodyFatPct == nil {
+		return 0, ErrBodyFatRequired
+	}
+	if err := ValidateBodyFat(*p.BodyFatPct); err != nil {
+		return 0, err
+	}
+	return p.WeightKg * (1 - *p.BodyFatPct/100), nil
+}
+
+// ValidateBodyFat checks a body-fat percentage is physiologically plausible
+func ValidateBodyFat(pct float64) error {
+	if pct < 2 || pct > 70 {
+		return ErrInvalidBodyFat
+	}
+	return nil
+}
+
+// EnergyEstimator estimates basal metabolic rate from a body profile
+type EnergyEstimator interface {
+	// Name returns the formula's identifier
+	Name() string
+	// RequiresBodyFat reports whether BMR needs BodyProfile.BodyFatPct
+	RequiresBodyFat() bool
+	// BMR returns the basal metabolic rate in kcal/day
+	BMR(p BodyProfile) (float64, error)
+}
+
+// mifflinStJeor implements the Mifflin-St Jeor (1990) equation
+type mifflinStJeor struct{}
+
+func (mifflinStJeor) Name() string          { return FormulaMifflinStJeor }
+func (mifflinStJeor) RequiresBodyFat() bool { return false }
+
+func (mifflinStJeor) BMR(p BodyProfile) (float64, error) {
+	bmr := 10*p.WeightKg + 6.25*p.HeightCm - 5*float64(p.Age)
+	if p.Gender == "male" {
+		return bmr + 5, nil
+	}
+	return bmr - 161, nil
+}
+
+// harrisBenedict implements the revised Harris-Benedict equation (Roza & Shizgal, 1984)
+type harrisBenedict struct{}
+
+func (harrisBenedict) Name() string          { return FormulaHarrisBenedict }
+func (harrisBenedict) RequiresBodyFat() bool { return false }
+
+func (harrisBenedict) BMR(p BodyProfile) (float64, error) {
+	if p.Gender == "male" {
+		return 88.362 + 13.397*p.WeightKg + 4.799*p.HeightCm - 5.677*float64(p.Age), nil
+	}
+	return 447.593 + 9.247*p.WeightKg + 3.098*p.HeightCm - 4.330*float64(p.Age), nil
+}
+
+// katchMcArdle implements the Katch-McArdle equation based on lean body mass
+type katchMcArdle struct{}
+
+func (katchMcArdle) Name() string          { return FormulaKatchMcArdle }
+func (katchMcArdle) RequiresBodyFat() bool { return true }
+
+func (katchMcArdle) BMR(p BodyProfile) (float64, error) {
+	lbm, err := p.LeanMass()
+	if err != nil {
+		return 0, err
+	}
+	return 370 + 21.6*lbm, nil
+}
+
+// cunningham implements the Cunningham (1980) equation based on lean body mass
+type cunningham struct{}
+
+func (cunningham) Name() string          { return FormulaCunningham }
+func (cunningham) RequiresBodyFat() bool { return true }
+
+func (cunningham) BMR(p BodyProfile) (float64, error) {
+	lbm, err := p.LeanMass()
+	if err != nil {
+		return 0, err
+	}
+	return 500 + 22*lbm, nil
+}
+
+// estimators holds every registered formula by name
+var estimators = map[string]EnergyEstimator{}
+
+// RegisterEstimator makes an estimator available by name
+func RegisterEstimator(e EnergyEstimator) {
+	estimators[e.Name()] = e
+}
+
+func init() {
+	RegisterEstimator(mifflinStJeor{})
+	RegisterEstimator(harrisBenedict{})
+	RegisterEstimator(katchMcArdle{})
+	RegisterEstimator(cunningham{})
+}
+
+// Estimator returns the estimator for a formula name; an empty name selects the default
+func Estimator(name string) (EnergyEstimator, error) {
+	if name == "" {
+		name = DefaultFormula
+	}
+	e, ok := estimators[name]
+	if !ok {
+		return nil, ErrUnknownFormula
+	}
+	return e, nil
+}
+
+// FormulaNames returns the registered formula names in alphabetical order
+func FormulaNames() []string {
+	names := make([]string, 0, len(estimators))
+	for name := range estimators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ActivityMultiplier returns the TDEE multiplier for an activity level
+func ActivityMultiplier(activityLevel string) float64 {
+	switch activityLevel {
+	case "light":
+		return 1.375
+	case "moderate":
+		return 1.55
+	case "active":
+		return 1.725
+	case "very_active":
+		return 1.9
+	default:
+		return 1.2 // sedentary
+	}
+}
+
+// GoalAdjustment returns the daily calorie adjustment for a goal type
+func GoalAdjustment(goalType string) int {
+	switch goalType {
+	case GoalLose:
+		return -GoalCalorieAdjustment
+	case GoalGain:
+		return GoalCalorieAdjustment
+	default:
+		return 0
+	}
+}
+
+// EnergyBreakdown explains how a daily calorie target was derived.
+// RequestedFormula is set when the chosen formula could not be used and
+// Formula was used in its place.
+type EnergyBreakdown struct {
+	Formula            string      `json:"formula"`
+	RequestedFormula   string      `json:"requestedFormula,omitempty"`
+	Profile            BodyProfile `json:"profile"`
+	BMR                float64     `json:"bmr"`
+	ActivityLevel      string      `json:"activityLevel"`
+	ActivityMultiplier float64     `json:"activityMultiplier"`
+	TDEE               float64     `json:"tdee"`
+	GoalType           string      `json:"goalType"`
+	GoalAdjustment     int         `json:"goalAdjustment"`
+	TargetCalories     int         `json:"targetCalories"`
+}
+
+// EstimateEnergy runs an estimator and applies activity and goal adjustments
+func EstimateEnergy(e EnergyEstimator, p BodyProfile, activityLevel, goalType string) (*EnergyBreakdown, error) {
+	if p.WeightKg <= 0 || p.HeightCm <= 0 {
+		return nil, ErrInvalidBodyMetrics
+	}
+	if p.BodyFatPct != nil {
+		if err := ValidateBodyFat(*p.BodyFatPct); err != nil {
+			return nil, err
+		}
+	}
+
+	bmr, err := e.BMR(p)
+	if err != nil {
+		return nil, err
+	}
+
+	multiplier := ActivityMultiplier(activityLevel)
+	tdee := bmr * multiplier
+	adjustment := GoalAdjustment(goalType)
+
+	return &EnergyBreakdown{
+		Formula:            e.Name(),
+		Profile:            p,
+		BMR:                bmr,
+		ActivityLevel:      activityLevel,
+		ActivityMultiplier: multiplier,
+		TDEE:               tdee,
+		GoalType:           goalType,
+		GoalAdjustment:     adjustment,
+		TargetCalories:     int(tdee) + adjustment,
+	}, nil
+}
+
+// DailyCalorieGoal estimates the daily calorie target using the named formula.
+// If the formula needs body fat that is not available, Mifflin-St Jeor is used
+// instead and the breakdown names the formula that was asked for.
+func DailyCalorieGoal(formula string, p BodyProfile, activityLevel, goalType string) (*EnergyBreakdown, error) {
+	e, err := Estimator(formula)
+	if err != nil {
+		return nil, err
+	}
+	requested := ""
+	if e.RequiresBodyFat() && p.BodyFatPct == nil {
+		requested = e.Name()
+		e = estimators[DefaultFormula]
+	}
+
+	breakdown, err := EstimateEnergy(e, p, activityLevel, goalType)
+	if err != nil {
+		return nil, err
+	}
+	breakdown.RequestedFormula = requested
+	return breakdown, nil
+}
+
+// AgeOn returns the age in whole years on the given date, accounting for
+// whether the birthday has already occurred that year
+func AgeOn(birthdate, on time.Time) int {
+	if birthdate.IsZero() || on.Before(birthdate) {
+		return 0
+	}
+	age := on.Year() - birthdate.Year()
+	if on.Month() < birthdate.Month() ||
+		(on.Month() == birthdate.Month() && on.Day() < birthdate.Day()) {
+		age--
+	}
+	return age
+}
@@ -0,0 +1,251 @@
+package nutrition
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Energy density of each macronutrient in kcal per gram
+const (
+	CaloriesPerGramProtein = 4.0
+	CaloriesPerGramCarbs   = 4.0
+	CaloriesPerGramFat     = 9.0
+)
+
+// Goal types understood by the planner (mirrors models.Goal* constants)
+const (
+	GoalLose     = "lose"
+	GoalGain     = "gain"
+	GoalMaintain = "maintain"
+)
+
+// Macro preset names
+const (
+	PresetBalanced    = "balanced"
+	PresetHighProtein = "high_protein"
+	PresetKeto        = "keto"
+	PresetLowFat      = "low_fat"
+	PresetCustom      = "custom"
+)
+
+// Limits for a grams-per-kg protein prescription
+const (
+	MinProteinPerKg = 0.6
+	MaxProteinPerKg = 3.5
+)
+
+// splitTolerance allows for rounding when percentages are entered by hand
+const splitTolerance = 0.5
+
+// Common errors
+var (
+	ErrUnknownPreset     = errors.New("unknown macro preset")
+	ErrInvalidSplit      = errors.New("macro split must sum to 100%")
+	ErrNegativeSplit     = errors.New("macro percentages must not be negative")
+	ErrInvalidProteinKg  = fmt.Errorf("protein per kg must be between %.1f and %.1f g", MinProteinPerKg, MaxProteinPerKg)
+	ErrProteinTooHigh    = errors.New("protein target exceeds the calorie goal")
+	ErrWeightRequired    = errors.New("body weight is required for a grams-per-kg protein target")
+	ErrAmbiguousCustom   = errors.New("custom preset requires percentages")
+	ErrPresetWithPercent = errors.New("percentages can only be given with the custom preset")
+)
+
+// MacroSplit is the share of daily calories taken from each macronutrient, in percent
+type MacroSplit struct {
+	ProteinPct float64 `json:"proteinPct"`
+	CarbsPct   float64 `json:"carbsPct"`
+	FatPct     float64 `json:"fatPct"`
+}
+
+// Validate checks that the split is non-negative and sums to 100%
+func (s MacroSplit) Validate() error {
+	if s.ProteinPct < 0 || s.CarbsPct < 0 || s.FatPct < 0 {
+		return ErrNegativeSplit
+	}
+	if math.Abs(s.ProteinPct+s.CarbsPct+s.FatPct-100) > splitTolerance {
+		return ErrInvalidSplit
+	}
+	return nil
+}
+
+// IsZero reports whether no percentages have been set
+func (s MacroSplit) IsZero() bool {
+	return s.ProteinPct == 0 && s.CarbsPct == 0 && s.FatPct == 0
+}
+
+// presets holds the named splits users and dietitians can choose from
+var presets = map[string]MacroSplit{
+	PresetBalanced:    {ProteinPct: 25, CarbsPct: 50, FatPct: 25},
+	PresetHighProtein: {ProteinPct: 35, CarbsPct: 35, FatPct: 30},
+	PresetKeto:        {ProteinPct: 20, CarbsPct: 5, FatPct: 75},
+	PresetLowFat:      {ProteinPct: 25, CarbsPct: 60, FatPct: 15},
+}
+
+// goalDefaults are the splits used when a user has no explicit preference
+var goalDefaults = map[string]MacroSplit{
+	GoalLose:     {ProteinPct: 35, CarbsPct: 30, FatPct: 35},
+	GoalMaintain: {ProteinPct: 25, CarbsPct: 50, FatPct: 25},
+	GoalGain:     {ProteinPct: 30, CarbsPct: 45, FatPct: 25},
+}
+
+// Preset returns the split for a named preset
+func Preset(name string) (MacroSplit, error) {
+	split, ok := presets[name]
+	if !ok {
+		return MacroSplit{}, ErrUnknownPreset
+	}
+	return split, nil
+}
+
+// PresetNames returns the available preset names in alphabetical order
+func PresetNames() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Presets returns a copy of all named presets
+func Presets() map[string]MacroSplit {
+	out := make(map[string]MacroSplit, len(presets))
+	for name, split := range presets {
+		out[name] = split
+	}
+	return out
+}
+
+// DefaultSplitForGoal returns the split used for a goal type when no preference is set
+func DefaultSplitForGoal(goalType string) MacroSplit {
+	if split, ok := goalDefaults[goalType]; ok {
+		return split
+	}
+	// Default to maintenance if goal type is invalid
+	return goalDefaults[GoalMaintain]
+}
+
+// MacroPreference describes how a user's calories should be divided between macros.
+// The zero value means "use the default split for the user's goal type".
+type MacroPreference struct {
+	Preset       string     `json:"preset"`
+	Split        MacroSplit `json:"split"`
+	ProteinPerKg float64    `json:"proteinPerKg"`
+}
+
+// IsDefault reports whether the preference falls back to the goal-type default
+func (p MacroPreference) IsDefault() bool {
+	return p.Preset == "" && p.Split.IsZero() && p.ProteinPerKg == 0
+}
+
+// Validate checks that the preference is internally consistent
+func (p MacroPreference) Validate() error {
+	switch p.Preset {
+	case "":
+		if !p.Split.IsZero() {
+			return ErrPresetWithPercent
+		}
+	case PresetCustom:
+		if p.Split.IsZero() {
+			return ErrAmbiguousCustom
+		}
+		if err := p.Split.Validate(); err != nil {
+			return err
+		}
+	default:
+		if _, ok := presets[p.Preset]; !ok {
+			return ErrUnknownPreset
+		}
+		if !p.Split.IsZero() {
+			return ErrPresetWithPercent
+		}
+	}
+
+	if p.ProteinPerKg != 0 && (p.ProteinPerKg < MinProteinPerKg || p.ProteinPerKg > MaxProteinPerKg) {
+		return ErrInvalidProteinKg
+	}
+
+	return nil
+}
+
+// ResolveSplit returns the percentage split the preference stands for
+func (p MacroPreference) ResolveSplit(goalType string) MacroSplit {
+	switch p.Preset {
+	case "":
+		return DefaultSplitForGoal(goalType)
+	case PresetCustom:
+		return p.Split
+	default:
+		if split, ok := presets[p.Preset]; ok {
+			return split
+		}
+		return DefaultSplitForGoal(goalType)
+	}
+}
+
+// MacroTargets holds daily macronutrient targets in grams
+type MacroTargets struct {
+	Protein float64 `json:"protein"`
+	Carbs   float64 `json:"carbs"`
+	Fats    float64 `json:"fats"`
+}
+
+// MacrosFromSplit converts a calorie goal and percentage split into gram targets
+func MacrosFromSplit(calories int, split MacroSplit) MacroTargets {
+	kcal := float64(calories)
+	return MacroTargets{
+		Protein: kcal * split.ProteinPct / 100 / CaloriesPerGramProtein,
+		Carbs:   kcal * split.CarbsPct / 100 / CaloriesPerGramCarbs,
+		Fats:    kcal * split.FatPct / 100 / CaloriesPerGramFat,
+	}
+}
+
+// CalculateMacros returns gram targets for the given calorie goal and preference.
+//
+// When ProteinPerKg is set, protein is fixed at that many grams per kg of body
+// weight and the remaining calories are divided between carbs and fat in the
+// same ratio as the resolved split.
+func CalculateMacros(calories int, weightKg float64, goalType string, pref MacroPreference) (MacroTargets, error) {
+	if err := pref.Validate(); err != nil {
+		return MacroTargets{}, err
+	}
+
+	split := pref.ResolveSplit(goalType)
+	if pref.ProteinPerKg == 0 {
+		return MacrosFromSplit(calories, split), nil
+	}
+
+	if weightKg <= 0 {
+		return MacroTargets{}, ErrWeightRequired
+	}
+
+	protein := pref.ProteinPerKg * weightKg
+	remaining := float64(calories) - protein*CaloriesPerGramProtein
+	if remaining < 0 {
+		return MacroTargets{}, ErrProteinTooHigh
+	}
+
+	targets := MacroTargets{Protein: protein}
+	nonProtein := split.CarbsPct + split.FatPct
+	if nonProtein == 0 {
+		// All-protein split: put the remainder into carbs
+		targets.Carbs = remaining / CaloriesPerGramCarbs
+		return targets, nil
+	}
+
+	targets.Carbs = remaining * split.CarbsPct / nonProtein / CaloriesPerGramCarbs
+	targets.Fats = remaining * split.FatPct / nonProtein / CaloriesPerGramFat
+	return targets, nil
+}
+
+// MacrosOrDefault behaves like CalculateMacros but falls back to the goal-type
+// default split if the stored preference can no longer be applied (for example
+// because a grams-per-kg protein target exceeds a newly lowered calorie goal).
+func MacrosOrDefault(calories int, weightKg float64, goalType string, pref MacroPreference) MacroTargets {
+	targets, err := CalculateMacros(calories, weightKg, goalType, pref)
+	if err != nil {
+		return MacrosFromSplit(calories, DefaultSplitForGoal(goalType))
+	}
+	return targets
+}
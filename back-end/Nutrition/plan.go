@@ -0,0 +1,256 @@
+package nutrition
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+)
+
+// KcalPerKgBodyWeight is the approximate energy content of one kg of body weight change
+const KcalPerKgBodyWeight = 7700.0
+
+// Safe-rate limits for planned weight change
+const (
+	// MaxLossPctPerWeek caps weekly loss as a percentage of current body weight
+	MaxLossPctPerWeek = 1.0
+	// MaxLossKgPerWeek caps weekly loss regardless of body weight
+	MaxLossKgPerWeek = 1.0
+	// MaxGainKgPerWeek caps weekly gain to limit fat accumulation
+	MaxGainKgPerWeek = 0.5
+	// MinCaloriesFemale and MinCaloriesMale are floors below which targets are never set
+	MinCaloriesFemale = 1200
+	MinCaloriesMale   = 1500
+	// maintainToleranceKg treats targets this close to the current weight as maintenance
+	maintainToleranceKg = 0.5
+)
+
+// Data requirements for the adaptive TDEE estimate
+const (
+	// AdaptiveWindowDays is how far back intake and weight data is considered
+	AdaptiveWindowDays = 21
+	// MinLoggedDays is the minimum number of days with logged intake
+	MinLoggedDays = 10
+	// MinWeightSpanDays is the minimum span between first and last weigh-in
+	MinWeightSpanDays = 7
+)
+
+// Plan directions
+const (
+	DirectionLose     = "lose"
+	DirectionGain     = "gain"
+	DirectionMaintain = "maintain"
+)
+
+// Common errors
+var (
+	ErrTargetDateInPast      = errors.New("target date must be in the future")
+	ErrInvalidTargetWeight   = errors.New("target weight must be positive")
+	ErrInsufficientPlanData  = errors.New("not enough logged intake and weight data to estimate TDEE")
+	ErrInvalidTDEE           = errors.New("TDEE must be positive")
+	ErrUnsupportedPlanWindow = errors.New("target date is too far away")
+)
+
+// maxPlanDays limits how far in the future a target date may be
+const maxPlanDays = 3 * 365
+
+// PlanInput holds everything needed to derive a calorie target for a weight plan
+type PlanInput struct {
+	CurrentWeight float64
+	TargetWeight  float64
+	TDEE          float64
+	Gender        string
+	Today         time.Time
+	TargetDate    time.Time
+}
+
+// PlanResult describes the daily energy balance needed to reach a target weight
+type PlanResult struct {
+	Direction            string    `json:"direction"`
+	DaysRemaining        int       `json:"daysRemaining"`
+	WeightChangeKg       float64   `json:"weightChangeKg"`
+	RequiredWeeklyRateKg float64   `json:"requiredWeeklyRateKg"`
+	WeeklyRateKg         float64   `json:"weeklyRateKg"`
+	DailyEnergyDelta     float64   `json:"dailyEnergyDelta"`
+	TargetCalories       int       `json:"targetCalories"`
+	RateLimited          bool      `json:"rateLimited"`
+	CalorieFloorApplied  bool      `json:"calorieFloorApplied"`
+	ProjectedDate        time.Time `json:"projectedDate"`
+}
+
+// MinimumCalories returns the lowest daily target allowed for a gender
+func MinimumCalories(gender string) int {
+	if gender == "male" {
+		return MinCaloriesMale
+	}
+	return MinCaloriesFemale
+}
+
+// MaxWeeklyLoss returns the safe weekly loss limit for a body weight
+func MaxWeeklyLoss(weightKg float64) float64 {
+	return math.Min(weightKg*MaxLossPctPerWeek/100, MaxLossKgPerWeek)
+}
+
+// PlanCalories derives the daily calorie target needed to reach the target weight
+// by the target date, clamped to safe rates of change and a minimum intake
+func PlanCalories(in PlanInput) (*PlanResult, error) {
+	if in.CurrentWeight <= 0 || in.TargetWeight <= 0 {
+		return nil, ErrInvalidTargetWeight
+	}
+	if in.TDEE <= 0 {
+		return nil, ErrInvalidTDEE
+	}
+
+	today := truncateDay(in.Today)
+	target := truncateDay(in.TargetDate)
+	days := int(target.Sub(today).Hours() / 24)
+	if days <= 0 {
+		return nil, ErrTargetDateInPast
+	}
+	if days > maxPlanDays {
+		return nil, ErrUnsupportedPlanWindow
+	}
+
+	change := in.TargetWeight - in.CurrentWeight
+	result := &PlanResult{
+		DaysRemaining:  days,
+		WeightChangeKg: change,
+	}
+
+	if math.Abs(change) < maintainToleranceKg {
+		result.Direction = DirectionMaintain
+		result.TargetCalories = int(in.TDEE)
+		result.ProjectedDate = today
+		return applyCalorieFloor(result, in), nil
+	}
+
+	weeks := float64(days) / 7
+	required := change / weeks
+	rate := required
+
+	if change < 0 {
+		result.Direction = DirectionLose
+		if limit := MaxWeeklyLoss(in.CurrentWeight); -rate > limit {
+			rate = -limit
+			result.RateLimited = true
+		}
+	} else {
+		result.Direction = DirectionGain
+		if rate > MaxGainKgPerWeek {
+			rate = MaxGainKgPerWeek
+			result.RateLimited = true
+		}
+	}
+
+	result.RequiredWeeklyRateKg = required
+	result.WeeklyRateKg = rate
+	result.DailyEnergyDelta = rate * KcalPerKgBodyWeight / 7
+	result.TargetCalories = int(math.Round(in.TDEE + result.DailyEnergyDelta))
+
+	return applyCalorieFloor(result, in), nil
+}
+
+// applyCalorieFloor raises the target to the minimum intake and recomputes the projection
+func applyCalorieFloor(result *PlanResult, in PlanInput) *PlanResult {
+	floor := MinimumCalories(in.Gender)
+	if result.TargetCalories < floor {
+		result.TargetCalories = floor
+		result.CalorieFloorApplied = true
+		result.DailyEnergyDelta = float64(floor) - in.TDEE
+		result.WeeklyRateKg = result.DailyEnergyDelta * 7 / KcalPerKgBodyWeight
+	}
+
+	if result.Direction != DirectionMaintain && result.WeeklyRateKg != 0 {
+		weeksNeeded := result.WeightChangeKg / result.WeeklyRateKg
+		if weeksNeeded > 0 {
+			result.ProjectedDate = truncateDay(in.Today).AddDate(0, 0, int(math.Ceil(weeksNeeded*7)))
+		}
+	}
+
+	return result
+}
+
+// DailyIntake is the total calories logged on one day
+type DailyIntake struct {
+	Date     time.Time
+	Calories float64
+}
+
+// WeightSample is one weigh-in
+type WeightSample struct {
+	Date   time.Time
+	Weight float64
+}
+
+// AdaptiveEstimate is a TDEE estimate derived from logged intake and weight trend
+type AdaptiveEstimate struct {
+	TDEE                 float64 `json:"tdee"`
+	AverageIntake        float64 `json:"averageIntake"`
+	WeightTrendKgPerWeek float64 `json:"weightTrendKgPerWeek"`
+	LoggedDays           int     `json:"loggedDays"`
+	WeightSamples        int     `json:"weightSamples"`
+}
+
+// EstimateAdaptiveTDEE estimates actual energy expenditure by energy balance:
+// average intake minus the energy equivalent of the observed weight trend.
+// Days without any logged calories are ignored as unlogged rather than fasting.
+func EstimateAdaptiveTDEE(intake []DailyIntake, weights []WeightSample) (*AdaptiveEstimate, error) {
+	var total float64
+	logged := 0
+	for _, day := range intake {
+		if day.Calories > 0 {
+			total += day.Calories
+			logged++
+		}
+	}
+	if logged < MinLoggedDays || len(weights) < 2 {
+		return nil, ErrInsufficientPlanData
+	}
+
+	sorted := make([]WeightSample, len(weights))
+	copy(sorted, weights)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Date.Before(sorted[j].Date) })
+
+	span := sorted[len(sorted)-1].Date.Sub(sorted[0].Date).Hours() / 24
+	if span < MinWeightSpanDays {
+		return nil, ErrInsufficientPlanData
+	}
+
+	slope := weightSlopePerDay(sorted)
+	avgIntake := total / float64(logged)
+
+	return &AdaptiveEstimate{
+		TDEE:                 avgIntake - slope*KcalPerKgBodyWeight,
+		AverageIntake:        avgIntake,
+		WeightTrendKgPerWeek: slope * 7,
+		LoggedDays:           logged,
+		WeightSamples:        len(sorted),
+	}, nil
+}
+
+// weightSlopePerDay fits a least-squares line through the samples and returns kg/day.
+// A regression is used rather than first-vs-last so that daily water-weight noise
+// in a single weigh-in does not dominate the estimate.
+func weightSlopePerDay(samples []WeightSample) float64 {
+	origin := samples[0].Date
+	n := float64(len(samples))
+	var sumX, sumY, sumXY, sumXX float64
+	for _, s := range samples {
+		x := s.Date.Sub(origin).Hours() / 24
+		sumX += x
+		sumY += s.Weight
+		sumXY += x * s.Weight
+		sumXX += x * x
+	}
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0
+	}
+	return (n*sumXY - sumX*sumY) / denominator
+}
+
+// truncateDay returns midnight UTC of the calendar day t falls on, so that
+// dates parsed in different locations compare as whole days
+func truncateDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,104 @@
+package passwords
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// prefixLength is the number of hex characters of a SHA-1 hash used to
+// select a range, as in the Have I Been Pwned range API
+const prefixLength = 5
+
+// BreachChecker answers k-anonymity range queries: given the first five hex
+// characters of a password's SHA-1 hash it returns the remaining 35 of every
+// breached hash with that prefix. The full hash never leaves the caller, so
+// a remote service could implement it as well as a local corpus.
+type BreachChecker interface {
+	Range(ctx context.Context, prefix string) ([]string, error)
+}
+
+// IsBreached reports whether the password's hash is in the checker's corpus
+func IsBreached(ctx context.Context, checker BreachChecker, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	suffixes, err := checker.Range(ctx, hash[:prefixLength])
+	if err != nil {
+		return false, err
+	}
+	for _, suffix := range suffixes {
+		if suffix == hash[prefixLength:] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Corpus is a breached-hash corpus held in memory and grouped by prefix
+type Corpus struct {
+	ranges map[string][]string
+	size   int
+}
+
+// LoadCorpus reads a corpus of upper- or lower-case SHA-1 hashes, one per
+// line. A ":count" after the hash, as in the Have I Been Pwned downloads,
+// is ignored, as are blank lines and lines starting with #.
+func LoadCorpus(path string) (*Corpus, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached password corpus: %v", err)
+	}
+	defer f.Close()
+
+	corpus := &Corpus{ranges: make(map[string][]string)}
+
+	scanner := bufio.NewScanner(f)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if colon := strings.IndexByte(line, ':'); colon >= 0 {
+			line = line[:colon]
+		}
+
+		hash := strings.ToUpper(line)
+		if len(hash) != 2*sha1.Size {
+			return nil, fmt.Errorf("breached password corpus line %d: not a SHA-1 hash", lineNumber)
+		}
+		if _, err := hex.DecodeString(hash); err != nil {
+			return nil, fmt.Errorf("breached password corpus line %d: not a SHA-1 hash", lineNumber)
+		}
+
+		prefix := hash[:prefixLength]
+		corpus.ranges[prefix] = append(corpus.ranges[prefix], hash[prefixLength:])
+		corpus.size++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read breached password corpus: %v", err)
+	}
+
+	for _, suffixes := range corpus.ranges {
+		sort.Strings(suffixes)
+	}
+
+	return corpus, nil
+}
+
+// Range returns the suffixes of the breached hashes with the given prefix
+func (c *Corpus) Range(ctx context.Context, prefix string) ([]string, error) {
+	return c.ranges[strings.ToUpper(prefix)], nil
+}
+
+// Size returns the number of hashes in the corpus
+func (c *Corpus) Size() int {
+	return c.size
+}
@@ -0,0 +1,196 @@
+package passwords
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	config "HabitBite/backend/Config"
+)
+
+// MaxBytes is the longest password bcrypt can hash
+const MaxBytes = 72
+
+// Reason codes reported by the policy
+const (
+	ReasonTooShort         = "too_short"
+	ReasonTooLong          = "too_long"
+	ReasonCommon           = "common"
+	ReasonContainsEmail    = "contains_email"
+	ReasonContainsUsername = "contains_username"
+	ReasonBreached         = "breached"
+)
+
+// Reason is one way a password fails the policy
+type Reason struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PolicyError lists every reason a password was rejected
+type PolicyError struct {
+	Reasons []Reason
+}
+
+// Error implements the error interface
+func (e *PolicyError) Error() string {
+	messages := make([]string, len(e.Reasons))
+	for i, r := range e.Reasons {
+		messages[i] = r.Message
+	}
+	return "password rejected: " + strings.Join(messages, "; ")
+}
+
+// Policy decides whether a password is acceptable
+type Policy struct {
+	minLength int
+	common    map[string]struct{}
+	breached  BreachChecker
+}
+
+// NewPolicy creates a policy from the configuration, loading the optional
+// banned-password list and breached-hash corpus from their files
+func NewPolicy(cfg *config.Config) (*Policy, error) {
+	p := &Policy{
+		minLength: cfg.PasswordMinLength,
+		common:    make(map[string]struct{}, len(commonPasswords)),
+	}
+	for _, password := range commonPasswords {
+		p.common[password] = struct{}{}
+	}
+
+	if cfg.PasswordBannedFile != "" {
+		if err := p.loadBanned(cfg.PasswordBannedFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.PasswordBreachedFile != "" {
+		corpus, err := LoadCorpus(cfg.PasswordBreachedFile)
+		if err != nil {
+			return nil, err
+		}
+		p.breached = corpus
+	}
+
+	return p, nil
+}
+
+// MinLength returns the minimum number of characters
+func (p *Policy) MinLength() int {
+	return p.minLength
+}
+
+// ChecksBreaches reports whether a breached-hash corpus is loaded
+func (p *Policy) ChecksBreaches() bool {
+	return p.breached != nil
+}
+
+// Check returns a *PolicyError listing every rule the password breaks, or
+// nil if it is acceptable. email and username are the account's, which the
+// password must not contain.
+func (p *Policy) Check(ctx context.Context, password, email, username string) error {
+	var reasons []Reason
+
+	if utf8.RuneCountInString(password) < p.minLength {
+		reasons = append(reasons, Reason{ReasonTooShort, fmt.Sprintf("Use at least %d characters", p.minLength)})
+	}
+	if len(password) > MaxBytes {
+		reasons = append(reasons, Reason{ReasonTooLong, fmt.Sprintf("Use at most %d bytes", MaxBytes)})
+	}
+
+	lower := strings.ToLower(password)
+	if p.isCommon(lower) {
+		reasons = append(reasons, Reason{ReasonCommon, "This password is too common"})
+	}
+
+	email = strings.ToLower(strings.TrimSpace(email))
+	local := email
+	if at := strings.IndexByte(email, '@'); at >= 0 {
+		local = email[:at]
+	}
+	if (email != "" && strings.Contains(lower, email)) || (len(local) >= 3 && strings.Contains(lower, local)) {
+		reasons = append(reasons, Reason{ReasonContainsEmail, "Do not use your email address in your password"})
+	}
+
+	username = strings.ToLower(strings.TrimSpace(username))
+	if len(username) >= 3 && strings.Contains(lower, username) {
+		reasons = append(reasons, Reason{ReasonContainsUsername, "Do not use your username in your password"})
+	}
+
+	if p.breached != nil {
+		breached, err := IsBreached(ctx, p.breached, password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			reasons = append(reasons, Reason{ReasonBreached, "This password has appeared in a data breach; choose another"})
+		}
+	}
+
+	if len(reasons) > 0 {
+		return &PolicyError{Reasons: reasons}
+	}
+	return nil
+}
+
+// isCommon reports whether a lower-cased password is banned, also when it
+// only adds digits or symbols to the end of a banned one ("password123!")
+func (p *Policy) isCommon(lower string) bool {
+	if _, ok := p.common[lower]; ok {
+		return true
+	}
+
+	base := strings.TrimRightFunc(lower, func(r rune) bool {
+		return unicode.IsDigit(r) || unicode.IsPunct(r) || unicode.IsSymbol(r)
+	})
+	if base == lower || len(base) < 4 {
+		return false
+	}
+	_, ok := p.common[base]
+	return ok
+}
+
+// loadBanned adds the passwords in a file, one per line, to the banned list.
+// Blank lines and lines starting with # are ignored.
+func (p *Policy) loadBanned(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open banned password list: %v", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p.common[strings.ToLower(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read banned password list: %v", err)
+	}
+
+	return nil
+}
+
+// commonPasswords is a built-in list of passwords that are long enough to
+// pass a length rule but are among the first an attacker tries
+var commonPasswords = []string{
+	"password", "passw0rd", "p@ssw0rd", "p@ssword", "password1", "password123",
+	"12345678", "123456789", "1234567890", "0123456789", "87654321", "11111111",
+	"00000000", "12341234", "11223344", "123123123", "qwertyuiop", "qwerty123",
+	"qwertyui", "1q2w3e4r", "1qaz2wsx", "zaq12wsx", "asdfghjkl", "asdfasdf",
+	"zxcvbnm1", "iloveyou", "sunshine", "princess", "football", "baseball",
+	"superman", "starwars", "whatever", "trustno1", "letmein1", "welcome1",
+	"welcome123", "changeme", "abcd1234", "abc12345", "aaaaaaaa", "computer",
+	"internet", "michelle", "jennifer", "jordan23", "mustang1", "shadow12",
+	"master12", "monkey12", "dragon12", "freedom1", "killer12", "login123",
+	"admin123", "administrator", "passpass", "secret12", "qwerty12",
+	"habitbite", "habitbite1", "habitbite123", "calories", "diet1234", "fitness1",
+}
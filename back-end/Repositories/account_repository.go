@@ -0,0 +1,299 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	models "HabitBite/backend/Models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// AccountRepository defines the interface for account deletion and export data access
+type AccountRepository interface {
+	ScheduleDeletion(ctx context.Context, userID int, at time.Time) (bool, error)
+	CancelDeletion(ctx context.Context, userID int) (bool, error)
+	FindDueDeletions(ctx context.Context, now time.Time, limit int) ([]int, error)
+	PurgeUser(ctx context.Context, userID int) error
+	ExportUserData(ctx context.Context, userID int) ([]models.DataTable, error)
+}
+
+// userTable is a table holding rows about a user, found by the condition in
+// where, whose placeholders all take the user's ID
+type userTable struct {
+	name  string
+	where string
+}
+
+// args returns the query arguments for the table's condition
+func (t userTable) args(userID int) []interface{} {
+	args := make([]interface{}, strings.Count(t.where, "?"))
+	for i := range args {
+		args[i] = userID
+	}
+	return args
+}
+
+// usersTable is the account row itself
+var usersTable = userTable{"users", "id = ?"}
+
+// userOwnedTables lists every table with rows belonging to a user. A table
+// added to the schema with a user reference must be added here, or deleted
+// accounts leave it behind and exports miss it. audit_log is left out on
+// purpose: it is append-only and must outlive the accounts it mentions, so
+// it is exported through auditTable and anonymised rather than purged.
+var userOwnedTables = []userTable{
+	{"consumed_foods", "user_id = ?"},
+	{"daily_entries", "user_id = ?"},
+	{"user_goals", "user_id = ?"},
+	{"user_goal_overrides", "user_id = ?"},
+	{"user_day_tags", "user_id = ?"},
+	{"weight_entries", "user_id = ?"},
+	{"weight_plans", "user_id = ?"},
+	{"user_dietitian", "user_id = ? OR dietitian_id = ?"},
+	{"refresh_tokens", "user_id = ?"},
+	{"revoked_tokens", "user_id = ?"},
+	{"user_token_revocations", "user_id = ?"},
+	{"password_resets", "user_id = ?"},
+	{"user_two_factor", "user_id = ?"},
+	{"user_recovery_codes", "user_id = ?"},
+	{"user_identities", "user_id = ?"},
+	{"oidc_flows", "user_id = ?"},
+	{"user_login_failures", "user_id = ?"},
+	{"user_sessions", "user_id = ?"},
+	{"personal_access_tokens", "user_id = ?"},
+	{"goal_recalculation_changes", "user_id = ?"},
+}
+
+// auditTable is the audit log entries about the user. Entries where the
+// user acted on someone else describe that other user and are not exported.
+var auditTable = userTable{"audit_log", "subject_id = ?"}
+
+// secretColumns are left out of exports; they only hold hashes and keys
+// that are of no use to the user and must never leave the database
+var secretColumns = map[string]bool{
+	"password_hash": true,
+	"token_hash":    true,
+	"code_hash":     true,
+	"secret":        true,
+	"state_hash":    true,
+	"nonce":         true,
+	"code_verifier": true,
+}
+
+// accountRepository implements AccountRepository
+type accountRepository struct {
+	db *sqlx.DB
+}
+
+// NewAccountRepository creates a new AccountRepository
+func NewAccountRepository(db *sqlx.DB) AccountRepository {
+	return &accountRepository{db: db}
+}
+
+// ScheduleDeletion sets when the account is deleted, unless a deletion is already scheduled
+func (r *accountRepository) ScheduleDeletion(ctx context.Context, userID int, at time.Time) (bool, error) {
+	query := `UPDATE users SET deletion_scheduled_at = ? WHERE id = ? AND deletion_scheduled_at IS NULL`
+
+	result, err := r.db.ExecContext(ctx, query, at, userID)
+	if err != nil {
+		return false, wrapDatabaseError(err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, wrapDatabaseError(err)
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// CancelDeletion clears a scheduled deletion
+func (r *accountRepository) CancelDeletion(ctx context.Context, userID int) (bool, error) {
+	query := `UPDATE users SET deletion_scheduled_at = NULL WHERE id = ? AND deletion_scheduled_at IS NOT NULL`
+
+	result, err := r.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return false, wrapDatabaseError(err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, wrapDatabaseError(err)
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// FindDueDeletions returns the IDs of accounts whose deletion time has passed
+func (r *accountRepository) FindDueDeletions(ctx context.Context, now time.Time, limit int) ([]int, error) {
+	query := `
+		SELECT id FROM users
+		WHERE deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= ?
+		ORDER BY deletion_scheduled_at
+		LIMIT ?
+	`
+
+	var userIDs []int
+	if err := r.db.SelectContext(ctx, &userIDs, query, now, limit); err != nil {
+		return nil, wrapDatabaseError(err)
+	}
+
+	return userIDs, nil
+}
+
+// PurgeUser deletes the user and everything they own in one transaction
+func (r *accountRepository) PurgeUser(ctx context.Context, userID int) error {
+	return purgeUser(ctx, r.db, userID)
+}
+
+// ExportUserData returns the user's rows from the users table, every
+// user-owned table and the audit log, without secret columns
+func (r *accountRepository) ExportUserData(ctx context.Context, userID int) ([]models.DataTable, error) {
+	tables := make([]models.DataTable, 0, len(userOwnedTables)+2)
+	exported := append([]userTable{usersTable}, userOwnedTables...)
+	for _, table := range append(exported, auditTable) {
+		data, err := r.exportTable(ctx, table, userID)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, *data)
+	}
+
+	return tables, nil
+}
+
+// exportTable reads one table's rows for the user
+func (r *accountRepository) exportTable(ctx context.Context, table userTable, userID int) (*models.DataTable, error) {
+	rows, err := r.db.QueryxContext(ctx, "SELECT * FROM "+table.name+" WHERE "+table.where, table.args(userID)...)
+	if err != nil {
+		return nil, wrapDatabaseError(err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, wrapDatabaseError(err)
+	}
+
+	data := &models.DataTable{Name: table.name, Rows: [][]interface{}{}}
+	var keep []int
+	for i, column := range columns {
+		if !secretColumns[column] {
+			data.Columns = append(data.Columns, column)
+			keep = append(keep, i)
+		}
+	}
+
+	for rows.Next() {
+		values, err := rows.SliceScan()
+		if err != nil {
+			return nil, wrapDatabaseError(err)
+		}
+
+		row := make([]interface{}, len(keep))
+		for j, i := range keep {
+			// Text and decimal columns arrive as bytes
+			if b, ok := values[i].([]byte); ok {
+				row[j] = string(b)
+			} else {
+				row[j] = values[i]
+			}
+		}
+		data.Rows = append(data.Rows, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapDatabaseError(err)
+	}
+
+	return data, nil
+}
+
+// purgeUser deletes the user's rows from every user-owned table and then
+// the user, so nothing is left behind whether or not a table has a
+// cascading foreign key. The user's audit log entries are kept but
+// anonymised.
+func purgeUser(ctx context.Context, db *sqlx.DB, userID int) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return wrapDatabaseError(err)
+	}
+	defer tx.Rollback()
+
+	if err := anonymiseAudit(ctx, tx, userID); err != nil {
+		return err
+	}
+
+	for _, table := range userOwnedTables {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+table.name+" WHERE "+table.where, table.args(userID)...); err != nil {
+			return wrapDatabaseError(err)
+		}
+	}
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM users WHERE id = ?", userID)
+	if err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	if err = tx.Commit(); err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	return nil
+}
+
+// anonymiseAudit strips personal data from the audit log entries of a user
+// being purged while keeping the entries themselves. Entries about the user
+// lose their request details and data; entries where the user acted on
+// someone else lose only the user's request details. Failed logins that
+// named the user's email without matching the account are cleared as well.
+func anonymiseAudit(ctx context.Context, tx *sqlx.Tx, userID int) error {
+	var email string
+	if err := tx.GetContext(ctx, &email, `SELECT email FROM users WHERE id = ?`, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return wrapDatabaseError(err)
+	}
+
+	queries := []struct {
+		query string
+		args  []interface{}
+	}{
+		{
+			`UPDATE audit_log SET ip_address = '', user_agent = '', before_data = NULL, after_data = NULL
+			WHERE subject_id = ?`,
+			[]interface{}{userID},
+		},
+		{
+			`UPDATE audit_log SET ip_address = '', user_agent = ''
+			WHERE actor_id = ?`,
+			[]interface{}{userID},
+		},
+		{
+			`UPDATE audit_log SET ip_address = '', user_agent = '', after_data = NULL
+			WHERE subject_id IS NULL AND action = ?
+				AND JSON_UNQUOTE(JSON_EXTRACT(after_data, '$.email')) = ?`,
+			[]interface{}{models.AuditLoginFailed, email},
+		},
+	}
+	for _, q := range queries {
+		if _, err := tx.ExecContext(ctx, q.query, q.args...); err != nil {
+			return wrapDatabaseError(err)
+		}
+	}
+
+	return nil
+}
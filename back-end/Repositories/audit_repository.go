@@ -0,0 +1,97 @@
+package repositories
+
+import (
+	"context"
+	"strings"
+
+	models "HabitBite/backend/Models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// AuditRepository defines the interface for audit log data access. Entries
+// can only be added, never changed or removed.
+type AuditRepository interface {
+	InsertAuditEntry(ctx context.Context, entry *models.AuditEntry) error
+	SearchAudit(ctx context.Context, query models.AuditQuery) ([]*models.AuditEntry, int, error)
+}
+
+// auditRepository implements AuditRepository
+type auditRepository struct {
+	db *sqlx.DB
+}
+
+// NewAuditRepository creates a new AuditRepository
+func NewAuditRepository(db *sqlx.DB) AuditRepository {
+	return &auditRepository{db: db}
+}
+
+// InsertAuditEntry appends an entry and sets its ID
+func (r *auditRepository) InsertAuditEntry(ctx context.Context, entry *models.AuditEntry) error {
+	query := `
+		INSERT INTO audit_log (actor_id, subject_id, action, ip_address, user_agent, before_data, after_data, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	result, err := r.db.ExecContext(ctx, query,
+		entry.ActorID, entry.SubjectID, entry.Action, entry.IPAddress, entry.UserAgent,
+		entry.Before, entry.After, entry.CreatedAt)
+	if err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return wrapDatabaseError(err)
+	}
+	entry.ID = id
+
+	return nil
+}
+
+// SearchAudit returns one page of matching entries, newest first, and the
+// number of matches
+func (r *auditRepository) SearchAudit(ctx context.Context, query models.AuditQuery) ([]*models.AuditEntry, int, error) {
+	conditions := []string{"1 = 1"}
+	var args []interface{}
+
+	if query.ActorID != 0 {
+		conditions = append(conditions, "actor_id = ?")
+		args = append(args, query.ActorID)
+	}
+	if query.SubjectID != 0 {
+		conditions = append(conditions, "subject_id = ?")
+		args = append(args, query.SubjectID)
+	}
+	if query.UserID != 0 {
+		conditions = append(conditions, "(actor_id = ? OR subject_id = ?)")
+		args = append(args, query.UserID, query.UserID)
+	}
+	if query.Action != "" {
+		conditions = append(conditions, "action = ?")
+		args = append(args, query.Action)
+	}
+	if query.From != nil {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, *query.From)
+	}
+	if query.Before != nil {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, *query.Before)
+	}
+	where := strings.Join(conditions, " AND ")
+
+	var total int
+	if err := r.db.GetContext(ctx, &total, `SELECT COUNT(*) FROM audit_log WHERE `+where, args...); err != nil {
+		return nil, 0, wrapDatabaseError(err)
+	}
+
+	selectQuery := `SELECT * FROM audit_log WHERE ` + where + ` ORDER BY id DESC LIMIT ? OFFSET ?`
+
+	entries := []*models.AuditEntry{}
+	if err := r.db.SelectContext(ctx, &entries, selectQuery, append(args, query.Limit, query.Offset)...); err != nil {
+		return nil, 0, wrapDatabaseError(err)
+	}
+
+	return entries, total, nil
+}
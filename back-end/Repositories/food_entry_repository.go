@@ -15,7 +15,7 @@ import (
 type FoodEntryRepository interface {
 	CreateFoodEntry(ctx context.Context, entry *models.FoodEntry) error
 	GetDailyEntries(ctx context.Context, userID int, date time.Time) ([]*models.FoodEntry, error)
-	DeleteFoodEntry(ctx context.Context, entryID int) error
+	DeleteFoodEntry(ctx context.Context, userID, entryID int) (*models.FoodEntry, error)
 	GetDailyNutrition(ctx context.Context, userID int, date time.Time) (*models.DailyNutrition, error)
 	GetNutritionHistory(ctx context.Context, userID int, startDate, endDate time.Time) ([]*models.DailyNutrition, error)
 }
@@ -286,38 +286,45 @@ func scanEntries(rows *sql.Rows) ([]*models.FoodEntry, error) {
 	return entries, nil
 }
 
-// DeleteFoodEntry deletes a food entry by ID
-func (r *foodEntryRepository) DeleteFoodEntry(ctx context.Context, entryID int) error {
+// DeleteFoodEntry deletes one of the user's food entries and returns it as
+// it was, or nil if the user has no entry with that ID
+func (r *foodEntryRepository) DeleteFoodEntry(ctx context.Context, userID, entryID int) (*models.FoodEntry, error) {
 	// Start a transaction
 	tx, err := r.db.BeginTxx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %v", err)
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
 	}
 
 	// Rollback is safe to call even if the tx is already closed
 	defer tx.Rollback()
 
-	// 1. First, get the entry details (we need user_id and date) before deleting
-	query := `SELECT user_id, entry_date FROM consumed_foods WHERE id = ?`
-	var userID int
-	var entryDate time.Time
+	// 1. First, get the entry before deleting it; entries of other users are not found
+	query := `
+		SELECT id, user_id, food_id, food_name, quantity, calories, protein, carbs, fats,
+			   entry_date, created_at, updated_at
+		FROM consumed_foods
+		WHERE id = ? AND user_id = ?
+		FOR UPDATE
+	`
+	var entry models.FoodEntry
 
-	err = tx.QueryRowContext(ctx, query, entryID).Scan(&userID, &entryDate)
+	err = tx.GetContext(ctx, &entry, query, entryID, userID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return fmt.Errorf("food entry not found")
+			return nil, nil
 		}
-		return fmt.Errorf("failed to fetch food entry: %v", err)
+		return nil, fmt.Errorf("failed to fetch food entry: %v", err)
 	}
 
 	// 2. Delete the food entry
-	deleteQuery := `DELETE FROM consumed_foods WHERE id = ?`
-	_, err = tx.ExecContext(ctx, deleteQuery, entryID)
+	deleteQuery := `DELETE FROM consumed_foods WHERE id = ? AND user_id = ?`
+	_, err = tx.ExecContext(ctx, deleteQuery, entryID, userID)
 	if err != nil {
-		return fmt.Errorf("failed to delete food entry: %v", err)
+		return nil, fmt.Errorf("failed to delete food entry: %v", err)
 	}
 
 	// 3. Get the new total nutrition for the day (after deletion)
+	entryDate := entry.Date
 	dateOnly := time.Date(entryDate.Year(), entryDate.Month(), entryDate.Day(), 0, 0, 0, 0, time.UTC)
 
 	nutritionQuery := `
@@ -338,7 +345,7 @@ func (r *foodEntryRepository) DeleteFoodEntry(ctx context.Context, entryID int)
 		&totalFats,
 	)
 	if err != nil && err != sql.ErrNoRows {
-		return fmt.Errorf("failed to calculate daily totals: %v", err)
+		return nil, fmt.Errorf("failed to calculate daily totals: %v", err)
 	}
 
 	// 4. Check if a daily entry exists for this date
@@ -368,7 +375,7 @@ func (r *foodEntryRepository) DeleteFoodEntry(ctx context.Context, entryID int)
 				totalFats,
 			)
 			if err != nil {
-				return fmt.Errorf("failed to insert daily entry: %v", err)
+				return nil, fmt.Errorf("failed to insert daily entry: %v", err)
 			}
 		}
 	} else if err == nil {
@@ -392,27 +399,27 @@ func (r *foodEntryRepository) DeleteFoodEntry(ctx context.Context, entryID int)
 				dailyEntryID,
 			)
 			if err != nil {
-				return fmt.Errorf("failed to update daily entry: %v", err)
+				return nil, fmt.Errorf("failed to update daily entry: %v", err)
 			}
 		} else {
 			// No more entries for this day, delete the daily entry
 			deleteEntryQuery := `DELETE FROM daily_entries WHERE id = ?`
 			_, err = tx.ExecContext(ctx, deleteEntryQuery, dailyEntryID)
 			if err != nil {
-				return fmt.Errorf("failed to delete daily entry: %v", err)
+				return nil, fmt.Errorf("failed to delete daily entry: %v", err)
 			}
 		}
 	} else {
 		// Some other error occurred
-		return fmt.Errorf("failed to check for existing daily entry: %v", err)
+		return nil, fmt.Errorf("failed to check for existing daily entry: %v", err)
 	}
 
 	// Commit the transaction
 	if err = tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %v", err)
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
 	}
 
-	return nil
+	return &entry, nil
 }
 
 // GetDailyNutrition retrieves the total nutrition for a user on a specific date
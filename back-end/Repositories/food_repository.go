@@ -0,0 +1,126 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	models "HabitBite/backend/Models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// defaultFoodSearchLimit caps search results when no limit is given
+const defaultFoodSearchLimit = 25
+
+// FoodRepository defines the interface for food catalog data access
+type FoodRepository interface {
+	GetFood(ctx context.Context, foodID string) (*models.Food, error)
+	SearchFoods(ctx context.Context, search models.FoodSearch) ([]*models.Food, error)
+	SaveFood(ctx context.Context, food *models.Food) error
+}
+
+// foodRepository implements FoodRepository
+type foodRepository struct {
+	db *sqlx.DB
+}
+
+// NewFoodRepository creates a new FoodRepository
+func NewFoodRepository(db *sqlx.DB) FoodRepository {
+	return &foodRepository{db: db}
+}
+
+// GetFood retrieves a catalog food by its food ID, or nil if it is not in the catalog
+func (r *foodRepository) GetFood(ctx context.Context, foodID string) (*models.Food, error) {
+	query := `SELECT * FROM foods WHERE food_id = ?`
+
+	var food models.Food
+	if err := r.db.GetContext(ctx, &food, query, foodID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, wrapDatabaseError(err)
+	}
+
+	return &food, nil
+}
+
+// SearchFoods finds catalog foods by name, optionally leaving out foods that
+// conflict with a diet profile
+func (r *foodRepository) SearchFoods(ctx context.Context, search models.FoodSearch) ([]*models.Food, error) {
+	conditions := []string{"name LIKE ?"}
+	args := []interface{}{"%" + escapeLike(search.Query) + "%"}
+
+	if p := search.Exclude; p != nil {
+		switch p.Diet {
+		case models.DietVegetarian:
+			conditions = append(conditions, "is_vegetarian = TRUE")
+		case models.DietVegan:
+			conditions = append(conditions, "is_vegan = TRUE")
+		case models.DietKeto:
+			conditions = append(conditions, "is_keto = TRUE")
+		}
+		for _, allergen := range p.Allergens {
+			conditions = append(conditions, "FIND_IN_SET(?, allergens) = 0")
+			args = append(args, allergen)
+		}
+	}
+
+	limit := search.Limit
+	if limit <= 0 {
+		limit = defaultFoodSearchLimit
+	}
+	args = append(args, limit)
+
+	query := `SELECT * FROM foods WHERE ` + strings.Join(conditions, " AND ") + ` ORDER BY name ASC LIMIT ?`
+
+	var foods []*models.Food
+	if err := r.db.SelectContext(ctx, &foods, query, args...); err != nil {
+		return nil, wrapDatabaseError(err)
+	}
+
+	return foods, nil
+}
+
+// SaveFood creates or replaces a catalog food
+func (r *foodRepository) SaveFood(ctx context.Context, food *models.Food) error {
+	now := time.Now()
+	if food.CreatedAt.IsZero() {
+		food.CreatedAt = now
+	}
+	food.UpdatedAt = now
+
+	query := `
+		INSERT INTO foods (
+			food_id, name, calories, protein, carbs, fats,
+			is_vegetarian, is_vegan, is_keto, allergens, created_at, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			name = VALUES(name),
+			calories = VALUES(calories),
+			protein = VALUES(protein),
+			carbs = VALUES(carbs),
+			fats = VALUES(fats),
+			is_vegetarian = VALUES(is_vegetarian),
+			is_vegan = VALUES(is_vegan),
+			is_keto = VALUES(is_keto),
+			allergens = VALUES(allergens),
+			updated_at = VALUES(updated_at)
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		food.FoodID, food.Name, food.Calories, food.Protein, food.Carbs, food.Fat,
+		food.Vegetarian, food.Vegan, food.KetoFriendly, food.Allergens, food.CreatedAt, food.UpdatedAt)
+	if err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	return nil
+}
+
+// escapeLike escapes LIKE wildcards so search terms match literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,317 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	models "HabitBite/backend/Models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// GoalJobRepository defines the interface for goal recalculation job data access
+type GoalJobRepository interface {
+	CreateJob(ctx context.Context, job *models.GoalRecalculationJob) error
+	FindJob(ctx context.Context, id int) (*models.GoalRecalculationJob, error)
+	ListJobs(ctx context.Context, limit int) ([]*models.GoalRecalculationJob, error)
+	FindClaimableJob(ctx context.Context, staleBefore time.Time) (*models.GoalRecalculationJob, error)
+	ClaimJob(ctx context.Context, id int, now, staleBefore time.Time) (bool, error)
+	SaveProgress(ctx context.Context, id int, progress models.GoalJobProgress, changes []models.GoalChange, now time.Time) (bool, error)
+	FinishJob(ctx context.Context, id int, status string, jobErr *string, now time.Time) (bool, error)
+	SetJobStatus(ctx context.Context, id int, from []string, to string, now time.Time) (bool, error)
+	ListChanges(ctx context.Context, jobID, limit, offset int) ([]*models.GoalChange, int, error)
+	CountUsers(ctx context.Context, goalType string) (int, error)
+	FindUsersAfter(ctx context.Context, afterID int, goalType string, limit int) ([]*models.User, error)
+	FindGoals(ctx context.Context, userIDs []int) ([]*models.UserGoals, error)
+}
+
+// goalJobRepository implements GoalJobRepository
+type goalJobRepository struct {
+	db *sqlx.DB
+}
+
+// NewGoalJobRepository creates a new GoalJobRepository
+func NewGoalJobRepository(db *sqlx.DB) GoalJobRepository {
+	return &goalJobRepository{db: db}
+}
+
+// CreateJob stores a new job and sets its ID
+func (r *goalJobRepository) CreateJob(ctx context.Context, job *models.GoalRecalculationJob) error {
+	query := `
+		INSERT INTO goal_recalculation_jobs (status, dry_run, goal_type, requested_by, total_users, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+
+	result, err := r.db.ExecContext(ctx, query,
+		job.Status, job.DryRun, job.GoalType, job.RequestedBy, job.TotalUsers, job.CreatedAt)
+	if err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return wrapDatabaseError(err)
+	}
+	job.ID = int(id)
+
+	return nil
+}
+
+// FindJob retrieves a job by ID, or nil if there is none
+func (r *goalJobRepository) FindJob(ctx context.Context, id int) (*models.GoalRecalculationJob, error) {
+	query := `SELECT * FROM goal_recalculation_jobs WHERE id = ? LIMIT 1`
+
+	var job models.GoalRecalculationJob
+	if err := r.db.GetContext(ctx, &job, query, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, wrapDatabaseError(err)
+	}
+
+	return &job, nil
+}
+
+// ListJobs returns the most recent jobs, newest first
+func (r *goalJobRepository) ListJobs(ctx context.Context, limit int) ([]*models.GoalRecalculationJob, error) {
+	query := `SELECT * FROM goal_recalculation_jobs ORDER BY id DESC LIMIT ?`
+
+	jobs := []*models.GoalRecalculationJob{}
+	if err := r.db.SelectContext(ctx, &jobs, query, limit); err != nil {
+		return nil, wrapDatabaseError(err)
+	}
+
+	return jobs, nil
+}
+
+// FindClaimableJob returns the oldest job that is pending or running with
+// a lease older than staleBefore, or nil if there is none
+func (r *goalJobRepository) FindClaimableJob(ctx context.Context, staleBefore time.Time) (*models.GoalRecalculationJob, error) {
+	query := `
+		SELECT * FROM goal_recalculation_jobs
+		WHERE status = ? OR (status = ? AND heartbeat_at < ?)
+		ORDER BY id
+		LIMIT 1
+	`
+
+	var job models.GoalRecalculationJob
+	if err := r.db.GetContext(ctx, &job, query, models.GoalJobPending, models.GoalJobRunning, staleBefore); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, wrapDatabaseError(err)
+	}
+
+	return &job, nil
+}
+
+// ClaimJob marks a pending or stale running job as running now
+func (r *goalJobRepository) ClaimJob(ctx context.Context, id int, now, staleBefore time.Time) (bool, error) {
+	query := `
+		UPDATE goal_recalculation_jobs
+		SET status = ?, started_at = COALESCE(started_at, ?), heartbeat_at = ?
+		WHERE id = ? AND (status = ? OR (status = ? AND heartbeat_at < ?))
+	`
+
+	result, err := r.db.ExecContext(ctx, query,
+		models.GoalJobRunning, now, now,
+		id, models.GoalJobPending, models.GoalJobRunning, staleBefore)
+	if err != nil {
+		return false, wrapDatabaseError(err)
+	}
+
+	claimed, err := result.RowsAffected()
+	if err != nil {
+		return false, wrapDatabaseError(err)
+	}
+
+	return claimed > 0, nil
+}
+
+// SaveProgress records a finished page of a running job together with the
+// goal changes it made. A change recorded for the same user before, by a
+// page that ran again after an interruption, is replaced.
+func (r *goalJobRepository) SaveProgress(ctx context.Context, id int, progress models.GoalJobProgress, changes []models.GoalChange, now time.Time) (bool, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, wrapDatabaseError(err)
+	}
+	defer tx.Rollback()
+
+	// Lock the job so a cancellation cannot slip in between the check and the update
+	var status string
+	if err := tx.GetContext(ctx, &status, `SELECT status FROM goal_recalculation_jobs WHERE id = ? FOR UPDATE`, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, wrapDatabaseError(err)
+	}
+	if status != models.GoalJobRunning {
+		return false, nil
+	}
+
+	insertQuery := `
+		INSERT INTO goal_recalculation_changes (
+			job_id, user_id,
+			before_calories, before_protein, before_carbs, before_fats,
+			after_calories, after_protein, after_carbs, after_fats
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			before_calories = VALUES(before_calories), before_protein = VALUES(before_protein),
+			before_carbs = VALUES(before_carbs), before_fats = VALUES(before_fats),
+			after_calories = VALUES(after_calories), after_protein = VALUES(after_protein),
+			after_carbs = VALUES(after_carbs), after_fats = VALUES(after_fats)
+	`
+	for _, change := range changes {
+		if _, err := tx.ExecContext(ctx, insertQuery,
+			id, change.UserID,
+			change.BeforeCalories, change.BeforeProtein, change.BeforeCarbs, change.BeforeFats,
+			change.AfterCalories, change.AfterProtein, change.AfterCarbs, change.AfterFats); err != nil {
+			return false, wrapDatabaseError(err)
+		}
+	}
+
+	updateQuery := `
+		UPDATE goal_recalculation_jobs
+		SET cursor_user_id = ?, processed = ?, changed = ?, failed = ?, heartbeat_at = ?
+		WHERE id = ?
+	`
+	if _, err := tx.ExecContext(ctx, updateQuery,
+		progress.CursorUserID, progress.Processed, progress.Changed, progress.Failed, now, id); err != nil {
+		return false, wrapDatabaseError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, wrapDatabaseError(err)
+	}
+
+	return true, nil
+}
+
+// FinishJob moves a running job to its final status
+func (r *goalJobRepository) FinishJob(ctx context.Context, id int, status string, jobErr *string, now time.Time) (bool, error) {
+	query := `
+		UPDATE goal_recalculation_jobs
+		SET status = ?, error = ?, finished_at = ?, heartbeat_at = ?
+		WHERE id = ? AND status = ?
+	`
+
+	result, err := r.db.ExecContext(ctx, query, status, jobErr, now, now, id, models.GoalJobRunning)
+	if err != nil {
+		return false, wrapDatabaseError(err)
+	}
+
+	finished, err := result.RowsAffected()
+	if err != nil {
+		return false, wrapDatabaseError(err)
+	}
+
+	return finished > 0, nil
+}
+
+// SetJobStatus moves a job to status to if its status is one of from.
+// Queuing a job again clears its error and finish time.
+func (r *goalJobRepository) SetJobStatus(ctx context.Context, id int, from []string, to string, now time.Time) (bool, error) {
+	query := `
+		UPDATE goal_recalculation_jobs
+		SET status = ?,
+			error = IF(? = ?, NULL, error),
+			finished_at = IF(? = ?, NULL, ?)
+		WHERE id = ? AND status IN (?)
+	`
+
+	query, args, err := sqlx.In(query,
+		to, to, models.GoalJobPending, to, models.GoalJobPending, now, id, from)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := r.db.ExecContext(ctx, r.db.Rebind(query), args...)
+	if err != nil {
+		return false, wrapDatabaseError(err)
+	}
+
+	changed, err := result.RowsAffected()
+	if err != nil {
+		return false, wrapDatabaseError(err)
+	}
+
+	return changed > 0, nil
+}
+
+// ListChanges returns one page of a job's goal changes in user ID order and
+// the total number of changes
+func (r *goalJobRepository) ListChanges(ctx context.Context, jobID, limit, offset int) ([]*models.GoalChange, int, error) {
+	var total int
+	if err := r.db.GetContext(ctx, &total, `SELECT COUNT(*) FROM goal_recalculation_changes WHERE job_id = ?`, jobID); err != nil {
+		return nil, 0, wrapDatabaseError(err)
+	}
+
+	query := `
+		SELECT job_id, user_id,
+			before_calories, before_protein, before_carbs, before_fats,
+			after_calories, after_protein, after_carbs, after_fats
+		FROM goal_recalculation_changes
+		WHERE job_id = ?
+		ORDER BY user_id
+		LIMIT ? OFFSET ?
+	`
+
+	changes := []*models.GoalChange{}
+	if err := r.db.SelectContext(ctx, &changes, query, jobID, limit, offset); err != nil {
+		return nil, 0, wrapDatabaseError(err)
+	}
+
+	return changes, total, nil
+}
+
+// CountUsers returns the number of users with goalType, or of all users
+// when it is empty
+func (r *goalJobRepository) CountUsers(ctx context.Context, goalType string) (int, error) {
+	query := `SELECT COUNT(*) FROM users WHERE (? = '' OR goal_type = ?)`
+
+	var count int
+	if err := r.db.GetContext(ctx, &count, query, goalType, goalType); err != nil {
+		return 0, wrapDatabaseError(err)
+	}
+
+	return count, nil
+}
+
+// FindUsersAfter returns up to limit users with IDs above afterID, in ID order
+func (r *goalJobRepository) FindUsersAfter(ctx context.Context, afterID int, goalType string, limit int) ([]*models.User, error) {
+	query := `
+		SELECT * FROM users
+		WHERE id > ? AND (? = '' OR goal_type = ?)
+		ORDER BY id
+		LIMIT ?
+	`
+
+	users := []*models.User{}
+	if err := r.db.SelectContext(ctx, &users, query, afterID, goalType, goalType, limit); err != nil {
+		return nil, wrapDatabaseError(err)
+	}
+
+	return users, nil
+}
+
+// FindGoals returns the stored goals of the given users
+func (r *goalJobRepository) FindGoals(ctx context.Context, userIDs []int) ([]*models.UserGoals, error) {
+	goals := []*models.UserGoals{}
+	if len(userIDs) == 0 {
+		return goals, nil
+	}
+
+	query, args, err := sqlx.In(`SELECT * FROM user_goals WHERE user_id IN (?)`, userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.db.SelectContext(ctx, &goals, r.db.Rebind(query), args...); err != nil {
+		return nil, wrapDatabaseError(err)
+	}
+
+	return goals, nil
+}
@@ -0,0 +1,122 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	models "HabitBite/backend/Models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// GoalScheduleRepository defines the interface for per-day goal overrides and day tags
+type GoalScheduleRepository interface {
+	GetGoalOverrides(ctx context.Context, userID int) ([]*models.GoalOverride, error)
+	ReplaceGoalOverrides(ctx context.Context, userID int, overrides []models.GoalOverride) error
+
+	GetDayTags(ctx context.Context, userID int, startDate, endDate time.Time) ([]*models.DayTag, error)
+	SetDayTag(ctx context.Context, tag *models.DayTag) error
+	DeleteDayTag(ctx context.Context, userID int, date time.Time) error
+}
+
+// goalScheduleRepository implements GoalScheduleRepository
+type goalScheduleRepository struct {
+	db *sqlx.DB
+}
+
+// NewGoalScheduleRepository creates a new GoalScheduleRepository
+func NewGoalScheduleRepository(db *sqlx.DB) GoalScheduleRepository {
+	return &goalScheduleRepository{db: db}
+}
+
+// GetGoalOverrides retrieves all goal overrides for a user
+func (r *goalScheduleRepository) GetGoalOverrides(ctx context.Context, userID int) ([]*models.GoalOverride, error) {
+	query := `
+		SELECT user_id, schedule_type, schedule_key, target_calories, target_protein, target_carbs, target_fats
+		FROM user_goal_overrides
+		WHERE user_id = ?
+		ORDER BY schedule_type, schedule_key
+	`
+
+	var overrides []*models.GoalOverride
+	if err := r.db.SelectContext(ctx, &overrides, query, userID); err != nil {
+		return nil, wrapDatabaseError(err)
+	}
+
+	return overrides, nil
+}
+
+// ReplaceGoalOverrides atomically replaces a user's whole goal schedule
+func (r *goalScheduleRepository) ReplaceGoalOverrides(ctx context.Context, userID int, overrides []models.GoalOverride) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return wrapDatabaseError(err)
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM user_goal_overrides WHERE user_id = ?`, userID); err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	insertQuery := `
+		INSERT INTO user_goal_overrides (
+			user_id, schedule_type, schedule_key, target_calories, target_protein, target_carbs, target_fats
+		) VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	for _, o := range overrides {
+		_, err = tx.ExecContext(ctx, insertQuery,
+			userID, o.ScheduleType, o.ScheduleKey, o.TargetCalories, o.TargetProtein, o.TargetCarbs, o.TargetFats)
+		if err != nil {
+			return wrapDatabaseError(err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	return nil
+}
+
+// GetDayTags retrieves the day tags in a date range
+func (r *goalScheduleRepository) GetDayTags(ctx context.Context, userID int, startDate, endDate time.Time) ([]*models.DayTag, error) {
+	query := `
+		SELECT user_id, tag_date, tag
+		FROM user_day_tags
+		WHERE user_id = ? AND tag_date BETWEEN DATE(?) AND DATE(?)
+		ORDER BY tag_date ASC
+	`
+
+	var tags []*models.DayTag
+	if err := r.db.SelectContext(ctx, &tags, query, userID, startDate, endDate); err != nil {
+		return nil, wrapDatabaseError(err)
+	}
+
+	return tags, nil
+}
+
+// SetDayTag tags a day, replacing any existing tag for that day
+func (r *goalScheduleRepository) SetDayTag(ctx context.Context, tag *models.DayTag) error {
+	query := `
+		INSERT INTO user_day_tags (user_id, tag_date, tag)
+		VALUES (?, DATE(?), ?)
+		ON DUPLICATE KEY UPDATE tag = VALUES(tag)
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, tag.UserID, tag.Date, tag.Tag); err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	return nil
+}
+
+// DeleteDayTag removes the tag from a day
+func (r *goalScheduleRepository) DeleteDayTag(ctx context.Context, userID int, date time.Time) error {
+	query := `DELETE FROM user_day_tags WHERE user_id = ? AND tag_date = DATE(?)`
+
+	if _, err := r.db.ExecContext(ctx, query, userID, date); err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	return nil
+}
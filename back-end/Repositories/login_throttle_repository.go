@@ -0,0 +1,185 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	models "HabitBite/backend/Models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// LoginThrottleRepository defines the interface for failed-login tracking data access
+type LoginThrottleRepository interface {
+	GetLoginFailures(ctx context.Context, userID int) (*models.LoginFailures, error)
+	UpdateLoginFailures(ctx context.Context, userID int, update models.LoginFailuresUpdate) error
+	UpdateEmailLoginFailures(ctx context.Context, emailHash string, update models.LoginFailuresUpdate) error
+	DeleteStaleEmailLoginFailures(ctx context.Context, before time.Time) (int64, error)
+	MarkLoginFailureNotified(ctx context.Context, userID int) (bool, error)
+	ClearLoginFailures(ctx context.Context, userID int) error
+}
+
+// loginThrottleRepository implements LoginThrottleRepository
+type loginThrottleRepository struct {
+	db *sqlx.DB
+}
+
+// NewLoginThrottleRepository creates a new LoginThrottleRepository
+func NewLoginThrottleRepository(db *sqlx.DB) LoginThrottleRepository {
+	return &loginThrottleRepository{db: db}
+}
+
+// GetLoginFailures retrieves an account's failure streak, or nil if there is none
+func (r *loginThrottleRepository) GetLoginFailures(ctx context.Context, userID int) (*models.LoginFailures, error) {
+	query := `SELECT * FROM user_login_failures WHERE user_id = ? LIMIT 1`
+
+	var failures models.LoginFailures
+	if err := r.db.GetContext(ctx, &failures, query, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, wrapDatabaseError(err)
+	}
+
+	return &failures, nil
+}
+
+// failureTable is a table of failed-login streaks keyed by keyColumn.
+// Only account streaks record when the user was notified.
+type failureTable struct {
+	name      string
+	keyColumn string
+	notified  bool
+}
+
+var (
+	accountFailures = failureTable{name: "user_login_failures", keyColumn: "user_id", notified: true}
+	emailFailures   = failureTable{name: "login_email_failures", keyColumn: "email_hash"}
+)
+
+// columns returns the streak columns stored in the table
+func (t failureTable) columns() []string {
+	columns := []string{"failed_count", "last_failed_at", "locked_until"}
+	if t.notified {
+		columns = append(columns, "notified_at")
+	}
+	return columns
+}
+
+// UpdateLoginFailures applies update to an account's streak while holding
+// its row lock
+func (r *loginThrottleRepository) UpdateLoginFailures(ctx context.Context, userID int, update models.LoginFailuresUpdate) error {
+	return r.updateFailures(ctx, accountFailures, userID, update)
+}
+
+// UpdateEmailLoginFailures applies update to the streak of an email address
+// without an account while holding its row lock
+func (r *loginThrottleRepository) UpdateEmailLoginFailures(ctx context.Context, emailHash string, update models.LoginFailuresUpdate) error {
+	return r.updateFailures(ctx, emailFailures, emailHash, update)
+}
+
+// DeleteStaleEmailLoginFailures removes email address streaks whose last
+// failure is before the given time
+func (r *loginThrottleRepository) DeleteStaleEmailLoginFailures(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM login_email_failures WHERE last_failed_at < ?`, before)
+	if err != nil {
+		return 0, wrapDatabaseError(err)
+	}
+
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return 0, wrapDatabaseError(err)
+	}
+
+	return removed, nil
+}
+
+// updateFailures locks the streak row with the given key, creating an empty
+// one first so even a first attempt has a row to lock, and stores what
+// update returns. When update returns nil the transaction is rolled back,
+// which also removes a row created here.
+func (r *loginThrottleRepository) updateFailures(ctx context.Context, table failureTable, key interface{}, update models.LoginFailuresUpdate) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return wrapDatabaseError(err)
+	}
+	defer tx.Rollback()
+
+	insertQuery := fmt.Sprintf(
+		"INSERT INTO %[1]s (%[2]s, failed_count, last_failed_at) VALUES (?, 0, ?) ON DUPLICATE KEY UPDATE %[2]s = %[2]s",
+		table.name, table.keyColumn)
+	result, err := tx.ExecContext(ctx, insertQuery, key, time.Now())
+	if err != nil {
+		return wrapDatabaseError(err)
+	}
+	created, err := result.RowsAffected()
+	if err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	columns := table.columns()
+	selectQuery := fmt.Sprintf("SELECT %s FROM %s WHERE %s = ? FOR UPDATE",
+		strings.Join(columns, ", "), table.name, table.keyColumn)
+	var current models.LoginFailures
+	if err := tx.GetContext(ctx, &current, selectQuery, key); err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	// A new row holds no streak yet
+	var next *models.LoginFailures
+	if created == 1 {
+		next = update(nil)
+	} else {
+		next = update(&current)
+	}
+	if next == nil {
+		return nil
+	}
+
+	args := []interface{}{next.FailedCount, next.LastFailedAt, next.LockedUntil}
+	if table.notified {
+		args = append(args, next.NotifiedAt)
+	}
+	updateQuery := fmt.Sprintf("UPDATE %s SET %s = ? WHERE %s = ?",
+		table.name, strings.Join(columns, " = ?, "), table.keyColumn)
+	if _, err := tx.ExecContext(ctx, updateQuery, append(args, key)...); err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	return nil
+}
+
+// MarkLoginFailureNotified records that the user was told about the current
+// streak, reporting false if they already were
+func (r *loginThrottleRepository) MarkLoginFailureNotified(ctx context.Context, userID int) (bool, error) {
+	query := `UPDATE user_login_failures SET notified_at = ? WHERE user_id = ? AND notified_at IS NULL`
+
+	result, err := r.db.ExecContext(ctx, query, time.Now(), userID)
+	if err != nil {
+		return false, wrapDatabaseError(err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, wrapDatabaseError(err)
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// ClearLoginFailures ends an account's failure streak and lockout
+func (r *loginThrottleRepository) ClearLoginFailures(ctx context.Context, userID int) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM user_login_failures WHERE user_id = ?`, userID); err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	return nil
+}
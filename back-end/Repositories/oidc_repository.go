@@ -0,0 +1,180 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	models "HabitBite/backend/Models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// OIDCRepository defines the interface for OpenID Connect sign-in data access
+type OIDCRepository interface {
+	CreateOIDCFlow(ctx context.Context, flow *models.OIDCFlow) error
+	ConsumeOIDCFlow(ctx context.Context, stateHash string) (*models.OIDCFlow, error)
+
+	FindIdentity(ctx context.Context, provider, subject string) (*models.UserIdentity, error)
+	ListIdentities(ctx context.Context, userID int) ([]*models.UserIdentity, error)
+	CreateIdentity(ctx context.Context, identity *models.UserIdentity) error
+	TouchIdentity(ctx context.Context, id int) error
+	DeleteIdentity(ctx context.Context, userID int, provider string) (bool, error)
+
+	FindUserIDByEmail(ctx context.Context, email string) (int, error)
+	UsernameTaken(ctx context.Context, username string) (bool, error)
+}
+
+// oidcRepository implements OIDCRepository
+type oidcRepository struct {
+	db *sqlx.DB
+}
+
+// NewOIDCRepository creates a new OIDCRepository
+func NewOIDCRepository(db *sqlx.DB) OIDCRepository {
+	return &oidcRepository{db: db}
+}
+
+// CreateOIDCFlow stores a started sign-in and clears out abandoned ones
+func (r *oidcRepository) CreateOIDCFlow(ctx context.Context, flow *models.OIDCFlow) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM oidc_flows WHERE expires_at < ?`, time.Now()); err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	query := `
+		INSERT INTO oidc_flows (state_hash, provider, nonce, code_verifier, user_id, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, flow.StateHash, flow.Provider, flow.Nonce, flow.CodeVerifier,
+		flow.UserID, flow.ExpiresAt, flow.CreatedAt); err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	return nil
+}
+
+// ConsumeOIDCFlow deletes and returns a started sign-in, or nil if there is
+// none. A state can only be consumed once.
+func (r *oidcRepository) ConsumeOIDCFlow(ctx context.Context, stateHash string) (*models.OIDCFlow, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, wrapDatabaseError(err)
+	}
+	defer tx.Rollback()
+
+	var flow models.OIDCFlow
+	if err := tx.GetContext(ctx, &flow, `SELECT * FROM oidc_flows WHERE state_hash = ? FOR UPDATE`, stateHash); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, wrapDatabaseError(err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM oidc_flows WHERE state_hash = ?`, stateHash); err != nil {
+		return nil, wrapDatabaseError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, wrapDatabaseError(err)
+	}
+
+	return &flow, nil
+}
+
+// FindIdentity retrieves the identity for a provider subject, or nil if it is not linked
+func (r *oidcRepository) FindIdentity(ctx context.Context, provider, subject string) (*models.UserIdentity, error) {
+	query := `SELECT * FROM user_identities WHERE provider = ? AND subject = ? LIMIT 1`
+
+	var identity models.UserIdentity
+	if err := r.db.GetContext(ctx, &identity, query, provider, subject); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, wrapDatabaseError(err)
+	}
+
+	return &identity, nil
+}
+
+// ListIdentities retrieves the identities linked to a user
+func (r *oidcRepository) ListIdentities(ctx context.Context, userID int) ([]*models.UserIdentity, error) {
+	query := `SELECT * FROM user_identities WHERE user_id = ? ORDER BY created_at`
+
+	identities := []*models.UserIdentity{}
+	if err := r.db.SelectContext(ctx, &identities, query, userID); err != nil {
+		return nil, wrapDatabaseError(err)
+	}
+
+	return identities, nil
+}
+
+// CreateIdentity links a provider identity to a user
+func (r *oidcRepository) CreateIdentity(ctx context.Context, identity *models.UserIdentity) error {
+	query := `
+		INSERT INTO user_identities (user_id, provider, subject, email, created_at, last_login_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+
+	result, err := r.db.ExecContext(ctx, query, identity.UserID, identity.Provider, identity.Subject,
+		identity.Email, identity.CreatedAt, identity.LastLoginAt)
+	if err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return wrapDatabaseError(err)
+	}
+	identity.ID = int(id)
+
+	return nil
+}
+
+// TouchIdentity records a sign-in with an identity
+func (r *oidcRepository) TouchIdentity(ctx context.Context, id int) error {
+	if _, err := r.db.ExecContext(ctx, `UPDATE user_identities SET last_login_at = ? WHERE id = ?`, time.Now(), id); err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	return nil
+}
+
+// DeleteIdentity unlinks a provider from a user, reporting false if it was not linked
+func (r *oidcRepository) DeleteIdentity(ctx context.Context, userID int, provider string) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM user_identities WHERE user_id = ? AND provider = ?`, userID, provider)
+	if err != nil {
+		return false, wrapDatabaseError(err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, wrapDatabaseError(err)
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// FindUserIDByEmail returns the ID of the user with the email, or 0 if there is none
+func (r *oidcRepository) FindUserIDByEmail(ctx context.Context, email string) (int, error) {
+	var id int
+	if err := r.db.GetContext(ctx, &id, `SELECT id FROM users WHERE email = ? LIMIT 1`, email); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, wrapDatabaseError(err)
+	}
+
+	return id, nil
+}
+
+// UsernameTaken reports whether a username is already in use
+func (r *oidcRepository) UsernameTaken(ctx context.Context, username string) (bool, error) {
+	var count int
+	if err := r.db.GetContext(ctx, &count, `SELECT COUNT(*) FROM users WHERE username = ?`, username); err != nil {
+		return false, wrapDatabaseError(err)
+	}
+
+	return count > 0, nil
+}
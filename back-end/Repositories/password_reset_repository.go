@@ -0,0 +1,89 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	models "HabitBite/backend/Models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// PasswordResetRepository defines the interface for password reset token data access
+type PasswordResetRepository interface {
+	CreatePasswordReset(ctx context.Context, reset *models.PasswordReset) error
+	FindPasswordReset(ctx context.Context, tokenHash string) (*models.PasswordReset, error)
+	ConsumePasswordReset(ctx context.Context, id int) (bool, error)
+	DeleteUserPasswordResets(ctx context.Context, userID int) error
+}
+
+// passwordResetRepository implements PasswordResetRepository
+type passwordResetRepository struct {
+	db *sqlx.DB
+}
+
+// NewPasswordResetRepository creates a new PasswordResetRepository
+func NewPasswordResetRepository(db *sqlx.DB) PasswordResetRepository {
+	return &passwordResetRepository{db: db}
+}
+
+// CreatePasswordReset stores a new reset token
+func (r *passwordResetRepository) CreatePasswordReset(ctx context.Context, reset *models.PasswordReset) error {
+	query := `
+		INSERT INTO password_resets (user_id, token_hash, expires_at, created_at)
+		VALUES (?, ?, ?, ?)
+	`
+
+	result, err := r.db.ExecContext(ctx, query, reset.UserID, reset.TokenHash, reset.ExpiresAt, reset.CreatedAt)
+	if err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return wrapDatabaseError(err)
+	}
+	reset.ID = int(id)
+
+	return nil
+}
+
+// FindPasswordReset retrieves a reset token by its hash, or nil if there is none
+func (r *passwordResetRepository) FindPasswordReset(ctx context.Context, tokenHash string) (*models.PasswordReset, error) {
+	query := `SELECT * FROM password_resets WHERE token_hash = ? LIMIT 1`
+
+	var reset models.PasswordReset
+	if err := r.db.GetContext(ctx, &reset, query, tokenHash); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, wrapDatabaseError(err)
+	}
+
+	return &reset, nil
+}
+
+// ConsumePasswordReset deletes a reset token, reporting false if it was already gone
+func (r *passwordResetRepository) ConsumePasswordReset(ctx context.Context, id int) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM password_resets WHERE id = ?`, id)
+	if err != nil {
+		return false, wrapDatabaseError(err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, wrapDatabaseError(err)
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// DeleteUserPasswordResets deletes every reset token of a user
+func (r *passwordResetRepository) DeleteUserPasswordResets(ctx context.Context, userID int) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM password_resets WHERE user_id = ?`, userID); err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	models "HabitBite/backend/Models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// PersonalTokenRepository defines the interface for personal access token data access
+type PersonalTokenRepository interface {
+	CreatePersonalToken(ctx context.Context, token *models.PersonalAccessToken) error
+	FindPersonalToken(ctx context.Context, tokenHash string) (*models.PersonalAccessToken, error)
+	ListPersonalTokens(ctx context.Context, userID int) ([]*models.PersonalAccessToken, error)
+	TouchPersonalToken(ctx context.Context, id int, now time.Time) error
+	DeletePersonalToken(ctx context.Context, id, userID int) (bool, error)
+}
+
+// personalTokenRepository implements PersonalTokenRepository
+type personalTokenRepository struct {
+	db *sqlx.DB
+}
+
+// NewPersonalTokenRepository creates a new PersonalTokenRepository
+func NewPersonalTokenRepository(db *sqlx.DB) PersonalTokenRepository {
+	return &personalTokenRepository{db: db}
+}
+
+// CreatePersonalToken stores a new personal access token
+func (r *personalTokenRepository) CreatePersonalToken(ctx context.Context, token *models.PersonalAccessToken) error {
+	query := `
+		INSERT INTO personal_access_tokens (user_id, name, token_hash, scopes, mfa, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+	result, err := r.db.ExecContext(ctx, query,
+		token.UserID, token.Name, token.TokenHash, token.Scopes, token.MFA, token.ExpiresAt, token.CreatedAt)
+	if err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return wrapDatabaseError(err)
+	}
+	token.ID = int(id)
+
+	return nil
+}
+
+// FindPersonalToken retrieves a token by its hash, or nil if there is none
+func (r *personalTokenRepository) FindPersonalToken(ctx context.Context, tokenHash string) (*models.PersonalAccessToken, error) {
+	query := `SELECT * FROM personal_access_tokens WHERE token_hash = ? LIMIT 1`
+
+	var token models.PersonalAccessToken
+	if err := r.db.GetContext(ctx, &token, query, tokenHash); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, wrapDatabaseError(err)
+	}
+
+	return &token, nil
+}
+
+// ListPersonalTokens returns the user's tokens, newest first
+func (r *personalTokenRepository) ListPersonalTokens(ctx context.Context, userID int) ([]*models.PersonalAccessToken, error) {
+	query := `SELECT * FROM personal_access_tokens WHERE user_id = ? ORDER BY created_at DESC, id DESC`
+
+	tokens := []*models.PersonalAccessToken{}
+	if err := r.db.SelectContext(ctx, &tokens, query, userID); err != nil {
+		return nil, wrapDatabaseError(err)
+	}
+
+	return tokens, nil
+}
+
+// TouchPersonalToken records that a token was used
+func (r *personalTokenRepository) TouchPersonalToken(ctx context.Context, id int, now time.Time) error {
+	query := `UPDATE personal_access_tokens SET last_used_at = ? WHERE id = ?`
+
+	if _, err := r.db.ExecContext(ctx, query, now, id); err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	return nil
+}
+
+// DeletePersonalToken deletes one of the user's tokens, reporting false if
+// it does not exist or belongs to someone else
+func (r *personalTokenRepository) DeletePersonalToken(ctx context.Context, id, userID int) (bool, error) {
+	query := `DELETE FROM personal_access_tokens WHERE id = ? AND user_id = ?`
+
+	result, err := r.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return false, wrapDatabaseError(err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, wrapDatabaseError(err)
+	}
+
+	return rowsAffected == 1, nil
+}
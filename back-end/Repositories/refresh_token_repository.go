@@ -0,0 +1,110 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	models "HabitBite/backend/Models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// RefreshTokenRepository defines the interface for refresh token data access
+type RefreshTokenRepository interface {
+	CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error
+	FindRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error)
+	MarkRefreshTokenUsed(ctx context.Context, id int) (bool, error)
+	RevokeRefreshFamily(ctx context.Context, familyID string) error
+	RevokeUserRefreshTokens(ctx context.Context, userID int) error
+}
+
+// refreshTokenRepository implements RefreshTokenRepository
+type refreshTokenRepository struct {
+	db *sqlx.DB
+}
+
+// NewRefreshTokenRepository creates a new RefreshTokenRepository
+func NewRefreshTokenRepository(db *sqlx.DB) RefreshTokenRepository {
+	return &refreshTokenRepository{db: db}
+}
+
+// CreateRefreshToken stores a new refresh token
+func (r *refreshTokenRepository) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	query := `
+		INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at, created_at, mfa)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+
+	result, err := r.db.ExecContext(ctx, query,
+		token.UserID, token.FamilyID, token.TokenHash, token.ExpiresAt, token.CreatedAt, token.MFA)
+	if err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return wrapDatabaseError(err)
+	}
+	token.ID = int(id)
+
+	return nil
+}
+
+// FindRefreshToken retrieves a refresh token by its hash, or nil if there is none
+func (r *refreshTokenRepository) FindRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	query := `SELECT * FROM refresh_tokens WHERE token_hash = ? LIMIT 1`
+
+	var token models.RefreshToken
+	if err := r.db.GetContext(ctx, &token, query, tokenHash); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, wrapDatabaseError(err)
+	}
+
+	return &token, nil
+}
+
+// MarkRefreshTokenUsed consumes a token, reporting false if it was already used or revoked
+func (r *refreshTokenRepository) MarkRefreshTokenUsed(ctx context.Context, id int) (bool, error) {
+	query := `
+		UPDATE refresh_tokens SET used_at = ?
+		WHERE id = ? AND used_at IS NULL AND revoked_at IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, query, time.Now(), id)
+	if err != nil {
+		return false, wrapDatabaseError(err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, wrapDatabaseError(err)
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// RevokeRefreshFamily revokes every token in a family
+func (r *refreshTokenRepository) RevokeRefreshFamily(ctx context.Context, familyID string) error {
+	query := `UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL`
+
+	if _, err := r.db.ExecContext(ctx, query, time.Now(), familyID); err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	return nil
+}
+
+// RevokeUserRefreshTokens revokes every token a user holds
+func (r *refreshTokenRepository) RevokeUserRefreshTokens(ctx context.Context, userID int) error {
+	query := `UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`
+
+	if _, err := r.db.ExecContext(ctx, query, time.Now(), userID); err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	models "HabitBite/backend/Models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// SessionRepository defines the interface for login session data access
+type SessionRepository interface {
+	CreateSession(ctx context.Context, session *models.Session) error
+	FindSession(ctx context.Context, id string) (*models.Session, error)
+	ListActiveSessions(ctx context.Context, userID int, now time.Time) ([]*models.Session, error)
+	TouchSession(ctx context.Context, id string, now time.Time, ipAddress string) error
+	RevokeSession(ctx context.Context, id string, userID int) (bool, error)
+	RevokeUserSessions(ctx context.Context, userID int) error
+}
+
+// sessionRepository implements SessionRepository
+type sessionRepository struct {
+	db *sqlx.DB
+}
+
+// NewSessionRepository creates a new SessionRepository
+func NewSessionRepository(db *sqlx.DB) SessionRepository {
+	return &sessionRepository{db: db}
+}
+
+// CreateSession stores a new session
+func (r *sessionRepository) CreateSession(ctx context.Context, session *models.Session) error {
+	query := `
+		INSERT INTO user_sessions (id, user_id, device, user_agent, ip_address, created_at, last_used_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+	if _, err := r.db.ExecContext(ctx, query,
+		session.ID, session.UserID, session.Device, session.UserAgent, session.IPAddress,
+		session.CreatedAt, session.LastUsedAt); err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	return nil
+}
+
+// FindSession retrieves a session by ID, or nil if there is none
+func (r *sessionRepository) FindSession(ctx context.Context, id string) (*models.Session, error) {
+	query := `SELECT * FROM user_sessions WHERE id = ? LIMIT 1`
+
+	var session models.Session
+	if err := r.db.GetContext(ctx, &session, query, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, wrapDatabaseError(err)
+	}
+
+	return &session, nil
+}
+
+// ListActiveSessions returns the user's sessions that are not revoked and
+// still have an unused, unexpired refresh token
+func (r *sessionRepository) ListActiveSessions(ctx context.Context, userID int, now time.Time) ([]*models.Session, error) {
+	query := `
+		SELECT s.* FROM user_sessions s
+		WHERE s.user_id = ? AND s.revoked_at IS NULL
+			AND EXISTS (
+				SELECT 1 FROM refresh_tokens rt
+				WHERE rt.family_id = s.id AND rt.used_at IS NULL AND rt.revoked_at IS NULL AND rt.expires_at > ?
+			)
+		ORDER BY s.last_used_at DESC
+	`
+
+	sessions := []*models.Session{}
+	if err := r.db.SelectContext(ctx, &sessions, query, userID, now); err != nil {
+		return nil, wrapDatabaseError(err)
+	}
+
+	return sessions, nil
+}
+
+// TouchSession records that a session was used, and from where
+func (r *sessionRepository) TouchSession(ctx context.Context, id string, now time.Time, ipAddress string) error {
+	query := `UPDATE user_sessions SET last_used_at = ?, ip_address = ? WHERE id = ? AND revoked_at IS NULL`
+
+	if _, err := r.db.ExecContext(ctx, query, now, ipAddress, id); err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	return nil
+}
+
+// RevokeSession revokes one of the user's sessions, reporting false if it
+// does not exist, belongs to someone else or was already revoked
+func (r *sessionRepository) RevokeSession(ctx context.Context, id string, userID int) (bool, error) {
+	query := `UPDATE user_sessions SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL`
+
+	result, err := r.db.ExecContext(ctx, query, time.Now(), id, userID)
+	if err != nil {
+		return false, wrapDatabaseError(err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, wrapDatabaseError(err)
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// RevokeUserSessions revokes every session of the user
+func (r *sessionRepository) RevokeUserSessions(ctx context.Context, userID int) error {
+	query := `UPDATE user_sessions SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`
+
+	if _, err := r.db.ExecContext(ctx, query, time.Now(), userID); err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	return nil
+}
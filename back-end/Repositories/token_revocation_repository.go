@@ -0,0 +1,87 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// TokenRevocationRepository defines the interface for access token revocation data access
+type TokenRevocationRepository interface {
+	RevokeToken(ctx context.Context, jti string, userID int, expiresAt time.Time) error
+	RevokeUserTokens(ctx context.Context, userID int, issuedBefore time.Time) error
+	IsTokenRevoked(ctx context.Context, jti string, userID int, issuedAt time.Time) (bool, error)
+	DeleteExpiredRevocations(ctx context.Context, now time.Time) (int64, error)
+}
+
+// tokenRevocationRepository implements TokenRevocationRepository
+type tokenRevocationRepository struct {
+	db *sqlx.DB
+}
+
+// NewTokenRevocationRepository creates a new TokenRevocationRepository
+func NewTokenRevocationRepository(db *sqlx.DB) TokenRevocationRepository {
+	return &tokenRevocationRepository{db: db}
+}
+
+// RevokeToken records a revoked token ID
+func (r *tokenRevocationRepository) RevokeToken(ctx context.Context, jti string, userID int, expiresAt time.Time) error {
+	query := `
+		INSERT INTO revoked_tokens (jti, user_id, expires_at, revoked_at)
+		VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE revoked_at = revoked_at
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, jti, userID, expiresAt, time.Now()); err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	return nil
+}
+
+// RevokeUserTokens revokes every token a user was issued before the given time
+func (r *tokenRevocationRepository) RevokeUserTokens(ctx context.Context, userID int, issuedBefore time.Time) error {
+	query := `
+		INSERT INTO user_token_revocations (user_id, revoked_before)
+		VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE revoked_before = VALUES(revoked_before)
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, userID, issuedBefore); err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	return nil
+}
+
+// IsTokenRevoked checks both the token ID and the user's revoke-all cutoff in one query
+func (r *tokenRevocationRepository) IsTokenRevoked(ctx context.Context, jti string, userID int, issuedAt time.Time) (bool, error) {
+	query := `
+		SELECT
+			EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = ?)
+			OR EXISTS (SELECT 1 FROM user_token_revocations WHERE user_id = ? AND revoked_before >= ?)
+	`
+
+	var revoked bool
+	if err := r.db.GetContext(ctx, &revoked, query, jti, userID, issuedAt); err != nil {
+		return false, wrapDatabaseError(err)
+	}
+
+	return revoked, nil
+}
+
+// DeleteExpiredRevocations removes revocations of tokens that have expired
+func (r *tokenRevocationRepository) DeleteExpiredRevocations(ctx context.Context, now time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM revoked_tokens WHERE expires_at < ?`, now)
+	if err != nil {
+		return 0, wrapDatabaseError(err)
+	}
+
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return 0, wrapDatabaseError(err)
+	}
+
+	return removed, nil
+}
@@ -0,0 +1,208 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	models "HabitBite/backend/Models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// TwoFactorRepository defines the interface for TOTP enrollment and recovery code data access
+type TwoFactorRepository interface {
+	GetTwoFactor(ctx context.Context, userID int) (*models.TwoFactor, error)
+	SaveTwoFactorSecret(ctx context.Context, userID int, secret string) error
+	EnableTwoFactor(ctx context.Context, userID int, step int64) error
+	UseTwoFactorStep(ctx context.Context, userID int, step int64) (bool, error)
+	RecordTwoFactorFailure(ctx context.Context, userID int, maxFailures int, lockUntil time.Time) error
+	DeleteTwoFactor(ctx context.Context, userID int) error
+
+	ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error
+	UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error)
+	CountRecoveryCodes(ctx context.Context, userID int) (int, error)
+}
+
+// twoFactorRepository implements TwoFactorRepository
+type twoFactorRepository struct {
+	db *sqlx.DB
+}
+
+// NewTwoFactorRepository creates a new TwoFactorRepository
+func NewTwoFactorRepository(db *sqlx.DB) TwoFactorRepository {
+	return &twoFactorRepository{db: db}
+}
+
+// GetTwoFactor retrieves a user's enrollment, or nil if there is none
+func (r *twoFactorRepository) GetTwoFactor(ctx context.Context, userID int) (*models.TwoFactor, error) {
+	query := `SELECT * FROM user_two_factor WHERE user_id = ? LIMIT 1`
+
+	var tf models.TwoFactor
+	if err := r.db.GetContext(ctx, &tf, query, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, wrapDatabaseError(err)
+	}
+
+	return &tf, nil
+}
+
+// SaveTwoFactorSecret stores a pending enrollment, replacing any earlier pending one
+func (r *twoFactorRepository) SaveTwoFactorSecret(ctx context.Context, userID int, secret string) error {
+	query := `
+		INSERT INTO user_two_factor (user_id, secret, enabled_at, last_used_step, failed_attempts, locked_until, created_at)
+		VALUES (?, ?, NULL, 0, 0, NULL, ?)
+		ON DUPLICATE KEY UPDATE
+			secret = VALUES(secret), enabled_at = NULL, last_used_step = 0,
+			failed_attempts = 0, locked_until = NULL, created_at = VALUES(created_at)
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, userID, secret, time.Now()); err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	return nil
+}
+
+// EnableTwoFactor confirms a pending enrollment, recording the step of the confirming code
+func (r *twoFactorRepository) EnableTwoFactor(ctx context.Context, userID int, step int64) error {
+	query := `UPDATE user_two_factor SET enabled_at = ?, last_used_step = ? WHERE user_id = ?`
+
+	if _, err := r.db.ExecContext(ctx, query, time.Now(), step, userID); err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	return nil
+}
+
+// UseTwoFactorStep records a used TOTP step, reporting false if it (or a later
+// step) was already used. Success clears the failure count.
+func (r *twoFactorRepository) UseTwoFactorStep(ctx context.Context, userID int, step int64) (bool, error) {
+	query := `
+		UPDATE user_two_factor SET last_used_step = ?, failed_attempts = 0, locked_until = NULL
+		WHERE user_id = ? AND enabled_at IS NOT NULL AND last_used_step < ?
+	`
+
+	result, err := r.db.ExecContext(ctx, query, step, userID, step)
+	if err != nil {
+		return false, wrapDatabaseError(err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, wrapDatabaseError(err)
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// RecordTwoFactorFailure counts an invalid code. Reaching maxFailures locks
+// verification until lockUntil and starts the count again.
+func (r *twoFactorRepository) RecordTwoFactorFailure(ctx context.Context, userID int, maxFailures int, lockUntil time.Time) error {
+	// Both assignments read the old failed_attempts, which MySQL only updates last
+	query := `
+		UPDATE user_two_factor SET
+			locked_until = IF(failed_attempts + 1 >= ?, ?, locked_until),
+			failed_attempts = IF(failed_attempts + 1 >= ?, 0, failed_attempts + 1)
+		WHERE user_id = ?
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, maxFailures, lockUntil, maxFailures, userID); err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	return nil
+}
+
+// DeleteTwoFactor removes a user's enrollment and recovery codes
+func (r *twoFactorRepository) DeleteTwoFactor(ctx context.Context, userID int) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return wrapDatabaseError(err)
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return wrapDatabaseError(err)
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM user_two_factor WHERE user_id = ?`, userID); err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	return nil
+}
+
+// ReplaceRecoveryCodes atomically replaces a user's recovery codes
+func (r *twoFactorRepository) ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return wrapDatabaseError(err)
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	insertQuery := `INSERT INTO user_recovery_codes (user_id, code_hash, created_at) VALUES (?, ?, ?)`
+	now := time.Now()
+	for _, hash := range codeHashes {
+		if _, err = tx.ExecContext(ctx, insertQuery, userID, hash, now); err != nil {
+			return wrapDatabaseError(err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	return nil
+}
+
+// UseRecoveryCode consumes a recovery code, reporting false if it is unknown or
+// already used. Success clears the failure count.
+func (r *twoFactorRepository) UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error) {
+	query := `
+		UPDATE user_recovery_codes SET used_at = ?
+		WHERE user_id = ? AND code_hash = ? AND used_at IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, query, time.Now(), userID, codeHash)
+	if err != nil {
+		return false, wrapDatabaseError(err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, wrapDatabaseError(err)
+	}
+	if rowsAffected != 1 {
+		return false, nil
+	}
+
+	resetQuery := `UPDATE user_two_factor SET failed_attempts = 0, locked_until = NULL WHERE user_id = ?`
+	if _, err := r.db.ExecContext(ctx, resetQuery, userID); err != nil {
+		return false, wrapDatabaseError(err)
+	}
+
+	return true, nil
+}
+
+// CountRecoveryCodes counts a user's unused recovery codes
+func (r *twoFactorRepository) CountRecoveryCodes(ctx context.Context, userID int) (int, error) {
+	query := `SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = ? AND used_at IS NULL`
+
+	var count int
+	if err := r.db.GetContext(ctx, &count, query, userID); err != nil {
+		return 0, wrapDatabaseError(err)
+	}
+
+	return count, nil
+}
@@ -0,0 +1,109 @@
+package repositories
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	models "HabitBite/backend/Models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// UserAdminRepository defines the interface for user administration data access
+type UserAdminRepository interface {
+	SearchUsers(ctx context.Context, search models.UserSearch) ([]*models.User, int, error)
+	SetUserRole(ctx context.Context, userID int, role string) error
+	SetUserDisabled(ctx context.Context, userID int, disabledAt *time.Time) error
+	ClearPassword(ctx context.Context, userID int) error
+}
+
+// userAdminRepository implements UserAdminRepository
+type userAdminRepository struct {
+	db *sqlx.DB
+}
+
+// NewUserAdminRepository creates a new UserAdminRepository
+func NewUserAdminRepository(db *sqlx.DB) UserAdminRepository {
+	return &userAdminRepository{db: db}
+}
+
+// SearchUsers returns one page of matching users, newest first, and the
+// number of matches
+func (r *userAdminRepository) SearchUsers(ctx context.Context, search models.UserSearch) ([]*models.User, int, error) {
+	conditions := []string{"1 = 1"}
+	var args []interface{}
+
+	if search.Query != "" {
+		pattern := "%" + escapeLike(search.Query) + "%"
+		conditions = append(conditions, "(email LIKE ? OR username LIKE ? OR full_name LIKE ?)")
+		args = append(args, pattern, pattern, pattern)
+	}
+	if search.Role != "" {
+		conditions = append(conditions, "role = ?")
+		args = append(args, search.Role)
+	}
+	switch search.Status {
+	case models.UserStatusActive:
+		conditions = append(conditions, "disabled_at IS NULL")
+	case models.UserStatusDisabled:
+		conditions = append(conditions, "disabled_at IS NOT NULL")
+	}
+	if search.CreatedFrom != nil {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, *search.CreatedFrom)
+	}
+	if search.CreatedBefore != nil {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, *search.CreatedBefore)
+	}
+	where := strings.Join(conditions, " AND ")
+
+	var total int
+	if err := r.db.GetContext(ctx, &total, `SELECT COUNT(*) FROM users WHERE `+where, args...); err != nil {
+		return nil, 0, wrapDatabaseError(err)
+	}
+
+	query := `SELECT * FROM users WHERE ` + where + ` ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?`
+
+	users := []*models.User{}
+	if err := r.db.SelectContext(ctx, &users, query, append(args, search.Limit, search.Offset)...); err != nil {
+		return nil, 0, wrapDatabaseError(err)
+	}
+
+	return users, total, nil
+}
+
+// SetUserRole changes a user's role
+func (r *userAdminRepository) SetUserRole(ctx context.Context, userID int, role string) error {
+	query := `UPDATE users SET role = ?, updated_at = ? WHERE id = ?`
+
+	if _, err := r.db.ExecContext(ctx, query, role, time.Now(), userID); err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	return nil
+}
+
+// SetUserDisabled disables a user as of disabledAt, or re-enables them when it is nil
+func (r *userAdminRepository) SetUserDisabled(ctx context.Context, userID int, disabledAt *time.Time) error {
+	query := `UPDATE users SET disabled_at = ?, updated_at = ? WHERE id = ?`
+
+	if _, err := r.db.ExecContext(ctx, query, disabledAt, time.Now(), userID); err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	return nil
+}
+
+// ClearPassword removes a user's password, so they can only sign in again
+// after choosing a new one through a reset link or with a linked provider
+func (r *userAdminRepository) ClearPassword(ctx context.Context, userID int) error {
+	query := `UPDATE users SET password_hash = '', updated_at = ? WHERE id = ?`
+
+	if _, err := r.db.ExecContext(ctx, query, time.Now(), userID); err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	models "HabitBite/backend/Models"
+	nutrition "HabitBite/backend/Nutrition"
 
 	"github.com/jmoiron/sqlx"
 )
@@ -24,13 +25,23 @@ type UserRepository interface {
 	FindByEmail(ctx context.Context, email string) (*models.User, error)
 	FindByUsername(ctx context.Context, username string) (*models.User, error)
 	FindByID(ctx context.Context, id int) (*models.User, error)
+	FindUserAccess(ctx context.Context, userID int) (*models.UserAccess, error)
 	UpdateUser(ctx context.Context, user *models.User) error
+	UpdatePassword(ctx context.Context, userID int, passwordHash string) error
+	MarkEmailVerified(ctx context.Context, userID int, email string) (bool, error)
+	ChangeEmail(ctx context.Context, userID int, oldEmail, newEmail string) (bool, error)
+	EmailExists(ctx context.Context, email string) (bool, error)
 	DeleteUser(ctx context.Context, id int) error
 
 	// User Goals methods
 	GetUserGoals(ctx context.Context, userID int) (*models.UserGoals, error)
 	UpdateUserGoals(ctx context.Context, goals *models.UserGoals) error
 	SyncUserCalorieGoal(ctx context.Context, userID int, calorieGoal int) error
+
+	// Dietitian methods
+	IsAssignedDietitian(ctx context.Context, dietitianID, userID int) (bool, error)
+	AssignDietitian(ctx context.Context, dietitianID, userID int) error
+	UnassignDietitian(ctx context.Context, dietitianID, userID int) error
 }
 
 // userRepository implements UserRepository
@@ -76,14 +87,16 @@ func (r *userRepository) CreateUser(ctx context.Context, user *models.User) erro
 	user.UpdatedAt = now
 
 	query := `INSERT INTO users (
-        email, username, password_hash, full_name, birthdate, gender, 
-        height, weight, goal_type, activity_level, daily_calorie_goal, role, created_at, updated_at
-    ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+        email, email_verified, username, password_hash, full_name, birthdate, gender, 
+        height, weight, goal_type, activity_level, daily_calorie_goal,
+        body_fat_pct, energy_formula, diet, allergens, role, profile_complete, created_at, updated_at
+    ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
 	result, err := tx.ExecContext(ctx, query,
-		user.Email, user.Username, user.PasswordHash, user.FullName,
+		user.Email, user.EmailVerified, user.Username, user.PasswordHash, user.FullName,
 		user.Birthdate, user.Gender, user.Height, user.Weight,
-		user.GoalType, user.ActivityLevel, user.DailyCalorieGoal, user.Role, user.CreatedAt, user.UpdatedAt)
+		user.GoalType, user.ActivityLevel, user.DailyCalorieGoal,
+		user.BodyFatPct, user.EnergyFormula, user.Diet, user.Allergens, user.Role, user.ProfileComplete, user.CreatedAt, user.UpdatedAt)
 
 	if err != nil {
 		return wrapDatabaseError(err)
@@ -96,34 +109,8 @@ func (r *userRepository) CreateUser(ctx context.Context, user *models.User) erro
 
 	user.ID = int(id)
 
-	// Calculate macronutrient targets based on goal type
-	var targetProtein, targetCarbs, targetFats float64
-	caloriesFromProtein := 4.0 // 4 calories per gram of protein
-	caloriesFromCarbs := 4.0   // 4 calories per gram of carbs
-	caloriesFromFats := 9.0    // 9 calories per gram of fat
-
-	switch user.GoalType {
-	case "lose":
-		// For weight loss: protein 35%, fats 35%, carbs 30%
-		targetProtein = float64(user.DailyCalorieGoal) * 0.35 / caloriesFromProtein
-		targetFats = float64(user.DailyCalorieGoal) * 0.35 / caloriesFromFats
-		targetCarbs = float64(user.DailyCalorieGoal) * 0.30 / caloriesFromCarbs
-	case "maintain":
-		// For weight maintenance: protein 25%, fats 25%, carbs 50%
-		targetProtein = float64(user.DailyCalorieGoal) * 0.25 / caloriesFromProtein
-		targetFats = float64(user.DailyCalorieGoal) * 0.25 / caloriesFromFats
-		targetCarbs = float64(user.DailyCalorieGoal) * 0.50 / caloriesFromCarbs
-	case "gain":
-		// For weight gain: protein 30%, fats 25%, carbs 45%
-		targetProtein = float64(user.DailyCalorieGoal) * 0.30 / caloriesFromProtein
-		targetFats = float64(user.DailyCalorieGoal) * 0.25 / caloriesFromFats
-		targetCarbs = float64(user.DailyCalorieGoal) * 0.45 / caloriesFromCarbs
-	default:
-		// Default to maintenance if goal type is invalid
-		targetProtein = float64(user.DailyCalorieGoal) * 0.25 / caloriesFromProtein
-		targetFats = float64(user.DailyCalorieGoal) * 0.25 / caloriesFromFats
-		targetCarbs = float64(user.DailyCalorieGoal) * 0.50 / caloriesFromCarbs
-	}
+	// New users start on the default split for their goal type
+	macros := nutrition.MacrosFromSplit(user.DailyCalorieGoal, nutrition.DefaultSplitForGoal(user.GoalType))
 
 	targetWeight := user.Weight // Default target weight is current weight
 
@@ -133,7 +120,7 @@ func (r *userRepository) CreateUser(ctx context.Context, user *models.User) erro
 	) VALUES (?, ?, ?, ?, ?, ?)`
 
 	_, err = tx.ExecContext(ctx, goalsQuery,
-		user.ID, user.DailyCalorieGoal, targetProtein, targetCarbs, targetFats, targetWeight)
+		user.ID, user.DailyCalorieGoal, macros.Protein, macros.Carbs, macros.Fats, targetWeight)
 
 	if err != nil {
 		return wrapDatabaseError(err)
@@ -195,6 +182,21 @@ func (r *userRepository) FindByID(ctx context.Context, id int) (*models.User, er
 	return &user, nil
 }
 
+// FindUserAccess returns a user's role and disabled status, or nil if there is no such user
+func (r *userRepository) FindUserAccess(ctx context.Context, userID int) (*models.UserAccess, error) {
+	query := `SELECT role, disabled_at FROM users WHERE id = ? LIMIT 1`
+
+	var access models.UserAccess
+	if err := r.db.GetContext(ctx, &access, query, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, wrapDatabaseError(err)
+	}
+
+	return &access, nil
+}
+
 // UpdateUser updates an existing user
 func (r *userRepository) UpdateUser(ctx context.Context, user *models.User) error {
 	// Start a transaction for atomicity
@@ -209,13 +211,17 @@ func (r *userRepository) UpdateUser(ctx context.Context, user *models.User) erro
 	query := `UPDATE users SET 
 		email = ?, username = ?, password_hash = ?, full_name = ?, 
 		birthdate = ?, gender = ?, height = ?, weight = ?, 
-		goal_type = ?, activity_level = ?, daily_calorie_goal = ?, role = ?, updated_at = ?
+		goal_type = ?, activity_level = ?, daily_calorie_goal = ?,
+		body_fat_pct = ?, energy_formula = ?, diet = ?, allergens = ?, role = ?,
+		profile_complete = ?, updated_at = ?
 		WHERE id = ?`
 
 	result, err := tx.ExecContext(ctx, query,
 		user.Email, user.Username, user.PasswordHash, user.FullName,
 		user.Birthdate, user.Gender, user.Height, user.Weight,
-		user.GoalType, user.ActivityLevel, user.DailyCalorieGoal, user.Role, user.UpdatedAt,
+		user.GoalType, user.ActivityLevel, user.DailyCalorieGoal,
+		user.BodyFatPct, user.EnergyFormula, user.Diet, user.Allergens, user.Role,
+		user.ProfileComplete, user.UpdatedAt,
 		user.ID)
 
 	if err != nil {
@@ -231,98 +237,30 @@ func (r *userRepository) UpdateUser(ctx context.Context, user *models.User) erro
 		return ErrUserNotFound
 	}
 
-	// Also update target_calories in user_goals to keep them in sync
-	goalsUpdateQuery := `
-		UPDATE user_goals 
-		SET target_calories = ? 
-		WHERE user_id = ?
-	`
-
-	_, err = tx.ExecContext(ctx, goalsUpdateQuery, user.DailyCalorieGoal, user.ID)
+	// Also update user_goals to keep calories and macros in sync,
+	// honouring any macro preference already stored for the user
+	pref, found, err := loadMacroPreference(ctx, tx, user.ID)
 	if err != nil {
-		// If no user_goals record exists, create one with calculated macronutrient targets
-		if errors.Is(err, sql.ErrNoRows) {
-			// Calculate macronutrient targets based on goal type
-			var targetProtein, targetCarbs, targetFats float64
-			caloriesFromProtein := 4.0 // 4 calories per gram of protein
-			caloriesFromCarbs := 4.0   // 4 calories per gram of carbs
-			caloriesFromFats := 9.0    // 9 calories per gram of fat
-
-			switch user.GoalType {
-			case "lose":
-				// For weight loss: protein 35%, fats 35%, carbs 30%
-				targetProtein = float64(user.DailyCalorieGoal) * 0.35 / caloriesFromProtein
-				targetFats = float64(user.DailyCalorieGoal) * 0.35 / caloriesFromFats
-				targetCarbs = float64(user.DailyCalorieGoal) * 0.30 / caloriesFromCarbs
-			case "maintain":
-				// For weight maintenance: protein 25%, fats 25%, carbs 50%
-				targetProtein = float64(user.DailyCalorieGoal) * 0.25 / caloriesFromProtein
-				targetFats = float64(user.DailyCalorieGoal) * 0.25 / caloriesFromFats
-				targetCarbs = float64(user.DailyCalorieGoal) * 0.50 / caloriesFromCarbs
-			case "gain":
-				// For weight gain: protein 30%, fats 25%, carbs 45%
-				targetProtein = float64(user.DailyCalorieGoal) * 0.30 / caloriesFromProtein
-				targetFats = float64(user.DailyCalorieGoal) * 0.25 / caloriesFromFats
-				targetCarbs = float64(user.DailyCalorieGoal) * 0.45 / caloriesFromCarbs
-			default:
-				// Default to maintenance if goal type is invalid
-				targetProtein = float64(user.DailyCalorieGoal) * 0.25 / caloriesFromProtein
-				targetFats = float64(user.DailyCalorieGoal) * 0.25 / caloriesFromFats
-				targetCarbs = float64(user.DailyCalorieGoal) * 0.50 / caloriesFromCarbs
-			}
+		return err
+	}
+	macros := nutrition.MacrosOrDefault(user.DailyCalorieGoal, user.Weight, user.GoalType, pref)
 
-			insertQuery := `
-				INSERT INTO user_goals (user_id, target_calories, target_protein, target_carbs, target_fats, target_weight)
-				VALUES (?, ?, ?, ?, ?, ?)
-			`
-			_, err = tx.ExecContext(ctx, insertQuery, user.ID, user.DailyCalorieGoal, targetProtein, targetCarbs, targetFats, user.Weight)
-			if err != nil {
-				return wrapDatabaseError(err)
-			}
-		} else {
-			return wrapDatabaseError(err)
-		}
+	if !found {
+		insertQuery := `
+			INSERT INTO user_goals (user_id, target_calories, target_protein, target_carbs, target_fats, target_weight)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`
+		_, err = tx.ExecContext(ctx, insertQuery, user.ID, user.DailyCalorieGoal, macros.Protein, macros.Carbs, macros.Fats, user.Weight)
 	} else {
-		// If the update was successful, also update the macronutrient targets
-		// Calculate macronutrient targets based on goal type
-		var targetProtein, targetCarbs, targetFats float64
-		caloriesFromProtein := 4.0 // 4 calories per gram of protein
-		caloriesFromCarbs := 4.0   // 4 calories per gram of carbs
-		caloriesFromFats := 9.0    // 9 calories per gram of fat
-
-		switch user.GoalType {
-		case "lose":
-			// For weight loss: protein 35%, fats 35%, carbs 30%
-			targetProtein = float64(user.DailyCalorieGoal) * 0.35 / caloriesFromProtein
-			targetFats = float64(user.DailyCalorieGoal) * 0.35 / caloriesFromFats
-			targetCarbs = float64(user.DailyCalorieGoal) * 0.30 / caloriesFromCarbs
-		case "maintain":
-			// For weight maintenance: protein 25%, fats 25%, carbs 50%
-			targetProtein = float64(user.DailyCalorieGoal) * 0.25 / caloriesFromProtein
-			targetFats = float64(user.DailyCalorieGoal) * 0.25 / caloriesFromFats
-			targetCarbs = float64(user.DailyCalorieGoal) * 0.50 / caloriesFromCarbs
-		case "gain":
-			// For weight gain: protein 30%, fats 25%, carbs 45%
-			targetProtein = float64(user.DailyCalorieGoal) * 0.30 / caloriesFromProtein
-			targetFats = float64(user.DailyCalorieGoal) * 0.25 / caloriesFromFats
-			targetCarbs = float64(user.DailyCalorieGoal) * 0.45 / caloriesFromCarbs
-		default:
-			// Default to maintenance if goal type is invalid
-			targetProtein = float64(user.DailyCalorieGoal) * 0.25 / caloriesFromProtein
-			targetFats = float64(user.DailyCalorieGoal) * 0.25 / caloriesFromFats
-			targetCarbs = float64(user.DailyCalorieGoal) * 0.50 / caloriesFromCarbs
-		}
-
-		// Update macronutrient targets
-		macroUpdateQuery := `
+		goalsUpdateQuery := `
 			UPDATE user_goals 
-			SET target_protein = ?, target_carbs = ?, target_fats = ?
+			SET target_calories = ?, target_protein = ?, target_carbs = ?, target_fats = ?
 			WHERE user_id = ?
 		`
-		_, err = tx.ExecContext(ctx, macroUpdateQuery, targetProtein, targetCarbs, targetFats, user.ID)
-		if err != nil {
-			return wrapDatabaseError(err)
-		}
+		_, err = tx.ExecContext(ctx, goalsUpdateQuery, user.DailyCalorieGoal, macros.Protein, macros.Carbs, macros.Fats, user.ID)
+	}
+	if err != nil {
+		return wrapDatabaseError(err)
 	}
 
 	// Commit the transaction
@@ -333,44 +271,83 @@ func (r *userRepository) UpdateUser(ctx context.Context, user *models.User) erro
 	return nil
 }
 
-// DeleteUser deletes a user by ID
-func (r *userRepository) DeleteUser(ctx context.Context, id int) error {
-	// Start a transaction
-	tx, err := r.db.BeginTxx(ctx, nil)
+// UpdatePassword replaces a user's password hash
+func (r *userRepository) UpdatePassword(ctx context.Context, userID int, passwordHash string) error {
+	query := `UPDATE users SET password_hash = ?, updated_at = ? WHERE id = ?`
+
+	result, err := r.db.ExecContext(ctx, query, passwordHash, time.Now(), userID)
 	if err != nil {
 		return wrapDatabaseError(err)
 	}
-	defer tx.Rollback()
 
-	// Delete from user_goals first (due to foreign key constraints)
-	goalsQuery := `DELETE FROM user_goals WHERE user_id = ?`
-	_, err = tx.ExecContext(ctx, goalsQuery, id)
+	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		return wrapDatabaseError(err)
 	}
 
-	// Then delete the user
-	userQuery := `DELETE FROM users WHERE id = ?`
-	result, err := tx.ExecContext(ctx, userQuery, id)
+	if rowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// MarkEmailVerified marks a user's email as verified, provided the address
+// is still the one the verification was sent to. It reports whether a row changed.
+func (r *userRepository) MarkEmailVerified(ctx context.Context, userID int, email string) (bool, error) {
+	query := `
+		UPDATE users SET email_verified = TRUE, email_verified_at = ?
+		WHERE id = ? AND email = ? AND email_verified = FALSE
+	`
+
+	result, err := r.db.ExecContext(ctx, query, time.Now(), userID, email)
 	if err != nil {
-		return wrapDatabaseError(err)
+		return false, wrapDatabaseError(err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return wrapDatabaseError(err)
+		return false, wrapDatabaseError(err)
 	}
 
-	if rowsAffected == 0 {
-		return ErrUserNotFound
+	return rowsAffected == 1, nil
+}
+
+// ChangeEmail replaces a user's email with a verified new address, provided
+// the current one is still oldEmail. It reports whether a row changed.
+func (r *userRepository) ChangeEmail(ctx context.Context, userID int, oldEmail, newEmail string) (bool, error) {
+	query := `
+		UPDATE users SET email = ?, email_verified = TRUE, email_verified_at = ?, updated_at = ?
+		WHERE id = ? AND email = ?
+	`
+
+	now := time.Now()
+	result, err := r.db.ExecContext(ctx, query, newEmail, now, now, userID, oldEmail)
+	if err != nil {
+		return false, wrapDatabaseError(err)
 	}
 
-	// Commit the transaction
-	if err = tx.Commit(); err != nil {
-		return wrapDatabaseError(err)
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, wrapDatabaseError(err)
 	}
 
-	return nil
+	return rowsAffected == 1, nil
+}
+
+// EmailExists reports whether any account uses the email address
+func (r *userRepository) EmailExists(ctx context.Context, email string) (bool, error) {
+	var exists bool
+	if err := r.db.GetContext(ctx, &exists, `SELECT EXISTS (SELECT 1 FROM users WHERE email = ?)`, email); err != nil {
+		return false, wrapDatabaseError(err)
+	}
+
+	return exists, nil
+}
+
+// DeleteUser deletes a user by ID together with every row they own
+func (r *userRepository) DeleteUser(ctx context.Context, id int) error {
+	return purgeUser(ctx, r.db, id)
 }
 
 // GetUserGoals retrieves a user's goals
@@ -387,42 +364,15 @@ func (r *userRepository) GetUserGoals(ctx context.Context, userID int) (*models.
 				return nil, err
 			}
 
-			// Calculate macronutrient targets based on goal type
-			var targetProtein, targetCarbs, targetFats float64
-			caloriesFromProtein := 4.0 // 4 calories per gram of protein
-			caloriesFromCarbs := 4.0   // 4 calories per gram of carbs
-			caloriesFromFats := 9.0    // 9 calories per gram of fat
-
-			switch user.GoalType {
-			case "lose":
-				// For weight loss: protein 35%, fats 35%, carbs 30%
-				targetProtein = float64(user.DailyCalorieGoal) * 0.35 / caloriesFromProtein
-				targetFats = float64(user.DailyCalorieGoal) * 0.35 / caloriesFromFats
-				targetCarbs = float64(user.DailyCalorieGoal) * 0.30 / caloriesFromCarbs
-			case "maintain":
-				// For weight maintenance: protein 25%, fats 25%, carbs 50%
-				targetProtein = float64(user.DailyCalorieGoal) * 0.25 / caloriesFromProtein
-				targetFats = float64(user.DailyCalorieGoal) * 0.25 / caloriesFromFats
-				targetCarbs = float64(user.DailyCalorieGoal) * 0.50 / caloriesFromCarbs
-			case "gain":
-				// For weight gain: protein 30%, fats 25%, carbs 45%
-				targetProtein = float64(user.DailyCalorieGoal) * 0.30 / caloriesFromProtein
-				targetFats = float64(user.DailyCalorieGoal) * 0.25 / caloriesFromFats
-				targetCarbs = float64(user.DailyCalorieGoal) * 0.45 / caloriesFromCarbs
-			default:
-				// Default to maintenance if goal type is invalid
-				targetProtein = float64(user.DailyCalorieGoal) * 0.25 / caloriesFromProtein
-				targetFats = float64(user.DailyCalorieGoal) * 0.25 / caloriesFromFats
-				targetCarbs = float64(user.DailyCalorieGoal) * 0.50 / caloriesFromCarbs
-			}
+			macros := nutrition.MacrosFromSplit(user.DailyCalorieGoal, nutrition.DefaultSplitForGoal(user.GoalType))
 
 			// Create default goals based on user
 			goals = models.UserGoals{
 				UserID:         userID,
 				TargetCalories: user.DailyCalorieGoal,
-				TargetProtein:  targetProtein,
-				TargetCarbs:    targetCarbs,
-				TargetFats:     targetFats,
+				TargetProtein:  macros.Protein,
+				TargetCarbs:    macros.Carbs,
+				TargetFats:     macros.Fats,
 				TargetWeight:   user.Weight,
 			}
 
@@ -449,41 +399,19 @@ func (r *userRepository) UpdateUserGoals(ctx context.Context, goals *models.User
 	}
 	defer tx.Rollback()
 
-	// Get user's goal type to calculate macros
-	var goalType string
-	userQuery := `SELECT goal_type FROM users WHERE id = ?`
-	err = tx.GetContext(ctx, &goalType, userQuery, goals.UserID)
+	// Get user's goal type and weight to calculate macros
+	var profile struct {
+		GoalType string  `db:"goal_type"`
+		Weight   float64 `db:"weight"`
+	}
+	userQuery := `SELECT goal_type, weight FROM users WHERE id = ?`
+	err = tx.GetContext(ctx, &profile, userQuery, goals.UserID)
 	if err != nil {
 		return wrapDatabaseError(err)
 	}
 
-	// Calculate macronutrient targets based on goal type
-	caloriesFromProtein := 4.0 // 4 calories per gram of protein
-	caloriesFromCarbs := 4.0   // 4 calories per gram of carbs
-	caloriesFromFats := 9.0    // 9 calories per gram of fat
-
-	switch goalType {
-	case "lose":
-		// For weight loss: protein 35%, fats 35%, carbs 30%
-		goals.TargetProtein = float64(goals.TargetCalories) * 0.35 / caloriesFromProtein
-		goals.TargetFats = float64(goals.TargetCalories) * 0.35 / caloriesFromFats
-		goals.TargetCarbs = float64(goals.TargetCalories) * 0.30 / caloriesFromCarbs
-	case "maintain":
-		// For weight maintenance: protein 25%, fats 25%, carbs 50%
-		goals.TargetProtein = float64(goals.TargetCalories) * 0.25 / caloriesFromProtein
-		goals.TargetFats = float64(goals.TargetCalories) * 0.25 / caloriesFromFats
-		goals.TargetCarbs = float64(goals.TargetCalories) * 0.50 / caloriesFromCarbs
-	case "gain":
-		// For weight gain: protein 30%, fats 25%, carbs 45%
-		goals.TargetProtein = float64(goals.TargetCalories) * 0.30 / caloriesFromProtein
-		goals.TargetFats = float64(goals.TargetCalories) * 0.25 / caloriesFromFats
-		goals.TargetCarbs = float64(goals.TargetCalories) * 0.45 / caloriesFromCarbs
-	default:
-		// Default to maintenance if goal type is invalid
-		goals.TargetProtein = float64(goals.TargetCalories) * 0.25 / caloriesFromProtein
-		goals.TargetFats = float64(goals.TargetCalories) * 0.25 / caloriesFromFats
-		goals.TargetCarbs = float64(goals.TargetCalories) * 0.50 / caloriesFromCarbs
-	}
+	goals.ApplyMacroTargets(nutrition.MacrosOrDefault(
+		goals.TargetCalories, profile.Weight, profile.GoalType, goals.MacroPreference()))
 
 	// Check if the goals exist
 	checkQuery := `SELECT 1 FROM user_goals WHERE user_id = ?`
@@ -495,23 +423,28 @@ func (r *userRepository) UpdateUserGoals(ctx context.Context, goals *models.User
 		// Insert new goals
 		insertQuery := `
 			INSERT INTO user_goals (
-				user_id, target_calories, target_protein, target_carbs, target_fats, target_weight
-			) VALUES (?, ?, ?, ?, ?, ?)
+				user_id, target_calories, target_protein, target_carbs, target_fats, target_weight,
+				macro_preset, protein_pct, carbs_pct, fat_pct, protein_per_kg
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		`
 		result, err = tx.ExecContext(ctx, insertQuery,
 			goals.UserID, goals.TargetCalories, goals.TargetProtein,
-			goals.TargetCarbs, goals.TargetFats, goals.TargetWeight)
+			goals.TargetCarbs, goals.TargetFats, goals.TargetWeight,
+			goals.MacroPreset, goals.ProteinPct, goals.CarbsPct, goals.FatPct, goals.ProteinPerKg)
 	} else {
 		// Update existing goals
 		updateQuery := `
 			UPDATE user_goals SET
 				target_calories = ?, target_protein = ?, target_carbs = ?, 
-				target_fats = ?, target_weight = ?
+				target_fats = ?, target_weight = ?,
+				macro_preset = ?, protein_pct = ?, carbs_pct = ?, fat_pct = ?, protein_per_kg = ?
 			WHERE user_id = ?
 		`
 		result, err = tx.ExecContext(ctx, updateQuery,
 			goals.TargetCalories, goals.TargetProtein, goals.TargetCarbs,
-			goals.TargetFats, goals.TargetWeight, goals.UserID)
+			goals.TargetFats, goals.TargetWeight,
+			goals.MacroPreset, goals.ProteinPct, goals.CarbsPct, goals.FatPct, goals.ProteinPerKg,
+			goals.UserID)
 	}
 
 	if err != nil {
@@ -577,65 +510,31 @@ func (r *userRepository) SyncUserCalorieGoal(ctx context.Context, userID int, ca
 		return ErrUserNotFound
 	}
 
-	// Get user's goal type to calculate macros
-	var goalType string
-	goalTypeQuery := `SELECT goal_type FROM users WHERE id = ?`
-	err = tx.GetContext(ctx, &goalType, goalTypeQuery, userID)
+	// Get user's goal type and weight to calculate macros
+	var profile struct {
+		GoalType string  `db:"goal_type"`
+		Weight   float64 `db:"weight"`
+	}
+	profileQuery := `SELECT goal_type, weight FROM users WHERE id = ?`
+	err = tx.GetContext(ctx, &profile, profileQuery, userID)
 	if err != nil {
 		return wrapDatabaseError(err)
 	}
 
-	// Calculate macronutrient targets based on goal type
-	caloriesFromProtein := 4.0 // 4 calories per gram of protein
-	caloriesFromCarbs := 4.0   // 4 calories per gram of carbs
-	caloriesFromFats := 9.0    // 9 calories per gram of fat
-
-	var targetProtein, targetCarbs, targetFats float64
-
-	switch goalType {
-	case "lose":
-		// For weight loss: protein 35%, fats 35%, carbs 30%
-		targetProtein = float64(calorieGoal) * 0.35 / caloriesFromProtein
-		targetFats = float64(calorieGoal) * 0.35 / caloriesFromFats
-		targetCarbs = float64(calorieGoal) * 0.30 / caloriesFromCarbs
-	case "maintain":
-		// For weight maintenance: protein 25%, fats 25%, carbs 50%
-		targetProtein = float64(calorieGoal) * 0.25 / caloriesFromProtein
-		targetFats = float64(calorieGoal) * 0.25 / caloriesFromFats
-		targetCarbs = float64(calorieGoal) * 0.50 / caloriesFromCarbs
-	case "gain":
-		// For weight gain: protein 30%, fats 25%, carbs 45%
-		targetProtein = float64(calorieGoal) * 0.30 / caloriesFromProtein
-		targetFats = float64(calorieGoal) * 0.25 / caloriesFromFats
-		targetCarbs = float64(calorieGoal) * 0.45 / caloriesFromCarbs
-	default:
-		// Default to maintenance if goal type is invalid
-		targetProtein = float64(calorieGoal) * 0.25 / caloriesFromProtein
-		targetFats = float64(calorieGoal) * 0.25 / caloriesFromFats
-		targetCarbs = float64(calorieGoal) * 0.50 / caloriesFromCarbs
-	}
-
-	// Check if user_goals record exists
-	checkQuery := `SELECT 1 FROM user_goals WHERE user_id = ?`
-	var exists bool
-	err = tx.GetContext(ctx, &exists, checkQuery, userID)
-
-	if err != nil && errors.Is(err, sql.ErrNoRows) {
-		// Get user details
-		var weight float64
-		weightQuery := `SELECT weight FROM users WHERE id = ?`
-		err = tx.GetContext(ctx, &weight, weightQuery, userID)
-		if err != nil {
-			return wrapDatabaseError(err)
-		}
+	pref, found, err := loadMacroPreference(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+	macros := nutrition.MacrosOrDefault(calorieGoal, profile.Weight, profile.GoalType, pref)
 
+	if !found {
 		// No record exists, insert one
 		insertQuery := `
 			INSERT INTO user_goals (
 				user_id, target_calories, target_protein, target_carbs, target_fats, target_weight
 			) VALUES (?, ?, ?, ?, ?, ?)
 		`
-		_, err = tx.ExecContext(ctx, insertQuery, userID, calorieGoal, targetProtein, targetCarbs, targetFats, weight)
+		_, err = tx.ExecContext(ctx, insertQuery, userID, calorieGoal, macros.Protein, macros.Carbs, macros.Fats, profile.Weight)
 	} else {
 		// Record exists, update it
 		updateQuery := `
@@ -643,7 +542,7 @@ func (r *userRepository) SyncUserCalorieGoal(ctx context.Context, userID int, ca
 			SET target_calories = ?, target_protein = ?, target_carbs = ?, target_fats = ?
 			WHERE user_id = ?
 		`
-		_, err = tx.ExecContext(ctx, updateQuery, calorieGoal, targetProtein, targetCarbs, targetFats, userID)
+		_, err = tx.ExecContext(ctx, updateQuery, calorieGoal, macros.Protein, macros.Carbs, macros.Fats, userID)
 	}
 
 	if err != nil {
@@ -658,7 +557,74 @@ func (r *userRepository) SyncUserCalorieGoal(ctx context.Context, userID int, ca
 	return nil
 }
 
+// IsAssignedDietitian reports whether the dietitian is assigned to the user
+func (r *userRepository) IsAssignedDietitian(ctx context.Context, dietitianID, userID int) (bool, error) {
+	query := `SELECT COUNT(*) FROM user_dietitian WHERE dietitian_id = ? AND user_id = ?`
+	var count int
+	if err := r.db.GetContext(ctx, &count, query, dietitianID, userID); err != nil {
+		return false, wrapDatabaseError(err)
+	}
+	return count > 0, nil
+}
+
+// loadMacroPreference reads the macro preference stored in user_goals.
+// found is false when the user has no user_goals row yet.
+func loadMacroPreference(ctx context.Context, q sqlx.QueryerContext, userID int) (pref nutrition.MacroPreference, found bool, err error) {
+	var row struct {
+		MacroPreset  string  `db:"macro_preset"`
+		ProteinPct   float64 `db:"protein_pct"`
+		CarbsPct     float64 `db:"carbs_pct"`
+		FatPct       float64 `db:"fat_pct"`
+		ProteinPerKg float64 `db:"protein_per_kg"`
+	}
+
+	query := `
+		SELECT macro_preset, protein_pct, carbs_pct, fat_pct, protein_per_kg
+		FROM user_goals WHERE user_id = ?
+	`
+	err = sqlx.GetContext(ctx, q, &row, query, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nutrition.MacroPreference{}, false, nil
+		}
+		return nutrition.MacroPreference{}, false, wrapDatabaseError(err)
+	}
+
+	pref = nutrition.MacroPreference{
+		Preset: row.MacroPreset,
+		Split: nutrition.MacroSplit{
+			ProteinPct: row.ProteinPct,
+			CarbsPct:   row.CarbsPct,
+			FatPct:     row.FatPct,
+		},
+		ProteinPerKg: row.ProteinPerKg,
+	}
+	return pref, true, nil
+}
+
 // wrapDatabaseError wraps SQL errors with a common error type
 func wrapDatabaseError(err error) error {
 	return errors.Join(ErrDatabaseOperation, err)
 }
+
+// AssignDietitian links a user to a dietitian; linking twice is a no-op
+func (r *userRepository) AssignDietitian(ctx context.Context, dietitianID, userID int) error {
+	query := `INSERT IGNORE INTO user_dietitian (user_id, dietitian_id) VALUES (?, ?)`
+
+	if _, err := r.db.ExecContext(ctx, query, userID, dietitianID); err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	return nil
+}
+
+// UnassignDietitian removes the link between a user and a dietitian
+func (r *userRepository) UnassignDietitian(ctx context.Context, dietitianID, userID int) error {
+	query := `DELETE FROM user_dietitian WHERE user_id = ? AND dietitian_id = ?`
+
+	if _, err := r.db.ExecContext(ctx, query, userID, dietitianID); err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	return nil
+}
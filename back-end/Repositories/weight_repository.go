@@ -0,0 +1,199 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	models "HabitBite/backend/Models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrWeightPlanNotFound is returned when a user has no target-weight plan
+var ErrWeightPlanNotFound = errors.New("weight plan not found")
+
+// WeightRepository defines the interface for weigh-in and weight plan data access
+type WeightRepository interface {
+	LogWeight(ctx context.Context, entry *models.WeightEntry) error
+	GetWeightEntries(ctx context.Context, userID int, startDate, endDate time.Time) ([]*models.WeightEntry, error)
+	GetLatestWeightEntry(ctx context.Context, userID int) (*models.WeightEntry, error)
+
+	GetWeightPlan(ctx context.Context, userID int) (*models.WeightPlan, error)
+	SaveWeightPlan(ctx context.Context, plan *models.WeightPlan) error
+	DeleteWeightPlan(ctx context.Context, userID int) error
+	ListAutoApplyPlans(ctx context.Context, evaluatedBefore time.Time) ([]*models.WeightPlan, error)
+}
+
+// weightRepository implements WeightRepository
+type weightRepository struct {
+	db *sqlx.DB
+}
+
+// NewWeightRepository creates a new WeightRepository
+func NewWeightRepository(db *sqlx.DB) WeightRepository {
+	return &weightRepository{db: db}
+}
+
+// LogWeight records a weigh-in, replacing any earlier entry for the same day
+func (r *weightRepository) LogWeight(ctx context.Context, entry *models.WeightEntry) error {
+	entry.CreatedAt = time.Now()
+
+	query := `
+		INSERT INTO weight_entries (user_id, weight, entry_date, created_at)
+		VALUES (?, ?, DATE(?), ?)
+		ON DUPLICATE KEY UPDATE weight = VALUES(weight), created_at = VALUES(created_at)
+	`
+
+	result, err := r.db.ExecContext(ctx, query, entry.UserID, entry.Weight, entry.Date, entry.CreatedAt)
+	if err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	if id, err := result.LastInsertId(); err == nil && id > 0 {
+		entry.ID = int(id)
+	}
+
+	return nil
+}
+
+// GetWeightEntries retrieves weigh-ins for a date range, oldest first
+func (r *weightRepository) GetWeightEntries(ctx context.Context, userID int, startDate, endDate time.Time) ([]*models.WeightEntry, error) {
+	query := `
+		SELECT id, user_id, weight, entry_date, created_at
+		FROM weight_entries
+		WHERE user_id = ? AND entry_date BETWEEN DATE(?) AND DATE(?)
+		ORDER BY entry_date ASC
+	`
+
+	var entries []*models.WeightEntry
+	if err := r.db.SelectContext(ctx, &entries, query, userID, startDate, endDate); err != nil {
+		return nil, wrapDatabaseError(err)
+	}
+
+	return entries, nil
+}
+
+// GetLatestWeightEntry retrieves the most recent weigh-in, or nil if there is none
+func (r *weightRepository) GetLatestWeightEntry(ctx context.Context, userID int) (*models.WeightEntry, error) {
+	query := `
+		SELECT id, user_id, weight, entry_date, created_at
+		FROM weight_entries
+		WHERE user_id = ?
+		ORDER BY entry_date DESC
+		LIMIT 1
+	`
+
+	var entry models.WeightEntry
+	if err := r.db.GetContext(ctx, &entry, query, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, wrapDatabaseError(err)
+	}
+
+	return &entry, nil
+}
+
+// GetWeightPlan retrieves a user's target-weight plan
+func (r *weightRepository) GetWeightPlan(ctx context.Context, userID int) (*models.WeightPlan, error) {
+	query := `SELECT * FROM weight_plans WHERE user_id = ?`
+
+	var plan models.WeightPlan
+	if err := r.db.GetContext(ctx, &plan, query, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrWeightPlanNotFound
+		}
+		return nil, wrapDatabaseError(err)
+	}
+
+	return &plan, nil
+}
+
+// SaveWeightPlan creates or replaces a user's target-weight plan and keeps
+// user_goals.target_weight in sync with it
+func (r *weightRepository) SaveWeightPlan(ctx context.Context, plan *models.WeightPlan) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return wrapDatabaseError(err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if plan.CreatedAt.IsZero() {
+		plan.CreatedAt = now
+	}
+	plan.UpdatedAt = now
+
+	query := `
+		INSERT INTO weight_plans (
+			user_id, start_weight, target_weight, start_date, target_date, auto_apply,
+			estimated_tdee, last_evaluated_at, created_at, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			start_weight = VALUES(start_weight),
+			target_weight = VALUES(target_weight),
+			start_date = VALUES(start_date),
+			target_date = VALUES(target_date),
+			auto_apply = VALUES(auto_apply),
+			estimated_tdee = VALUES(estimated_tdee),
+			last_evaluated_at = VALUES(last_evaluated_at),
+			updated_at = VALUES(updated_at)
+	`
+
+	_, err = tx.ExecContext(ctx, query,
+		plan.UserID, plan.StartWeight, plan.TargetWeight, plan.StartDate, plan.TargetDate, plan.AutoApply,
+		plan.EstimatedTDEE, plan.LastEvaluatedAt, plan.CreatedAt, plan.UpdatedAt)
+	if err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	goalsQuery := `UPDATE user_goals SET target_weight = ? WHERE user_id = ?`
+	if _, err = tx.ExecContext(ctx, goalsQuery, plan.TargetWeight, plan.UserID); err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	return nil
+}
+
+// DeleteWeightPlan removes a user's target-weight plan
+func (r *weightRepository) DeleteWeightPlan(ctx context.Context, userID int) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM weight_plans WHERE user_id = ?`, userID)
+	if err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return wrapDatabaseError(err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrWeightPlanNotFound
+	}
+
+	return nil
+}
+
+// ListAutoApplyPlans returns auto-applying plans that have not been evaluated since the given time
+func (r *weightRepository) ListAutoApplyPlans(ctx context.Context, evaluatedBefore time.Time) ([]*models.WeightPlan, error) {
+	query := `
+		SELECT * FROM weight_plans
+		WHERE auto_apply = TRUE
+			AND target_date > CURDATE()
+			AND (last_evaluated_at IS NULL OR last_evaluated_at < ?)
+		ORDER BY user_id ASC
+	`
+
+	var plans []*models.WeightPlan
+	if err := r.db.SelectContext(ctx, &plans, query, evaluatedBefore); err != nil {
+		return nil, wrapDatabaseError(err)
+	}
+
+	return plans, nil
+}
@@ -0,0 +1,111 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 seed from RFC 6238 appendix B, base32-encoded
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// The RFC vectors have eight digits; six-digit codes are their last six
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code at %d: %v", tt.unix, err)
+		}
+		if got != tt.want {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Error("Code accepted an invalid secret")
+	}
+	if _, err := Code(strings.ToLower(rfcSecret), 1); err != nil {
+		t.Errorf("Code rejected a lower-case secret: %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+	codeAt := func(delta int64) string {
+		code, err := Code(rfcSecret, step+delta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		skew     int
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", rfcSecret, codeAt(0), 1, step, true},
+		{"previous step within skew", rfcSecret, codeAt(-1), 1, step - 1, true},
+		{"next step within skew", rfcSecret, codeAt(1), 1, step + 1, true},
+		{"two steps back", rfcSecret, codeAt(-2), 1, 0, false},
+		{"two steps ahead", rfcSecret, codeAt(2), 1, 0, false},
+		{"previous step without skew", rfcSecret, codeAt(-1), 0, 0, false},
+		{"surrounding spaces", rfcSecret, " " + codeAt(0) + " ", 1, step, true},
+		{"too short", rfcSecret, codeAt(0)[:5], 1, 0, false},
+		{"too long", rfcSecret, codeAt(0) + "0", 1, 0, false},
+		{"empty", rfcSecret, "", 1, 0, false},
+		{"wrong secret", "JBSWY3DPEHPK3PXP", codeAt(0), 1, 0, false},
+		{"invalid secret", "not base32!", codeAt(0), 1, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, ok := Validate(tt.secret, tt.code, now, tt.skew)
+			if ok != tt.wantOK || gotStep != tt.wantStep {
+				t.Errorf("Validate() = %d, %v; want %d, %v", gotStep, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secret) != 32 {
+		t.Errorf("secret %q has %d characters, want 32", secret, len(secret))
+	}
+	if _, err := Code(secret, 1); err != nil {
+		t.Errorf("generated secret is not usable: %v", err)
+	}
+}
+
+func TestURI(t *testing.T) {
+	got := URI("Habit Bite", "a@example.com", rfcSecret)
+	for _, part := range []string{
+		"otpauth://totp/Habit%20Bite:a@example.com?",
+		"secret=" + rfcSecret,
+		"issuer=Habit+Bite",
+		"digits=6",
+		"period=30",
+	} {
+		if !strings.Contains(got, part) {
+			t.Errorf("URI %q does not contain %q", got, part)
+		}
+	}
+}
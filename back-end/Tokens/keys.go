@@ -0,0 +1,212 @@
+package tokens
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported signing algorithms
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// hmacKeyID is the kid of the shared-secret key; it is never published
+const hmacKeyID = "hs256"
+
+// minRSABits is the smallest RSA modulus accepted for signing or verification
+const minRSABits = 2048
+
+// Key errors
+var (
+	ErrUnknownKeyID      = errors.New("unknown signing key ID")
+	ErrUnsupportedKey    = errors.New("unsupported key type")
+	ErrUnsupportedAlg    = errors.New("unsupported signing algorithm")
+	ErrWeakKey           = errors.New("RSA keys must be at least 2048 bits")
+	ErrKeyAlgMismatch    = errors.New("token algorithm does not match its key")
+	ErrSigningKeyMissing = errors.New("a signing key file is required for asymmetric signing")
+)
+
+// key is one signing or verification key
+type key struct {
+	id     string
+	method jwt.SigningMethod
+	// signing material: []byte for HMAC, *rsa.PrivateKey or ed25519.PrivateKey
+	private interface{}
+	// verification material: []byte for HMAC, *rsa.PublicKey or ed25519.PublicKey
+	public interface{}
+}
+
+// JWK is a public key in JSON Web Key format
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// hmacKey returns the shared-secret key
+func hmacKey(secret []byte) *key {
+	return &key{id: hmacKeyID, method: jwt.SigningMethodHS256, private: secret, public: secret}
+}
+
+// generateKey creates an ephemeral key pair for the algorithm
+func generateKey(alg string) (*key, error) {
+	switch alg {
+	case AlgRS256:
+		private, err := rsa.GenerateKey(rand.Reader, minRSABits)
+		if err != nil {
+			return nil, err
+		}
+		return newKey(private)
+	case AlgEdDSA:
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return newKey(private)
+	}
+	return nil, ErrUnsupportedAlg
+}
+
+// loadKeyFile reads a PEM private or public key. The key ID is the key's
+// RFC 7638 thumbprint, so the same key always gets the same kid.
+func loadKeyFile(path string) (*key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file %s: %v", path, err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in key file %s", path)
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q in key file %s", block.Type, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key file %s: %v", path, err)
+	}
+
+	k, err := newKey(parsed)
+	if err != nil {
+		return nil, fmt.Errorf("key file %s: %w", path, err)
+	}
+	return k, nil
+}
+
+// newKey wraps a parsed RSA or Ed25519 key
+func newKey(parsed interface{}) (*key, error) {
+	k := &key{}
+	switch v := parsed.(type) {
+	case *rsa.PrivateKey:
+		k.method, k.private, k.public = jwt.SigningMethodRS256, v, &v.PublicKey
+	case *rsa.PublicKey:
+		k.method, k.public = jwt.SigningMethodRS256, v
+	case ed25519.PrivateKey:
+		k.method, k.private, k.public = jwt.SigningMethodEdDSA, v, v.Public()
+	case ed25519.PublicKey:
+		k.method, k.public = jwt.SigningMethodEdDSA, v
+	default:
+		return nil, ErrUnsupportedKey
+	}
+
+	if pub, ok := k.public.(*rsa.PublicKey); ok && pub.N.BitLen() < minRSABits {
+		return nil, ErrWeakKey
+	}
+
+	jwk := k.jwk()
+	k.id = thumbprint(jwk)
+	return k, nil
+}
+
+// jwk returns the public half of an asymmetric key as a JWK
+func (k *key) jwk() JWK {
+	switch pub := k.public.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			KeyType:   "RSA",
+			KeyID:     k.id,
+			Use:       "sig",
+			Algorithm: AlgRS256,
+			N:         base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}
+	case ed25519.PublicKey:
+		return JWK{
+			KeyType:   "OKP",
+			KeyID:     k.id,
+			Use:       "sig",
+			Algorithm: AlgEdDSA,
+			Curve:     "Ed25519",
+			X:         base64.RawURLEncoding.EncodeToString(pub),
+		}
+	}
+	return JWK{}
+}
+
+// publishable reports whether the key belongs in the JWKS
+func (k *key) publishable() bool {
+	switch k.public.(type) {
+	case *rsa.PublicKey, ed25519.PublicKey:
+		return true
+	}
+	return false
+}
+
+// thumbprint computes the RFC 7638 JWK thumbprint of a public key
+func thumbprint(jwk JWK) string {
+	// The required members in lexicographic order, without whitespace
+	var members interface{}
+	switch jwk.KeyType {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.KeyType, jwk.N}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Curve, jwk.KeyType, jwk.X}
+	}
+
+	encoded, _ := json.Marshal(members)
+	sum := sha256.Sum256(encoded)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
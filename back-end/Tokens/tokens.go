@@ -0,0 +1,445 @@
+package tokens
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	config "HabitBite/backend/Config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Token types carried in the "typ" claim
+const (
+	TypeAccess            = "access"
+	TypeEmailVerification = "email_verification"
+	TypeEmailChange       = "email_change"
+	TypeTwoFactor         = "2fa_challenge"
+	TypeImpersonation     = "impersonation"
+)
+
+// TypePersonalAccess marks the claims of a personal access token. Those
+// tokens are opaque and stored server-side rather than signed; their claims
+// are built on lookup so they pass through the same checks as access tokens.
+const TypePersonalAccess = "personal_access"
+
+// PersonalAccessTokenPrefix starts every personal access token, telling it
+// apart from a JWT
+const PersonalAccessTokenPrefix = "hbp_"
+
+// TwoFactorChallengeTTL is how long a user has to enter their code after the password
+const TwoFactorChallengeTTL = 5 * time.Minute
+
+// ImpersonationTTL is how long an admin can view the API as another user
+// before asking for a new impersonation token
+const ImpersonationTTL = 15 * time.Minute
+
+// Common errors
+var (
+	ErrInvalidToken     = errors.New("invalid token")
+	ErrWrongTokenType   = errors.New("wrong token type")
+	ErrInvalidSubject   = errors.New("token subject is not a user ID")
+	ErrMissingTokenID   = errors.New("token has no ID")
+	ErrMissingIssueTime = errors.New("token has no issue time")
+	ErrMissingActor     = errors.New("impersonation token has no acting user")
+)
+
+// Claims are the claims carried by every token this service issues
+type Claims struct {
+	jwt.RegisteredClaims
+	Type  string `json:"typ"`
+	Email string `json:"email,omitempty"`
+	// PreviousEmail is the address an email change moves away from
+	PreviousEmail string `json:"prev_email,omitempty"`
+	Role          string `json:"role,omitempty"`
+	// MFA is set on access tokens from a login that used a second factor
+	MFA bool `json:"mfa,omitempty"`
+	// SessionID ties an access token to the login session it was issued for
+	SessionID string `json:"sid,omitempty"`
+	// Scopes limits what a personal access token may do
+	Scopes []string `json:"scope,omitempty"`
+	// Actor is the admin behind an impersonation token; the subject is the
+	// user they are viewing the API as
+	Actor *Actor `json:"act,omitempty"`
+	// Writable lets an impersonation token make changes. Without it the
+	// token is read-only.
+	Writable bool `json:"wr,omitempty"`
+}
+
+// Actor identifies who is acting on behalf of a token's subject
+type Actor struct {
+	Subject string `json:"sub"`
+}
+
+// ImpersonatorID returns the ID of the admin behind an impersonation token,
+// or 0 for every other token
+func (c *Claims) ImpersonatorID() int {
+	if c.Type != TypeImpersonation || c.Actor == nil {
+		return 0
+	}
+	id, err := strconv.Atoi(c.Actor.Subject)
+	if err != nil || id <= 0 {
+		return 0
+	}
+	return id
+}
+
+// HasScope reports whether the claims grant a scope
+func (c *Claims) HasScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// PersonalAccessClaims returns the claims a stored personal access token
+// grants. mfa records whether the token was created from a login that used
+// a second factor.
+func PersonalAccessClaims(tokenID, userID int, role string, scopes []string, mfa bool) *Claims {
+	claims := &Claims{
+		Type:   TypePersonalAccess,
+		Role:   role,
+		MFA:    mfa,
+		Scopes: scopes,
+	}
+	claims.ID = "pat-" + strconv.Itoa(tokenID)
+	claims.Subject = strconv.Itoa(userID)
+	return claims
+}
+
+// UserID returns the subject as a user ID
+func (c *Claims) UserID() (int, error) {
+	id, err := strconv.Atoi(c.Subject)
+	if err != nil || id <= 0 {
+		return 0, ErrInvalidSubject
+	}
+	return id, nil
+}
+
+// Service issues and validates signed tokens. It owns the signing key,
+// issuer, audience, lifetimes and allowed clock skew, so every token in
+// the application is created and checked the same way.
+//
+// Tokens are signed with one active key and carry its ID in the "kid"
+// header. Verification accepts any key in the set, so a retired key can be
+// kept for verification until the tokens it signed have expired.
+type Service struct {
+	signingKey *key
+	keys       map[string]*key
+	methods    []string
+	issuer     string
+	audience   string
+	leeway     time.Duration
+	accessTTL  time.Duration
+	verifyTTL  time.Duration
+}
+
+// NewService creates a token service from the application config. With
+// HS256 the JWT secret signs tokens; with RS256 or EdDSA the signing key
+// is read from a PEM file, or generated per process in development.
+func NewService(cfg *config.Config) (*Service, error) {
+	var signingKey *key
+	var err error
+
+	switch {
+	case cfg.JWTSigningAlg == AlgHS256:
+		signingKey = hmacKey([]byte(cfg.JWTSecret))
+	case cfg.JWTSigningKeyFile != "":
+		signingKey, err = loadKeyFile(cfg.JWTSigningKeyFile)
+	case cfg.IsDevelopment():
+		log.Printf("Warning: no JWT signing key file configured, generating an ephemeral %s key", cfg.JWTSigningAlg)
+		signingKey, err = generateKey(cfg.JWTSigningAlg)
+	default:
+		err = ErrSigningKeyMissing
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if signingKey.private == nil {
+		return nil, fmt.Errorf("signing key %s has no private key", signingKey.id)
+	}
+	if signingKey.method.Alg() != cfg.JWTSigningAlg {
+		return nil, fmt.Errorf("signing key is %s but JWT_SIGNING_ALG is %s", signingKey.method.Alg(), cfg.JWTSigningAlg)
+	}
+
+	s := &Service{
+		signingKey: signingKey,
+		keys:       map[string]*key{signingKey.id: signingKey},
+		issuer:     cfg.JWTIssuer,
+		audience:   cfg.JWTAudience,
+		leeway:     cfg.JWTLeeway,
+		accessTTL:  cfg.AccessTokenTTL,
+		verifyTTL:  cfg.EmailVerificationTTL,
+	}
+
+	for _, path := range cfg.JWTVerificationKeyFiles {
+		k, err := loadKeyFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := s.keys[k.id]; !exists {
+			s.keys[k.id] = k
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, k := range s.keys {
+		if alg := k.method.Alg(); !seen[alg] {
+			seen[alg] = true
+			s.methods = append(s.methods, alg)
+		}
+	}
+
+	return s, nil
+}
+
+// JWKS returns the public verification keys. The shared HS256 secret is
+// never published, so the set is empty when tokens are signed with it.
+func (s *Service) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, k := range s.keys {
+		if k.publishable() {
+			set.Keys = append(set.Keys, k.jwk())
+		}
+	}
+	sort.Slice(set.Keys, func(i, j int) bool {
+		// Active key first, the rest in a stable order
+		if set.Keys[i].KeyID == s.signingKey.id || set.Keys[j].KeyID == s.signingKey.id {
+			return set.Keys[i].KeyID == s.signingKey.id
+		}
+		return set.Keys[i].KeyID < set.Keys[j].KeyID
+	})
+	return set
+}
+
+// AccessTokenTTL returns the lifetime of access tokens
+func (s *Service) AccessTokenTTL() time.Duration {
+	return s.accessTTL
+}
+
+// IssueAccessToken issues an access token for a user. mfa marks tokens from
+// a login that passed two-factor authentication; sessionID, if set, is the
+// login session whose revocation also ends the token.
+func (s *Service) IssueAccessToken(userID int, email, role string, mfa bool, sessionID string) (string, *Claims, error) {
+	claims := &Claims{
+		Type:      TypeAccess,
+		Email:     email,
+		Role:      role,
+		MFA:       mfa,
+		SessionID: sessionID,
+	}
+	claims.Subject = strconv.Itoa(userID)
+
+	signed, err := s.sign(claims, s.accessTTL)
+	if err != nil {
+		return "", nil, err
+	}
+	return signed, claims, nil
+}
+
+// ParseAccessToken validates an access token and returns its claims
+func (s *Service) ParseAccessToken(raw string) (*Claims, error) {
+	return s.parse(raw, TypeAccess)
+}
+
+// IssueImpersonationToken issues a short-lived token that lets an admin use
+// the API as another user. It is read-only unless writable is set. mfa
+// carries over whether the admin's own login used a second factor.
+func (s *Service) IssueImpersonationToken(adminID, userID int, role string, mfa, writable bool) (string, *Claims, error) {
+	claims := &Claims{
+		Type:     TypeImpersonation,
+		Role:     role,
+		MFA:      mfa,
+		Actor:    &Actor{Subject: strconv.Itoa(adminID)},
+		Writable: writable,
+	}
+	claims.Subject = strconv.Itoa(userID)
+
+	signed, err := s.sign(claims, ImpersonationTTL)
+	if err != nil {
+		return "", nil, err
+	}
+	return signed, claims, nil
+}
+
+// ParseRequestToken validates a token presented to the API, either an
+// access token or an impersonation token, and returns its claims
+func (s *Service) ParseRequestToken(raw string) (*Claims, error) {
+	claims, err := s.parse(raw, TypeAccess, TypeImpersonation)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Type == TypeImpersonation && claims.ImpersonatorID() == 0 {
+		return nil, ErrMissingActor
+	}
+	return claims, nil
+}
+
+// IssueEmailVerificationToken issues a token proving control of an email
+// address, for use in a verification link
+func (s *Service) IssueEmailVerificationToken(userID int, email string) (string, error) {
+	claims := &Claims{
+		Type:  TypeEmailVerification,
+		Email: email,
+	}
+	claims.Subject = strconv.Itoa(userID)
+
+	return s.sign(claims, s.verifyTTL)
+}
+
+// ParseEmailVerificationToken validates an email verification token and
+// returns the user ID and address it was issued for
+func (s *Service) ParseEmailVerificationToken(raw string) (int, string, error) {
+	claims, err := s.parse(raw, TypeEmailVerification)
+	if err != nil {
+		return 0, "", err
+	}
+	if claims.Email == "" {
+		return 0, "", ErrInvalidToken
+	}
+
+	userID, _ := claims.UserID()
+	return userID, claims.Email, nil
+}
+
+// IssueEmailChangeToken issues a token proving control of a new email
+// address. It only applies while the account still has the old address.
+func (s *Service) IssueEmailChangeToken(userID int, oldEmail, newEmail string) (string, error) {
+	claims := &Claims{
+		Type:          TypeEmailChange,
+		Email:         newEmail,
+		PreviousEmail: oldEmail,
+	}
+	claims.Subject = strconv.Itoa(userID)
+
+	return s.sign(claims, s.verifyTTL)
+}
+
+// ParseEmailChangeToken validates an email change token and returns the
+// user ID with the old and new addresses
+func (s *Service) ParseEmailChangeToken(raw string) (int, string, string, error) {
+	claims, err := s.parse(raw, TypeEmailChange)
+	if err != nil {
+		return 0, "", "", err
+	}
+	if claims.Email == "" || claims.PreviousEmail == "" {
+		return 0, "", "", ErrInvalidToken
+	}
+
+	userID, _ := claims.UserID()
+	return userID, claims.PreviousEmail, claims.Email, nil
+}
+
+// IssueTwoFactorChallenge issues the token that carries a login from the
+// password step to the two-factor step
+func (s *Service) IssueTwoFactorChallenge(userID int) (string, error) {
+	claims := &Claims{Type: TypeTwoFactor}
+	claims.Subject = strconv.Itoa(userID)
+
+	return s.sign(claims, TwoFactorChallengeTTL)
+}
+
+// ParseTwoFactorChallenge validates a two-factor challenge token and returns its user ID
+func (s *Service) ParseTwoFactorChallenge(raw string) (int, error) {
+	claims, err := s.parse(raw, TypeTwoFactor)
+	if err != nil {
+		return 0, err
+	}
+	return claims.UserID()
+}
+
+// sign fills in the registered claims and signs the token
+func (s *Service) sign(claims *Claims, ttl time.Duration) (string, error) {
+	id, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims.ID = id
+	claims.Issuer = s.issuer
+	claims.Audience = jwt.ClaimStrings{s.audience}
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.NotBefore = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(ttl))
+
+	token := jwt.NewWithClaims(s.signingKey.method, claims)
+	token.Header["kid"] = s.signingKey.id
+	signed, err := token.SignedString(s.signingKey.private)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %v", err)
+	}
+	return signed, nil
+}
+
+// parse validates signature, issuer, audience, times and that the token has
+// one of the given types
+func (s *Service) parse(raw string, tokenTypes ...string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(raw, claims,
+		s.keyFunc,
+		jwt.WithValidMethods(s.methods),
+		jwt.WithIssuer(s.issuer),
+		jwt.WithAudience(s.audience),
+		jwt.WithLeeway(s.leeway),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return nil, errors.Join(ErrInvalidToken, err)
+	}
+
+	if !slices.Contains(tokenTypes, claims.Type) {
+		return nil, ErrWrongTokenType
+	}
+	if claims.ID == "" {
+		return nil, ErrMissingTokenID
+	}
+	if claims.IssuedAt == nil {
+		return nil, ErrMissingIssueTime
+	}
+	if _, err := claims.UserID(); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// keyFunc picks the verification key named by the token's kid header.
+// Tokens without a kid predate key IDs and are only accepted by the HS256
+// key. The key's own algorithm must match the header's, so a public key can
+// never be used as an HMAC secret.
+func (s *Service) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		kid = hmacKeyID
+	}
+
+	k, ok := s.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKeyID
+	}
+	if token.Method.Alg() != k.method.Alg() {
+		return nil, ErrKeyAlgMismatch
+	}
+	return k.public, nil
+}
+
+// newTokenID returns a random token ID for the jti claim
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token ID: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,534 @@
+package tokens
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	config "HabitBite/backend/Config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "test-secret-0123456789abcdef0123"
+
+// testConfig returns a config for an HS256 token service
+func testConfig() *config.Config {
+	return &config.Config{
+		JWTSecret:            testSecret,
+		JWTSigningAlg:        AlgHS256,
+		JWTIssuer:            "habitbite",
+		JWTAudience:          "habitbite-api",
+		AccessTokenTTL:       time.Hour,
+		EmailVerificationTTL: time.Hour,
+	}
+}
+
+// writePublicKey writes the public half of a key as PEM and returns its path
+func writePublicKey(t *testing.T, public interface{}) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "public.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// validClaims returns claims that pass every check for the given type
+func validClaims(tokenType string) *Claims {
+	now := time.Now()
+	claims := &Claims{Type: tokenType, Role: "user"}
+	claims.ID = "test-id"
+	claims.Subject = "42"
+	claims.Issuer = "habitbite"
+	claims.Audience = jwt.ClaimStrings{"habitbite-api"}
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(time.Hour))
+	return claims
+}
+
+// signWith signs claims with any method and key, setting kid when given
+func signWith(t *testing.T, method jwt.SigningMethod, signingKey interface{}, kid string, claims *Claims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(signingKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestParseAccessToken(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, minRSABits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaVerify, err := newKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPublicDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPublicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: rsaPublicDER})
+
+	// HS256 signing with a retired RS256 key still accepted, so both
+	// algorithms are allowed and keyFunc alone must keep them apart
+	cfg := testConfig()
+	cfg.JWTVerificationKeyFiles = []string{writePublicKey(t, &rsaKey.PublicKey)}
+	s, err := NewService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret := []byte(testSecret)
+	tests := []struct {
+		name    string
+		token   func() string
+		wantErr error
+	}{
+		{
+			name: "issued by the service",
+			token: func() string {
+				signed, _, err := s.IssueAccessToken(42, "a@example.com", "user", false, "")
+				if err != nil {
+					t.Fatal(err)
+				}
+				return signed
+			},
+		},
+		{
+			name: "HS256 without kid",
+			token: func() string {
+				return signWith(t, jwt.SigningMethodHS256, secret, "", validClaims(TypeAccess))
+			},
+		},
+		{
+			name: "retired RS256 key",
+			token: func() string {
+				return signWith(t, jwt.SigningMethodRS256, rsaKey, rsaVerify.id, validClaims(TypeAccess))
+			},
+		},
+		{
+			name: "RS256 token without kid",
+			token: func() string {
+				return signWith(t, jwt.SigningMethodRS256, rsaKey, "", validClaims(TypeAccess))
+			},
+			wantErr: ErrKeyAlgMismatch,
+		},
+		{
+			name: "HS256 signed with the RSA public key",
+			token: func() string {
+				return signWith(t, jwt.SigningMethodHS256, rsaPublicPEM, rsaVerify.id, validClaims(TypeAccess))
+			},
+			wantErr: ErrKeyAlgMismatch,
+		},
+		{
+			name: "HS256 signed with the RSA public key DER",
+			token: func() string {
+				return signWith(t, jwt.SigningMethodHS256, rsaPublicDER, rsaVerify.id, validClaims(TypeAccess))
+			},
+			wantErr: ErrKeyAlgMismatch,
+		},
+		{
+			name: "unknown kid",
+			token: func() string {
+				return signWith(t, jwt.SigningMethodHS256, secret, "other", validClaims(TypeAccess))
+			},
+			wantErr: ErrUnknownKeyID,
+		},
+		{
+			name: "alg none",
+			token: func() string {
+				return signWith(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "", validClaims(TypeAccess))
+			},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "wrong secret",
+			token: func() string {
+				return signWith(t, jwt.SigningMethodHS256, []byte("another-secret"), hmacKeyID, validClaims(TypeAccess))
+			},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "expired",
+			token: func() string {
+				claims := validClaims(TypeAccess)
+				claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+				return signWith(t, jwt.SigningMethodHS256, secret, hmacKeyID, claims)
+			},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "no expiry",
+			token: func() string {
+				claims := validClaims(TypeAccess)
+				claims.ExpiresAt = nil
+				return signWith(t, jwt.SigningMethodHS256, secret, hmacKeyID, claims)
+			},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "wrong issuer",
+			token: func() string {
+				claims := validClaims(TypeAccess)
+				claims.Issuer = "someone-else"
+				return signWith(t, jwt.SigningMethodHS256, secret, hmacKeyID, claims)
+			},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "wrong audience",
+			token: func() string {
+				claims := validClaims(TypeAccess)
+				claims.Audience = jwt.ClaimStrings{"another-api"}
+				return signWith(t, jwt.SigningMethodHS256, secret, hmacKeyID, claims)
+			},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "email verification token",
+			token: func() string {
+				signed, err := s.IssueEmailVerificationToken(42, "a@example.com")
+				if err != nil {
+					t.Fatal(err)
+				}
+				return signed
+			},
+			wantErr: ErrWrongTokenType,
+		},
+		{
+			name: "impersonation token",
+			token: func() string {
+				signed, _, err := s.IssueImpersonationToken(1, 42, "user", false, false)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return signed
+			},
+			wantErr: ErrWrongTokenType,
+		},
+		{
+			name: "missing token ID",
+			token: func() string {
+				claims := validClaims(TypeAccess)
+				claims.ID = ""
+				return signWith(t, jwt.SigningMethodHS256, secret, hmacKeyID, claims)
+			},
+			wantErr: ErrMissingTokenID,
+		},
+		{
+			name: "missing issue time",
+			token: func() string {
+				claims := validClaims(TypeAccess)
+				claims.IssuedAt = nil
+				return signWith(t, jwt.SigningMethodHS256, secret, hmacKeyID, claims)
+			},
+			wantErr: ErrMissingIssueTime,
+		},
+		{
+			name: "subject is not a user ID",
+			token: func() string {
+				claims := validClaims(TypeAccess)
+				claims.Subject = "admin"
+				return signWith(t, jwt.SigningMethodHS256, secret, hmacKeyID, claims)
+			},
+			wantErr: ErrInvalidSubject,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := s.ParseAccessToken(tt.token())
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if id, _ := claims.UserID(); id != 42 {
+				t.Errorf("got user ID %d, want 42", id)
+			}
+		})
+	}
+}
+
+func TestParseAccessTokenAsymmetric(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "signing.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := testConfig()
+	cfg.JWTSecret = ""
+	cfg.JWTSigningAlg = AlgEdDSA
+	cfg.JWTSigningKeyFile = path
+	s, err := NewService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public := edKey.Public().(ed25519.PublicKey)
+
+	tests := []struct {
+		name    string
+		token   func() string
+		wantErr error
+	}{
+		{
+			name: "issued by the service",
+			token: func() string {
+				signed, _, err := s.IssueAccessToken(42, "a@example.com", "user", false, "")
+				if err != nil {
+					t.Fatal(err)
+				}
+				return signed
+			},
+		},
+		{
+			name: "HS256 signed with the public key",
+			token: func() string {
+				return signWith(t, jwt.SigningMethodHS256, []byte(public), s.signingKey.id, validClaims(TypeAccess))
+			},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "HS256 without kid",
+			token: func() string {
+				return signWith(t, jwt.SigningMethodHS256, []byte(testSecret), "", validClaims(TypeAccess))
+			},
+			wantErr: ErrInvalidToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.ParseAccessToken(tt.token())
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if jwks := s.JWKS(); len(jwks.Keys) != 1 || jwks.Keys[0].KeyID != s.signingKey.id {
+		t.Errorf("JWKS does not publish the signing key: %+v", jwks)
+	}
+}
+
+func TestParseRequestToken(t *testing.T) {
+	s, err := NewService(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := []byte(testSecret)
+
+	tests := []struct {
+		name             string
+		token            func() string
+		wantErr          error
+		wantImpersonator int
+	}{
+		{
+			name: "access token",
+			token: func() string {
+				signed, _, err := s.IssueAccessToken(42, "a@example.com", "user", false, "")
+				if err != nil {
+					t.Fatal(err)
+				}
+				return signed
+			},
+		},
+		{
+			name: "impersonation token",
+			token: func() string {
+				signed, _, err := s.IssueImpersonationToken(7, 42, "user", true, false)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return signed
+			},
+			wantImpersonator: 7,
+		},
+		{
+			name: "impersonation token without actor",
+			token: func() string {
+				return signWith(t, jwt.SigningMethodHS256, secret, hmacKeyID, validClaims(TypeImpersonation))
+			},
+			wantErr: ErrMissingActor,
+		},
+		{
+			name: "impersonation token with invalid actor",
+			token: func() string {
+				claims := validClaims(TypeImpersonation)
+				claims.Actor = &Actor{Subject: "0"}
+				return signWith(t, jwt.SigningMethodHS256, secret, hmacKeyID, claims)
+			},
+			wantErr: ErrMissingActor,
+		},
+		{
+			name: "two-factor challenge",
+			token: func() string {
+				signed, err := s.IssueTwoFactorChallenge(42)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return signed
+			},
+			wantErr: ErrWrongTokenType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := s.ParseRequestToken(tt.token())
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := claims.ImpersonatorID(); got != tt.wantImpersonator {
+				t.Errorf("got impersonator %d, want %d", got, tt.wantImpersonator)
+			}
+		})
+	}
+}
+
+func TestParseSingleUseTokens(t *testing.T) {
+	s, err := NewService(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	access, _, err := s.IssueAccessToken(42, "a@example.com", "user", false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		issue   func() (string, error)
+		parse   func(raw string) (int, error)
+		wantErr error
+	}{
+		{
+			name:  "email verification",
+			issue: func() (string, error) { return s.IssueEmailVerificationToken(42, "a@example.com") },
+			parse: func(raw string) (int, error) {
+				id, email, err := s.ParseEmailVerificationToken(raw)
+				if err == nil && email != "a@example.com" {
+					t.Errorf("got email %q", email)
+				}
+				return id, err
+			},
+		},
+		{
+			name:  "email change",
+			issue: func() (string, error) { return s.IssueEmailChangeToken(42, "old@example.com", "new@example.com") },
+			parse: func(raw string) (int, error) {
+				id, oldEmail, newEmail, err := s.ParseEmailChangeToken(raw)
+				if err == nil && (oldEmail != "old@example.com" || newEmail != "new@example.com") {
+					t.Errorf("got emails %q -> %q", oldEmail, newEmail)
+				}
+				return id, err
+			},
+		},
+		{
+			name:  "two-factor challenge",
+			issue: func() (string, error) { return s.IssueTwoFactorChallenge(42) },
+			parse: s.ParseTwoFactorChallenge,
+		},
+		{
+			name:  "access token as email verification",
+			issue: func() (string, error) { return access, nil },
+			parse: func(raw string) (int, error) {
+				id, _, err := s.ParseEmailVerificationToken(raw)
+				return id, err
+			},
+			wantErr: ErrWrongTokenType,
+		},
+		{
+			name:    "access token as two-factor challenge",
+			issue:   func() (string, error) { return access, nil },
+			parse:   s.ParseTwoFactorChallenge,
+			wantErr: ErrWrongTokenType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := tt.issue()
+			if err != nil {
+				t.Fatal(err)
+			}
+			id, err := tt.parse(raw)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if id != 42 {
+				t.Errorf("got user ID %d, want 42", id)
+			}
+		})
+	}
+}
+
+func TestPersonalAccessClaims(t *testing.T) {
+	claims := PersonalAccessClaims(3, 42, "user", []string{"read:entries"}, false)
+
+	tests := []struct {
+		scope string
+		want  bool
+	}{
+		{"read:entries", true},
+		{"write:entries", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := claims.HasScope(tt.scope); got != tt.want {
+			t.Errorf("HasScope(%q) = %v, want %v", tt.scope, got, tt.want)
+		}
+	}
+	if id, err := claims.UserID(); err != nil || id != 42 {
+		t.Errorf("UserID() = %d, %v", id, err)
+	}
+	if claims.ID != "pat-3" {
+		t.Errorf("got ID %q", claims.ID)
+	}
+}
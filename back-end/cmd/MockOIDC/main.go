@@ -0,0 +1,287 @@
+// Command MockOIDC runs a minimal OpenID Connect provider for local
+// development and testing of provider sign-in. It approves every
+// authorization request without asking, as the user given by -email (or a
+// login_hint parameter), and checks PKCE, redirect URIs and single use of
+// authorization codes like a real provider would.
+//
+// Point the API at it with, for example:
+//
+//	OIDC_PROVIDERS=mock
+//	OIDC_MOCK_ISSUER=http://localhost:9400
+//	OIDC_MOCK_CLIENT_ID=habitbite
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// authCode is an issued authorization code waiting to be exchanged
+type authCode struct {
+	clientID      string
+	redirectURI   string
+	codeChallenge string
+	nonce         string
+	email         string
+	expiresAt     time.Time
+}
+
+// provider holds the mock provider's key and outstanding codes
+type provider struct {
+	issuer        string
+	clientID      string
+	clientSecret  string
+	email         string
+	emailVerified bool
+	key           *rsa.PrivateKey
+	keyID         string
+
+	mu    sync.Mutex
+	codes map[string]*authCode
+}
+
+func main() {
+	addr := flag.String("addr", "localhost:9400", "listen address")
+	issuer := flag.String("issuer", "", "issuer URL (default http://<addr>)")
+	clientID := flag.String("client-id", "habitbite", "accepted client ID")
+	clientSecret := flag.String("client-secret", "", "required client secret; empty accepts public clients")
+	email := flag.String("email", "mock.user@example.com", "email of the signed-in user")
+	emailVerified := flag.Bool("email-verified", true, "whether the email is reported as verified")
+	flag.Parse()
+
+	if *issuer == "" {
+		*issuer = "http://" + *addr
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatalf("Failed to generate signing key: %v", err)
+	}
+
+	p := &provider{
+		issuer:        strings.TrimRight(*issuer, "/"),
+		clientID:      *clientID,
+		clientSecret:  *clientSecret,
+		email:         *email,
+		emailVerified: *emailVerified,
+		key:           key,
+		keyID:         randomString(8),
+		codes:         make(map[string]*authCode),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/authorize", p.authorize)
+	mux.HandleFunc("/token", p.token)
+	mux.HandleFunc("/jwks", p.jwks)
+
+	log.Printf("Mock OIDC provider %s signing in %s", p.issuer, p.email)
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
+
+// discovery serves the provider metadata
+func (p *provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                p.issuer,
+		"authorization_endpoint":                p.issuer + "/authorize",
+		"token_endpoint":                        p.issuer + "/token",
+		"jwks_uri":                              p.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"scopes_supported":                      []string{"openid", "email", "profile"},
+	})
+}
+
+// authorize approves the request and redirects back with a code
+func (p *provider) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	redirectURI := q.Get("redirect_uri")
+	target, err := url.Parse(redirectURI)
+	if err != nil || target.Host == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	if q.Get("client_id") != p.clientID {
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	}
+
+	// From here on errors go back to the client, as the spec requires
+	reply := target.Query()
+	reply.Set("state", q.Get("state"))
+
+	switch {
+	case q.Get("response_type") != "code":
+		reply.Set("error", "unsupported_response_type")
+	case !strings.Contains(" "+q.Get("scope")+" ", " openid "):
+		reply.Set("error", "invalid_scope")
+	case q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256":
+		reply.Set("error", "invalid_request")
+		reply.Set("error_description", "PKCE with S256 is required")
+	default:
+		email := p.email
+		if hint := q.Get("login_hint"); hint != "" {
+			email = hint
+		}
+
+		code := randomString(24)
+		p.mu.Lock()
+		p.codes[code] = &authCode{
+			clientID:      p.clientID,
+			redirectURI:   redirectURI,
+			codeChallenge: q.Get("code_challenge"),
+			nonce:         q.Get("nonce"),
+			email:         email,
+			expiresAt:     time.Now().Add(time.Minute),
+		}
+		p.mu.Unlock()
+		reply.Set("code", code)
+	}
+
+	target.RawQuery = reply.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// token exchanges a code for an ID token after checking PKCE
+func (p *provider) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request", "malformed form")
+		return
+	}
+
+	clientID := r.PostForm.Get("client_id")
+	clientSecret := ""
+	if id, secret, ok := r.BasicAuth(); ok {
+		clientID, _ = url.QueryUnescape(id)
+		clientSecret, _ = url.QueryUnescape(secret)
+	}
+	if clientID != p.clientID ||
+		(p.clientSecret != "" && subtle.ConstantTimeCompare([]byte(clientSecret), []byte(p.clientSecret)) != 1) {
+		w.Header().Set("WWW-Authenticate", "Basic")
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, "unsupported_grant_type", "")
+		return
+	}
+
+	// Codes are single use, whether or not the exchange succeeds
+	code := r.PostForm.Get("code")
+	p.mu.Lock()
+	issued, ok := p.codes[code]
+	delete(p.codes, code)
+	p.mu.Unlock()
+
+	switch {
+	case !ok || time.Now().After(issued.expiresAt):
+		tokenError(w, "invalid_grant", "unknown or expired code")
+		return
+	case issued.redirectURI != r.PostForm.Get("redirect_uri"):
+		tokenError(w, "invalid_grant", "redirect_uri mismatch")
+		return
+	case pkceChallenge(r.PostForm.Get("code_verifier")) != issued.codeChallenge:
+		tokenError(w, "invalid_grant", "PKCE verification failed")
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            p.issuer,
+		"sub":            "mock|" + issued.email,
+		"aud":            issued.clientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          issued.nonce,
+		"email":          issued.email,
+		"email_verified": p.emailVerified,
+		"name":           strings.SplitN(issued.email, "@", 2)[0],
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = p.keyID
+
+	idToken, err := token.SignedString(p.key)
+	if err != nil {
+		log.Printf("Failed to sign ID token: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(24),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+// jwks serves the public signing key
+func (p *provider) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := p.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": p.keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+// tokenError writes an OAuth error from the token endpoint
+func tokenError(w http.ResponseWriter, code, description string) {
+	body := map[string]string{"error": code}
+	if description != "" {
+		body["error_description"] = description
+	}
+	writeJSON(w, http.StatusBadRequest, body)
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write response: %v", err)
+	}
+}
+
+// pkceChallenge derives the S256 challenge for a verifier
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// randomString returns n random bytes, base64url-encoded
+func randomString(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatalf("Failed to generate random value: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -11,9 +11,13 @@ import (
 
 	config "HabitBite/backend/Config"
 	controllers "HabitBite/backend/Controllers"
+	mailer "HabitBite/backend/Mailer"
 	middleware "HabitBite/backend/Middleware"
 	models "HabitBite/backend/Models"
+	oidc "HabitBite/backend/OIDC"
+	passwords "HabitBite/backend/Passwords"
 	repositories "HabitBite/backend/Repositories"
+	tokens "HabitBite/backend/Tokens"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-contrib/sessions/cookie"
@@ -35,6 +39,9 @@ func main() {
 	if err != nil {
 		log.Fatal("Error loading config:", err)
 	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatal("Invalid config:", err)
+	}
 
 	// Set Gin mode based on environment
 	if os.Getenv("GIN_MODE") == "release" {
@@ -48,22 +55,129 @@ func main() {
 	}
 	defer db.Close()
 
+	// Bring the schema up to date
+	if err := config.MigrateDB(db); err != nil {
+		log.Fatal("Database migration failed:", err)
+	}
+
 	// Initialize repositories
 	userRepo := repositories.NewUserRepository(db)
 	foodEntryRepo := repositories.NewFoodEntryRepository(db)
+	weightRepo := repositories.NewWeightRepository(db)
+	goalScheduleRepo := repositories.NewGoalScheduleRepository(db)
+	foodRepo := repositories.NewFoodRepository(db)
+	refreshTokenRepo := repositories.NewRefreshTokenRepository(db)
+	sessionRepo := repositories.NewSessionRepository(db)
+	revocationRepo := repositories.NewTokenRevocationRepository(db)
+	passwordResetRepo := repositories.NewPasswordResetRepository(db)
+	twoFactorRepo := repositories.NewTwoFactorRepository(db)
+	oidcRepo := repositories.NewOIDCRepository(db)
+	loginThrottleRepo := repositories.NewLoginThrottleRepository(db)
+	accountRepo := repositories.NewAccountRepository(db)
+	personalTokenRepo := repositories.NewPersonalTokenRepository(db)
+	userAdminRepo := repositories.NewUserAdminRepository(db)
+	goalJobRepo := repositories.NewGoalJobRepository(db)
+	auditRepo := repositories.NewAuditRepository(db)
 
 	// Initialize services
-	userService := models.NewUserService(userRepo)
+	passwordPolicy, err := passwords.NewPolicy(cfg)
+	if err != nil {
+		log.Fatalf("Failed to load password policy: %v", err)
+	}
+	userService := models.NewUserService(userRepo, goalScheduleRepo, passwordPolicy)
+	planService := models.NewPlanService(userService, weightRepo, foodEntryRepo)
+	foodCatalog := models.NewFoodCatalogService(userService, foodRepo)
+	tokenService, err := tokens.NewService(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize token service: %v", err)
+	}
+	refreshTokens := models.NewRefreshTokenService(refreshTokenRepo, cfg.RefreshTokenTTL)
+	revocations := models.NewTokenRevocationService(revocationRepo)
+	loginSessions := models.NewSessionService(sessionRepo, refreshTokens)
+
+	mail, err := mailer.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize mailer: %v", err)
+	}
+	passwordResets := models.NewPasswordResetService(userService, passwordResetRepo, mail,
+		loginSessions, revocations, cfg.PasswordResetTTL, cfg.AppBaseURL)
+	verifications := models.NewEmailVerificationService(userService, tokenService, mail, cfg.AppBaseURL)
+	twoFactor := models.NewTwoFactorService(twoFactorRepo, cfg.TOTPIssuer, cfg.TwoFactorRequiredRoles, cfg.TwoFactorEnforceAfter)
+	loginThrottle := models.NewLoginThrottleService(loginThrottleRepo, mail, models.LoginPolicy{
+		BackoffAfter:    cfg.LoginBackoffAfter,
+		LockoutAfter:    cfg.LoginLockoutAfter,
+		LockoutDuration: cfg.LoginLockoutDuration,
+		NotifyAfter:     cfg.LoginNotifyAfter,
+	}, cfg.AppBaseURL)
+	personalTokens := models.NewPersonalTokenService(personalTokenRepo, userService)
+	rolePermissions := models.DefaultRolePermissions
+	if cfg.RolePermissionsFile != "" {
+		if rolePermissions, err = models.LoadRolePermissions(cfg.RolePermissionsFile); err != nil {
+			log.Fatalf("Failed to load role permissions: %v", err)
+		}
+	}
+	permissions := models.NewPermissionService(rolePermissions, userRepo)
+	userAdmin := models.NewUserAdminService(userAdminRepo, userService, permissions, loginSessions, revocations, passwordResets)
+	goalJobs := models.NewGoalRecalculationService(goalJobRepo, userService)
+	audit := models.NewAuditService(auditRepo)
+	accounts := models.NewAccountService(accountRepo, userService, mail, cfg.AccountDeletionGrace, cfg.AppBaseURL)
+
+	var oidcProviders []*oidc.Provider
+	for _, p := range cfg.OIDCProviders {
+		redirectURL := cfg.OIDCRedirectBaseURL + "/api/auth/oidc/" + p.Name + "/callback"
+		oidcProviders = append(oidcProviders, oidc.NewProvider(p, redirectURL))
+	}
+	oidcService := models.NewOIDCService(oidcProviders, oidcRepo, userService)
+
+	// Background jobs stop when the server shuts down
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
+	// Periodically re-estimate TDEE for auto-applying weight plans
+	go planService.RunScheduler(jobsCtx, 24*time.Hour)
+
+	// Drop revocations of access tokens that have expired anyway
+	go revocations.RunCleanup(jobsCtx, time.Hour)
+
+	// Drop failed-login streaks of unknown addresses once they have run out
+	go loginThrottle.RunCleanup(jobsCtx, time.Hour)
+
+	// Delete accounts whose deletion grace period has passed
+	go accounts.RunPurge(jobsCtx, time.Hour)
+
+	// Run queued goal recalculations, resuming any interrupted by a restart
+	go goalJobs.RunWorker(jobsCtx, time.Minute)
 
 	// Initialize controllers with service instead of repository
-	authController := controllers.NewAuthControllerWithService(userService, cfg)
-	foodEntryController := controllers.NewFoodEntryController(foodEntryRepo)
+	authController := controllers.NewAuthControllerWithService(userService, tokenService, refreshTokens, loginSessions, revocations, verifications, twoFactor, loginThrottle, audit, cfg)
+	foodEntryController := controllers.NewFoodEntryControllerWithService(foodEntryRepo, userService, foodCatalog, audit)
+	nutritionController := controllers.NewNutritionController(userService, audit)
+	planController := controllers.NewPlanController(planService)
+	foodController := controllers.NewFoodController(foodCatalog)
+	passwordController := controllers.NewPasswordController(passwordResets, passwordPolicy)
+	verificationController := controllers.NewEmailVerificationController(verifications)
+	twoFactorController := controllers.NewTwoFactorController(twoFactor, userService)
+	oidcController := controllers.NewOIDCController(oidcService, authController, userService, cfg)
+	adminController := controllers.NewAdminController(userService, loginThrottle, userAdmin, audit)
+	accountController := controllers.NewAccountController(userService, accounts, verifications, loginThrottle, authController)
+	personalTokenController := controllers.NewPersonalTokenController(personalTokens)
+	goalJobController := controllers.NewGoalJobController(goalJobs, audit)
+	auditController := controllers.NewAuditController(audit)
+	impersonationController := controllers.NewImpersonationController(userAdmin, tokenService, audit)
+
+	// verifiedEmailFor blocks a feature until the user's email is verified, if configured
+	verifiedEmailFor := func(feature string) gin.HandlerFunc {
+		if !cfg.RequiresVerifiedEmail(feature) {
+			return func(c *gin.Context) { c.Next() }
+		}
+		return middleware.RequireVerifiedEmail(verifications)
+	}
 
 	// Create Gin router
 	router := gin.Default()
 
 	// Session store setup
-	store := cookie.NewStore([]byte(cfg.JWTSecret))
+	store := cookie.NewStore([]byte(cfg.SessionSecret))
 	store.Options(sessions.Options{
 		Path:     "/",
 		Domain:   cfg.CookieDomain,
@@ -80,6 +194,32 @@ func main() {
 		middleware.SecurityHeaders(),
 	)
 
+	// Public verification keys for access tokens
+	router.GET("/.well-known/jwks.json", authController.GetJWKS)
+
+	// Authentication for API routes; roles are looked up on each request so
+	// role changes apply without logging in again. Admins may view the app as
+	// another user, with every such request written to the audit log.
+	authOptions := middleware.AuthOptions{
+		Revocations: revocations,
+		Sessions:    loginSessions,
+		Accounts:    permissions,
+		Roles:       permissions,
+		Permissions: permissions,
+		Impersonation: &middleware.Impersonation{
+			Permission: models.PermUsersImpersonate,
+			Auditor:    audit,
+		},
+	}
+	requireAuth := middleware.AuthMiddleware(tokenService, authOptions)
+
+	// Account security stays with the account owner while impersonated
+	ownerOnly := middleware.ForbidImpersonation()
+
+	// Checks the double-submit CSRF token on cookie-authenticated unsafe
+	// requests; it runs after authentication
+	csrf := middleware.CSRFMiddleware(cfg)
+
 	// API routes
 	api := router.Group("/api")
 
@@ -108,29 +248,149 @@ func main() {
 	{
 		auth.POST("/register", authController.Register)
 		auth.POST("/login", authController.Login)
+		auth.POST("/login/2fa", authController.LoginTwoFactor)
 		auth.POST("/logout", authController.Logout)
-		auth.GET("/profile", middleware.AuthMiddleware(cfg), authController.GetCurrentUser)
-		auth.POST("/refresh", middleware.AuthMiddleware(cfg), authController.RefreshToken)
+		auth.POST("/logout-all", requireAuth, ownerOnly, csrf, authController.LogoutAll)
+		auth.GET("/profile", requireAuth, authController.GetCurrentUser)
+		auth.GET("/sessions", requireAuth, ownerOnly, authController.ListSessions)
+		auth.DELETE("/sessions/:id", requireAuth, ownerOnly, csrf, authController.RevokeSession)
+		auth.POST("/refresh", authController.RefreshToken)
 		auth.GET("/csrf", authController.GetCSRFToken) // New endpoint for getting CSRF token
+		auth.POST("/forgot-password", passwordController.ForgotPassword)
+		auth.POST("/reset-password", passwordController.ResetPassword)
+		auth.GET("/password-policy", passwordController.GetPolicy)
+		auth.POST("/verify-email", verificationController.VerifyEmail)
+		auth.POST("/resend-verification", requireAuth, ownerOnly, csrf, verificationController.ResendVerification)
+		auth.POST("/confirm-email-change", verificationController.ConfirmEmailChange)
+	}
+
+	// Two-factor management stays reachable for accounts that still have to enroll
+	twoFactorRoutes := auth.Group("/2fa")
+	twoFactorRoutes.Use(requireAuth, ownerOnly, csrf)
+	{
+		twoFactorRoutes.GET("", twoFactorController.GetStatus)
+		twoFactorRoutes.POST("/enroll", twoFactorController.Enroll)
+		twoFactorRoutes.POST("/confirm", twoFactorController.Confirm)
+		twoFactorRoutes.POST("/disable", twoFactorController.Disable)
+		twoFactorRoutes.POST("/recovery-codes", twoFactorController.RegenerateRecoveryCodes)
+	}
+
+	// Sign-in with OpenID Connect providers and linking them to an account
+	oidcRoutes := auth.Group("/oidc")
+	{
+		oidcRoutes.GET("/providers", oidcController.GetProviders)
+		oidcRoutes.GET("/:provider/login", oidcController.Login)
+		oidcRoutes.GET("/:provider/callback", oidcController.Callback)
+		oidcRoutes.GET("/identities", requireAuth, ownerOnly, oidcController.GetIdentities)
+		oidcRoutes.POST("/:provider/link", requireAuth, ownerOnly, csrf, oidcController.Link)
+		oidcRoutes.DELETE("/:provider", requireAuth, ownerOnly, csrf, oidcController.Unlink)
+	}
+
+	// Routes scripts may call with a personal access token, and the scope each needs
+	protectedAuth := authOptions
+	protectedAuth.PersonalTokens = &middleware.PersonalTokens{
+		Authenticator: personalTokens,
+		Scopes: map[string]string{
+			"GET /api/consumed-foods/daily":     models.ScopeReadEntries,
+			"GET /api/consumed-foods/nutrition": models.ScopeReadEntries,
+			"GET /api/consumed-foods/history":   models.ScopeReadEntries,
+			"GET /api/foods/search":             models.ScopeReadEntries,
+			"GET /api/foods/:id":                models.ScopeReadEntries,
+			"GET /api/user/weight":              models.ScopeReadEntries,
+			"POST /api/consumed-foods":          models.ScopeWriteEntries,
+			"DELETE /api/consumed-foods/:id":    models.ScopeWriteEntries,
+			"POST /api/user/weight":             models.ScopeWriteEntries,
+			"GET /api/user/goals":               models.ScopeReadGoals,
+			"GET /api/user/goals/schedule":      models.ScopeReadGoals,
+			"GET /api/user/plan":                models.ScopeReadGoals,
+		},
 	}
 
 	// Protected routes (with CSRF protection)
 	protected := api.Group("")
 	protected.Use(
-		middleware.AuthMiddleware(cfg),
-		middleware.CSRFMiddleware(),
+		middleware.AuthMiddleware(tokenService, protectedAuth),
+		middleware.RequireTwoFactorForRoles(cfg.TwoFactorEnforceAfter, cfg.TwoFactorRequiredRoles...),
+		csrf,
 	)
 	{
 		// Food entry routes
-		protected.POST("/consumed-foods", foodEntryController.AddFoodEntry)
+		protected.POST("/consumed-foods", verifiedEmailFor(config.FeatureFoodLogging), foodEntryController.AddFoodEntry)
 		protected.GET("/consumed-foods/daily", foodEntryController.GetDailyEntries)
 		protected.GET("/consumed-foods/nutrition", foodEntryController.GetDailyNutrition)
 		protected.DELETE("/consumed-foods/:id", foodEntryController.DeleteFoodEntry)
 		protected.GET("/consumed-foods/history", foodEntryController.GetNutritionHistory)
 
+		// Food catalog routes
+		protected.GET("/foods/search", foodController.SearchFoods)
+		protected.GET("/foods/:id", foodController.GetFood)
+		protected.PUT("/foods/:id",
+			middleware.RequirePermission(models.PermFoodsWrite),
+			foodController.SaveFood)
+
 		// User routes
+		protected.PUT("/user/profile", accountController.UpdateProfile)
+		protected.POST("/user/password", ownerOnly, accountController.ChangePassword)
+		protected.POST("/user/email", ownerOnly, accountController.RequestEmailChange)
+		protected.GET("/user/export", ownerOnly, accountController.ExportData)
+		protected.POST("/user/deletion", ownerOnly, accountController.RequestDeletion)
+		protected.DELETE("/user/deletion", ownerOnly, accountController.CancelDeletion)
+		protected.GET("/user/tokens", ownerOnly, personalTokenController.ListTokens)
+		protected.POST("/user/tokens", ownerOnly, personalTokenController.CreateToken)
+		protected.DELETE("/user/tokens/:id", ownerOnly, personalTokenController.RevokeToken)
 		protected.GET("/user/goals", authController.GetUserGoals)
 		protected.PUT("/user/goals", authController.UpdateUserGoals)
+		protected.PUT("/user/macros", nutritionController.UpdateMacroPreference)
+		protected.GET("/user/diet-profile", nutritionController.GetDietProfile)
+		protected.PUT("/user/diet-profile", nutritionController.UpdateDietProfile)
+		protected.GET("/user/goals/schedule", nutritionController.GetGoalSchedule)
+		protected.PUT("/user/goals/schedule", nutritionController.UpdateGoalSchedule)
+		protected.GET("/user/day-tags", nutritionController.GetDayTags)
+		protected.PUT("/user/day-tags/:date", nutritionController.SetDayTag)
+		protected.DELETE("/user/day-tags/:date", nutritionController.DeleteDayTag)
+
+		protected.PUT("/user/dietitians/:id", verifiedEmailFor(config.FeatureDietitianLinking), nutritionController.LinkDietitian)
+		protected.DELETE("/user/dietitians/:id", nutritionController.UnlinkDietitian)
+
+		// Weight tracking and target-weight plan routes
+		protected.POST("/user/weight", planController.LogWeight)
+		protected.GET("/user/weight", planController.GetWeightHistory)
+		protected.GET("/user/plan", planController.GetPlan)
+		protected.PUT("/user/plan", planController.SetPlan)
+		protected.DELETE("/user/plan", planController.DeletePlan)
+		protected.POST("/user/plan/recalculate", planController.RecalculatePlan)
+
+		// Nutrition planning routes
+		protected.GET("/nutrition/macro-presets", nutritionController.GetMacroPresets)
+		protected.GET("/nutrition/energy-preview", nutritionController.GetEnergyPreview)
+
+		// Dietitian routes
+		protected.PUT("/dietitian/clients/:id/macros",
+			middleware.RequirePermission(models.PermClientsManage),
+			nutritionController.UpdateClientMacroPreference)
+	}
+
+	// Admin routes
+	admin := protected.Group("/admin", ownerOnly)
+	{
+		admin.GET("/users", middleware.RequirePermission(models.PermUsersRead), adminController.ListUsers)
+		admin.GET("/users/:id", middleware.RequirePermission(models.PermUsersRead), adminController.GetUser)
+		admin.PUT("/users/:id/role", middleware.RequirePermission(models.PermUsersManage), adminController.ChangeRole)
+		admin.POST("/users/:id/disable", middleware.RequirePermission(models.PermUsersManage), adminController.DisableUser)
+		admin.POST("/users/:id/enable", middleware.RequirePermission(models.PermUsersManage), adminController.EnableUser)
+		admin.POST("/users/:id/password-reset", middleware.RequirePermission(models.PermUsersManage), adminController.ForcePasswordReset)
+		admin.POST("/users/:id/unlock", middleware.RequirePermission(models.PermUsersManage), adminController.UnlockUser)
+		admin.POST("/users/:id/impersonate", middleware.RequirePermission(models.PermUsersImpersonate), impersonationController.StartImpersonation)
+
+		admin.GET("/audit-log", middleware.RequirePermission(models.PermAuditRead), auditController.SearchAuditLog)
+
+		goalJobRoutes := admin.Group("/goal-jobs", middleware.RequirePermission(models.PermGoalsRecalculate))
+		goalJobRoutes.POST("", goalJobController.StartJob)
+		goalJobRoutes.GET("", goalJobController.ListJobs)
+		goalJobRoutes.GET("/:id", goalJobController.GetJob)
+		goalJobRoutes.GET("/:id/changes", goalJobController.ListChanges)
+		goalJobRoutes.POST("/:id/cancel", goalJobController.CancelJob)
+		goalJobRoutes.POST("/:id/resume", goalJobController.ResumeJob)
 	}
 
 	// Create server with timeouts
@@ -173,6 +433,7 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	log.Println("Shutting down server...")
+	stopJobs()
 
 	// Create a deadline to wait for
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)